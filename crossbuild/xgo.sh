@@ -4,4 +4,4 @@ docker pull kolaente/xgo-latest
 go get github.com/kolaente/xgo
 go get github.com/GeertJohan/go.rice
 go get github.com/GeertJohan/go.rice/rice
-xgo github.com/daptin/daptin
+xgo -tags sqlite_json github.com/daptin/daptin
@@ -51,6 +51,7 @@ func main() {
 	//var assetsSource = flag.String("assets", "assets", "path to folder for assets")
 	var port = flag.String("port", ":6336", "Daptin port")
 	var runtimeMode = flag.String("runtime", "debug", "Runtime for Gin: debug, test, release")
+	var invalidationBusType = flag.String("invalidation_bus", "poll", "How changes are shared with other instances using the same database: poll/postgres/none")
 
 	gin.SetMode(*runtimeMode)
 
@@ -80,16 +81,37 @@ func main() {
 	var hostSwitch server.HostSwitch
 	var mailDaemon *guerrilla.Daemon
 	var taskScheduler resource.TaskScheduler
+	var invalidationBus resource.InvalidationBus
+	var restartServer func()
 
-	hostSwitch, mailDaemon, taskScheduler, _ = server.Main(boxRoot, db)
+	// the bus is created again with the new connection on every restart
+	newInvalidationBus := func() resource.InvalidationBus {
+		bus, err := resource.NewInvalidationBus(*invalidationBusType, db, *connection_string)
+		if err != nil {
+			log.Errorf("Failed to create invalidation bus [%v], changes will not be shared with other instances: %v", *invalidationBusType, err)
+			bus = resource.NewLocalInvalidationBus()
+		}
+		bus.Subscribe(resource.InvalidationTopicRestart, func(message resource.InvalidationMessage) {
+			if message.Origin == resource.InstanceId() {
+				return
+			}
+			log.Printf("Restart requested by [%v]", message.Origin)
+			go restartServer()
+		})
+		return bus
+	}
+
+	invalidationBus = newInvalidationBus()
+	hostSwitch, mailDaemon, taskScheduler, _ = server.Main(boxRoot, db, invalidationBus)
 	rhs := RestartHandlerServer{
 		HostSwitch: &hostSwitch,
 	}
 
-	trigger.On("restart", func() {
+	restartServer = func() {
 		log.Printf("Trigger restart")
 
-		taskScheduler.StartTasks()
+		taskScheduler.StopTasks()
+		invalidationBus.Stop()
 		mailDaemon.Shutdown()
 		err = db.Close()
 		if err != nil {
@@ -98,8 +120,16 @@ func main() {
 
 		db, err = server.GetDbConnection(*db_type, *connection_string)
 
-		hostSwitch, mailDaemon, taskScheduler, _ = server.Main(boxRoot, db)
+		invalidationBus = newInvalidationBus()
+		hostSwitch, mailDaemon, taskScheduler, _ = server.Main(boxRoot, db, invalidationBus)
 		rhs.HostSwitch = &hostSwitch
+	}
+
+	trigger.On("restart", func() {
+		// schema and config changes which need a restart have to be loaded by the other instances as well
+		err := invalidationBus.Publish(resource.InvalidationTopicRestart, "")
+		resource.CheckErr(err, "Failed to ask other instances to restart")
+		restartServer()
 	})
 
 	log.Printf("[%v] Listening at port: %v", syscall.Getpid(), *port)
@@ -6,7 +6,7 @@ import (
 	"log"
 )
 
-func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.ConfigStore, cruds map[string]*resource.DbResource, mailDaemon *guerrilla.Daemon) []resource.ActionPerformerInterface {
+func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.ConfigStore, cruds map[string]*resource.DbResource, mailDaemon *guerrilla.Daemon, taskScheduler resource.TaskScheduler) []resource.ActionPerformerInterface {
 
 	performers := make([]resource.ActionPerformerInterface, 0)
 
@@ -42,6 +42,14 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create csv data export performer")
 	performers = append(performers, exportCsvDataPerformer)
 
+	exportStreamPerformer, err := resource.NewExportStreamPerformer(initConfig, cruds)
+	resource.CheckErr(err, "Failed to create stream export performer")
+	performers = append(performers, exportStreamPerformer)
+
+	streamRefreshPerformer, err := resource.NewStreamRefreshPerformer(initConfig, cruds)
+	resource.CheckErr(err, "Failed to create stream refresh performer")
+	performers = append(performers, streamRefreshPerformer)
+
 	importDataPerformer, err := resource.NewImportDataPerformer(initConfig, cruds)
 	resource.CheckErr(err, "Failed to create data import performer")
 	performers = append(performers, importDataPerformer)
@@ -54,7 +62,7 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create oauth2 response handler")
 	performers = append(performers, oauth2response)
 
-	storeSyncAction, err := resource.NewSyncSiteStorageActionPerformer(cruds)
+	storeSyncAction, err := resource.NewSyncSiteStorageActionPerformer(initConfig, cruds)
 	resource.CheckErr(err, "Failed to site sync action performer")
 	performers = append(performers, storeSyncAction)
 
@@ -106,6 +114,10 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create csv upload performer")
 	performers = append(performers, csvUploadPerformer)
 
+	uploadPreviewPerformer, err := resource.NewUploadPreviewPerformer(initConfig, cruds)
+	resource.CheckErr(err, "Failed to create upload preview performer")
+	performers = append(performers, uploadPreviewPerformer)
+
 	columnDeletePerformer, err := resource.NewDeleteWorldColumnPerformer(initConfig, cruds)
 	resource.CheckErr(err, "Failed to create column delete performer")
 	performers = append(performers, columnDeletePerformer)
@@ -126,6 +138,34 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create integration installation performer")
 	performers = append(performers, integrationInstallationPerformer)
 
+	taskRunPerformer, err := resource.NewTaskRunActionPerformer(cruds, taskScheduler)
+	resource.CheckErr(err, "Failed to create task run performer")
+	performers = append(performers, taskRunPerformer)
+
+	stateTimerPerformer, err := resource.NewStateTimerActionPerformer(cruds)
+	resource.CheckErr(err, "Failed to create state timer performer")
+	performers = append(performers, stateTimerPerformer)
+
+	exchangeRunPerformer, err := resource.NewExchangeRunActionPerformer(cruds)
+	resource.CheckErr(err, "Failed to create exchange run performer")
+	performers = append(performers, exchangeRunPerformer)
+
+	signUrlPerformer, err := resource.NewSignUrlPerformer(configStore, cruds)
+	resource.CheckErr(err, "Failed to create sign url performer")
+	performers = append(performers, signUrlPerformer)
+
+	siteRevisionPublishPerformer, err := resource.NewSiteRevisionPublishPerformer(initConfig, cruds)
+	resource.CheckErr(err, "Failed to create site revision publish performer")
+	performers = append(performers, siteRevisionPublishPerformer)
+
+	siteDomainVerifyPerformer, err := resource.NewSiteDomainVerifyPerformer(configStore, cruds)
+	resource.CheckErr(err, "Failed to create site domain verify performer")
+	performers = append(performers, siteDomainVerifyPerformer)
+
+	workspaceConfigSetPerformer, err := resource.NewWorkspaceConfigSetPerformer(configStore, cruds)
+	resource.CheckErr(err, "Failed to create workspace config set performer")
+	performers = append(performers, workspaceConfigSetPerformer)
+
 	integrations, err := cruds["world"].GetActiveIntegrations()
 	if err == nil {
 
@@ -0,0 +1,583 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"github.com/anthonynsimon/bild/blur"
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/disintegration/gift"
+	"github.com/gin-gonic/gin"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// assetMaxAge is how long, in seconds, a browser keeps an asset, the ETag tells it when a cached copy is still valid
+const assetMaxAge = 86400
+
+// maxFilterRadius limits the radius of blur, dilate, erode and similar filters which get slower as it grows
+const maxFilterRadius = 100
+
+// derivativesFolder is the folder in the local sync folder, and in the cloud store, of a column where derivatives
+// of its images are kept
+const derivativesFolder = ".derivatives"
+
+// imageFilterNames are the query params read as image filters, other params do not change the derivative
+var imageFilterNames = map[string]bool{
+	"boxblur": true, "gaussianblur": true, "dilate": true, "edgedetection": true, "erode": true, "emboss": true,
+	"median": true, "sharpen": true, "brightness": true, "colorBalance": true, "colorize": true,
+	"colorspaceLinearToSRGB": true, "colorspaceSRGBToLinear": true, "contrast": true, "crop": true,
+	"cropToSize": true, "flipHorizontal": true, "flipVertical": true, "gamma": true, "gaussianBlur": true,
+	"grayscale": true, "hue": true, "invert": true, "resize": true, "rotate": true, "rotate180": true,
+	"rotate270": true, "rotate90": true, "saturation": true, "sepia": true, "sobel": true, "threshold": true,
+	"transpose": true, "transverse": true,
+}
+
+// An ImageEncoder writes an image in one format
+type ImageEncoder func(w io.Writer, img image.Image) error
+
+// imageEncoders are the formats images can be sent in, by mime type. WebP and AVIF are added when cwebp and avifenc
+// are installed
+var imageEncoders = map[string]ImageEncoder{
+	"image/jpeg": func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, nil)
+	},
+	"image/png": func(w io.Writer, img image.Image) error {
+		return png.Encode(w, img)
+	},
+}
+
+// preferredImageFormats are tried in order when the browser accepts them
+var preferredImageFormats = []string{"image/avif", "image/webp"}
+
+func init() {
+	if path, err := exec.LookPath("cwebp"); err == nil {
+		imageEncoders["image/webp"] = externalImageEncoder(path, func(in, out string) []string {
+			return []string{"-quiet", "-q", "80", in, "-o", out}
+		})
+	}
+	if path, err := exec.LookPath("avifenc"); err == nil {
+		imageEncoders["image/avif"] = externalImageEncoder(path, func(in, out string) []string {
+			return []string{in, out}
+		})
+	}
+}
+
+// externalImageEncoder encodes with a command line tool which converts a png file into the output file
+func externalImageEncoder(tool string, args func(in, out string) []string) ImageEncoder {
+	return func(w io.Writer, img image.Image) error {
+
+		dir, err := ioutil.TempDir("", "daptin-image")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		in := filepath.Join(dir, "in.png")
+		out := filepath.Join(dir, "out")
+		file, err := os.Create(in)
+		if err != nil {
+			return err
+		}
+		err = png.Encode(file, img)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		output, err := exec.Command(tool, args(in, out)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v failed: %v: %s", filepath.Base(tool), err, output)
+		}
+
+		encoded, err := ioutil.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(encoded)
+		return err
+	}
+}
+
+// NegotiateImageFormat picks the mime type to send an image in, avif or webp when the Accept header lists it and it
+// can be encoded, otherwise png for png images and jpeg for everything else
+func NegotiateImageFormat(accept string, sourceFormat string) string {
+
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		mimeType := strings.ToLower(strings.TrimSpace(fields[0]))
+		rejected := false
+		for _, field := range fields[1:] {
+			field = strings.Replace(strings.TrimSpace(field), " ", "", -1)
+			if field == "q=0" || field == "q=0.0" {
+				rejected = true
+			}
+		}
+		accepted[mimeType] = !rejected
+	}
+
+	for _, format := range preferredImageFormats {
+		if _, ok := imageEncoders[format]; ok && accepted[format] {
+			return format
+		}
+	}
+
+	if sourceFormat == "png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// ImagePresets are the named filters of an image column, defined as options of the column with the preset name as the
+// label and the filters as a query string for the value, like {"Label": "thumb", "Value": "resize=200,200,Lanczos"}
+func ImagePresets(column *api2go.ColumnInfo) map[string]url.Values {
+	presets := make(map[string]url.Values)
+	for _, option := range column.Options {
+		query, ok := option.Value.(string)
+		if !ok || option.Label == "" {
+			continue
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			log.Printf("Invalid image preset [%v] on column [%v]: %v", option.Label, column.ColumnName, err)
+			continue
+		}
+		presets[option.Label] = values
+	}
+	return presets
+}
+
+// ImageFilterParams are the filters of a request, the filters of the preset followed by the filters of the query
+func ImageFilterParams(query url.Values, presets map[string]url.Values) (url.Values, error) {
+
+	params := url.Values{}
+	if presetName := query.Get("preset"); presetName != "" {
+		preset, ok := presets[presetName]
+		if !ok {
+			return nil, fmt.Errorf("no such preset [%v]", presetName)
+		}
+		for key, values := range preset {
+			if imageFilterNames[key] {
+				params[key] = values
+			}
+		}
+	}
+
+	for key, values := range query {
+		if imageFilterNames[key] {
+			params[key] = values
+		}
+	}
+
+	return params, nil
+}
+
+func isTrueParam(value string) bool {
+	return strings.ToLower(value) == "true" || value == "1"
+}
+
+// ImageFilters reads the filters from the params. Radius of blur like filters is limited to maxFilterRadius
+func ImageFilters(params url.Values) ([]func(image.Image) image.Image, []gift.Filter, error) {
+
+	bildFilters := make([]func(image.Image) image.Image, 0)
+	filters := make([]gift.Filter, 0)
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		param := gin.Param{
+			Key:   key,
+			Value: params.Get(key),
+		}
+
+		valueFloat64, floatError := strconv.ParseFloat(param.Value, 32)
+		valueFloat32 := float32(valueFloat64)
+
+		switch param.Key {
+		case "boxblur", "gaussianblur", "dilate", "edgedetection", "erode", "median", "gaussianBlur":
+			if valueFloat64 > maxFilterRadius {
+				return nil, nil, fmt.Errorf("%v is more than %v", param.Key, maxFilterRadius)
+			}
+		}
+
+		switch param.Key {
+
+		case "boxblur":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return blur.Box(img, radius)
+				}
+			}(valueFloat64))
+		case "gaussianblur":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return blur.Gaussian(img, radius)
+				}
+			}(valueFloat64))
+		case "dilate":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Dilate(img, radius)
+				}
+			}(valueFloat64))
+		case "edgedetection":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.EdgeDetection(img, radius)
+				}
+			}(valueFloat64))
+		case "erode":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Erode(img, radius)
+				}
+			}(valueFloat64))
+		case "emboss":
+			bildFilters = append(bildFilters, func(img image.Image) image.Image {
+				return effect.Emboss(img)
+			})
+		case "median":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Median(img, radius)
+				}
+			}(valueFloat64))
+		case "sharpen":
+			bildFilters = append(bildFilters, func(img image.Image) image.Image {
+				return effect.Sharpen(img)
+			})
+		case "brightness":
+			filters = append(filters, gift.Brightness(valueFloat32))
+		case "colorBalance":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			red, _ := strconv.ParseFloat(vals[0], 32)
+			green, _ := strconv.ParseFloat(vals[1], 32)
+			blue, _ := strconv.ParseFloat(vals[2], 32)
+			filters = append(filters, gift.ColorBalance(float32(red), float32(green), float32(blue)))
+		case "colorize":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			hue, _ := strconv.ParseFloat(vals[0], 32)
+			saturation, _ := strconv.ParseFloat(vals[1], 32)
+			percent, _ := strconv.ParseFloat(vals[2], 32)
+			filters = append(filters, gift.Colorize(float32(hue), float32(saturation), float32(percent)))
+		case "colorspaceLinearToSRGB":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.ColorspaceLinearToSRGB())
+			}
+		case "colorspaceSRGBToLinear":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.ColorspaceSRGBToLinear())
+			}
+		case "contrast":
+			if floatError == nil {
+				filters = append(filters, gift.Contrast(valueFloat32))
+			}
+		case "crop":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 4 {
+				continue
+			}
+			minX, _ := strconv.ParseInt(vals[0], 10, 32)
+			minY, _ := strconv.ParseInt(vals[1], 10, 32)
+			maxX, _ := strconv.ParseInt(vals[2], 10, 32)
+			maxY, _ := strconv.ParseInt(vals[3], 10, 32)
+			filters = append(filters, gift.Crop(image.Rect(int(minX), int(minY), int(maxX), int(maxY))))
+		case "cropToSize":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			width, _ := strconv.ParseInt(vals[0], 10, 32)
+			height, _ := strconv.ParseInt(vals[1], 10, 32)
+			anchor := gift.CenterAnchor
+			switch vals[2] {
+			case "TopLeft":
+				anchor = gift.TopLeftAnchor
+			case "Top":
+				anchor = gift.TopAnchor
+			case "TopRight":
+				anchor = gift.TopRightAnchor
+			case "Left":
+				anchor = gift.LeftAnchor
+			case "Right":
+				anchor = gift.RightAnchor
+			case "BottomLeft":
+				anchor = gift.BottomLeftAnchor
+			case "Bottom":
+				anchor = gift.BottomAnchor
+			case "BottomRight":
+				anchor = gift.BottomRightAnchor
+			}
+			filters = append(filters, gift.CropToSize(int(width), int(height), anchor))
+		case "flipHorizontal":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.FlipHorizontal())
+			}
+		case "flipVertical":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.FlipVertical())
+			}
+		case "gamma":
+			filters = append(filters, gift.Gamma(valueFloat32))
+		case "gaussianBlur":
+			filters = append(filters, gift.GaussianBlur(valueFloat32))
+		case "grayscale":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Grayscale())
+			}
+		case "hue":
+			filters = append(filters, gift.Hue(valueFloat32))
+		case "invert":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Invert())
+			}
+		case "resize":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			width, _ := strconv.ParseInt(vals[0], 10, 32)
+			height, _ := strconv.ParseInt(vals[1], 10, 32)
+			resampling := gift.NearestNeighborResampling
+			switch vals[2] {
+			case "Box":
+				resampling = gift.BoxResampling
+			case "Linear":
+				resampling = gift.LinearResampling
+			case "Cubic":
+				resampling = gift.CubicResampling
+			case "Lanczos":
+				resampling = gift.LanczosResampling
+			}
+			filters = append(filters, gift.Resize(int(width), int(height), resampling))
+		case "rotate":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			angle, _ := strconv.ParseFloat(vals[0], 32)
+			backgroundColor, _ := ParseHexColor(vals[1])
+			interpolation := gift.NearestNeighborInterpolation
+			switch vals[2] {
+			case "Linear":
+				interpolation = gift.LinearInterpolation
+			case "Cubic":
+				interpolation = gift.CubicInterpolation
+			}
+			filters = append(filters, gift.Rotate(float32(angle), backgroundColor, interpolation))
+		case "rotate180":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Rotate180())
+			}
+		case "rotate270":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Rotate270())
+			}
+		case "rotate90":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Rotate90())
+			}
+		case "saturation":
+			filters = append(filters, gift.Saturation(valueFloat32))
+		case "sepia":
+			filters = append(filters, gift.Sepia(valueFloat32))
+		case "sobel":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Sobel())
+			}
+		case "threshold":
+			filters = append(filters, gift.Threshold(valueFloat32))
+		case "transpose":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Transpose())
+			}
+		case "transverse":
+			if isTrueParam(param.Value) {
+				filters = append(filters, gift.Transverse())
+			}
+		}
+	}
+
+	return bildFilters, filters, nil
+}
+
+// ImageDerivative applies the filters to the image and encodes it in the format. The output can not be larger than
+// maxDimension pixels on either side
+func ImageDerivative(contents []byte, params url.Values, format string, maxDimension int) ([]byte, error) {
+
+	bildFilters, filters, err := ImageFilters(params)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return nil, fmt.Errorf("image of %dx%d is larger than %d pixels", config.Width, config.Height, maxDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	f := gift.New(filters...)
+	bounds := f.Bounds(img.Bounds())
+	if bounds.Dx() > maxDimension || bounds.Dy() > maxDimension {
+		return nil, fmt.Errorf("output of %dx%d is larger than %d pixels", bounds.Dx(), bounds.Dy(), maxDimension)
+	}
+
+	for _, bildFilter := range bildFilters {
+		img = bildFilter(img)
+	}
+
+	dst := image.NewNRGBA(bounds)
+	f.Draw(dst, img)
+
+	encoder, ok := imageEncoders[format]
+	if !ok {
+		return nil, fmt.Errorf("no encoder for [%v]", format)
+	}
+	var out bytes.Buffer
+	err = encoder(&out, dst)
+	return out.Bytes(), err
+}
+
+// HasAdhocImageFilters is true when the query has filters of its own instead of only naming a preset. Only derivatives
+// of presets are cached, so the number of cached files of an image is bounded by the presets and the formats
+func HasAdhocImageFilters(query url.Values) bool {
+	for key := range query {
+		if imageFilterNames[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// DerivativeKey is the name a derivative is cached with, a hash of the original contents, the filters and the format
+func DerivativeKey(contentEtag string, params url.Values, format string) string {
+	hash := md5.Sum([]byte(contentEtag + "?" + params.Encode() + "#" + format))
+	return fmt.Sprintf("%x.%s", hash, strings.TrimPrefix(format, "image/"))
+}
+
+// DerivativeCache keeps generated images in a folder, the local sync folder of a column backed by a cloud store also
+// sends them to the store
+type DerivativeCache struct {
+	Folder     string
+	AssetCache *resource.AssetFolderCache
+	Cruds      map[string]*resource.DbResource
+}
+
+func (dc DerivativeCache) Get(key string) ([]byte, bool) {
+	contents, err := ioutil.ReadFile(filepath.Join(dc.Folder, key))
+	return contents, err == nil
+}
+
+func (dc DerivativeCache) Put(key string, contents []byte) {
+
+	err := os.MkdirAll(dc.Folder, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dc.Folder, key), contents, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to cache image derivative [%v]: %v", key, err)
+		return
+	}
+
+	if dc.AssetCache == nil {
+		return
+	}
+
+	uploadPerformer, err := resource.NewFileUploadActionPerformer(dc.Cruds)
+	if err != nil {
+		log.Printf("Failed to create upload performer for image derivative: %v", err)
+		return
+	}
+	rootPath := dc.AssetCache.CloudStore.RootPath + "/"
+	if dc.AssetCache.Keyname != "" {
+		rootPath = rootPath + dc.AssetCache.Keyname + "/"
+	}
+	inFields := map[string]interface{}{
+		"file": []interface{}{
+			map[string]interface{}{
+				"name":     key,
+				"contents": base64.StdEncoding.EncodeToString(contents),
+			},
+		},
+		"store_provider": dc.AssetCache.CloudStore.StoreProvider,
+		"root_path":      rootPath + derivativesFolder,
+	}
+	if dc.AssetCache.CloudStore.OAutoTokenId != "" {
+		inFields["oauth_token_id"] = dc.AssetCache.CloudStore.OAutoTokenId
+	}
+	_, _, errs := uploadPerformer.DoAction(resource.Outcome{}, inFields)
+	if len(errs) > 0 {
+		log.Printf("Failed to upload image derivative [%v] to cloud store: %v", key, errs)
+	}
+}
+
+// AssetCacheControl lets shared caches keep an asset only when guests can read it. A signed url is not cached past
+// its expiry
+func AssetCacheControl(guestReadable bool, query url.Values, now time.Time) string {
+
+	maxAge := int64(assetMaxAge)
+	if resource.IsSigned(query) {
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil {
+			expires = now.Unix()
+		}
+		if remaining := expires - now.Unix(); remaining < maxAge {
+			maxAge = remaining
+		}
+		if maxAge < 0 {
+			maxAge = 0
+		}
+	}
+
+	scope := "private"
+	if guestReadable {
+		scope = "public"
+	}
+	return fmt.Sprintf("%s, max-age=%d", scope, maxAge)
+}
+
+// serveAsset writes the contents with the cache headers, answering conditional and range requests
+func serveAsset(c *gin.Context, contentType string, cacheControl string, etag string, contents []byte) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", cacheControl)
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(contents))
+	c.Abort()
+}
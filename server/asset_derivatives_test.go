@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"github.com/artpar/api2go"
+	"image"
+	"image/png"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestImageFilterParams(t *testing.T) {
+
+	presets := ImagePresets(&api2go.ColumnInfo{
+		ColumnName: "photo",
+		Options: []api2go.ValueOptions{
+			{Label: "thumb", Value: "resize=100,100,Lanczos&grayscale=true"},
+		},
+	})
+
+	params, err := ImageFilterParams(url.Values{"preset": {"thumb"}, "grayscale": {"false"}, "v": {"2"}}, presets)
+	if err != nil {
+		t.Fatalf("thumb should be a preset: %v", err)
+	}
+	if params.Get("resize") != "100,100,Lanczos" || params.Get("grayscale") != "false" || params.Get("v") != "" {
+		t.Errorf("unexpected params %v", params)
+	}
+
+	if _, err := ImageFilterParams(url.Values{"preset": {"large"}}, presets); err == nil {
+		t.Errorf("large is not a preset")
+	}
+}
+
+func TestNegotiateImageFormat(t *testing.T) {
+
+	if format := NegotiateImageFormat("text/html,*/*", "png"); format != "image/png" {
+		t.Errorf("expected image/png, found %v", format)
+	}
+	if format := NegotiateImageFormat("", "gif"); format != "image/jpeg" {
+		t.Errorf("expected image/jpeg, found %v", format)
+	}
+
+	imageEncoders["image/webp"] = imageEncoders["image/png"]
+	defer delete(imageEncoders, "image/webp")
+	if format := NegotiateImageFormat("image/webp,*/*", "jpeg"); format != "image/webp" {
+		t.Errorf("expected image/webp, found %v", format)
+	}
+	if format := NegotiateImageFormat("image/webp;q=0,*/*", "jpeg"); format != "image/jpeg" {
+		t.Errorf("expected image/jpeg, found %v", format)
+	}
+}
+
+func TestImageDerivativeDimensions(t *testing.T) {
+
+	var original bytes.Buffer
+	png.Encode(&original, image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+
+	derivative, err := ImageDerivative(original.Bytes(), url.Values{"resize": {"20,5,Linear"}}, "image/png", 100)
+	if err != nil {
+		t.Fatalf("failed to resize: %v", err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(derivative))
+	if err != nil || config.Width != 20 || config.Height != 5 {
+		t.Errorf("expected a 20x5 image, found %v %v", config, err)
+	}
+
+	if _, err := ImageDerivative(original.Bytes(), url.Values{"resize": {"5000,5000,Linear"}}, "image/png", 100); err == nil {
+		t.Errorf("resize beyond the max dimension should fail")
+	}
+	if _, err := ImageDerivative(original.Bytes(), url.Values{"boxblur": {"1000"}}, "image/png", 100); err == nil {
+		t.Errorf("blur radius beyond the limit should fail")
+	}
+
+	var large bytes.Buffer
+	png.Encode(&large, image.NewNRGBA(image.Rect(0, 0, 200, 10)))
+	if _, err := ImageDerivative(large.Bytes(), url.Values{"resize": {"50,5,Linear"}}, "image/png", 100); err == nil {
+		t.Errorf("an original larger than the max dimension should not be decoded")
+	}
+}
+
+func TestOnlyPresetDerivativesAreCached(t *testing.T) {
+
+	if HasAdhocImageFilters(url.Values{"preset": {"thumb"}, "v": {"2"}}) {
+		t.Errorf("a preset should be cached")
+	}
+	if !HasAdhocImageFilters(url.Values{"preset": {"thumb"}, "grayscale": {"true"}}) {
+		t.Errorf("filters of the query should not be cached")
+	}
+}
+
+func TestAssetCacheControl(t *testing.T) {
+
+	now := time.Unix(1000000, 0)
+
+	if cacheControl := AssetCacheControl(true, url.Values{}, now); cacheControl != "public, max-age=86400" {
+		t.Errorf("expected a guest readable asset to be public, found %v", cacheControl)
+	}
+	if cacheControl := AssetCacheControl(false, url.Values{}, now); cacheControl != "private, max-age=86400" {
+		t.Errorf("expected an asset of a user to be private, found %v", cacheControl)
+	}
+
+	signed := url.Values{"signature": {"abc"}, "expires": {strconv.FormatInt(now.Unix()+60, 10)}}
+	if cacheControl := AssetCacheControl(false, signed, now); cacheControl != "private, max-age=60" {
+		t.Errorf("expected a signed url to be cached until it expires, found %v", cacheControl)
+	}
+	signed.Set("expires", strconv.FormatInt(now.Unix()+2*86400, 10))
+	if cacheControl := AssetCacheControl(false, signed, now); cacheControl != "private, max-age=86400" {
+		t.Errorf("expected a signed url to be cached for at most a day, found %v", cacheControl)
+	}
+}
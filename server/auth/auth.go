@@ -14,6 +14,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type AuthPermission int64
@@ -68,6 +69,11 @@ type AuthMiddleware struct {
 	userGroupCrud     ResourceAdapter
 	userUserGroupCrud ResourceAdapter
 	issuer            string
+	// workspaceBaseDomain is the domain whose subdomains are the slugs of workspaces
+	workspaceBaseDomain string
+	// workspaces are cached by slug only when the cache is enabled
+	workspaces    map[string]*cachedWorkspace
+	workspaceLock sync.RWMutex
 }
 
 func NewAuthMiddlewareBuilder(db database.DatabaseConnection, issuer string) *AuthMiddleware {
@@ -215,6 +221,9 @@ func (a *AuthMiddleware) AuthCheckMiddlewareWithHttp(req *http.Request, writer h
 		hasUser = true
 	}
 
+	claimedWorkspace := ""
+	var sessionUser *SessionUser
+
 	if hasUser {
 
 		//log.Infof("Set user: %v", user)
@@ -229,6 +238,7 @@ func (a *AuthMiddleware) AuthCheckMiddlewareWithHttp(req *http.Request, writer h
 			userToken := user
 			email := userToken.Claims.(jwt.MapClaims)["email"].(string)
 			name := userToken.Claims.(jwt.MapClaims)["name"].(string)
+			claimedWorkspace, _ = userToken.Claims.(jwt.MapClaims)[WorkspaceClaim].(string)
 			//log.Infof("User is not nil: %v", email  )
 
 			var referenceId string
@@ -322,19 +332,28 @@ func (a *AuthMiddleware) AuthCheckMiddlewareWithHttp(req *http.Request, writer h
 
 			//log.Infof("Group permissions :%v", userGroups)
 
-			user := &SessionUser{
+			sessionUser = &SessionUser{
 				UserId:          userId,
 				UserReferenceId: referenceId,
 				Groups:          userGroups,
 			}
 			ct := req.Context()
-			ct = context.WithValue(ct, "user", user)
+			ct = context.WithValue(ct, "user", sessionUser)
 			newRequest := req.WithContext(ct)
 			req = newRequest
 			okToContinue = true
 		}
 	}
 
+	workspace, err := a.ResolveWorkspace(req, claimedWorkspace, sessionUser)
+	if err != nil {
+		log.Errorf("Failed to resolve workspace of request: %v", err)
+		return false, false, req
+	}
+	if workspace != nil {
+		req = req.WithContext(context.WithValue(req.Context(), "workspace", workspace))
+	}
+
 	return okToContinue, abortRequest, req
 }
 
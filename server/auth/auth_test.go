@@ -2,6 +2,10 @@ package auth
 
 import (
 	"fmt"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"net/http"
 	"testing"
 )
 
@@ -89,3 +93,75 @@ func TestAuthPermissions(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkspaceSlugFromHost(t *testing.T) {
+
+	hosts := map[string]string{
+		"acme.example.com":      "acme",
+		"Acme.Example.com:8080": "acme",
+		"example.com":           "",
+		"www.acme.example.com":  "",
+		"www.example.org":       "",
+		"localhost:6336":        "",
+		"10.0.0.1:6336":         "",
+	}
+
+	for host, slug := range hosts {
+		if found := WorkspaceSlugFromHost(host, "example.com"); found != slug {
+			t.Errorf("expected slug [%v] for host [%v], found [%v]", slug, host, found)
+		}
+	}
+
+	if found := WorkspaceSlugFromHost("acme.example.com", ""); found != "" {
+		t.Errorf("expected no workspace without a base domain, found [%v]", found)
+	}
+}
+
+func TestResolveWorkspaceIsCached(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table workspace (id integer primary key, reference_id varchar(40), slug varchar(100), enable bool)",
+		"create table workspace_member (id integer primary key, workspace_id int, member_id int, role varchar(20))",
+		"insert into workspace (reference_id, slug, enable) values ('w1', 'acme', 1)",
+		"insert into workspace_member (workspace_id, member_id, role) values (1, 7, 'admin')",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	a := NewAuthMiddlewareBuilder(db, "test")
+	a.SetWorkspaceBaseDomain("example.com")
+	a.EnableWorkspaceCache()
+
+	req, _ := http.NewRequest("GET", "http://acme.example.com/api/todo", nil)
+	admin := &SessionUser{UserId: 7}
+	workspace, err := a.ResolveWorkspace(req, "", admin)
+	if err != nil || workspace == nil || workspace.Slug != "acme" || !workspace.IsAdmin {
+		t.Fatalf("expected the user to administer acme, got %+v: %v", workspace, err)
+	}
+	guest, err := a.ResolveWorkspace(req, "", &SessionUser{UserId: 8})
+	if err != nil || guest == nil || guest.IsMember {
+		t.Errorf("expected another user to not be a member, got %+v: %v", guest, err)
+	}
+
+	db.Exec("update workspace set enable = 0")
+	db.Exec("delete from workspace_member")
+	workspace, err = a.ResolveWorkspace(req, "", admin)
+	if err != nil || workspace == nil || !workspace.IsAdmin {
+		t.Errorf("expected the cached workspace until the cache is cleared, got %+v: %v", workspace, err)
+	}
+
+	a.ClearWorkspaceCache()
+	if _, err = a.ResolveWorkspace(req, "", admin); err == nil {
+		t.Errorf("expected a disabled workspace to be rejected once the cache is cleared")
+	}
+}
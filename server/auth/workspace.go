@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WorkspaceClaim is the claim of the token which names the workspace the user signed in to
+const WorkspaceClaim = "workspace"
+
+// SessionWorkspace is the workspace a request works in, the rows of the scoped tables are read from and written to
+// this workspace only
+type SessionWorkspace struct {
+	WorkspaceId          int64
+	WorkspaceReferenceId string
+	Slug                 string
+	// IsMember is set when the user of the request is a member of the workspace, only members can write to it
+	IsMember bool
+	// IsAdmin is set for the administrators of the workspace
+	IsAdmin bool
+}
+
+// WorkspaceSlugFromHost gives the subdomain of the base domain as the slug of a workspace. Other hosts, like the
+// hostnames of sites, have no workspace, and neither does any host when there is no base domain
+func WorkspaceSlugFromHost(host string, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.Trim(strings.ToLower(baseDomain), ".")
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	slug := strings.TrimSuffix(host, suffix)
+	if slug == "" || strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// cachedWorkspace is a workspace read by its slug, with the roles of the users who were resolved in it
+type cachedWorkspace struct {
+	workspace SessionWorkspace
+	enable    bool
+	roles     map[int64]string
+}
+
+// SetWorkspaceBaseDomain sets the domain whose subdomains are the slugs of workspaces
+func (a *AuthMiddleware) SetWorkspaceBaseDomain(baseDomain string) {
+	a.workspaceBaseDomain = baseDomain
+}
+
+// EnableWorkspaceCache keeps the workspaces and the roles of their members in memory. It is enabled only along with
+// an invalidation bus which calls ClearWorkspaceCache when any instance changes a workspace or its members
+func (a *AuthMiddleware) EnableWorkspaceCache() {
+	a.workspaceLock.Lock()
+	defer a.workspaceLock.Unlock()
+	a.workspaces = make(map[string]*cachedWorkspace)
+}
+
+// ClearWorkspaceCache drops the cached workspaces and roles
+func (a *AuthMiddleware) ClearWorkspaceCache() {
+	a.workspaceLock.Lock()
+	defer a.workspaceLock.Unlock()
+	if a.workspaces != nil {
+		a.workspaces = make(map[string]*cachedWorkspace)
+	}
+}
+
+// workspaceBySlug reads the workspace with the slug, sql.ErrNoRows when there is none
+func (a *AuthMiddleware) workspaceBySlug(slug string) (*cachedWorkspace, error) {
+
+	a.workspaceLock.RLock()
+	cached, ok := a.workspaces[slug]
+	a.workspaceLock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	s, v, err := statementbuilder.Squirrel.Select("id", "reference_id", "slug", "enable").
+		From("workspace").Where(squirrel.Eq{"slug": slug}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	cached = &cachedWorkspace{roles: make(map[int64]string)}
+	err = a.db.QueryRowx(s, v...).Scan(&cached.workspace.WorkspaceId, &cached.workspace.WorkspaceReferenceId,
+		&cached.workspace.Slug, &cached.enable)
+	if err != nil {
+		return nil, err
+	}
+
+	a.workspaceLock.Lock()
+	defer a.workspaceLock.Unlock()
+	if a.workspaces != nil {
+		a.workspaces[slug] = cached
+	}
+	return cached, nil
+}
+
+// workspaceRole reads the role of the user in the workspace, empty when the user is not a member
+func (a *AuthMiddleware) workspaceRole(cached *cachedWorkspace, userId int64) (string, error) {
+
+	a.workspaceLock.RLock()
+	role, ok := cached.roles[userId]
+	a.workspaceLock.RUnlock()
+	if ok {
+		return role, nil
+	}
+
+	s, v, err := statementbuilder.Squirrel.Select("role").From("workspace_member").
+		Where(squirrel.Eq{"workspace_id": cached.workspace.WorkspaceId}).
+		Where(squirrel.Eq{"member_id": userId}).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.db.QueryRowx(s, v...).Scan(&role)
+	if err == sql.ErrNoRows {
+		role = ""
+	} else if err != nil {
+		return "", err
+	}
+
+	a.workspaceLock.Lock()
+	defer a.workspaceLock.Unlock()
+	cached.roles[userId] = role
+	return role, nil
+}
+
+// ResolveWorkspace finds the workspace of a request from the claim of the token, or else from the subdomain of the
+// host under the base domain. A claimed workspace has to exist and have the user as a member, a subdomain which is
+// not a workspace leaves the request in the default workspace
+func (a *AuthMiddleware) ResolveWorkspace(req *http.Request, claimed string, user *SessionUser) (*SessionWorkspace, error) {
+
+	slug := claimed
+	if slug == "" {
+		slug = WorkspaceSlugFromHost(req.Host, a.workspaceBaseDomain)
+	}
+	if slug == "" {
+		return nil, nil
+	}
+
+	cached, err := a.workspaceBySlug(slug)
+	if err == sql.ErrNoRows && claimed == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("no workspace [%v]: %v", slug, err)
+	}
+	if !cached.enable {
+		return nil, fmt.Errorf("workspace [%v] is disabled", slug)
+	}
+
+	// the cached workspace is shared, each request gets a copy with the role of its user
+	workspace := cached.workspace
+	if user != nil && user.UserId != 0 {
+		role, err := a.workspaceRole(cached, user.UserId)
+		if err != nil {
+			return nil, err
+		}
+		workspace.IsMember = role != ""
+		workspace.IsAdmin = role == "admin"
+	}
+
+	if claimed != "" && !workspace.IsMember {
+		return nil, fmt.Errorf("not a member of workspace [%v]", slug)
+	}
+
+	return &workspace, nil
+}
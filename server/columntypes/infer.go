@@ -0,0 +1,318 @@
+package fieldtypes
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// enumerationLimit is the most distinct values a column of repeated values can have to become an enumeration
+const enumerationLimit = 12
+
+// An Inference is what the values of one column of an uploaded dataset look like
+type Inference struct {
+	EntityType EntityType
+	// DateFormat is the layout which reads every value of a date or datetime column
+	DateFormat string
+	// Options are the values of an enumeration
+	Options   []string
+	Nullable  bool
+	Unique    bool
+	Distinct  int
+	MaxLength int
+}
+
+var (
+	percentageRegex = regexp.MustCompile(`^[-+]?[0-9]+([.,][0-9]+)? ?%$`)
+	currencyRegex   = regexp.MustCompile(`^([$€£¥₹]|[A-Z]{3} ?)?[-+]?[0-9]{1,3}([,. ']?[0-9]{3})*([.,][0-9]{1,2})?( ?[A-Z]{3}|[$€£¥₹])?$`)
+	currencyMark    = regexp.MustCompile(`[$€£¥₹]|(^[A-Z]{3} ?)|( ?[A-Z]{3}$)`)
+	phoneRegex      = regexp.MustCompile(`^\+?[0-9(][0-9 ().\-]{5,18}[0-9]$`)
+	emailRegex      = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+	colorRegex      = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	uuidRegex       = regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$`)
+)
+
+var isoDateFormats = []string{"2006-01-02", "2006/01/02", "2006.01.02"}
+var dayFirstDateFormats = []string{"2/1/2006", "2.1.2006", "2-1-2006", "2/1/06", "2.1.06"}
+var monthFirstDateFormats = []string{"1/2/2006", "1-2-2006", "1.2.2006", "1/2/06"}
+var textDateFormats = []string{"2 Jan 2006", "Jan 2, 2006", "2 January 2006", "January 2, 2006", "Jan 2 2006", "2-Jan-2006", "2-Jan-06"}
+var clockFormats = []string{" 15:04:05", " 15:04", "T15:04:05", "T15:04:05Z07:00", " 3:04 PM", " 3:04:05 PM"}
+
+// MonthFirst tells if dates like 01/02/2006 are January 2nd in the locale, like in en-US
+func MonthFirst(locale string) bool {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	switch locale {
+	case "us", "en-us", "en-ph", "en-ca", "es-us", "en-um":
+		return true
+	}
+	return false
+}
+
+// DateFormats are the layouts tried for the dates of the locale, the order of day and month follows the locale
+func DateFormats(locale string) []string {
+	formats := append([]string{}, isoDateFormats...)
+	if MonthFirst(locale) {
+		formats = append(formats, monthFirstDateFormats...)
+		formats = append(formats, dayFirstDateFormats...)
+	} else {
+		formats = append(formats, dayFirstDateFormats...)
+		formats = append(formats, monthFirstDateFormats...)
+	}
+	return append(formats, textDateFormats...)
+}
+
+// DateTimeFormats are the date formats of the locale followed by a time, and the formats of DetectType
+func DateTimeFormats(locale string) []string {
+	formats := make([]string, 0)
+	for _, date := range DateFormats(locale) {
+		for _, clock := range clockFormats {
+			formats = append(formats, date+clock)
+		}
+	}
+	return append(formats, dateTimeFormat...)
+}
+
+// commonFormat returns the first format which parses every value
+func commonFormat(values []string, formats []string) (string, bool) {
+	for _, format := range formats {
+		all := true
+		for _, value := range values {
+			if _, err := time.Parse(format, value); err != nil {
+				all = false
+				break
+			}
+		}
+		if all {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func allMatch(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if !match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DecimalComma tells if the language of the locale writes the decimals after a comma, like 1.234,50 in de-DE
+func DecimalComma(locale string) bool {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	switch strings.Split(locale, "-")[0] {
+	case "de", "fr", "es", "it", "nl", "pt", "ru", "pl", "tr", "sv", "da", "nb", "no", "fi", "cs", "sk", "id", "el", "hu", "ro", "uk", "vi":
+		return true
+	}
+	return false
+}
+
+// ParseNumber reads numbers written with a currency, a percent sign or thousands separators, like "$1,234.50",
+// "1.234,50 EUR" or "12 %". With both separators the last one is the decimal separator, a single dot is a decimal
+// point and a single comma followed by three digits separates thousands, unless the locale writes decimals after a
+// comma, then it is the other way around
+func ParseNumber(value string, locale string) (float64, bool) {
+
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(value, "%")
+	value = currencyMark.ReplaceAllString(value, "")
+	value = strings.TrimSpace(value)
+	value = strings.Replace(value, " ", "", -1)
+	value = strings.Replace(value, "'", "", -1)
+
+	lastDot := strings.LastIndex(value, ".")
+	lastComma := strings.LastIndex(value, ",")
+	decimalComma := DecimalComma(locale)
+	decimal := -1
+	switch {
+	case lastDot > -1 && lastComma > -1:
+		decimal = lastDot
+		if lastComma > lastDot {
+			decimal = lastComma
+		}
+	case lastDot > -1:
+		// 1.234.567 repeats the separator of thousands, 1.234 is one thousand two hundred thirty four in de-DE
+		if strings.Count(value, ".") == 1 && !(decimalComma && len(value)-lastDot-1 == 3) {
+			decimal = lastDot
+		}
+	case lastComma > -1:
+		if strings.Count(value, ",") == 1 && (decimalComma || len(value)-lastComma-1 != 3) {
+			decimal = lastComma
+		}
+	}
+
+	var builder strings.Builder
+	for i, c := range value {
+		switch {
+		case c >= '0' && c <= '9', c == '-' || c == '+':
+			builder.WriteRune(c)
+		case i == decimal:
+			builder.WriteRune('.')
+		case c == '.' || c == ',':
+		default:
+			return 0, false
+		}
+	}
+
+	number, err := strconv.ParseFloat(builder.String(), 64)
+	return number, err == nil
+}
+
+func isPlainNumber(value string) bool {
+	in := sort.SearchStrings(unknownNumbers, strings.ToLower(value))
+	if in < len(unknownNumbers) && unknownNumbers[in] == strings.ToLower(value) {
+		return true
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+func isBoolean(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "y", "n", "1", "0":
+		return true
+	}
+	return false
+}
+
+func isUrl(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "ftp") && u.Host != ""
+}
+
+func isJsonBlob(value string) bool {
+	if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+		return false
+	}
+	var v interface{}
+	return json.Unmarshal([]byte(value), &v) == nil
+}
+
+func isPhone(value string) bool {
+	if !phoneRegex.MatchString(value) {
+		return false
+	}
+	digits := 0
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// InferType proposes the type of a column from its name and values. Dates are read in the order of day and month
+// of the locale, columns with a few values which repeat are enumerations with the values as options
+func InferType(name string, values []string, locale string) Inference {
+
+	inference := Inference{EntityType: None}
+
+	seen := make(map[string]bool)
+	distinct := make([]string, 0)
+	nonEmpty := 0
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			inference.Nullable = true
+			continue
+		}
+		nonEmpty++
+		if len(value) > inference.MaxLength {
+			inference.MaxLength = len(value)
+		}
+		if !seen[value] {
+			seen[value] = true
+			distinct = append(distinct, value)
+		}
+	}
+	inference.Distinct = len(distinct)
+	inference.Unique = nonEmpty > 0 && len(distinct) == nonEmpty
+
+	if len(distinct) == 0 {
+		inference.EntityType = Label
+		return inference
+	}
+
+	if len(distinct) <= 2 && allMatch(distinct, isBoolean) {
+		inference.EntityType = Boolean
+		return inference
+	}
+
+	if allMatch(distinct, percentageRegex.MatchString) {
+		inference.EntityType = Percentage
+		return inference
+	}
+
+	if allMatch(distinct, isPlainNumber) {
+		inference.EntityType = NumberFloat
+		if allMatch(distinct, func(v string) bool { ok, _ := IsInt(v); return ok }) {
+			inference.EntityType = NumberInt
+		}
+		switch columnTypeFromName(name) {
+		case Money:
+			inference.EntityType = Money
+		case Latitude:
+			inference.EntityType = Latitude
+		case Longitude:
+			inference.EntityType = Longitude
+		case Pincode:
+			inference.EntityType = Pincode
+		case Id:
+			inference.EntityType = Id
+		}
+		return inference
+	}
+
+	if allMatch(distinct, func(v string) bool { return currencyRegex.MatchString(v) && currencyMark.MatchString(v) }) {
+		inference.EntityType = Money
+		return inference
+	}
+
+	if format, ok := commonFormat(distinct, DateFormats(locale)); ok {
+		inference.EntityType = Date
+		inference.DateFormat = format
+		return inference
+	}
+	if format, ok := commonFormat(distinct, DateTimeFormats(locale)); ok {
+		inference.EntityType = DateTime
+		inference.DateFormat = format
+		return inference
+	}
+	if _, ok := commonFormat(distinct, timeFormat); ok {
+		inference.EntityType = Time
+		return inference
+	}
+
+	switch {
+	case allMatch(distinct, emailRegex.MatchString):
+		inference.EntityType = Email
+	case allMatch(distinct, isUrl):
+		inference.EntityType = Url
+	case allMatch(distinct, func(v string) bool { return net.ParseIP(v) != nil }):
+		inference.EntityType = Ipaddress
+	case allMatch(distinct, isPhone):
+		inference.EntityType = Phone
+	case allMatch(distinct, colorRegex.MatchString):
+		inference.EntityType = Color
+	case allMatch(distinct, uuidRegex.MatchString):
+		inference.EntityType = Alias
+	case allMatch(distinct, isJsonBlob):
+		inference.EntityType = Json
+	case len(distinct) <= enumerationLimit && nonEmpty >= 2*len(distinct) && inference.MaxLength <= 100:
+		inference.EntityType = Enumeration
+		sort.Strings(distinct)
+		inference.Options = distinct
+	case inference.MaxLength > 100:
+		inference.EntityType = Content
+	default:
+		inference.EntityType = Label
+	}
+
+	return inference
+}
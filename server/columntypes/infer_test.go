@@ -0,0 +1,78 @@
+package fieldtypes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+
+	cases := []struct {
+		value    string
+		locale   string
+		expected float64
+	}{
+		{"0.125", "", 0.125},
+		{"12.125 %", "", 12.125},
+		{"12 %", "", 12},
+		{"$1,234.50", "", 1234.5},
+		{"1,234", "", 1234},
+		{"1,5", "", 1.5},
+		{"1.234.567", "", 1234567},
+		{"1.234,50 EUR", "", 1234.5},
+		{"1 234 567", "", 1234567},
+		{"-42", "", -42},
+		{"1.234", "de-DE", 1234},
+		{"1,234", "de_DE", 1.234},
+		{"12.5", "de-DE", 12.5},
+		{"1,234", "en-US", 1234},
+	}
+
+	for _, c := range cases {
+		number, ok := ParseNumber(c.value, c.locale)
+		if !ok || number != c.expected {
+			t.Errorf("expected [%v] in [%v] to be %v, got %v, %v", c.value, c.locale, c.expected, number, ok)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "12 apples"} {
+		if _, ok := ParseNumber(value, ""); ok {
+			t.Errorf("expected [%v] to not be a number", value)
+		}
+	}
+}
+
+func TestInferType(t *testing.T) {
+
+	cases := []struct {
+		name       string
+		values     []string
+		locale     string
+		entityType EntityType
+		dateFormat string
+	}{
+		{"active", []string{"yes", "no", "yes"}, "", Boolean, ""},
+		{"share", []string{"12 %", "0.5%"}, "", Percentage, ""},
+		{"count", []string{"1", "2", "30"}, "", NumberInt, ""},
+		{"ratio", []string{"0.125", "2"}, "", NumberFloat, ""},
+		{"price", []string{"10", "12.5"}, "", Money, ""},
+		{"total", []string{"$1,234.50", "$5"}, "", Money, ""},
+		{"email", []string{"a@example.com", "b@example.org"}, "", Email, ""},
+		{"born", []string{"01/02/2006", "25/12/2006"}, "en-GB", Date, "2/1/2006"},
+		{"born", []string{"01/02/2006", "12/25/2006"}, "en-US", Date, "1/2/2006"},
+		{"website", []string{"https://example.com/a"}, "", Url, ""},
+		{"name", []string{"", ""}, "", Label, ""},
+	}
+
+	for _, c := range cases {
+		inference := InferType(c.name, c.values, c.locale)
+		if inference.EntityType != c.entityType || inference.DateFormat != c.dateFormat {
+			t.Errorf("expected %v of [%v] to be %v %v, got %v %v", c.values, c.name, c.entityType, c.dateFormat, inference.EntityType, inference.DateFormat)
+		}
+	}
+
+	status := InferType("status", []string{"open", "closed", "open", "closed", "", "open"}, "")
+	if status.EntityType != Enumeration || !reflect.DeepEqual(status.Options, []string{"closed", "open"}) || !status.Nullable {
+		t.Errorf("expected a nullable enumeration of open and closed, got %+v", status)
+	}
+}
@@ -73,6 +73,14 @@ func (t EntityType) String() string {
 		return "name"
 	case Id:
 		return "id-col"
+	case Percentage:
+		return "percentage"
+	case Url:
+		return "url"
+	case Phone:
+		return "phone"
+	case Enumeration:
+		return "enumeration"
 	}
 	return "name-not-set"
 }
@@ -111,6 +119,10 @@ const (
 	Namespace
 	Name
 	None
+	Percentage
+	Url
+	Phone
+	Enumeration
 )
 
 var (
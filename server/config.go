@@ -16,7 +16,11 @@ import (
 func CreateConfigHandler(configStore *resource.ConfigStore) func(context *gin.Context) {
 
 	return func(c *gin.Context) {
-		webConfig := configStore.GetWebConfig()
+		store := configStore
+		if workspace := resource.GetWorkspace(c.Request); workspace != nil {
+			store = configStore.WorkspaceConfigStore(workspace.Slug)
+		}
+		webConfig := store.GetWebConfig()
 		c.JSON(200, webConfig)
 	}
 }
@@ -144,6 +148,9 @@ func LoadConfigFiles() (resource.CmsConfig, []error) {
 
 	}
 
+	// materialised streams are served from a table of their own
+	globalInitConfig.Tables = append(globalInitConfig.Tables, resource.MaterializedStreamTables(globalInitConfig.Streams)...)
+
 	return globalInitConfig, errs
 
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // Possible improvements:
@@ -55,9 +56,13 @@ func CorsMiddlewareFunc(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", c.Request.Header.Get("Origin"))
 	c.Header("Access-Control-Allow-Methods", "POST,GET,DELETE,PUT,OPTIONS,PATCH")
 	c.Header("Access-Control-Allow-Credentials", "true")
-	c.Header("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With")
+	c.Header("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With,Tus-Resumable,Upload-Length,Upload-Metadata,Upload-Offset")
+	c.Header("Access-Control-Expose-Headers", "Location,Tus-Resumable,Tus-Version,Tus-Extension,Tus-Max-Size,Upload-Offset,Upload-Length")
 
 	if c.Request.Method == "OPTIONS" {
+		if strings.HasPrefix(c.Request.URL.Path, "/upload/") {
+			TusOptions(c)
+		}
 		c.AbortWithStatus(200)
 	}
 
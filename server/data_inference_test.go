@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"testing"
+)
+
+func TestInferredReferencesOnlyUseReadableTables(t *testing.T) {
+
+	wrapper, dbResource := GetResource()
+	defer wrapper.db.Close()
+
+	emails := []string{"first@example.com", "second@example.com"}
+	for i, email := range emails {
+		// the test database is kept between runs
+		wrapper.db.Exec("delete from user_account where email = ?", email)
+		_, err := wrapper.db.Exec("insert into user_account (name, email, password, reference_id, permission) values (?, ?, '', ?, ?)",
+			email, email, []string{"u-first", "u-second"}[i], auth.DEFAULT_PERMISSION)
+		if err != nil {
+			t.Fatalf("failed to add user: %v", err)
+		}
+	}
+	rows := []map[string]interface{}{{"email": emails[0]}, {"email": emails[1]}}
+
+	infer := func() *resource.ColumnReference {
+		_, inferred := resource.InferTableInfo("contacts", []string{"email"}, rows, resource.ImportOptions{}, "", dbResource.Cruds, &auth.SessionUser{})
+		return inferred[0].Reference
+	}
+
+	var permission int64
+	err := wrapper.db.QueryRowx("select permission from world where table_name = ?", resource.USER_ACCOUNT_TABLE_NAME).Scan(&permission)
+	if err != nil {
+		t.Fatalf("failed to read permission: %v", err)
+	}
+	defer wrapper.db.Exec("update world set permission = ? where table_name = ?", permission, resource.USER_ACCOUNT_TABLE_NAME)
+
+	// a guest cannot read the users, so the upload must not tell which of the emails are registered
+	_, err = wrapper.db.Exec("update world set permission = ? where table_name = ?", auth.UserCRUD, resource.USER_ACCOUNT_TABLE_NAME)
+	if err != nil {
+		t.Fatalf("failed to update permission: %v", err)
+	}
+	if reference := infer(); reference != nil {
+		t.Errorf("expected no reference to a table the user cannot read, got %v", reference)
+	}
+
+	_, err = wrapper.db.Exec("update world set permission = ? where table_name = ?", auth.GuestPeek|auth.GuestRead, resource.USER_ACCOUNT_TABLE_NAME)
+	if err != nil {
+		t.Fatalf("failed to update permission: %v", err)
+	}
+	reference := infer()
+	if reference == nil || reference.Table != resource.USER_ACCOUNT_TABLE_NAME || reference.Column != "email" {
+		t.Errorf("expected a reference to the emails of a readable table, got %v", reference)
+	}
+}
@@ -645,7 +645,13 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 						sessionUser = sessionUserInterface.(*auth.SessionUser)
 					}
 
-					existingObj, _, err := resources[table.TableName].GetSingleRowByReferenceId(table.TableName, resourceId)
+					pr := &http.Request{
+						Method: "PATCH",
+					}
+
+					pr = pr.WithContext(params.Context)
+
+					existingObj, _, err := resources[table.TableName].GetSingleRowByReferenceId(table.TableName, resourceId, pr)
 					if err != nil {
 						return nil, err
 					}
@@ -672,12 +678,6 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 
 					obj.SetAttributes(args)
 
-					pr := &http.Request{
-						Method: "PATCH",
-					}
-
-					pr = pr.WithContext(params.Context)
-
 					req := api2go.Request{
 						PlainRequest: pr,
 					}
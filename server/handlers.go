@@ -2,12 +2,10 @@ package server
 
 import (
 	"encoding/json"
-	"github.com/Masterminds/squirrel"
 	"github.com/artpar/api2go"
 	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/database"
 	"github.com/daptin/daptin/server/resource"
-	"github.com/daptin/daptin/server/statementbuilder"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -39,8 +37,6 @@ func CreateEventHandler(initConfig *resource.CmsConfig, fsmManager resource.FsmM
 
 		objectStateMachine := objectStateMachineResponse.Result().(*api2go.Api2GoModel)
 
-		stateObject := objectStateMachine.Data
-
 		var subjectInstanceModel *api2go.Api2GoModel
 		//var stateMachineDescriptionInstance *api2go.Api2GoModel
 
@@ -62,13 +58,34 @@ func CreateEventHandler(initConfig *resource.CmsConfig, fsmManager resource.FsmM
 			return
 		}
 
-		nextState, err := fsmManager.ApplyEvent(subjectInstanceModel.GetAllAsAttributes(), resource.NewStateMachineEvent(stateMachineId, eventName))
+		// input fields of the event are sent as {"attributes": {...}}
+		eventData := make(map[string]interface{})
+		if gincontext.Request.Body != nil {
+			bodyBytes, err := ioutil.ReadAll(gincontext.Request.Body)
+			if err == nil && len(bodyBytes) > 0 {
+				body := make(map[string]interface{})
+				err = json.Unmarshal(bodyBytes, &body)
+				if err != nil {
+					gincontext.AbortWithStatusJSON(400, resource.NewStateMachineEventError(400, "invalid-body", "Event body is not valid json"))
+					return
+				}
+				if attributes, ok := body["attributes"].(map[string]interface{}); ok {
+					eventData = attributes
+				}
+			}
+		}
+
+		nextState, err := fsmManager.ApplyEvent(subjectInstanceModel.GetAllAsAttributes(), resource.NewStateMachineEvent(stateMachineId, eventName, eventData), req)
 		if err != nil {
-			gincontext.AbortWithError(400, err)
+			if httpErr, ok := err.(api2go.HTTPError); ok {
+				gincontext.AbortWithStatusJSON(httpErr.Status(), httpErr)
+			} else {
+				gincontext.AbortWithError(400, err)
+			}
 			return
 		}
 
-		stateAudit := objectStateMachine.GetAuditModel()
+		stateAudit := resource.TransitionAuditModel(objectStateMachine, eventName, nextState, false)
 		creator, ok := cruds[stateAudit.GetTableName()]
 		if ok {
 
@@ -86,17 +103,6 @@ func CreateEventHandler(initConfig *resource.CmsConfig, fsmManager resource.FsmM
 			resource.CheckErr(err, "Failed to create audit for [%v]", objectStateMachine.GetTableName())
 		}
 
-		s, v, err := statementbuilder.Squirrel.Update(typename+"_state").
-			Set("current_state", nextState).
-			Set("version", stateObject["version"].(int64)+1).
-			Where(squirrel.Eq{"reference_id": stateMachineId}).ToSql()
-
-		_, err = db.Exec(s, v...)
-		if err != nil {
-			gincontext.AbortWithError(500, err)
-			return
-		}
-
 		gincontext.AbortWithStatus(200)
 
 	}
@@ -180,3 +186,142 @@ func CreateEventStartHandler(fsmManager resource.FsmManager, cruds map[string]*r
 	}
 
 }
+
+// abortWithHttpError responds with the status and errors of an api2go.HTTPError, anything else is sent with the default status
+func abortWithHttpError(gincontext *gin.Context, defaultStatus int, err error) {
+	if httpErr, ok := err.(api2go.HTTPError); ok {
+		gincontext.AbortWithStatusJSON(httpErr.Status(), httpErr)
+		return
+	}
+	gincontext.AbortWithError(defaultStatus, err)
+}
+
+// loadObjectState reads the state row with the permissions of the caller
+func loadObjectState(gincontext *gin.Context, cruds map[string]*resource.DbResource) (*api2go.Api2GoModel, bool) {
+
+	typename := gincontext.Param("typename")
+	stateCrud, ok := cruds[typename+"_state"]
+	if !ok {
+		gincontext.AbortWithStatusJSON(404, resource.NewStateMachineEventError(404, "not-tracked", "State is not tracked for "+typename))
+		return nil, false
+	}
+
+	pr := &http.Request{}
+	pr.Method = "GET"
+	pr = pr.WithContext(gincontext.Request.Context())
+	req := api2go.Request{
+		PlainRequest: pr,
+		QueryParams:  map[string][]string{},
+	}
+
+	objectStateResponse, err := stateCrud.FindOne(gincontext.Param("objectStateId"), req)
+	if err != nil {
+		abortWithHttpError(gincontext, 404, err)
+		return nil, false
+	}
+
+	// rows the caller cannot read are filtered out without an error
+	objectState := objectStateResponse.Result().(*api2go.Api2GoModel)
+	if objectState.Data == nil || objectState.Data["reference_id"] == nil {
+		gincontext.AbortWithStatusJSON(404, resource.NewStateMachineEventError(404, "not-found", "No such state"))
+		return nil, false
+	}
+
+	return objectState, true
+}
+
+// CreateAllowedEventsHandler lists the events which can be applied to a state machine instance in its current state
+// The list is empty when the caller cannot execute the state machine
+func CreateAllowedEventsHandler(fsmManager resource.FsmManager, cruds map[string]*resource.DbResource) func(context *gin.Context) {
+
+	return func(gincontext *gin.Context) {
+
+		sessionUser := &auth.SessionUser{}
+		if user := gincontext.Request.Context().Value("user"); user != nil {
+			sessionUser = user.(*auth.SessionUser)
+		}
+
+		objectStateMachine, ok := loadObjectState(gincontext, cruds)
+		if !ok {
+			return
+		}
+
+		currentState, events, err := fsmManager.AllowedEvents(gincontext.Param("typename"), objectStateMachine.GetID())
+		if err != nil {
+			abortWithHttpError(gincontext, 500, err)
+			return
+		}
+
+		stateMachinePermission := cruds["smd"].GetRowPermission(objectStateMachine.GetAllAsAttributes())
+		if !stateMachinePermission.CanExecute(sessionUser.UserReferenceId, sessionUser.Groups) {
+			events = []resource.AllowedEvent{}
+		}
+
+		gincontext.JSON(200, gin.H{
+			"current_state": currentState,
+			"events":        events,
+		})
+	}
+}
+
+// CreateStateHistoryHandler returns the transitions of a state machine instance, oldest first
+func CreateStateHistoryHandler(fsmManager resource.FsmManager, cruds map[string]*resource.DbResource) func(context *gin.Context) {
+
+	return func(gincontext *gin.Context) {
+
+		objectStateMachine, ok := loadObjectState(gincontext, cruds)
+		if !ok {
+			return
+		}
+
+		history, err := fsmManager.History(gincontext.Param("typename"), objectStateMachine.GetID())
+		if err != nil {
+			abortWithHttpError(gincontext, 500, err)
+			return
+		}
+
+		gincontext.JSON(200, gin.H{
+			"current_state": objectStateMachine.GetAttributes()["current_state"],
+			"transitions":   history,
+		})
+	}
+}
+
+// CreateStateMachineExportHandler renders a state machine definition as graphviz dot or as a mermaid diagram
+func CreateStateMachineExportHandler(fsmManager resource.FsmManager, cruds map[string]*resource.DbResource) func(context *gin.Context) {
+
+	return func(gincontext *gin.Context) {
+
+		stateMachineId := gincontext.Param("stateMachineId")
+
+		pr := &http.Request{}
+		pr.Method = "GET"
+		pr = pr.WithContext(gincontext.Request.Context())
+		req := api2go.Request{
+			PlainRequest: pr,
+			QueryParams:  map[string][]string{},
+		}
+
+		// checks if the caller can read the state machine
+		_, err := cruds["smd"].FindOne(stateMachineId, req)
+		if err != nil {
+			abortWithHttpError(gincontext, 404, err)
+			return
+		}
+
+		description, err := fsmManager.Description(stateMachineId)
+		if err != nil {
+			abortWithHttpError(gincontext, 500, err)
+			return
+		}
+
+		switch gincontext.Param("format") {
+		case "dot":
+			gincontext.Data(200, "text/vnd.graphviz; charset=utf-8", []byte(resource.StateMachineToDot(description)))
+		case "mermaid":
+			gincontext.Data(200, "text/plain; charset=utf-8", []byte(resource.StateMachineToMermaid(description)))
+		default:
+			gincontext.AbortWithStatusJSON(400, resource.NewStateMachineEventError(400, "invalid-format", "Format should be dot or mermaid"))
+		}
+	}
+}
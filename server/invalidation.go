@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscribeInvalidations applies changes made on other instances to the state this instance keeps in memory
+// New sites and changed hostnames are still picked up only on restart, a site change re-syncs the local copy of its files
+func SubscribeInvalidations(bus resource.InvalidationBus, cmsConfig *resource.CmsConfig, cruds map[string]*resource.DbResource,
+	taskScheduler resource.TaskScheduler, authMiddleware *auth.AuthMiddleware) {
+
+	authMiddleware.EnableWorkspaceCache()
+	bus.Subscribe(resource.InvalidationTopicWorkspace, func(message resource.InvalidationMessage) {
+		authMiddleware.ClearWorkspaceCache()
+	})
+
+	bus.Subscribe(resource.InvalidationTopicTask, func(message resource.InvalidationMessage) {
+		if message.Origin == resource.InstanceId() {
+			// already synced by the task scheduler middleware
+			return
+		}
+		err := taskScheduler.SyncTasks()
+		resource.CheckErr(err, "Failed to sync tasks changed on [%v]", message.Origin)
+	})
+
+	bus.Subscribe(resource.InvalidationTopicContext, func(message resource.InvalidationMessage) {
+		for _, crud := range cruds {
+			crud.ClearContext()
+		}
+	})
+
+	bus.Subscribe(resource.InvalidationTopicSite, func(message resource.InvalidationMessage) {
+		// sites are listed once by hostname and once by path
+		synced := make(map[string]bool)
+		for _, siteInfo := range cmsConfig.SubSites {
+			site := siteInfo.SubSite
+			if synced[site.ReferenceId] || siteInfo.SourceRoot == "" {
+				continue
+			}
+			if message.Key != "" && message.Key != site.ReferenceId {
+				continue
+			}
+			synced[site.ReferenceId] = true
+
+			cloudStore, err := cruds["cloud_store"].GetCloudStoreByReferenceId(siteInfo.CloudStore.ReferenceId)
+			if resource.CheckErr(err, "Failed to load cloud store for site [%v]", site.Name) {
+				continue
+			}
+
+			log.Infof("Site [%v] changed, sync files to %v", site.Name, siteInfo.SourceRoot)
+			err = cruds["task"].SyncStorageToPath(cloudStore, "", siteInfo.SourceRoot)
+			resource.CheckErr(err, "Failed to sync storage for site [%v]", site.Name)
+		}
+	})
+
+}
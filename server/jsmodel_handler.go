@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/artpar/api2go"
 	"github.com/daptin/daptin/server/apiblueprint"
@@ -57,9 +58,21 @@ func CreateStatsHandler(initConfig *resource.CmsConfig, cruds map[string]*resour
 		aggReq.TimeFrom = c.Query("timefrom")
 		aggReq.TimeTo = c.Query("timeto")
 		aggReq.Order = c.QueryArray("order")
+		aggReq.PlainRequest = c.Request
+		if query := c.Query("query"); query != "" {
+			err := json.Unmarshal([]byte(query), &aggReq.Query)
+			if err != nil {
+				c.JSON(400, resource.NewDaptinError("Invalid query", err.Error()))
+				return
+			}
+		}
 
 		aggResponse, err := cruds[typeName].DataStats(aggReq)
 
+		if err == resource.ErrJsonFunctionsMissing {
+			c.JSON(400, resource.NewDaptinError("Invalid query", err.Error()))
+			return
+		}
 		if err != nil {
 			c.JSON(500, resource.NewDaptinError("Failed to query stats", "query failed"))
 			return
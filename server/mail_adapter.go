@@ -246,7 +246,7 @@ func DaptinSmtpDbResource(dbResource *resource.DbResource) func() backends.Decor
 							continue
 						}
 
-						user, _, err := dbResource.GetSingleRowByReferenceId("user_account", mailAccount["user_account_id"].(string))
+						user, _, err := dbResource.GetSingleRowByReferenceId("user_account", mailAccount["user_account_id"].(string), nil)
 
 						sessionUser := &auth.SessionUser{
 							UserId:          user["id"].(int64),
@@ -6,7 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/artpar/api2go"
-	"github.com/daptin/daptin/server/columntypes"
+	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/csvmap"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -33,15 +33,21 @@ func (d *UploadCsvFileToEntityPerformer) DoAction(request Outcome, inFields map[
 	entityName := inFields["entity_name"].(string)
 	create_if_not_exists := inFields["create_if_not_exists"].(bool)
 	add_missing_columns := inFields["add_missing_columns"].(bool)
+	sessionUser, _ := request.Attributes["user"].(*auth.SessionUser)
+	options, err := ImportOptionsFromFields(inFields)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
 	table := TableInfo{}
 	table.TableName = SmallSnakeCaseText(entityName)
 
-	columns := make([]api2go.ColumnInfo, 0)
+	relations := make([]api2go.TableRelation, 0)
 
 	allSt := make(map[string]interface{})
 
 	sources := make([]DataFileImport, 0)
+	dryRunRows := make([]map[string]interface{}, 0)
 
 	completed := false
 
@@ -79,92 +85,39 @@ func (d *UploadCsvFileToEntityPerformer) DoAction(request Outcome, inFields map[
 			return nil, nil, []error{err}
 		}
 
-		csvReader.Columns = columnNames
-		data, err := csvReader.ReadAll()
-		recordCount := len(data)
+		rows, err := CsvDataRows(fileBytes)
 		if err != nil {
 			return nil, nil, []error{err}
 		}
 
-		if err != nil {
-			return nil, nil, []error{err}
+		var inferred []InferredColumn
+		table, relations, inferred, options = UploadTable(entityName, columnNames, rows, options, existingEntity, add_missing_columns, d.cruds, sessionUser)
+		for _, column := range inferred {
+			log.Infof("Column %v was identified as %v", column.FileColumn, column.Inference.EntityType)
 		}
 
-		// identify data type of each column
-		for _, colName := range columnNames {
-
-			if colName == "" {
-				continue
-			}
-
-			var column api2go.ColumnInfo
-
-			if add_missing_columns && existingEntity != nil {
-				_, ok := existingEntity.GetColumnByName(colName)
-				if !ok {
-					// ignore column if it doesn't exists
-					continue
-				}
-			}
-
-			dataMap := map[string]bool{}
-			datas := make([]string, 0)
-
-			isNullable := false
-			count := 100000
-			for _, d := range data {
-				if count < 0 {
-					break
-				}
-				i := d[colName]
-				var strVal string
-				if i == "" {
-					isNullable = true
-					continue
-				} else {
-					strVal = i
-				}
-				if dataMap[strVal] {
-					continue
-				}
-				dataMap[strVal] = true
-				datas = append(datas, strVal)
-				count -= 1
-			}
-
-			eType, _, err := fieldtypes.DetectType(datas)
-			if err != nil {
-				column.ColumnType = "label"
-				column.DataType = "varchar(100)"
-			} else {
-				column.ColumnType = EntityTypeToColumnTypeMap[eType]
-				column.DataType = EntityTypeToDataTypeMap[eType]
-			}
-
-			if len(datas) > (recordCount / 10) {
-				column.IsIndexed = true
-			}
-
-			if len(datas) == recordCount {
-				column.IsUnique = true
-			}
-
-			column.IsNullable = isNullable
-			column.Name = colName
-			column.ColumnName = SmallSnakeCaseText(colName)
-
-			columns = append(columns, column)
-		}
-		table.Columns = columns
 		completed = true
-		sources = append(sources, DataFileImport{FilePath: fileName, Entity: table.TableName, FileType: "csv"})
+		sources = append(sources, DataFileImport{FilePath: fileName, Entity: table.TableName, FileType: "csv", Options: options})
+		if options.DryRun {
+			dryRunRows = append(dryRunRows, rows...)
+		}
 
 	}
 
+	if completed && options.DryRun {
+		return nil, DryRunImport(d.cruds, table, dryRunRows, options), nil
+	}
+
+	if completed && !create_if_not_exists && !add_missing_columns {
+		reports := ImportDataFiles(sources, d.cruds[entityName].db, d.cruds)
+		return nil, ImportReportResponses(reports), nil
+	}
+
 	if completed {
 
 		if create_if_not_exists {
 			allSt["tables"] = []TableInfo{table}
+			allSt["relations"] = relations
 		}
 
 		allSt["imports"] = sources
@@ -179,11 +132,7 @@ func (d *UploadCsvFileToEntityPerformer) DoAction(request Outcome, inFields map[
 		ioutil.WriteFile(jsonFileName, jsonStr, 0644)
 		log.Printf("File %v written to disk for upload", jsonFileName)
 
-		if create_if_not_exists || add_missing_columns {
-			go restart()
-		} else {
-			ImportDataFiles(sources, d.cruds[entityName].db, d.cruds)
-		}
+		go restart()
 
 		return nil, successResponses, nil
 	} else {
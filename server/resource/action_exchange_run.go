@@ -0,0 +1,74 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+)
+
+// ExchangeRunActionPerformer pulls the rows of an exchange from its source, it is run by the run_exchange action
+// and by the tasks registered for exchanges with a schedule. The lease of the task makes one instance run a
+// scheduled exchange
+type ExchangeRunActionPerformer struct {
+	cruds map[string]*DbResource
+}
+
+func (d *ExchangeRunActionPerformer) Name() string {
+	return "exchange.run"
+}
+
+func (d *ExchangeRunActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	responses := make([]ActionResponse, 0)
+
+	exchangeId, ok := inFields["data_exchange_id"].(string)
+	if !ok || exchangeId == "" {
+		return nil, nil, []error{fmt.Errorf("data_exchange_id is required to run an exchange")}
+	}
+
+	exchanges, err := GetExchangeContracts(d.cruds["data_exchange"].connection, squirrel.Eq{"reference_id": exchangeId})
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if len(exchanges) == 0 {
+		return nil, nil, []error{fmt.Errorf("no such exchange [%v]", exchangeId)}
+	}
+	exchange := exchanges[0]
+
+	token, oauthConfig, err := d.cruds["data_exchange"].GetExchangeToken(exchange)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	email := ""
+	if user, ok := inFields["user"].(map[string]interface{}); ok {
+		email, _ = user["email"].(string)
+	}
+
+	execution := NewExchangeExecution(exchange, token, oauthConfig, d.cruds, d.cruds["data_exchange"].requestAsUser(email, "POST"))
+	run, err := execution.Pull(make(map[string]interface{}))
+	if err != nil {
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("error", "Exchange failed: "+err.Error(), "Failed")))
+		return nil, responses, []error{err}
+	}
+
+	message := fmt.Sprintf("Exchange [%v] read %d and wrote %d rows", exchange.Name, run.RowsRead, run.RowsWritten)
+	if run.RowsFailed > 0 {
+		message = fmt.Sprintf("%v, %d rows failed and are listed in the run log", message, run.RowsFailed)
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("warning", message, "Partial")))
+		return nil, responses, nil
+	}
+	responses = append(responses, NewActionResponse("client.notify", NewClientNotification("success", message, "Success")))
+
+	return nil, responses, nil
+}
+
+func NewExchangeRunActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := ExchangeRunActionPerformer{
+		cruds: cruds,
+	}
+
+	return &handler, nil
+
+}
@@ -0,0 +1,147 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// ExportStreamPerformer downloads every row of a stream as json or csv, with the permissions of the user
+type ExportStreamPerformer struct {
+	cmsConfig *CmsConfig
+	cruds     map[string]*DbResource
+}
+
+func (d *ExportStreamPerformer) Name() string {
+	return "__stream_export"
+}
+
+func (d *ExportStreamPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	responses := make([]ActionResponse, 0)
+
+	streamName, _ := inFields["stream_name"].(string)
+
+	var contract *StreamContract
+	for i, stream := range d.cmsConfig.Streams {
+		if stream.StreamName == streamName {
+			contract = &d.cmsConfig.Streams[i]
+			break
+		}
+	}
+	if contract == nil {
+		return nil, nil, []error{fmt.Errorf("no such stream [%v]", streamName)}
+	}
+
+	format, _ := inFields["format"].(string)
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		return nil, nil, []error{fmt.Errorf("unsupported export format [%v]", format)}
+	}
+
+	email := ""
+	if user, ok := inFields["user"].(map[string]interface{}); ok {
+		email, _ = user["email"].(string)
+	}
+
+	log.Infof("Export data for stream: %v", streamName)
+	processor := NewStreamProcessor(*contract, d.cruds)
+	rows, err := processor.ReadAll(d.cruds["stream"].requestAsUser(email, "GET"))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	var content []byte
+	contentType := "application/json"
+	if format == "json" {
+		content, err = json.Marshal(map[string]interface{}{
+			streamName: rows,
+		})
+	} else {
+		contentType = "application/csv"
+		content, err = streamRowsToCsv(*contract, rows)
+	}
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	responseAttrs := make(map[string]interface{})
+	responseAttrs["content"] = base64.StdEncoding.EncodeToString(content)
+	responseAttrs["name"] = fmt.Sprintf("daptin_stream_%v.%v", streamName, format)
+	responseAttrs["contentType"] = contentType
+	responseAttrs["message"] = "Downloading stream data"
+
+	actionResponse := NewActionResponse("client.file.download", responseAttrs)
+
+	responses = append(responses, actionResponse)
+
+	return nil, responses, nil
+}
+
+// streamRowsToCsv writes the columns of the stream contract first, then the other columns of the rows in name order
+func streamRowsToCsv(contract StreamContract, rows []map[string]interface{}) ([]byte, error) {
+
+	columnNames := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, column := range contract.Columns {
+		name := column.ColumnName
+		if name == "" {
+			name = column.Name
+		}
+		seen[name] = true
+		columnNames = append(columnNames, name)
+	}
+
+	extra := make([]string, 0)
+	for _, row := range rows {
+		for name := range row {
+			if !seen[name] && name != "__type" {
+				seen[name] = true
+				extra = append(extra, name)
+			}
+		}
+	}
+	sort.Strings(extra)
+	columnNames = append(columnNames, extra...)
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	err := writer.Write(columnNames)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(columnNames))
+		for i, name := range columnNames {
+			if row[name] != nil {
+				record[i] = fmt.Sprintf("%v", row[name])
+			}
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func NewExportStreamPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := ExportStreamPerformer{
+		cmsConfig: initConfig,
+		cruds:     cruds,
+	}
+
+	return &handler, nil
+
+}
@@ -12,6 +12,7 @@ import (
 	"archive/zip"
 	"encoding/json"
 	"github.com/artpar/api2go"
+	"github.com/artpar/rclone/fs"
 	"github.com/artpar/rclone/fs/config"
 	"github.com/artpar/rclone/fs/sync"
 	"golang.org/x/oauth2"
@@ -148,27 +149,75 @@ func (d *FileUploadActionPerformer) DoAction(request Outcome, inFields map[strin
 
 	//targetInformation := inFields["subject"]
 	//targetInformationMap := targetInformation.(map[string]interface{})
-	rootPath := inFields["root_path"].(string)
+	oauthTokenId, _ := inFields["oauth_token_id"].(string)
+	CopyToCloudStore(d.cruds, tempDirectoryPath, inFields["store_provider"].(string), oauthTokenId, inFields["root_path"].(string), func(err error) {
+		os.RemoveAll(tempDirectoryPath)
+	})
+
+	restartAttrs := make(map[string]interface{})
+	restartAttrs["type"] = "success"
+	restartAttrs["message"] = "Cloud storage file upload queued"
+	restartAttrs["title"] = "Success"
+	actionResponse := NewActionResponse("client.notify", restartAttrs)
+	responses = append(responses, actionResponse)
+
+	return nil, responses, nil
+}
+
+// CopyToCloudStore copies the files in the folder to the root path of a store in the background, done is called with
+// the result of the copy
+func CopyToCloudStore(cruds map[string]*DbResource, sourceFolder string, storeProvider string, oauthTokenId string, rootPath string, done func(err error)) {
+
+	fsrc, fdst := cloudStoreSrcDst(cruds, sourceFolder, storeProvider, oauthTokenId, rootPath)
+
+	go cmd.Run(true, true, nil, func() error {
+		if fsrc == nil || fdst == nil {
+			log.Errorf("Source or destination is null")
+			done(errors.New("source or destination is null"))
+			return nil
+		}
+
+		ctx := context.Background()
+
+		err := sync.CopyDir(ctx, fdst, fsrc, true)
+		InfoErr(err, "Failed to sync files for upload to cloud")
+		done(err)
+		return err
+	})
+}
+
+// CopyToCloudStoreAndWait copies the files in the source folder to the store and returns once they are copied
+func CopyToCloudStoreAndWait(cruds map[string]*DbResource, sourceFolder string, storeProvider string, oauthTokenId string, rootPath string) error {
+
+	fsrc, fdst := cloudStoreSrcDst(cruds, sourceFolder, storeProvider, oauthTokenId, rootPath)
+	if fsrc == nil || fdst == nil {
+		return errors.New("source or destination is null")
+	}
+
+	return sync.CopyDir(context.Background(), fdst, fsrc, true)
+}
+
+// cloudStoreSrcDst configures the store with its oauth token and opens the source folder and the root of the store
+func cloudStoreSrcDst(cruds map[string]*DbResource, sourceFolder string, storeProvider string, oauthTokenId string, rootPath string) (fs.Fs, fs.Fs) {
+
 	args := []string{
-		tempDirectoryPath,
+		sourceFolder,
 		rootPath,
 	}
 
 	var token *oauth2.Token
+	var err error
 	oauthConf := &oauth2.Config{}
-	oauthTokenId1 := inFields["oauth_token_id"]
-	if oauthTokenId1 == nil {
+	if oauthTokenId == "" {
 		log.Infof("No oauth token set for target store")
 	} else {
-		oauthTokenId := oauthTokenId1.(string)
-		token, oauthConf, err = d.cruds["oauth_token"].GetTokenByTokenReferenceId(oauthTokenId)
+		token, oauthConf, err = cruds["oauth_token"].GetTokenByTokenReferenceId(oauthTokenId)
 		CheckErr(err, "Failed to get oauth2 token for store sync")
 	}
 
 	jsonToken, err := json.Marshal(token)
 	CheckErr(err, "Failed to marshal access token to json")
 
-	storeProvider := inFields["store_provider"].(string)
 	config.FileSet(storeProvider, "client_id", oauthConf.ClientID)
 	config.FileSet(storeProvider, "type", storeProvider)
 	config.FileSet(storeProvider, "client_secret", oauthConf.ClientSecret)
@@ -176,30 +225,7 @@ func (d *FileUploadActionPerformer) DoAction(request Outcome, inFields map[strin
 	config.FileSet(storeProvider, "client_scopes", strings.Join(oauthConf.Scopes, ","))
 	config.FileSet(storeProvider, "redirect_url", oauthConf.RedirectURL)
 
-	fsrc, fdst := cmd.NewFsSrcDst(args)
-
-	go cmd.Run(true, true, nil, func() error {
-		if fsrc == nil || fdst == nil {
-			log.Errorf("Source or destination is null")
-			return nil
-		}
-
-		ctx := context.Background()
-
-		err := sync.CopyDir(ctx, fdst, fsrc, true)
-		os.RemoveAll(tempDirectoryPath)
-		InfoErr(err, "Failed to sync files for upload to cloud")
-		return err
-	})
-
-	restartAttrs := make(map[string]interface{})
-	restartAttrs["type"] = "success"
-	restartAttrs["message"] = "Cloud storage file upload queued"
-	restartAttrs["title"] = "Success"
-	actionResponse := NewActionResponse("client.notify", restartAttrs)
-	responses = append(responses, actionResponse)
-
-	return nil, responses, nil
+	return cmd.NewFsSrcDst(args)
 }
 
 func NewFileUploadActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
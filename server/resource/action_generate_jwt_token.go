@@ -5,6 +5,7 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/artpar/api2go"
 	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
 	"github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
 	"strings"
@@ -59,12 +60,23 @@ func (d *GenerateJwtTokenActionPerformer) DoAction(request Outcome, inFieldMap m
 		responses = append(responses, actionResponse)
 	} else {
 		existingUser := existingUsers[0]
+		workspace, _ := inFieldMap["workspace"].(string)
 		if skipPasswordCheck || (existingUser["password"] != nil && BcryptCheckStringHash(password, existingUser["password"].(string))) {
 
+			if workspace != "" {
+				if _, err := d.cruds[WORKSPACE_TABLE_NAME].GetWorkspaceRole(workspace, existingUser["reference_id"].(string)); err != nil {
+					log.Infof("User [%v] is not a member of workspace [%v]: %v", existingUser["email"], workspace, err)
+					responseAttrs["type"] = "error"
+					responseAttrs["message"] = "Not a member of the workspace"
+					responseAttrs["title"] = "Failed"
+					return nil, []ActionResponse{NewActionResponse("client.notify", responseAttrs)}, nil
+				}
+			}
+
 			// Create a new token object, specifying signing method and the claims
 			// you would like it to contain.
 			u, _ := uuid.NewV4()
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			claims := jwt.MapClaims{
 				"email":   existingUser["email"],
 				"name":    existingUser["name"],
 				"nbf":     time.Now().Unix(),
@@ -73,7 +85,11 @@ func (d *GenerateJwtTokenActionPerformer) DoAction(request Outcome, inFieldMap m
 				"picture": fmt.Sprintf("https://www.gravatar.com/avatar/%s&d=monsterid", GetMD5Hash(strings.ToLower(existingUser["email"].(string)))),
 				"iat":     time.Now(),
 				"jti":     u.String(),
-			})
+			}
+			if workspace != "" {
+				claims[auth.WorkspaceClaim] = workspace
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 			// Sign and get the complete encoded token as a string using the secret
 			tokenString, err := token.SignedString(d.secret)
@@ -169,13 +169,19 @@ func (db *DbResource) HandleActionRequest(actionRequest *ActionRequest, req api2
 		subjectInstanceMap["__type"] = subjectInstance.GetName()
 		permission := db.GetRowPermission(subjectInstanceMap)
 
-		if !permission.CanExecute(sessionUser.UserReferenceId, sessionUser.Groups) {
+		// a policy of the roles of the user on the action decides in place of the permissions of the row and the action
+		decision := db.RoleDecision(sessionUser, actionRequest.Type, actionRequest.Action, PolicyOperationExecute, &permission)
+		if decision == PolicyDeny || decision == PolicyNoDecision && !permission.CanExecute(sessionUser.UserReferenceId, sessionUser.Groups) {
+			return nil, api2go.NewHTTPError(errors.New("forbidden"), "forbidden", 403)
+		}
+		if decision == PolicyNoDecision && !db.IsUserActionAllowed(sessionUser.UserReferenceId, sessionUser.Groups, actionRequest.Type, actionRequest.Action) {
+			return nil, api2go.NewHTTPError(errors.New("forbidden"), "forbidden", 403)
+		}
+	} else {
+		decision := db.RoleDecision(sessionUser, actionRequest.Type, actionRequest.Action, PolicyOperationExecute, nil)
+		if decision == PolicyDeny || decision == PolicyNoDecision && !db.IsUserActionAllowed(sessionUser.UserReferenceId, sessionUser.Groups, actionRequest.Type, actionRequest.Action) {
 			return nil, api2go.NewHTTPError(errors.New("forbidden"), "forbidden", 403)
 		}
-	}
-
-	if !db.IsUserActionAllowed(sessionUser.UserReferenceId, sessionUser.Groups, actionRequest.Type, actionRequest.Action) {
-		return nil, api2go.NewHTTPError(errors.New("forbidden"), "forbidden", 403)
 	}
 
 	log.Infof("Handle event for action [%v]", actionRequest.Action)
@@ -235,6 +241,10 @@ func (db *DbResource) HandleActionRequest(actionRequest *ActionRequest, req api2
 		inFieldMap["user"] = user
 	}
 
+	if workspace := GetWorkspace(req.PlainRequest); workspace != nil {
+		inFieldMap[WORKSPACE_ID_COLUMN] = workspace.WorkspaceId
+	}
+
 	if subjectInstanceMap != nil {
 		inFieldMap[actionRequest.Type+"_id"] = subjectInstanceMap["reference_id"]
 		inFieldMap["subject"] = subjectInstanceMap
@@ -251,34 +261,13 @@ OutFields:
 		var actionResponse ActionResponse
 
 		if len(outcome.Condition) > 0 {
-			outcomeResult, err := evaluateString(outcome.Condition, inFieldMap)
+			conditionResult, err := evaluateCondition(outcome.Condition, inFieldMap)
 			CheckErr(err, "Failed to evaluate condition, assuming false by default")
 			if err != nil {
 				continue
 			}
 
-			log.Printf("Evaluated condition [%v] result: %v", outcome.Condition, outcomeResult)
-			boolValue, ok := outcomeResult.(bool)
-			if !ok {
-
-				strVal, ok := outcomeResult.(string)
-				if ok {
-					if strVal == "1" || strings.ToLower(strings.TrimSpace(strVal)) == "true" {
-						log.Printf("Condition is true")
-						// condition is true
-					} else {
-						// condition isn't true
-						log.Printf("Condition is false, skipping outcome")
-						continue
-					}
-
-				} else {
-
-					log.Printf("Failed to convert value to bool, assuming false")
-					continue
-				}
-
-			} else if !boolValue {
+			if !conditionResult {
 				log.Infof("Outcome [%v][%v] skipped because condition failed [%v]", outcome.Method, outcome.Type, outcome.Condition)
 				continue
 			}
@@ -334,7 +323,7 @@ OutFields:
 			actionResponses = append(actionResponses, actionResponse)
 		case "GET_BY_ID":
 
-			responseObjects, _, err = dbResource.GetSingleRowByReferenceId(outcome.Type, model.Data["reference_id"].(string))
+			responseObjects, _, err = dbResource.GetSingleRowByReferenceId(outcome.Type, model.Data["reference_id"].(string), req.PlainRequest)
 			CheckErr(err, "Failed to get by id")
 
 			if err != nil {
@@ -744,6 +733,30 @@ func buildActionContext(outcomeAttributes interface{}, inFieldMap map[string]int
 	return data, nil
 }
 
+// evaluateCondition evaluates a condition of an outcome or a state machine guard
+// The condition is true when it evaluates to true, "true" or "1"
+func evaluateCondition(condition string, context map[string]interface{}) (bool, error) {
+
+	outcomeResult, err := evaluateString(condition, context)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("Evaluated condition [%v] result: %v", condition, outcomeResult)
+	boolValue, ok := outcomeResult.(bool)
+	if ok {
+		return boolValue, nil
+	}
+
+	strVal, ok := outcomeResult.(string)
+	if ok {
+		return strVal == "1" || strings.ToLower(strings.TrimSpace(strVal)) == "true", nil
+	}
+
+	log.Printf("Failed to convert value to bool, assuming false")
+	return false, nil
+}
+
 func evaluateString(fieldString string, inFieldMap map[string]interface{}) (interface{}, error) {
 
 	var val interface{}
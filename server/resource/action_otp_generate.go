@@ -42,11 +42,11 @@ func (d *OtpGenerateActionPerformer) DoAction(request Outcome, inFieldMap map[st
 		if i == nil {
 			return nil, nil, []error{errors.New("invalid account")}
 		}
-		userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "otp_of_account", i.(int64))
+		userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "otp_of_account", i.(int64), nil)
 	}
 
 	if phoneOk && userAccount == nil && mobile != "" {
-		userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "mobile_number", mobile)
+		userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "mobile_number", mobile, nil)
 		if err != nil {
 			return nil, nil, []error{errors.New("unregistered number")}
 		}
@@ -54,7 +54,7 @@ func (d *OtpGenerateActionPerformer) DoAction(request Outcome, inFieldMap map[st
 		if i == nil {
 			return nil, nil, []error{errors.New("unregistered number")}
 		}
-		userAccount, _, err = d.cruds["user_account"].GetSingleRowByReferenceId("user_account", i.(string))
+		userAccount, _, err = d.cruds["user_account"].GetSingleRowByReferenceId("user_account", i.(string), nil)
 		if err != nil {
 			return nil, nil, []error{errors.New("unregistered number")}
 		}
@@ -48,7 +48,7 @@ func (d *OtpRegisterBeginActionPerformer) DoAction(request Outcome, inFieldMap m
 		}
 		userOtpProfileId, ok := userAccount["primary_user_otp"]
 		if ok && userOtpProfileId != nil {
-			userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "reference_id", userOtpProfileId.(string))
+			userOtpProfile, err = d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "reference_id", userOtpProfileId.(string), nil)
 		}
 	}
 
@@ -0,0 +1,138 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignUrlPerformer makes expiring urls to download or upload the files of a row, and to download the files of a
+// site, which can be used without logging in. The user asking for the url should have the access the url grants
+type SignUrlPerformer struct {
+	cruds  map[string]*DbResource
+	signer *UrlSigner
+}
+
+func (d *SignUrlPerformer) Name() string {
+	return "url.sign"
+}
+
+func (d *SignUrlPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	adminId := d.cruds[USER_ACCOUNT_TABLE_NAME].GetAdminReferenceId()
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+
+	expiresIn := 3600
+	switch value := inFields["expires_in"].(type) {
+	case float64:
+		expiresIn = int(value)
+	case int:
+		expiresIn = value
+	case string:
+		if parsed, err := strconv.Atoi(value); err == nil {
+			expiresIn = parsed
+		}
+	}
+
+	var method, path, publicUrl string
+	query := url.Values{}
+
+	if siteId, ok := inFields["site_id"].(string); ok && siteId != "" {
+
+		filePath, _ := inFields["path"].(string)
+		site, err := d.cruds["site"].GetReferenceIdToObject("site", siteId)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		permission := d.cruds["site"].GetObjectPermissionByReferenceId("site", siteId)
+		if !isAdmin && !permission.CanExecute(sessionUser.UserReferenceId, sessionUser.Groups) {
+			return nil, nil, []error{fmt.Errorf("no access to site [%v]", siteId)}
+		}
+
+		method = "GET"
+		path = "/" + strings.TrimLeft(filePath, "/")
+		query.Set("site", siteId)
+		if hostname, ok := site["hostname"].(string); ok && hostname != "" {
+			publicUrl = "//" + hostname
+		} else if sitePath, ok := site["path"].(string); ok && sitePath != "" {
+			publicUrl = "/" + sitePath
+		}
+
+	} else {
+
+		tableName, _ := inFields["table_name"].(string)
+		resourceId, _ := inFields["resource_id"].(string)
+		columnName, _ := inFields["column_name"].(string)
+
+		table, ok := d.cruds[tableName]
+		if !ok {
+			return nil, nil, []error{fmt.Errorf("no such table [%v]", tableName)}
+		}
+		column, ok := table.TableInfo().GetColumnByName(columnName)
+		if !ok || !column.IsForeignKey || column.ForeignKeyData.DataSource != "cloud_store" {
+			return nil, nil, []error{fmt.Errorf("[%v] is not a file column of [%v]", columnName, tableName)}
+		}
+
+		path = fmt.Sprintf("/asset/%s/%s/%s", tableName, resourceId, columnName)
+		permission := table.GetObjectPermissionByReferenceId(tableName, resourceId)
+
+		switch inFields["method"] {
+		case "upload":
+			if !isAdmin && !permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups) {
+				return nil, nil, []error{fmt.Errorf("no access to update [%v][%v]", tableName, resourceId)}
+			}
+			fileName, _ := inFields["file_name"].(string)
+			if fileName == "" {
+				return nil, nil, []error{fmt.Errorf("file_name is needed for an upload url")}
+			}
+			method = "PUT"
+			query.Set("filename", fileName)
+		default:
+			httpReq := &http.Request{
+				Method: "GET",
+			}
+			httpReq = httpReq.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+			_, err := table.FindOne(resourceId, api2go.Request{
+				PlainRequest: httpReq,
+			})
+			if err != nil {
+				return nil, nil, []error{fmt.Errorf("no access to read [%v][%v]", tableName, resourceId)}
+			}
+			method = "GET"
+		}
+	}
+
+	signed, expires, err := d.signer.Sign(method, path, query, sessionUser.UserReferenceId, time.Duration(expiresIn)*time.Second)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("signed.url", map[string]interface{}{
+			"url":     publicUrl + signed,
+			"method":  method,
+			"expires": expires.Unix(),
+		}),
+	}, nil
+}
+
+func NewSignUrlPerformer(configStore *ConfigStore, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := SignUrlPerformer{
+		cruds:  cruds,
+		signer: NewUrlSigner(configStore, cruds[USER_ACCOUNT_TABLE_NAME]),
+	}
+
+	return &handler, nil
+
+}
@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/artpar/api2go"
+)
+
+// SiteDomainVerifyPerformer checks that the user who added a domain to a site controls the domain. The server is
+// restarted once the domain is verified, to serve the site on it
+type SiteDomainVerifyPerformer struct {
+	cruds    map[string]*DbResource
+	verifier *DomainVerifier
+}
+
+func (d *SiteDomainVerifyPerformer) Name() string {
+	return "site.domain.verify"
+}
+
+func (d *SiteDomainVerifyPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	domainId, _ := inFields["site_domain_id"].(string)
+	domain, err := d.cruds["site_domain"].GetSiteDomainByReferenceId(domainId)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if domain.SiteId == 0 {
+		return nil, nil, []error{fmt.Errorf("domain [%v] is not added to a site", domain.Hostname)}
+	}
+
+	otherDomains, err := d.cruds["site_domain"].GetAllSiteDomains()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	for _, other := range otherDomains {
+		if other.SiteId != domain.SiteId && d.verifier.IsVerified(other) && MatchHostname(other.Hostname, domain.Hostname) {
+			return nil, nil, []error{fmt.Errorf("[%v] is already verified for another site", domain.Hostname)}
+		}
+	}
+
+	// the token is stored before the check, it is what the server answers with for a http check
+	token := d.verifier.Token(domain)
+	err = d.cruds["site_domain"].updateSiteDomainVerification(domain, token, "")
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	err = d.verifier.Verify(domain)
+	if err != nil {
+		return nil, nil, []error{fmt.Errorf("failed to verify [%v], %v: %v", domain.Hostname, d.verifier.Instructions(domain), err)}
+	}
+
+	err = d.cruds["site_domain"].updateSiteDomainVerification(domain, token, d.verifier.Proof(domain))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	go restart()
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("success", "Verified "+domain.Hostname+", the site will be served on it after the restart", "Success")),
+	}, nil
+}
+
+func NewSiteDomainVerifyPerformer(configStore *ConfigStore, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := SiteDomainVerifyPerformer{
+		cruds:    cruds,
+		verifier: NewDomainVerifier(configStore),
+	}
+
+	return &handler, nil
+
+}
@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+)
+
+// SiteRevisionPublishPerformer publishes a revision of a site file. A rollback publishes a copy of an older revision,
+// so the history of the file keeps the order in which versions went live
+type SiteRevisionPublishPerformer struct {
+	cmsConfig *CmsConfig
+	cruds     map[string]*DbResource
+}
+
+func (d *SiteRevisionPublishPerformer) Name() string {
+	return "site.revision.publish"
+}
+
+func (d *SiteRevisionPublishPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	revisionId, _ := inFields["site_revision_id"].(string)
+	revision, err := d.cruds["site_revision"].GetSiteRevisionByReferenceId(revisionId)
+	if err != nil {
+		return nil, nil, []error{fmt.Errorf("no such revision [%v]: %v", revisionId, err)}
+	}
+
+	site, ok := d.cmsConfig.SubSiteById(revision.SiteId)
+	if !ok {
+		return nil, nil, []error{fmt.Errorf("site of revision [%v] is not enabled", revisionId)}
+	}
+
+	// reading a revision is not enough to change the live site, the caller has to be able to edit the site
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	adminId := d.cruds["site"].GetAdminReferenceId()
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+	if !isAdmin && !site.SubSite.Permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups) {
+		return nil, nil, []error{api2go.NewHTTPError(errors.New("forbidden"), "forbidden", 403)}
+	}
+
+	if rollback, _ := inFields["rollback"].(bool); rollback {
+		revision, err = d.cruds["site_revision"].CreateSiteRevision(revision.SiteId, revision.Path, revision.Contents, SiteRevisionDraft, sessionUser.UserId)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+	}
+
+	err = d.cruds["site_revision"].PublishSiteRevision(site, revision)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("success", "Published "+revision.Path, "Success")),
+	}, nil
+}
+
+func NewSiteRevisionPublishPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := SiteRevisionPublishPerformer{
+		cmsConfig: initConfig,
+		cruds:     cruds,
+	}
+
+	return &handler, nil
+
+}
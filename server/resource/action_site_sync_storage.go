@@ -13,7 +13,8 @@ import (
 )
 
 type SyncSiteStorageActionPerformer struct {
-	cruds map[string]*DbResource
+	cmsConfig *CmsConfig
+	cruds     map[string]*DbResource
 }
 
 func (d *SyncSiteStorageActionPerformer) Name() string {
@@ -26,6 +27,8 @@ func (d *SyncSiteStorageActionPerformer) DoAction(request Outcome, inFields map[
 
 	cloudStoreId := inFields["cloud_store_id"].(string)
 	tempDirectoryPath := inFields["path"].(string)
+	siteId, _ := inFields["site_id"].(string)
+	site, _ := d.cmsConfig.SubSiteByReferenceId(siteId)
 	cloudStore, err := d.cruds["cloud_store"].GetCloudStoreByReferenceId(cloudStoreId)
 	if err != nil {
 		return nil, nil, []error{err}
@@ -65,6 +68,10 @@ func (d *SyncSiteStorageActionPerformer) DoAction(request Outcome, inFields map[
 			return nil
 		}
 		dir := sync.CopyDir(ctx, fdst, fsrc, true)
+		if dir == nil && site.MarkdownSite != nil && site.SourceRoot == tempDirectoryPath {
+			err := site.MarkdownSite.Build()
+			CheckErr(err, "Failed to build markdown site [%v]", site.SubSite.Name)
+		}
 		return dir
 	})
 
@@ -78,10 +85,11 @@ func (d *SyncSiteStorageActionPerformer) DoAction(request Outcome, inFields map[
 	return nil, responses, nil
 }
 
-func NewSyncSiteStorageActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+func NewSyncSiteStorageActionPerformer(cmsConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
 
 	handler := SyncSiteStorageActionPerformer{
-		cruds: cruds,
+		cmsConfig: cmsConfig,
+		cruds:     cruds,
 	}
 
 	return &handler, nil
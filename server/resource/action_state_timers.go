@@ -0,0 +1,55 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+// StateTimerActionPerformer applies the timed events of all state machines, it runs every minute as a system task
+// The lease of the task makes one instance run the timers each minute, a transition is stored only if the state did not
+// change meanwhile, so a run started by hand cannot apply an event twice either
+type StateTimerActionPerformer struct {
+	cruds map[string]*DbResource
+	fsm   *fsmManager
+}
+
+func (d *StateTimerActionPerformer) Name() string {
+	return "smd.timers.run"
+}
+
+func (d *StateTimerActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	responses := make([]ActionResponse, 0)
+
+	email := ""
+	user, ok := inFields["user"].(map[string]interface{})
+	if ok {
+		email, _ = user["email"].(string)
+	}
+
+	applied, err := d.fsm.RunStateTimers(d.cruds["world"].requestAsUser(email, "GET"))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if applied > 0 {
+		log.Infof("Applied %d timed state machine events", applied)
+	}
+
+	responses = append(responses, NewActionResponse("client.notify", NewClientNotification("success", fmt.Sprintf("Applied %d timed events", applied), "Success")))
+	return nil, responses, nil
+}
+
+func NewStateTimerActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := StateTimerActionPerformer{
+		cruds: cruds,
+		fsm: &fsmManager{
+			db:    cruds["world"].connection,
+			cruds: cruds,
+		},
+	}
+
+	return &handler, nil
+
+}
@@ -0,0 +1,56 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/artpar/api2go"
+	"time"
+)
+
+type TaskRunActionPerformer struct {
+	cruds         map[string]*DbResource
+	taskScheduler TaskScheduler
+}
+
+func (d *TaskRunActionPerformer) Name() string {
+	return "task.run"
+}
+
+func (d *TaskRunActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	responses := make([]ActionResponse, 0)
+
+	taskId, ok := inFields["task_id"].(string)
+	if !ok || taskId == "" {
+		return nil, nil, []error{fmt.Errorf("task_id is required to run a task")}
+	}
+
+	taskRun, err := d.taskScheduler.RunTask(taskId)
+	if err == ErrTaskAlreadyRunning {
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("warning", "Task is already running", "Skipped")))
+		return nil, responses, nil
+	}
+	if err == ErrTaskLeaseHeld {
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("warning", "Task is running on another instance", "Skipped")))
+		return nil, responses, nil
+	}
+	if err != nil {
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("error", "Task failed: "+err.Error(), "Failed")))
+		return nil, responses, []error{err}
+	}
+
+	message := fmt.Sprintf("Task [%v] completed in %v", taskRun.TaskName, taskRun.Duration.Round(time.Millisecond))
+	responses = append(responses, NewActionResponse("client.notify", NewClientNotification("success", message, "Success")))
+
+	return nil, responses, nil
+}
+
+func NewTaskRunActionPerformer(cruds map[string]*DbResource, taskScheduler TaskScheduler) (ActionPerformerInterface, error) {
+
+	handler := TaskRunActionPerformer{
+		cruds:         cruds,
+		taskScheduler: taskScheduler,
+	}
+
+	return &handler, nil
+
+}
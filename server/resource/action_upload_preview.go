@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/csvmap"
+	log "github.com/sirupsen/logrus"
+	"github.com/tealeg/xlsx"
+	"strings"
+)
+
+// UploadPreviewPerformer returns the table an xlsx or csv upload would create, without creating it, so the columns
+// can be reviewed before the file is uploaded with __upload_xlsx_file_to_entity or __upload_csv_file_to_entity
+type UploadPreviewPerformer struct {
+	cmsConfig *CmsConfig
+	cruds     map[string]*DbResource
+}
+
+func (d *UploadPreviewPerformer) Name() string {
+	return "__upload_file_preview"
+}
+
+func (d *UploadPreviewPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	files, _ := inFields["data_file"].([]interface{})
+	if len(files) == 0 {
+		return nil, nil, []error{fmt.Errorf("no file to preview")}
+	}
+
+	entityName, _ := inFields["entity_name"].(string)
+	sessionUser, _ := request.Attributes["user"].(*auth.SessionUser)
+	options, err := ImportOptionsFromFields(inFields)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	file := files[0].(map[string]interface{})
+	fileName, _ := file["name"].(string)
+	fileContentsBase64, _ := file["file"].(string)
+	contentParts := strings.Split(fileContentsBase64, ",")
+	fileBytes, err := base64.StdEncoding.DecodeString(contentParts[len(contentParts)-1])
+	if err != nil {
+		return nil, nil, []error{fmt.Errorf("failed to read file: %v", err)}
+	}
+	log.Infof("Preview table for file: %v", fileName)
+
+	var columnNames []string
+	var rows []map[string]interface{}
+	if strings.HasSuffix(strings.ToLower(fileName), ".csv") {
+		columnNames, err = csvmap.NewReader(bytes.NewReader(fileBytes)).ReadHeader()
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		rows, err = CsvDataRows(fileBytes)
+	} else {
+		xlsFile, err := xlsx.OpenBinary(fileBytes)
+		if err != nil {
+			return nil, nil, []error{fmt.Errorf("failed to read file: %v", err)}
+		}
+		if len(xlsFile.Sheets) == 0 {
+			return nil, nil, []error{fmt.Errorf("file has no sheets")}
+		}
+		rows, columnNames, err = GetDataArray(xlsFile.Sheets[0])
+	}
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	var existingEntity *TableInfo
+	if crud, ok := d.cruds[SmallSnakeCaseText(entityName)]; ok {
+		existingEntity = crud.TableInfo()
+	}
+
+	table, relations, inferred, options := UploadTable(entityName, columnNames, rows, options, existingEntity, false, d.cruds, sessionUser)
+
+	return nil, []ActionResponse{
+		NewActionResponse("upload.preview", map[string]interface{}{
+			"table":     table,
+			"relations": relations,
+			"columns":   inferred,
+			"exists":    existingEntity != nil,
+			"rows":      len(rows),
+			"options":   options,
+		}),
+	}, nil
+}
+
+func NewUploadPreviewPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := UploadPreviewPerformer{
+		cmsConfig: initConfig,
+		cruds:     cruds,
+	}
+
+	return &handler, nil
+
+}
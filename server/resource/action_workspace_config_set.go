@@ -0,0 +1,60 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/artpar/api2go"
+)
+
+// WorkspaceConfigSetPerformer sets a web config value of a workspace, which the workspace reads in place of the
+// value of the server. Only the administrators of the workspace can set its config
+type WorkspaceConfigSetPerformer struct {
+	cruds       map[string]*DbResource
+	configStore *ConfigStore
+}
+
+func (d *WorkspaceConfigSetPerformer) Name() string {
+	return "workspace.config.set"
+}
+
+func (d *WorkspaceConfigSetPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	slug, _ := inFields["slug"].(string)
+	if slug == "" {
+		return nil, nil, []error{fmt.Errorf("workspace has no slug")}
+	}
+
+	userReferenceId, _ := inFields["user_id"].(string)
+	adminId := d.cruds[WORKSPACE_TABLE_NAME].GetAdminReferenceId()
+	if adminId == "" || adminId != userReferenceId {
+		role, err := d.cruds[WORKSPACE_TABLE_NAME].GetWorkspaceRole(slug, userReferenceId)
+		if err != nil || role != WorkspaceRoleAdmin {
+			return nil, nil, []error{fmt.Errorf("only the administrators of [%v] can set its config", slug)}
+		}
+	}
+
+	name, _ := inFields["name"].(string)
+	value, _ := inFields["value"].(string)
+	if name == "" {
+		return nil, nil, []error{fmt.Errorf("name of the config value is empty")}
+	}
+
+	err := d.configStore.WorkspaceConfigStore(slug).SetConfigValueFor(name, value, "web")
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("success", "Set "+name+" of "+slug, "Success")),
+	}, nil
+}
+
+func NewWorkspaceConfigSetPerformer(configStore *ConfigStore, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := WorkspaceConfigSetPerformer{
+		cruds:       cruds,
+		configStore: configStore,
+	}
+
+	return &handler, nil
+
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/artpar/api2go"
 	"github.com/artpar/conform"
+	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/columntypes"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -55,6 +56,10 @@ var EntityTypeToDataTypeMap = map[fieldtypes.EntityType]string{
 	fieldtypes.Color:       "varchar(10)",
 	fieldtypes.Alias:       "varchar(100)",
 	fieldtypes.Namespace:   "varchar(100)",
+	fieldtypes.Percentage:  "float(11)",
+	fieldtypes.Url:         "varchar(500)",
+	fieldtypes.Phone:       "varchar(20)",
+	fieldtypes.Enumeration: "varchar(100)",
 }
 
 var EntityTypeToColumnTypeMap = map[fieldtypes.EntityType]string{
@@ -87,6 +92,10 @@ var EntityTypeToColumnTypeMap = map[fieldtypes.EntityType]string{
 	fieldtypes.Color:       "color",
 	fieldtypes.Alias:       "alias",
 	fieldtypes.Namespace:   "namespace",
+	fieldtypes.Percentage:  "measurement",
+	fieldtypes.Url:         "url",
+	fieldtypes.Phone:       "label",
+	fieldtypes.Enumeration: "label",
 }
 
 func (d *UploadXlsFileToEntityPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
@@ -99,15 +108,21 @@ func (d *UploadXlsFileToEntityPerformer) DoAction(request Outcome, inFields map[
 	entityName := inFields["entity_name"].(string)
 	create_if_not_exists := inFields["create_if_not_exists"].(bool)
 	add_missing_columns := inFields["add_missing_columns"].(bool)
+	sessionUser, _ := request.Attributes["user"].(*auth.SessionUser)
+	options, err := ImportOptionsFromFields(inFields)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
 	table := TableInfo{}
 	table.TableName = SmallSnakeCaseText(entityName)
 
-	columns := make([]api2go.ColumnInfo, 0)
+	relations := make([]api2go.TableRelation, 0)
 
 	allSt := make(map[string]interface{})
 
 	sources := make([]DataFileImport, 0)
+	dryRunRows := make([]map[string]interface{}, 0)
 
 	completed := false
 
@@ -143,104 +158,40 @@ nextFile:
 		for _, sheet := range xlsFile.Sheets {
 
 			data, columnNames, err := GetDataArray(sheet)
-			recordCount := len(data)
 
 			if err != nil {
 				log.Errorf("Failed to get data from sheet [%s]: %v", sheet.Name, err)
 				return nil, nil, []error{fmt.Errorf("Failed to get data from sheet [%s]: %v", sheet.Name, err)}
 			}
 
-			// identify data type of each column
-			for _, colName := range columnNames {
-
-				if colName == "" {
-					continue
-				}
-
-				var column api2go.ColumnInfo
-
-				if add_missing_columns && existingEntity != nil {
-					_, ok := existingEntity.GetColumnByName(colName)
-					if !ok {
-						// ignore column if it doesn't exists
-						continue
-					}
-				}
-
-				dataMap := map[string]bool{}
-				datas := make([]string, 0)
-
-				isNullable := false
-				count := 100000
-				maxLen := 100
-				for _, d := range data {
-					if count < 0 {
-						break
-					}
-					i := d[colName]
-					var strVal string
-					if i == nil {
-						strVal = ""
-						isNullable = true
-						continue
-					} else {
-						strVal = i.(string)
-					}
-					if dataMap[strVal] {
-						continue
-					}
-					dataMap[strVal] = true
-					datas = append(datas, strVal)
-					if maxLen < len(strVal) {
-						maxLen = len(strVal)
-					}
-					count -= 1
-				}
-
-				eType, _, err := fieldtypes.DetectType(datas)
-				if err != nil {
-					log.Infof("Unable to identify column type for %v", colName)
-					column.ColumnType = "label"
-					column.DataType = fmt.Sprintf("varchar(%v)", maxLen)
-				} else {
-					log.Infof("Column %v was identified as %v", colName, eType)
-					column.ColumnType = EntityTypeToColumnTypeMap[eType]
-
-					dbDataType := EntityTypeToDataTypeMap[eType]
-					if strings.Index(dbDataType, "varchar") == 0 {
-						dbDataType = fmt.Sprintf("varchar(%v)", maxLen+100)
-					}
-					column.DataType = dbDataType
-
-				}
-
-				if len(datas) > (recordCount / 10) {
-					column.IsIndexed = true
-				}
-
-				if len(datas) == recordCount {
-					column.IsUnique = true
-				}
-
-				column.IsNullable = isNullable
-				column.Name = colName
-				column.ColumnName = SmallSnakeCaseText(colName)
-
-				columns = append(columns, column)
+			var inferred []InferredColumn
+			table, relations, inferred, options = UploadTable(entityName, columnNames, data, options, existingEntity, add_missing_columns, d.cruds, sessionUser)
+			for _, column := range inferred {
+				log.Infof("Column %v was identified as %v", column.FileColumn, column.Inference.EntityType)
 			}
 
-			table.Columns = columns
 			completed = true
-			sources = append(sources, DataFileImport{FilePath: fileName, Entity: table.TableName, FileType: "xlsx"})
+			sources = append(sources, DataFileImport{FilePath: fileName, Entity: table.TableName, FileType: "xlsx", Options: options})
+			dryRunRows = append(dryRunRows, data...)
 
 			break nextFile
 		}
 	}
 
+	if completed && options.DryRun {
+		return nil, DryRunImport(d.cruds, table, dryRunRows, options), nil
+	}
+
+	if completed && !create_if_not_exists && !add_missing_columns {
+		reports := ImportDataFiles(sources, d.cruds[entityName].db, d.cruds)
+		return nil, ImportReportResponses(reports), nil
+	}
+
 	if completed {
 
 		if create_if_not_exists {
 			allSt["tables"] = []TableInfo{table}
+			allSt["relations"] = relations
 		}
 
 		allSt["imports"] = sources
@@ -255,11 +206,7 @@ nextFile:
 		ioutil.WriteFile(jsonFileName, jsonStr, 0644)
 		log.Printf("File %v written to disk for upload", jsonFileName)
 
-		if create_if_not_exists || add_missing_columns {
-			go restart()
-		} else {
-			ImportDataFiles(sources, d.cruds[entityName].db, d.cruds)
-		}
+		go restart()
 
 		return nil, successResponses, nil
 	} else {
@@ -297,6 +244,7 @@ type DataFileImport struct {
 	FilePath string
 	Entity   string
 	FileType string
+	Options  ImportOptions
 }
 
 func SmallSnakeCaseText(str string) string {
@@ -7,6 +7,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/Masterminds/squirrel"
 	"gopkg.in/go-playground/validator.v9"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -57,6 +59,8 @@ type SubSiteInformation struct {
 	SubSite    SubSite
 	CloudStore CloudStore
 	SourceRoot string
+	// MarkdownSite builds the pages of a markdown site from SourceRoot, it is nil for a static site
+	MarkdownSite *MarkdownSite
 }
 
 type Config struct {
@@ -73,6 +77,12 @@ type Config struct {
 type ConfigStore struct {
 	defaultEnv string
 	db         database.DatabaseConnection
+	// values are cached only when an invalidation bus is set, so a change on any instance clears the cached value everywhere
+	bus       InvalidationBus
+	cache     map[string]string
+	cacheLock sync.RWMutex
+	// parent is the config store a workspace falls back to for the values it does not set
+	parent *ConfigStore
 }
 
 var settingsTableName = "_config"
@@ -166,11 +176,76 @@ var ConfigTableStructure = TableInfo{
 
 func (c *ConfigStore) SetDefaultEnv(env string) {
 	c.defaultEnv = env
+	c.cacheLock.Lock()
+	c.cache = make(map[string]string)
+	c.cacheLock.Unlock()
+}
+
+// SetInvalidationBus enables the config value cache and drops cached values when any instance changes them
+func (c *ConfigStore) SetInvalidationBus(bus InvalidationBus) {
+	c.bus = bus
+	bus.Subscribe(InvalidationTopicConfig, func(message InvalidationMessage) {
+		c.cacheLock.Lock()
+		delete(c.cache, message.Key)
+		c.cacheLock.Unlock()
+	})
+}
+
+// WorkspaceConfigStore gives the config of a workspace, kept under an env of its own. Values the workspace does not
+// set are read from this config store
+func (c *ConfigStore) WorkspaceConfigStore(slug string) *ConfigStore {
+	return &ConfigStore{
+		db:         c.db,
+		defaultEnv: c.defaultEnv + ".workspace." + slug,
+		cache:      make(map[string]string),
+		parent:     c,
+	}
+}
+
+func configCacheKey(key string, configtype string) string {
+	return configtype + "." + key
+}
+
+func (c *ConfigStore) getCachedValue(key string, configtype string) (string, bool) {
+	if c.bus == nil {
+		return "", false
+	}
+	c.cacheLock.RLock()
+	defer c.cacheLock.RUnlock()
+	val, ok := c.cache[configCacheKey(key, configtype)]
+	return val, ok
+}
+
+func (c *ConfigStore) putCachedValue(key string, configtype string, val string) {
+	if c.bus == nil {
+		return
+	}
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+	c.cache[configCacheKey(key, configtype)] = val
+}
+
+// invalidate removes the value from the local cache and tells the other instances to do the same
+func (c *ConfigStore) invalidate(key string, configtype string) {
+	if c.bus == nil {
+		return
+	}
+	cacheKey := configCacheKey(key, configtype)
+	c.cacheLock.Lock()
+	delete(c.cache, cacheKey)
+	c.cacheLock.Unlock()
+
+	err := c.bus.Publish(InvalidationTopicConfig, cacheKey)
+	CheckErr(err, "Failed to publish config change [%v]", cacheKey)
 }
 
 func (c *ConfigStore) GetConfigValueFor(key string, configtype string) (string, error) {
 	var val string
 
+	if cached, ok := c.getCachedValue(key, configtype); ok {
+		return cached, nil
+	}
+
 	s, v, err := statementbuilder.Squirrel.Select("value").
 		From(settingsTableName).
 		Where(squirrel.Eq{"name": key}).
@@ -181,8 +256,12 @@ func (c *ConfigStore) GetConfigValueFor(key string, configtype string) (string,
 	CheckErr(err, "Failed to create config select query")
 
 	err = c.db.QueryRowx(s, v...).Scan(&val)
-	if err != nil {
+	if err != nil && c.parent != nil {
+		return c.parent.GetConfigValueFor(key, configtype)
+	} else if err != nil {
 		log.Infof("Failed to scan config value [%v]: %v", key, err)
+	} else {
+		c.putCachedValue(key, configtype, val)
 	}
 	return val, err
 }
@@ -190,6 +269,10 @@ func (c *ConfigStore) GetConfigValueFor(key string, configtype string) (string,
 func (c *ConfigStore) GetConfigIntValueFor(key string, configtype string) (int, error) {
 	var val int
 
+	if cached, ok := c.getCachedValue(key, configtype); ok {
+		return strconv.Atoi(cached)
+	}
+
 	s, v, err := statementbuilder.Squirrel.Select("value").
 		From(settingsTableName).
 		Where(squirrel.Eq{"name": key}).
@@ -200,8 +283,12 @@ func (c *ConfigStore) GetConfigIntValueFor(key string, configtype string) (int,
 	CheckErr(err, "Failed to create config select query")
 
 	err = c.db.QueryRowx(s, v...).Scan(&val)
-	if err != nil {
+	if err != nil && c.parent != nil {
+		return c.parent.GetConfigIntValueFor(key, configtype)
+	} else if err != nil {
 		log.Infof("Failed to scan config value: %v", err)
+	} else {
+		c.putCachedValue(key, configtype, strconv.Itoa(val))
 	}
 	return val, err
 }
@@ -217,6 +304,9 @@ func (c *ConfigStore) GetWebConfig() map[string]string {
 	CheckErr(err, "Failed to create config select query")
 
 	retMap := make(map[string]string)
+	if c.parent != nil {
+		retMap = c.parent.GetWebConfig()
+	}
 	res, err := c.db.Queryx(s, v...)
 	if err != nil {
 		log.Errorf("Failed to get web config map: %v", err)
@@ -258,6 +348,7 @@ func (c *ConfigStore) SetConfigValueFor(key string, val string, configtype strin
 
 		_, err = c.db.Exec(s, v...)
 		CheckErr(err, "Failed to execute config insert query")
+		c.invalidate(key, configtype)
 		return err
 	} else {
 
@@ -275,6 +366,7 @@ func (c *ConfigStore) SetConfigValueFor(key string, val string, configtype strin
 
 		_, err = c.db.Exec(s, v...)
 		CheckErr(err, "Failed to execute config update query")
+		c.invalidate(key, configtype)
 		return err
 	}
 
@@ -305,6 +397,7 @@ func (c *ConfigStore) SetConfigIntValueFor(key string, val int, configtype strin
 
 		_, err = c.db.Exec(s, v...)
 		CheckErr(err, "Failed to execute config insert query")
+		c.invalidate(key, configtype)
 		return err
 	} else {
 
@@ -322,6 +415,7 @@ func (c *ConfigStore) SetConfigIntValueFor(key string, val int, configtype strin
 
 		_, err = c.db.Exec(s, v...)
 		CheckErr(err, "Failed to execute config update query")
+		c.invalidate(key, configtype)
 		return err
 	}
 
@@ -353,6 +447,7 @@ func NewConfigStore(db database.DatabaseConnection) (*ConfigStore, error) {
 	return &ConfigStore{
 		db:         db,
 		defaultEnv: "release",
+		cache:      make(map[string]string),
 	}, nil
 
 }
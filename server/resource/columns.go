@@ -78,10 +78,18 @@ var StandardRelations = []api2go.TableRelation{
 	api2go.NewTableRelation("timeline", "belongs_to", "world"),
 	api2go.NewTableRelation("cloud_store", "has_one", "oauth_token"),
 	api2go.NewTableRelation("site", "has_one", "cloud_store"),
+	api2go.NewTableRelation("site_revision", "belongs_to", "site"),
+	api2go.NewTableRelation("site_domain", "belongs_to", "site"),
 	api2go.NewTableRelation("mail_account", "belongs_to", "mail_server"),
 	api2go.NewTableRelation("mail_box", "belongs_to", "mail_account"),
 	api2go.NewTableRelation("mail", "belongs_to", "mail_box"),
+	api2go.NewTableRelation("workspace_member", "belongs_to", "workspace"),
+	api2go.NewTableRelationWithNames("workspace_member", "membership", "belongs_to", USER_ACCOUNT_TABLE_NAME, "member_id"),
+	api2go.NewTableRelation("role_policy", "belongs_to", "role"),
+	api2go.NewTableRelation(USER_ACCOUNT_TABLE_NAME, "has_many", "role"),
 	api2go.NewTableRelationWithNames("task", "task_executed", "has_one", USER_ACCOUNT_TABLE_NAME, "as_user_id"),
+	api2go.NewTableRelation("task_run", "has_one", "task"),
+	api2go.NewTableRelation("data_exchange_run", "has_one", "data_exchange"),
 }
 
 var SystemSmds []LoopbookFsmDescription
@@ -304,12 +312,171 @@ var SystemActions = []Action{
 				Type:   "site.storage.sync",
 				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
+					"site_id":        "$.reference_id",
 					"cloud_store_id": "$.cloud_store_id",
 					"path":           "~path",
 				},
 			},
 		},
 	},
+	{
+		Name:             "publish_site_revision",
+		Label:            "Publish",
+		OnType:           "site_revision",
+		InstanceOptional: false,
+		OutFields: []Outcome{
+			{
+				Type:   "site.revision.publish",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"site_revision_id": "$.reference_id",
+				},
+			},
+		},
+	},
+	{
+		Name:             "rollback_site_revision",
+		Label:            "Roll back to this revision",
+		OnType:           "site_revision",
+		InstanceOptional: false,
+		OutFields: []Outcome{
+			{
+				Type:   "site.revision.publish",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"site_revision_id": "$.reference_id",
+					"rollback":         true,
+				},
+			},
+		},
+	},
+	{
+		Name:             "verify_site_domain",
+		Label:            "Verify domain",
+		OnType:           "site_domain",
+		InstanceOptional: false,
+		OutFields: []Outcome{
+			{
+				Type:   "site.domain.verify",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"site_domain_id": "$.reference_id",
+				},
+			},
+		},
+	},
+	{
+		Name:             "set_workspace_config",
+		Label:            "Set a config value of the workspace",
+		OnType:           "workspace",
+		InstanceOptional: false,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "Name",
+				ColumnName: "name",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Value",
+				ColumnName: "value",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "workspace.config.set",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"slug":    "$.slug",
+					"user_id": "~user.reference_id",
+					"name":    "~name",
+					"value":   "~value",
+				},
+			},
+		},
+	},
+	{
+		Name:             "sign_site_file_url",
+		Label:            "Get a link to a file of the site",
+		OnType:           "site",
+		InstanceOptional: false,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "Path",
+				ColumnName: "path",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Expires in seconds",
+				ColumnName: "expires_in",
+				ColumnType: "measurement",
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "url.sign",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"site_id":    "$.reference_id",
+					"path":       "~path",
+					"expires_in": "~expires_in",
+				},
+			},
+		},
+	},
+	{
+		Name:             "sign_asset_url",
+		Label:            "Get a link to download or upload a file of a row",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "Table name",
+				ColumnName: "table_name",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Resource id",
+				ColumnName: "resource_id",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Column name",
+				ColumnName: "column_name",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Method",
+				ColumnName: "method",
+				ColumnType: "label",
+			},
+			{
+				Name:       "File name",
+				ColumnName: "file_name",
+				ColumnType: "label",
+			},
+			{
+				Name:       "Expires in seconds",
+				ColumnName: "expires_in",
+				ColumnType: "measurement",
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "url.sign",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"table_name":  "~table_name",
+					"resource_id": "~resource_id",
+					"column_name": "~column_name",
+					"method":      "~method",
+					"file_name":   "~file_name",
+					"expires_in":  "~expires_in",
+				},
+			},
+		},
+	},
 	{
 		Name:             "sync_column_storage",
 		Label:            "Sync column storage",
@@ -352,6 +519,55 @@ var SystemActions = []Action{
 			},
 		},
 	},
+	{
+		Name:             "run_exchange",
+		Label:            "Run exchange",
+		OnType:           "data_exchange",
+		InstanceOptional: false,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "exchange.run",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"data_exchange_id": "$.reference_id",
+					"user":             "~user",
+				},
+			},
+		},
+	},
+	{
+		Name:             "run_state_timers",
+		Label:            "Run state machine timers",
+		OnType:           "smd",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "smd.timers.run",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"user": "~user",
+				},
+			},
+		},
+	},
+	{
+		Name:             "run_task",
+		Label:            "Run now",
+		OnType:           "task",
+		InstanceOptional: false,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "task.run",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"task_id": "$.reference_id",
+				},
+			},
+		},
+	},
 	{
 		Name:             "restart_daptin",
 		Label:            "Restart system",
@@ -517,6 +733,48 @@ var SystemActions = []Action{
 			},
 		},
 	},
+	{
+		Name:             "export_stream",
+		Label:            "Export stream data",
+		OnType:           "stream",
+		InstanceOptional: false,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "format",
+				ColumnName: "format",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "__stream_export",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"stream_name": "$.stream_name",
+					"format":      "~format",
+					"user":        "~user",
+				},
+			},
+		},
+	},
+	{
+		Name:             "refresh_stream",
+		Label:            "Refresh materialised stream",
+		OnType:           "stream",
+		InstanceOptional: false,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "stream.refresh",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"stream_name":  "$.stream_name",
+					"workspace_id": "~workspace_id",
+				},
+			},
+		},
+	},
 	{
 		Name:             "import_data",
 		Label:            "Import data from dump",
@@ -599,6 +857,56 @@ var SystemActions = []Action{
 			},
 		},
 	},
+	{
+		Name:             "preview_upload_table",
+		Label:            "Preview table of xls or csv upload",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "XLSX or CSV file",
+				ColumnName: "data_file",
+				ColumnType: "file.xls|xlsx|csv",
+				IsNullable: false,
+			},
+			{
+				Name:       "Entity name",
+				ColumnName: "entity_name",
+				ColumnType: "label",
+				IsNullable: false,
+			},
+			{
+				Name:       "Locale of dates",
+				ColumnName: "locale",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Column mapping",
+				ColumnName: "column_mapping",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "entity_name",
+				Tags:       "required",
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "__upload_file_preview",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"data_file":      "~data_file",
+					"entity_name":    "~entity_name",
+					"locale":         "~locale",
+					"column_mapping": "~column_mapping",
+				},
+			},
+		},
+	},
 	{
 		Name:             "upload_xls_to_system_schema",
 		Label:            "Upload xls to entity",
@@ -629,6 +937,36 @@ var SystemActions = []Action{
 				ColumnType: "truefalse",
 				IsNullable: false,
 			},
+			{
+				Name:       "Only validate, do not import",
+				ColumnName: "dry_run",
+				ColumnType: "truefalse",
+				IsNullable: true,
+			},
+			{
+				Name:       "Import nothing if any row fails",
+				ColumnName: "all_or_nothing",
+				ColumnType: "truefalse",
+				IsNullable: true,
+			},
+			{
+				Name:       "Update rows with the same value in column",
+				ColumnName: "upsert_column",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Column mapping",
+				ColumnName: "column_mapping",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "Locale of dates",
+				ColumnName: "locale",
+				ColumnType: "label",
+				IsNullable: true,
+			},
 		},
 		Validations: []ColumnTag{
 			{
@@ -645,6 +983,11 @@ var SystemActions = []Action{
 					"entity_name":          "~entity_name",
 					"add_missing_columns":  "~add_missing_columns",
 					"create_if_not_exists": "~create_if_not_exists",
+					"dry_run":              "~dry_run",
+					"all_or_nothing":       "~all_or_nothing",
+					"upsert_column":        "~upsert_column",
+					"column_mapping":       "~column_mapping",
+					"locale":               "~locale",
 				},
 			},
 		},
@@ -679,6 +1022,36 @@ var SystemActions = []Action{
 				ColumnType: "truefalse",
 				IsNullable: false,
 			},
+			{
+				Name:       "Only validate, do not import",
+				ColumnName: "dry_run",
+				ColumnType: "truefalse",
+				IsNullable: true,
+			},
+			{
+				Name:       "Import nothing if any row fails",
+				ColumnName: "all_or_nothing",
+				ColumnType: "truefalse",
+				IsNullable: true,
+			},
+			{
+				Name:       "Update rows with the same value in column",
+				ColumnName: "upsert_column",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Column mapping",
+				ColumnName: "column_mapping",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "Locale of dates",
+				ColumnName: "locale",
+				ColumnType: "label",
+				IsNullable: true,
+			},
 		},
 		Validations: []ColumnTag{
 			{
@@ -695,6 +1068,11 @@ var SystemActions = []Action{
 					"entity_name":          "~entity_name",
 					"add_missing_columns":  "~add_missing_columns",
 					"create_if_not_exists": "~create_if_not_exists",
+					"dry_run":              "~dry_run",
+					"all_or_nothing":       "~all_or_nothing",
+					"upsert_column":        "~upsert_column",
+					"column_mapping":       "~column_mapping",
+					"locale":               "~locale",
 				},
 			},
 		},
@@ -882,22 +1260,30 @@ var SystemActions = []Action{
 				ColumnType: "password",
 				IsNullable: false,
 			},
+			{
+				Name:       "workspace",
+				ColumnName: "workspace",
+				ColumnType: "label",
+				IsNullable: true,
+			},
 		},
 		OutFields: []Outcome{
 			{
 				Type:   "jwt.token",
 				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
-					"email":    "~email",
-					"password": "~password",
+					"email":     "~email",
+					"password":  "~password",
+					"workspace": "~workspace",
 				},
 			},
 			{
 				Type:   "jwt.token",
 				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
-					"email":    "~email",
-					"password": "~password",
+					"email":     "~email",
+					"password":  "~password",
+					"workspace": "~workspace",
 				},
 			},
 		},
@@ -1075,10 +1461,10 @@ var SystemActions = []Action{
 					"name":              "!'Export ' + subject.table_name + ' to excel sheet'",
 					"source_attributes": "!JSON.stringify({name: subject.table_name})",
 					"source_type":       "self",
-					"target_type":       "gsheet-append",
+					"target_type":       "gsheet",
 					"options":           "!JSON.stringify({hasHeader: true})",
-					"attributes":        "!JSON.stringify([{SourceColumn: '$self.description', TargetColumn: 'Task description'}])",
-					"target_attributes": "!JSON.stringify({sheetUrl: 'https://content-sheets.googleapis.com/v4/spreadsheets/' + sheet_id + '/values/A1:append', appKey: app_key})",
+					"attributes":        "[]",
+					"target_attributes": "!JSON.stringify({sheetId: sheet_id, appKey: app_key})",
 				},
 			},
 		},
@@ -1168,34 +1554,104 @@ var StandardTables = []TableInfo{
 				ColumnType: "label",
 			},
 			{
-				Name:       "entity_name",
-				ColumnName: "entity_name",
-				DataType:   "varchar(100)",
-				ColumnType: "label",
+				Name:       "entity_name",
+				ColumnName: "entity_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "schedule",
+				ColumnName: "schedule",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "active",
+				ColumnName: "active",
+				DataType:   "bool",
+				ColumnType: "truefalse",
+			},
+			{
+				Name:       "attributes",
+				ColumnName: "attributes",
+				DataType:   "text",
+				ColumnType: "json",
+			},
+			{
+				Name:       "job_type",
+				ColumnName: "job_type",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "on_failure",
+				ColumnName: "on_failure",
+				DataType:   "text",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     "task_run",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-history",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "task_name",
+				ColumnName: "task_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "triggered_by",
+				ColumnName: "triggered_by",
+				DataType:   "varchar(20)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "started_at",
+				ColumnName: "started_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "ended_at",
+				ColumnName: "ended_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+			{
+				Name:         "duration_ms",
+				ColumnName:   "duration_ms",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
 			},
 			{
-				Name:       "schedule",
-				ColumnName: "schedule",
-				DataType:   "varchar(100)",
+				Name:       "outcome",
+				ColumnName: "outcome",
+				DataType:   "varchar(20)",
 				ColumnType: "label",
+				IsIndexed:  true,
 			},
 			{
-				Name:       "active",
-				ColumnName: "active",
-				DataType:   "bool",
-				ColumnType: "truefalse",
+				Name:       "error",
+				ColumnName: "error",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
 			},
 			{
-				Name:       "attributes",
-				ColumnName: "attributes",
+				Name:       "response",
+				ColumnName: "response",
 				DataType:   "text",
 				ColumnType: "json",
-			},
-			{
-				Name:       "job_type",
-				ColumnName: "job_type",
-				DataType:   "varchar(100)",
-				ColumnType: "label",
+				IsNullable: true,
 			},
 		},
 	},
@@ -1691,6 +2147,97 @@ var StandardTables = []TableInfo{
 			},
 		},
 	},
+	{
+		TableName:     "data_exchange_run",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-history",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "exchange_name",
+				ColumnName: "exchange_name",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "direction",
+				ColumnName: "direction",
+				DataType:   "varchar(10)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "started_at",
+				ColumnName: "started_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "ended_at",
+				ColumnName: "ended_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+			{
+				Name:         "duration_ms",
+				ColumnName:   "duration_ms",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
+			},
+			{
+				Name:       "outcome",
+				ColumnName: "outcome",
+				DataType:   "varchar(20)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:         "response_status",
+				ColumnName:   "response_status",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
+			},
+			{
+				Name:         "rows_read",
+				ColumnName:   "rows_read",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
+			},
+			{
+				Name:         "rows_written",
+				ColumnName:   "rows_written",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
+			},
+			{
+				Name:         "rows_failed",
+				ColumnName:   "rows_failed",
+				DataType:     "int(11)",
+				ColumnType:   "measurement",
+				DefaultValue: "0",
+			},
+			{
+				Name:       "sync_cursor",
+				ColumnName: "sync_cursor",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "error",
+				ColumnName: "error",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+		},
+	},
 	{
 		TableName:     "oauth_token",
 		IsHidden:      true,
@@ -1796,6 +2343,99 @@ var StandardTables = []TableInfo{
 				DataType:     "bool",
 				DefaultValue: "false",
 			},
+			{
+				Name:         "site_type",
+				ColumnName:   "site_type",
+				ColumnType:   "label",
+				DataType:     "varchar(20)",
+				DefaultValue: "'static'",
+			},
+			{
+				Name:       "serve_config",
+				ColumnName: "serve_config",
+				ColumnType: "json",
+				DataType:   "text",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     "site_revision",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-history",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "path",
+				ColumnName: "path",
+				ColumnType: "label",
+				DataType:   "varchar(500)",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "contents",
+				ColumnName: "contents",
+				ColumnType: "content",
+				DataType:   "text",
+			},
+			{
+				Name:         "status",
+				ColumnName:   "status",
+				ColumnType:   "label",
+				DataType:     "varchar(20)",
+				DefaultValue: "'draft'",
+				IsIndexed:    true,
+			},
+			{
+				Name:       "published_at",
+				ColumnName: "published_at",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     "site_domain",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-globe",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "hostname",
+				ColumnName: "hostname",
+				ColumnType: "label",
+				DataType:   "varchar(255)",
+				IsIndexed:  true,
+			},
+			{
+				Name:         "verification_method",
+				ColumnName:   "verification_method",
+				ColumnType:   "label",
+				DataType:     "varchar(10)",
+				DefaultValue: "'dns'",
+			},
+			{
+				Name:       "verification_token",
+				ColumnName: "verification_token",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsNullable: true,
+			},
+			{
+				Name:       "verification_proof",
+				ColumnName: "verification_proof",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsNullable: true,
+			},
+			{
+				Name:       "verified_at",
+				ColumnName: "verified_at",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsNullable: true,
+			},
 		},
 	},
 	{
@@ -2097,6 +2737,132 @@ var StandardTables = []TableInfo{
 			},
 		},
 	},
+	{
+		TableName:     "workspace",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-building",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "slug",
+				ColumnName: "slug",
+				ColumnType: "label",
+				DataType:   "varchar(63)",
+				IsIndexed:  true,
+				IsUnique:   true,
+			},
+			{
+				Name:         "enable",
+				ColumnName:   "enable",
+				ColumnType:   "truefalse",
+				DataType:     "bool",
+				DefaultValue: "true",
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "slug",
+				Tags:       "db_unique",
+			},
+		},
+	},
+	{
+		TableName:     "role",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-user-tag",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsIndexed:  true,
+				IsUnique:   true,
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "name",
+				Tags:       "db_unique",
+			},
+		},
+	},
+	{
+		TableName:     "role_policy",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-shield-alt",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "table_name",
+				ColumnName: "table_name",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "action_name",
+				ColumnName: "action_name",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsNullable: true,
+			},
+			{
+				Name:         "operations",
+				ColumnName:   "operations",
+				ColumnType:   "label",
+				DataType:     "varchar(100)",
+				DefaultValue: "'read'",
+			},
+			{
+				Name:         "ownership",
+				ColumnName:   "ownership",
+				ColumnType:   "label",
+				DataType:     "varchar(10)",
+				DefaultValue: "'any'",
+			},
+			{
+				Name:         "effect",
+				ColumnName:   "effect",
+				ColumnType:   "label",
+				DataType:     "varchar(10)",
+				DefaultValue: "'allow'",
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "ownership",
+				Tags:       "oneof=any own group",
+			},
+			{
+				ColumnName: "effect",
+				Tags:       "oneof=allow deny",
+			},
+		},
+	},
+	{
+		TableName:     "workspace_member",
+		IsHidden:      true,
+		DefaultGroups: adminsGroup,
+		Icon:          "fa-id-badge",
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:         "role",
+				ColumnName:   "role",
+				ColumnType:   "label",
+				DataType:     "varchar(20)",
+				DefaultValue: "'member'",
+			},
+		},
+	},
 }
 
 var StandardMarketplaces = []Marketplace{
@@ -2185,6 +2951,8 @@ type TableInfo struct {
 	DefaultGroups          []string `db:"default_groups"`
 	Validations            []ColumnTag
 	Conformations          []ColumnTag
+	JsonIndexes            []JsonIndex
+	UploadLimits           []UploadLimit
 	DefaultOrder           string
 	Icon                   string
 }
@@ -2,3 +2,5 @@ package resource
 
 const USER_ACCOUNT_TABLE_NAME = "user_account"
 const USER_ACCOUNT_ID_COLUMN = "user_account_id"
+const WORKSPACE_TABLE_NAME = "workspace"
+const WORKSPACE_ID_COLUMN = "workspace_id"
@@ -0,0 +1,445 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/artpar/conform"
+	"github.com/daptin/daptin/server/columntypes"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/go-playground/validator.v9"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportOptions change how uploaded rows are written. DryRun only validates the rows and reports what would happen,
+// AllOrNothing writes the rows in one transaction which is rolled back when any row fails, UpsertColumn updates the
+// row with the same value in that column instead of inserting a new one and ColumnMapping renames the columns of the
+// file to the columns of the table, a column mapped to "" is not imported. Locale decides the order of day and month
+// in dates like 01/02/2006, DateFormats are the layouts the values of date columns are read with and the values of
+// NumberColumns may carry a currency, a percent sign or thousands separators
+type ImportOptions struct {
+	DryRun        bool
+	AllOrNothing  bool
+	UpsertColumn  string
+	ColumnMapping map[string]string
+	Locale        string
+	DateFormats   map[string]string
+	NumberColumns []string
+}
+
+// ImportRowError lists what is wrong with one row, Row starts at 1 for the first row after the header
+type ImportRowError struct {
+	Row    int
+	Errors []string
+}
+
+// ImportReport is the outcome of an import, with a dry run Created and Updated are the rows which would be
+type ImportReport struct {
+	Entity         string
+	DryRun         bool
+	RolledBack     bool
+	Rows           int
+	Created        int
+	Updated        int
+	Failed         int
+	IgnoredColumns []string
+	RowErrors      []ImportRowError
+}
+
+// ImportOptionsFromFields reads the import options from the in fields of an upload action
+func ImportOptionsFromFields(inFields map[string]interface{}) (ImportOptions, error) {
+
+	options := ImportOptions{
+		DryRun:       fieldIsTrue(inFields["dry_run"]),
+		AllOrNothing: fieldIsTrue(inFields["all_or_nothing"]),
+	}
+	options.UpsertColumn, _ = inFields["upsert_column"].(string)
+	options.UpsertColumn = strings.TrimSpace(options.UpsertColumn)
+	options.Locale, _ = inFields["locale"].(string)
+	options.Locale = strings.TrimSpace(options.Locale)
+
+	switch mapping := inFields["column_mapping"].(type) {
+	case map[string]interface{}:
+		options.ColumnMapping = make(map[string]string)
+		for from, to := range mapping {
+			options.ColumnMapping[from], _ = to.(string)
+		}
+	case string:
+		if strings.TrimSpace(mapping) != "" {
+			err := json.Unmarshal([]byte(mapping), &options.ColumnMapping)
+			if err != nil {
+				return options, fmt.Errorf("column_mapping is not a json object of column names: %v", err)
+			}
+		}
+	}
+
+	return options, nil
+}
+
+func fieldIsTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1" || v == "on"
+	}
+	return false
+}
+
+// MappedColumn returns the column of the table a column of the file is written to, "" when it is not imported
+func (options ImportOptions) MappedColumn(fileColumn string) string {
+	if len(options.ColumnMapping) == 0 {
+		return SmallSnakeCaseText(fileColumn)
+	}
+	for from, to := range options.ColumnMapping {
+		if from == fileColumn || SmallSnakeCaseText(from) == SmallSnakeCaseText(fileColumn) {
+			return to
+		}
+	}
+	return SmallSnakeCaseText(fileColumn)
+}
+
+// prepareImportRows maps, conforms and validates the rows. The rows which are not valid are nil in the result
+func prepareImportRows(rows []map[string]interface{}, crud *DbResource, options ImportOptions, report *ImportReport, req api2go.Request) []map[string]interface{} {
+
+	tableInfo := crud.TableInfo()
+	tableName := tableInfo.TableName
+
+	standardColumns := make(map[string]bool)
+	for _, column := range StandardColumns {
+		standardColumns[column.ColumnName] = true
+	}
+
+	ignored := make(map[string]bool)
+	prepared := make([]map[string]interface{}, len(rows))
+
+	for i, row := range rows {
+
+		values := make(map[string]interface{})
+		for fileColumn, value := range row {
+			column := options.MappedColumn(fileColumn)
+			if column == "" {
+				continue
+			}
+			if _, ok := tableInfo.GetColumnByName(column); !ok {
+				// a header like "name" is snake cased to col_name, which is not a column of a table made by hand
+				column = fileColumn
+			}
+			if _, ok := tableInfo.GetColumnByName(column); !ok || column == "id" {
+				ignored[fileColumn] = true
+				continue
+			}
+			values[column] = value
+		}
+
+		for column, format := range options.DateFormats {
+			if value, ok := values[column]; ok {
+				values[column] = importDateValue(value, format)
+			}
+		}
+		for _, column := range options.NumberColumns {
+			if value, ok := values[column].(string); ok {
+				if number, ok := fieldtypes.ParseNumber(value, options.Locale); ok {
+					values[column] = number
+				}
+			}
+		}
+
+		for _, conformation := range tableInfo.Conformations {
+			value, ok := values[conformation.ColumnName].(string)
+			if !ok {
+				continue
+			}
+			values[conformation.ColumnName] = conform.TransformString(value, conformation.Tags)
+		}
+
+		exists := false
+		existingReferenceId := ""
+		if options.UpsertColumn != "" && !isEmptyImportValue(values[options.UpsertColumn]) {
+			existing, err := crud.GetObjectByWhereClause(tableName, options.UpsertColumn, values[options.UpsertColumn], req.PlainRequest)
+			exists = err == nil && existing != nil
+			if exists {
+				existingReferenceId, _ = existing["reference_id"].(string)
+			}
+		}
+
+		errs := make([]string, 0)
+		for _, column := range tableInfo.Columns {
+			value, present := values[column.ColumnName]
+			if exists || (present && !isEmptyImportValue(value)) {
+				continue
+			}
+			if !column.IsNullable && !column.IsForeignKey && column.DefaultValue == "" && !standardColumns[column.ColumnName] {
+				errs = append(errs, column.ColumnName+": required")
+			}
+		}
+
+		for _, validation := range tableInfo.Validations {
+			value, ok := values[validation.ColumnName]
+			if !ok || isEmptyImportValue(value) {
+				continue
+			}
+			tags, dataValidatorTags := SplitValidationTags(validation.Tags)
+			if tags != "" {
+				err := ValidatorInstance.VarWithValue(value, values, tags)
+				if validationErrors, ok := err.(validator.ValidationErrors); ok {
+					errs = append(errs, validation.ColumnName+": "+validationErrors[0].Tag())
+				} else if err != nil {
+					errs = append(errs, validation.ColumnName+": "+err.Error())
+				}
+			}
+			if !options.DryRun {
+				// the rows written are checked against the stored rows by the data validation middleware
+				continue
+			}
+			// a row which updates a stored row is checked as that row, so it can keep its own values
+			obj := values
+			if existingReferenceId != "" {
+				obj = map[string]interface{}{"reference_id": existingReferenceId}
+				for column, columnValue := range values {
+					obj[column] = columnValue
+				}
+			}
+			for _, dataValidatorTag := range dataValidatorTags {
+				valid, err := dataValidatorTag.Validator(crud, &req, validation.ColumnName, value, dataValidatorTag.Param, obj)
+				if err != nil {
+					errs = append(errs, validation.ColumnName+": "+err.Error())
+				} else if !valid {
+					errs = append(errs, validation.ColumnName+": "+dataValidatorTag.Tag)
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			report.Failed += 1
+			report.RowErrors = append(report.RowErrors, ImportRowError{Row: i + 1, Errors: errs})
+			continue
+		}
+
+		if options.DryRun {
+			if exists {
+				report.Updated += 1
+			} else {
+				report.Created += 1
+			}
+		}
+		prepared[i] = values
+	}
+
+	for column := range ignored {
+		report.IgnoredColumns = append(report.IgnoredColumns, column)
+	}
+	sort.Strings(report.IgnoredColumns)
+
+	return prepared
+}
+
+// importDateValue rewrites a date read with the layout of the file to the layout of the database
+func importDateValue(value interface{}, format string) interface{} {
+	s, ok := value.(string)
+	if !ok || strings.TrimSpace(s) == "" {
+		return value
+	}
+	t, err := time.Parse(format, strings.TrimSpace(s))
+	if err != nil {
+		return value
+	}
+	if strings.Contains(format, "15") || strings.Contains(format, "3:04") {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return t.Format("2006-01-02")
+}
+
+func isEmptyImportValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// ImportRows validates the rows and writes the valid ones into the table of crud according to the options
+func ImportRows(rows []map[string]interface{}, crud *DbResource, options ImportOptions, req api2go.Request) ImportReport {
+
+	report := ImportReport{
+		Entity:         crud.TableInfo().TableName,
+		DryRun:         options.DryRun,
+		Rows:           len(rows),
+		IgnoredColumns: []string{},
+		RowErrors:      []ImportRowError{},
+	}
+
+	prepared := prepareImportRows(rows, crud, options, &report, req)
+	if options.DryRun {
+		return report
+	}
+	if options.AllOrNothing && report.Failed > 0 {
+		report.RolledBack = true
+		return report
+	}
+
+	writer := crud
+	var commit func() error
+	var rollback func() error
+	if options.AllOrNothing {
+		tx, err := crud.connection.Beginx()
+		if err != nil {
+			report.RolledBack = true
+			report.RowErrors = append(report.RowErrors, ImportRowError{Errors: []string{err.Error()}})
+			return report
+		}
+		writer = NewFromDbResourceWithTransaction(crud, tx)
+		commit = tx.Commit
+		rollback = tx.Rollback
+	}
+
+	uniqueColumns := make([]api2go.ColumnInfo, 0)
+	for _, column := range crud.TableInfo().Columns {
+		if column.IsUnique {
+			uniqueColumns = append(uniqueColumns, column)
+		}
+	}
+
+	for i, row := range prepared {
+		if row == nil {
+			continue
+		}
+
+		updated, err := writeImportRow(writer, row, options, uniqueColumns, req)
+		if err != nil {
+			report.Failed += 1
+			report.RowErrors = append(report.RowErrors, ImportRowError{Row: i + 1, Errors: []string{err.Error()}})
+			if options.AllOrNothing {
+				CheckErr(rollback(), "Failed to rollback import into [%v]", report.Entity)
+				report.RolledBack = true
+				report.Created = 0
+				report.Updated = 0
+				return report
+			}
+			continue
+		}
+
+		if updated {
+			report.Updated += 1
+		} else {
+			report.Created += 1
+		}
+	}
+
+	if commit != nil {
+		err := commit()
+		if err != nil {
+			report.RolledBack = true
+			report.Created = 0
+			report.Updated = 0
+			report.RowErrors = append(report.RowErrors, ImportRowError{Errors: []string{err.Error()}})
+		}
+	}
+
+	log.Infof("Imported [%v]: %d created, %d updated, %d failed", report.Entity, report.Created, report.Updated, report.Failed)
+	return report
+}
+
+// writeImportRow inserts the row, or updates the existing row by the upsert column. Without an upsert column a row
+// which fails to insert is updated by the first unique column it has a value for
+func writeImportRow(crud *DbResource, row map[string]interface{}, options ImportOptions, uniqueColumns []api2go.ColumnInfo, req api2go.Request) (bool, error) {
+
+	tableName := crud.TableInfo().TableName
+
+	if options.UpsertColumn != "" && !isEmptyImportValue(row[options.UpsertColumn]) {
+		existingRow, err := crud.GetObjectByWhereClause(tableName, options.UpsertColumn, row[options.UpsertColumn], req.PlainRequest)
+		if err != nil {
+			return false, err
+		}
+		if existingRow != nil {
+			return true, updateImportRow(crud, existingRow, row, req)
+		}
+	}
+
+	model := api2go.NewApi2GoModelWithData(tableName, nil, int64(crud.TableInfo().DefaultPermission), nil, row)
+	_, createErr := crud.Create(model, req)
+	if createErr == nil || options.UpsertColumn != "" {
+		return false, createErr
+	}
+
+	for _, uniqueColumn := range uniqueColumns {
+		value, ok := row[uniqueColumn.ColumnName]
+		if !ok || isEmptyImportValue(value) {
+			continue
+		}
+		log.Infof("Try to update data by unique column: %v", uniqueColumn.ColumnName)
+		existingRow, err := crud.GetObjectByWhereClause(tableName, uniqueColumn.ColumnName, value, req.PlainRequest)
+		if err != nil || existingRow == nil {
+			continue
+		}
+		err = updateImportRow(crud, existingRow, row, req)
+		if err != nil {
+			log.Errorf("Failed to update table [%v] update row by unique column [%v]: %v", tableName, uniqueColumn.ColumnName, err)
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, createErr
+}
+
+func updateImportRow(crud *DbResource, existingRow map[string]interface{}, row map[string]interface{}, req api2go.Request) error {
+	// the changes of a model are what is set after it was made from the existing row
+	obj := api2go.NewApi2GoModelWithData(crud.TableInfo().TableName, nil, 0, nil, existingRow)
+	obj.SetAttributes(row)
+	_, err := crud.Update(obj, req)
+	return err
+}
+
+// ImportReportResponses notifies the result of the imports and returns the reports to the client
+func ImportReportResponses(reports []ImportReport) []ActionResponse {
+
+	messages := make([]string, 0)
+	failed := false
+	for _, report := range reports {
+		switch {
+		case report.DryRun:
+			messages = append(messages, fmt.Sprintf("[%v] %d rows would be created, %d updated and %d are not valid", report.Entity, report.Created, report.Updated, report.Failed))
+		case report.RolledBack:
+			messages = append(messages, fmt.Sprintf("[%v] nothing was imported, %d rows are not valid", report.Entity, report.Failed))
+		default:
+			messages = append(messages, fmt.Sprintf("[%v] %d rows created, %d updated and %d failed", report.Entity, report.Created, report.Updated, report.Failed))
+		}
+		if report.Failed > 0 || report.RolledBack {
+			failed = true
+		}
+	}
+
+	notification := NewClientNotification("success", strings.Join(messages, ", "), "Imported")
+	if failed {
+		notification = NewClientNotification("warning", strings.Join(messages, ", "), "Import has errors")
+	}
+
+	return []ActionResponse{
+		NewActionResponse("client.notify", notification),
+		NewActionResponse("import.report", map[string]interface{}{
+			"reports": reports,
+		}),
+	}
+}
+
+// DryRunImport validates uploaded rows against the entity, rows for an entity which does not exist yet are only counted
+func DryRunImport(cruds map[string]*DbResource, table TableInfo, rows []map[string]interface{}, options ImportOptions) []ActionResponse {
+
+	options.DryRun = true
+	crud, ok := cruds[table.TableName]
+	if !ok {
+		return ImportReportResponses([]ImportReport{{
+			Entity:         table.TableName,
+			DryRun:         true,
+			Rows:           len(rows),
+			Created:        len(rows),
+			IgnoredColumns: []string{},
+			RowErrors:      []ImportRowError{},
+		}})
+	}
+
+	return ImportReportResponses([]ImportReport{ImportRows(rows, crud, options, adminImportRequest(crud.db, cruds))})
+}
@@ -0,0 +1,151 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newImportTestResource(t *testing.T) (*sqlx.DB, *DbResource) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table contact (id integer primary key, reference_id varchar(40), email varchar(100) not null unique, name varchar(100) not null, age int)",
+		"insert into contact (reference_id, email, name) values ('c1', 'a@example.com', 'A')",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	table := TableInfo{
+		TableName: "contact",
+		Columns: []api2go.ColumnInfo{
+			{Name: "id", ColumnName: "id", ColumnType: "id"},
+			{Name: "email", ColumnName: "email", ColumnType: "email", IsUnique: true},
+			{Name: "name", ColumnName: "name", ColumnType: "label"},
+			{Name: "age", ColumnName: "age", ColumnType: "measurement", IsNullable: true},
+		},
+	}
+	cruds := make(map[string]*DbResource)
+	crud := NewDbResource(api2go.NewApi2GoModel(table.TableName, table.Columns, 0, nil), db, nil, cruds, nil, table)
+	cruds[table.TableName] = crud
+
+	return db, crud
+}
+
+func TestImportOptionsFromFields(t *testing.T) {
+
+	options, err := ImportOptionsFromFields(map[string]interface{}{
+		"dry_run":        "true",
+		"all_or_nothing": true,
+		"upsert_column":  " email ",
+		"column_mapping": `{"E-mail": "email", "Notes": ""}`,
+	})
+	if err != nil {
+		t.Fatalf("failed to read options: %v", err)
+	}
+	if !options.DryRun || !options.AllOrNothing || options.UpsertColumn != "email" {
+		t.Errorf("unexpected options: %+v", options)
+	}
+	if options.MappedColumn("e-mail") != "email" || options.MappedColumn("Notes") != "" || options.MappedColumn("Full Name") != "full_name" {
+		t.Errorf("unexpected column mapping: %v", options.ColumnMapping)
+	}
+
+	_, err = ImportOptionsFromFields(map[string]interface{}{"column_mapping": "email"})
+	if err == nil {
+		t.Errorf("expected a column mapping which is not json to be rejected")
+	}
+}
+
+func TestImportDryRunReportsWithoutWriting(t *testing.T) {
+
+	db, crud := newImportTestResource(t)
+	defer db.Close()
+
+	rows := []map[string]interface{}{
+		{"E-mail": "a@example.com", "name": "A2"},
+		{"E-mail": "b@example.com", "name": "B", "age": "1,200", "Notes": "new"},
+		{"E-mail": "c@example.com", "name": ""},
+	}
+	options := ImportOptions{
+		DryRun:        true,
+		UpsertColumn:  "email",
+		ColumnMapping: map[string]string{"E-mail": "email"},
+		NumberColumns: []string{"age"},
+	}
+
+	report := ImportRows(rows, crud, options, api2go.Request{})
+
+	if report.Rows != 3 || report.Updated != 1 || report.Created != 1 || report.Failed != 1 {
+		t.Errorf("expected one update, one create and one failure, got %+v", report)
+	}
+	expectedErrors := []ImportRowError{{Row: 3, Errors: []string{"name: required"}}}
+	if !reflect.DeepEqual(report.RowErrors, expectedErrors) {
+		t.Errorf("expected the third row to miss its name, got %v", report.RowErrors)
+	}
+	if !reflect.DeepEqual(report.IgnoredColumns, []string{"Notes"}) {
+		t.Errorf("expected the notes to be ignored, got %v", report.IgnoredColumns)
+	}
+
+	var count int
+	err := db.Get(&count, "select count(*) from contact")
+	if err != nil || count != 1 {
+		t.Errorf("expected a dry run to not write, found %d rows: %v", count, err)
+	}
+}
+
+func TestImportAllOrNothingWritesNothingWhenARowIsInvalid(t *testing.T) {
+
+	db, crud := newImportTestResource(t)
+	defer db.Close()
+
+	rows := []map[string]interface{}{
+		{"email": "b@example.com", "name": "B"},
+		{"email": "c@example.com"},
+	}
+
+	report := ImportRows(rows, crud, ImportOptions{AllOrNothing: true}, api2go.Request{})
+
+	if !report.RolledBack || report.Created != 0 || report.Failed != 1 {
+		t.Errorf("expected the import to be rolled back, got %+v", report)
+	}
+	var count int
+	err := db.Get(&count, "select count(*) from contact")
+	if err != nil || count != 1 {
+		t.Errorf("expected no row to be written, found %d rows: %v", count, err)
+	}
+}
+
+func TestImportDryRunChecksStoredRows(t *testing.T) {
+
+	db, crud := newImportTestResource(t)
+	defer db.Close()
+	crud.tableInfo.Validations = []ColumnTag{{ColumnName: "email", Tags: "email,db_unique"}}
+
+	rows := []map[string]interface{}{
+		{"email": "a@example.com", "name": "A2"},
+		{"email": "b@example.com", "name": "B"},
+	}
+	req := api2go.Request{PlainRequest: httptest.NewRequest("POST", "/action/contact/upload_csv_to_system_schema", nil)}
+
+	report := ImportRows(rows, crud, ImportOptions{DryRun: true}, req)
+	expectedErrors := []ImportRowError{{Row: 1, Errors: []string{"email: db_unique"}}}
+	if report.Created != 1 || report.Failed != 1 || !reflect.DeepEqual(report.RowErrors, expectedErrors) {
+		t.Errorf("expected the stored email to be reported by the dry run, got %+v", report)
+	}
+
+	report = ImportRows(rows, crud, ImportOptions{DryRun: true, UpsertColumn: "email"}, req)
+	if report.Updated != 1 || report.Created != 1 || report.Failed != 0 {
+		t.Errorf("expected a row updating the stored row to keep its email, got %+v", report)
+	}
+}
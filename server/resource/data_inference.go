@@ -0,0 +1,255 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/columntypes"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// referenceOverlap is the share of the distinct values of a column which have to be found in a column of another
+// table to propose a reference to it
+const referenceOverlap = 0.9
+
+// referenceSampleSize is the most distinct values looked up in the other tables
+const referenceSampleSize = 200
+
+// InferredColumn is the column proposed for a column of an uploaded file, Reference is set when the values of the
+// column are found in a column of an existing table
+type InferredColumn struct {
+	FileColumn string
+	Column     api2go.ColumnInfo
+	Inference  fieldtypes.Inference
+	Reference  *ColumnReference
+}
+
+// ColumnReference is a column of an existing table which holds most of the values of an uploaded column
+type ColumnReference struct {
+	Table   string
+	Column  string
+	Overlap float64
+}
+
+// InferTableInfo proposes the table for the rows of an upload, the columns of the file are renamed by the column
+// mapping of the options and the dates are read in the order of day and month of the locale. References are only
+// looked for in the tables the user can read
+func InferTableInfo(tableName string, columnNames []string, rows []map[string]interface{}, options ImportOptions, locale string, cruds map[string]*DbResource, sessionUser *auth.SessionUser) (TableInfo, []InferredColumn) {
+
+	table := TableInfo{
+		TableName: SmallSnakeCaseText(tableName),
+		Columns:   make([]api2go.ColumnInfo, 0),
+	}
+	inferred := make([]InferredColumn, 0)
+
+	for _, fileColumn := range columnNames {
+
+		columnName := options.MappedColumn(fileColumn)
+		if fileColumn == "" || columnName == "" {
+			continue
+		}
+
+		values := make([]string, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, cellString(row[fileColumn]))
+		}
+
+		inference := fieldtypes.InferType(fileColumn, values, locale)
+		log.Infof("Column %v was identified as %v", fileColumn, inference.EntityType)
+
+		column := api2go.ColumnInfo{
+			Name:       fileColumn,
+			ColumnName: columnName,
+			ColumnType: "label",
+			DataType:   "varchar(100)",
+			IsNullable: inference.Nullable,
+			IsUnique:   inference.Unique && !inference.Nullable && len(rows) > 1,
+			IsIndexed:  inference.Distinct > len(rows)/10,
+		}
+		if columnType, ok := EntityTypeToColumnTypeMap[inference.EntityType]; ok {
+			column.ColumnType = columnType
+			column.DataType = EntityTypeToDataTypeMap[inference.EntityType]
+		}
+		if strings.Index(column.DataType, "varchar") == 0 {
+			column.DataType = fmt.Sprintf("varchar(%v)", inference.MaxLength+100)
+		}
+		for _, option := range inference.Options {
+			column.Options = append(column.Options, api2go.ValueOptions{
+				ValueType: "string",
+				Value:     option,
+				Label:     option,
+			})
+		}
+
+		inferredColumn := InferredColumn{
+			FileColumn: fileColumn,
+			Column:     column,
+			Inference:  inference,
+		}
+		switch inference.EntityType {
+		case fieldtypes.Label, fieldtypes.Enumeration, fieldtypes.Alias, fieldtypes.Email, fieldtypes.Id, fieldtypes.NumberInt:
+			inferredColumn.Reference = findColumnReference(cruds, table.TableName, values, sessionUser)
+		}
+
+		table.Columns = append(table.Columns, column)
+		inferred = append(inferred, inferredColumn)
+	}
+
+	return table, inferred
+}
+
+// findColumnReference looks for the reference id or a unique column of another table which holds the values
+// The tables the user cannot read are skipped, the lookup would otherwise tell which values are stored in them
+func findColumnReference(cruds map[string]*DbResource, tableName string, values []string, sessionUser *auth.SessionUser) *ColumnReference {
+
+	seen := make(map[string]bool)
+	sample := make([]string, 0)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		sample = append(sample, value)
+		if len(sample) >= referenceSampleSize {
+			break
+		}
+	}
+	if len(sample) < 2 {
+		return nil
+	}
+
+	var best *ColumnReference
+	for name, crud := range cruds {
+		tableInfo := crud.TableInfo()
+		if name == tableName || tableInfo == nil || tableInfo.IsJoinTable || !crud.CanUserReadTable(sessionUser, name) {
+			continue
+		}
+
+		for _, column := range tableInfo.Columns {
+			if column.ColumnName != "reference_id" && (!column.IsUnique || column.IsForeignKey || column.ColumnName == "id") {
+				continue
+			}
+
+			s, v, err := statementbuilder.Squirrel.Select(fmt.Sprintf("count(distinct %v)", column.ColumnName)).
+				From(name).Where(squirrel.Eq{column.ColumnName: sample}).ToSql()
+			if err != nil {
+				continue
+			}
+			var found int
+			err = crud.db.QueryRowx(s, v...).Scan(&found)
+			if err != nil {
+				continue
+			}
+
+			overlap := float64(found) / float64(len(sample))
+			if overlap >= referenceOverlap && (best == nil || overlap > best.Overlap) {
+				best = &ColumnReference{
+					Table:   name,
+					Column:  column.ColumnName,
+					Overlap: overlap,
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+// DateFormatsOf returns the layouts of the date and datetime columns, to read the values while importing
+func DateFormatsOf(columns []InferredColumn) map[string]string {
+	formats := make(map[string]string)
+	for _, column := range columns {
+		if column.Inference.DateFormat != "" {
+			formats[column.Column.ColumnName] = column.Inference.DateFormat
+		}
+	}
+	return formats
+}
+
+// NumberColumnsOf returns the money and percentage columns, which are written without currency and percent sign
+func NumberColumnsOf(columns []InferredColumn) []string {
+	numberColumns := make([]string, 0)
+	for _, column := range columns {
+		switch column.Inference.EntityType {
+		case fieldtypes.Money, fieldtypes.Percentage:
+			numberColumns = append(numberColumns, column.Column.ColumnName)
+		}
+	}
+	return numberColumns
+}
+
+// ReferenceRelations turns the columns whose values are reference ids of another table into has_one relations to
+// that table, the relation makes the column so it is removed from the table
+func ReferenceRelations(table TableInfo, columns []InferredColumn) (TableInfo, []api2go.TableRelation) {
+
+	relations := make([]api2go.TableRelation, 0)
+	referenced := make(map[string]bool)
+	for _, column := range columns {
+		if column.Reference == nil || column.Reference.Column != "reference_id" {
+			continue
+		}
+		referenced[column.Column.ColumnName] = true
+		relations = append(relations, api2go.TableRelation{
+			Subject:     table.TableName,
+			Relation:    "has_one",
+			Object:      column.Reference.Table,
+			SubjectName: table.TableName + "_id",
+			ObjectName:  column.Column.ColumnName,
+		})
+	}
+
+	tableColumns := make([]api2go.ColumnInfo, 0)
+	for _, column := range table.Columns {
+		if !referenced[column.ColumnName] {
+			tableColumns = append(tableColumns, column)
+		}
+	}
+	table.Columns = tableColumns
+
+	return table, relations
+}
+
+// UploadTable proposes the table for the rows of an uploaded file by the user and completes the options to import
+// them. When onlyExisting is set the columns which are not in the existing entity are left out
+func UploadTable(tableName string, columnNames []string, rows []map[string]interface{}, options ImportOptions,
+	existingEntity *TableInfo, onlyExisting bool, cruds map[string]*DbResource, sessionUser *auth.SessionUser) (TableInfo, []api2go.TableRelation, []InferredColumn, ImportOptions) {
+
+	if onlyExisting && existingEntity != nil {
+		existingColumns := make([]string, 0)
+		for _, columnName := range columnNames {
+			if _, ok := existingEntity.GetColumnByName(options.MappedColumn(columnName)); ok {
+				existingColumns = append(existingColumns, columnName)
+			}
+		}
+		columnNames = existingColumns
+	}
+
+	table, inferred := InferTableInfo(tableName, columnNames, rows, options, options.Locale, cruds, sessionUser)
+	table, relations := ReferenceRelations(table, inferred)
+
+	options.DateFormats = DateFormatsOf(inferred)
+	options.NumberColumns = NumberColumnsOf(inferred)
+	if existingEntity != nil {
+		// values are only rewritten for the columns the existing entity stores as dates and numbers
+		for columnName := range options.DateFormats {
+			column, ok := existingEntity.GetColumnByName(columnName)
+			if !ok || (column.ColumnType != "date" && column.ColumnType != "datetime") {
+				delete(options.DateFormats, columnName)
+			}
+		}
+		numberColumns := make([]string, 0)
+		for _, columnName := range options.NumberColumns {
+			column, ok := existingEntity.GetColumnByName(columnName)
+			if ok && (column.ColumnType == "measurement" || column.ColumnType == "float" || column.ColumnType == "value") {
+				numberColumns = append(numberColumns, columnName)
+			}
+		}
+		options.NumberColumns = numberColumns
+	}
+
+	return table, relations, inferred, options
+}
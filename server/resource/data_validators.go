@@ -0,0 +1,125 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"strings"
+)
+
+// DataValidator checks the value of a column against the stored rows, which the validator tags cannot see. The
+// param is the part of the tag after "=", it gives false for a value which is not valid
+type DataValidator func(dr *DbResource, req *api2go.Request, columnName string, value interface{}, param string,
+	obj map[string]interface{}) (bool, error)
+
+// DataValidators are the validators which can be named in the validation tags of a column along with the validator
+// tags, they are checked once the validator tags of the column pass
+var DataValidators = map[string]DataValidator{
+	// db_unique checks that no other row of the table has the value
+	"db_unique": UniqueDataValidator,
+	// db_referable checks that the value is the reference id of a row the user can refer to, in the table named by
+	// the param or else in the table the foreign key column points to
+	"db_referable": ReferableDataValidator,
+}
+
+// DataValidatorTag is a data validator named in the validation tags of a column
+type DataValidatorTag struct {
+	Tag       string
+	Param     string
+	Validator DataValidator
+}
+
+// SplitValidationTags separates the data validators named in the validation tags from the validator tags
+func SplitValidationTags(tags string) (string, []DataValidatorTag) {
+
+	validatorTags := make([]string, 0)
+	dataValidators := make([]DataValidatorTag, 0)
+
+	for _, tag := range strings.Split(tags, ",") {
+		name, param := tag, ""
+		if i := strings.Index(tag, "="); i > -1 {
+			name, param = tag[:i], tag[i+1:]
+		}
+		if validator, ok := DataValidators[strings.TrimSpace(name)]; ok {
+			dataValidators = append(dataValidators, DataValidatorTag{
+				Tag:       strings.TrimSpace(name),
+				Param:     param,
+				Validator: validator,
+			})
+			continue
+		}
+		validatorTags = append(validatorTags, tag)
+	}
+
+	return strings.Join(validatorTags, ","), dataValidators
+}
+
+func UniqueDataValidator(dr *DbResource, req *api2go.Request, columnName string, value interface{}, param string,
+	obj map[string]interface{}) (bool, error) {
+
+	if value == nil || value == "" {
+		return true, nil
+	}
+
+	query := statementbuilder.Squirrel.Select("count(*)").From(dr.model.GetName()).
+		Where(squirrel.Eq{columnName: value})
+	if referenceId, ok := obj["reference_id"].(string); ok && referenceId != "" {
+		// the row being updated can keep its own value
+		query = query.Where(squirrel.NotEq{"reference_id": referenceId})
+	}
+	query = dr.ScopeToWorkspace(query, req.PlainRequest, "")
+
+	s, v, err := query.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	err = dr.db.QueryRowx(s, v...).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func ReferableDataValidator(dr *DbResource, req *api2go.Request, columnName string, value interface{}, param string,
+	obj map[string]interface{}) (bool, error) {
+
+	if value == nil || value == "" {
+		return true, nil
+	}
+	referenceId, ok := value.(string)
+	if !ok {
+		return false, nil
+	}
+
+	typeName := param
+	if typeName == "" {
+		column, ok := dr.TableInfo().GetColumnByName(columnName)
+		if !ok || !column.IsForeignKey || column.ForeignKeyData.DataSource != "self" {
+			return false, fmt.Errorf("column [%v] is not a foreign key, db_referable needs a table name", columnName)
+		}
+		typeName = column.ForeignKeyData.Namespace
+	}
+
+	_, err := dr.GetReferenceIdToId(typeName, referenceId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if isAdministrator(dr, req) {
+		return true, nil
+	}
+
+	sessionUser, ok := req.PlainRequest.Context().Value("user").(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	permission := dr.GetObjectPermissionByReferenceId(typeName, referenceId)
+	return permission.CanRefer(sessionUser.UserReferenceId, sessionUser.Groups), nil
+}
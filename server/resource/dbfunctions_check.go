@@ -53,6 +53,43 @@ func CheckInfo(err error, message ...interface{}) bool {
 	return false
 }
 
+// StateTableColumns are the columns of the <table>_state table of a table with state tracking
+// The event_name, next_state and is_automatic columns are only filled in the audit rows, each audit row keeps
+// the state before a transition along with the event which ended it
+func StateTableColumns() []api2go.ColumnInfo {
+	return []api2go.ColumnInfo{
+		{
+			Name:       "current_state",
+			ColumnName: "current_state",
+			ColumnType: "label",
+			DataType:   "varchar(100)",
+			IsNullable: false,
+		},
+		{
+			Name:       "event_name",
+			ColumnName: "event_name",
+			ColumnType: "label",
+			DataType:   "varchar(100)",
+			IsNullable: true,
+		},
+		{
+			Name:       "next_state",
+			ColumnName: "next_state",
+			ColumnType: "label",
+			DataType:   "varchar(100)",
+			IsNullable: true,
+		},
+		{
+			Name:         "is_automatic",
+			ColumnName:   "is_automatic",
+			ColumnType:   "truefalse",
+			DataType:     "bool",
+			IsNullable:   true,
+			DefaultValue: "false",
+		},
+	}
+}
+
 func CheckRelations(config *CmsConfig) {
 	relations := config.Relations
 	config.Relations = make([]api2go.TableRelation, 0)
@@ -95,6 +132,13 @@ func CheckRelations(config *CmsConfig) {
 				finalRelations = append(finalRelations, relationGroup)
 			}
 
+			relationWorkspace := api2go.NewTableRelation(table.TableName, "belongs_to", WORKSPACE_TABLE_NAME)
+			if IsWorkspaceScopedTable(table.TableName) && !relationsDone[relationWorkspace.Hash()] {
+				relationsDone[relationWorkspace.Hash()] = true
+				config.Tables[i].Relations = append(config.Tables[i].Relations, relationWorkspace)
+				finalRelations = append(finalRelations, relationWorkspace)
+			}
+
 		}
 
 		userRelation := api2go.NewTableRelation(table.TableName+"_state", "belongs_to", USER_ACCOUNT_TABLE_NAME)
@@ -138,16 +182,9 @@ func CheckRelations(config *CmsConfig) {
 				if !relationsDone[stateRelation.Hash()] {
 
 					stateTable := TableInfo{
-						TableName: table.TableName + "_state",
-						Columns: []api2go.ColumnInfo{
-							{
-								Name:       "current_state",
-								ColumnName: "current_state",
-								ColumnType: "label",
-								DataType:   "varchar(100)",
-								IsNullable: false,
-							},
-						},
+						TableName:      table.TableName + "_state",
+						IsAuditEnabled: true,
+						Columns:        StateTableColumns(),
 					}
 
 					stateTableHasOneDescription := api2go.NewTableRelation(stateTable.TableName, "has_one", "smd")
@@ -168,16 +205,9 @@ func CheckRelations(config *CmsConfig) {
 
 			if table.IsStateTrackingEnabled {
 				stateTable := TableInfo{
-					TableName: table.TableName + "_state",
-					Columns: []api2go.ColumnInfo{
-						{
-							Name:       "current_state",
-							ColumnName: "current_state",
-							ColumnType: "label",
-							DataType:   "varchar(100)",
-							IsNullable: false,
-						},
-					},
+					TableName:      table.TableName + "_state",
+					IsAuditEnabled: true,
+					Columns:        StateTableColumns(),
 				}
 
 				stateTableHasOneDescription := api2go.NewTableRelation(stateTable.TableName, "has_one", "smd")
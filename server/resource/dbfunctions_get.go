@@ -125,9 +125,11 @@ type SubSite struct {
 	Path         string
 	CloudStoreId *int64 `db:"cloud_store_id"`
 	Permission   PermissionInstance
-	UserId       *int64 `db:"user_account_id"`
-	ReferenceId  string `db:"reference_id"`
-	Enable       bool   `db:"enable"`
+	UserId       *int64          `db:"user_account_id"`
+	ReferenceId  string          `db:"reference_id"`
+	Enable       bool            `db:"enable"`
+	SiteType     string          `db:"site_type"`
+	ServeConfig  SiteServeConfig `db:"serve_config"`
 }
 
 type CloudStore struct {
@@ -346,8 +348,8 @@ func (resource *DbResource) GetAllTasks() ([]Task, error) {
 
 	var tasks []Task
 
-	s, v, err := statementbuilder.Squirrel.Select("t.name", "t.action_name", "t.entity_name", "t.schedule", "t.active", "t.attributes", "t.as_user_id").
-		From("task t").
+	s, v, err := statementbuilder.Squirrel.Select(taskColumns...).
+		From("task t").LeftJoin(taskUserJoin).
 		ToSql()
 	if err != nil {
 		return tasks, err
@@ -360,16 +362,11 @@ func (resource *DbResource) GetAllTasks() ([]Task, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var task Task
-		err = rows.Scan(&task.Name, &task.ActionName, &task.EntityName, &task.Schedule, &task.Active, &task.AttributesJson, &task.AsUserEmail)
+		task, err := scanTask(rows)
 		if err != nil {
 			log.Errorf("Failed to scan task from db to struct: %v", err)
 			continue
 		}
-		err = json.Unmarshal([]byte(task.AttributesJson), &task.Attributes)
-		if CheckErr(err, "Failed to unmarshal attributes for task") {
-			continue
-		}
 		tasks = append(tasks, task)
 	}
 
@@ -377,6 +374,60 @@ func (resource *DbResource) GetAllTasks() ([]Task, error) {
 
 }
 
+// GetTaskByReferenceId loads a single row of the task table as a Task
+func (resource *DbResource) GetTaskByReferenceId(referenceId string) (Task, error) {
+
+	var task Task
+
+	s, v, err := statementbuilder.Squirrel.Select(taskColumns...).
+		From("task t").LeftJoin(taskUserJoin).Where(squirrel.Eq{"t.reference_id": referenceId}).
+		ToSql()
+	if err != nil {
+		return task, err
+	}
+
+	rows, err := resource.db.Queryx(s, v...)
+	if err != nil {
+		return task, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return task, fmt.Errorf("no such task [%v]", referenceId)
+	}
+
+	return scanTask(rows)
+}
+
+// the task is executed as the user referred by as_user_id, which is loaded by email when the task runs
+var taskColumns = []string{"t.id", "t.reference_id", "t.name", "t.action_name", "t.entity_name", "t.schedule", "t.active", "t.attributes", "u.email", "t.on_failure"}
+var taskUserJoin = USER_ACCOUNT_TABLE_NAME + " u on u.id = t.as_user_id"
+
+func scanTask(rows *sqlx.Rows) (Task, error) {
+	var task Task
+	var attributesJson, asUserEmail, onFailure *string
+	err := rows.Scan(&task.Id, &task.ReferenceId, &task.Name, &task.ActionName, &task.EntityName, &task.Schedule, &task.Active, &attributesJson, &asUserEmail, &onFailure)
+	if err != nil {
+		return task, err
+	}
+	if asUserEmail != nil {
+		task.AsUserEmail = *asUserEmail
+	}
+	task.Attributes = make(map[string]interface{})
+	if attributesJson != nil && len(*attributesJson) > 0 {
+		task.AttributesJson = *attributesJson
+		err = json.Unmarshal([]byte(task.AttributesJson), &task.Attributes)
+		if err != nil {
+			return task, err
+		}
+	}
+	if onFailure != nil && len(*onFailure) > 0 {
+		err = json.Unmarshal([]byte(*onFailure), &task.OnFailure)
+		CheckErr(err, "Failed to unmarshal failure hook for task [%v]", task.Name)
+	}
+	return task, nil
+}
+
 func (resource *DbResource) GetMarketplaceByReferenceId(referenceId string) (Marketplace, error) {
 
 	marketPlace := Marketplace{}
@@ -397,7 +448,7 @@ func (resource *DbResource) GetAllSites() ([]SubSite, error) {
 
 	var sites []SubSite
 
-	s, v, err := statementbuilder.Squirrel.Select("s.name", "s.hostname", "s.cloud_store_id", "s."+USER_ACCOUNT_ID_COLUMN, "s.path", "s.reference_id", "s.id", "s.enable").
+	s, v, err := statementbuilder.Squirrel.Select("s.name", "s.hostname", "s.cloud_store_id", "s."+USER_ACCOUNT_ID_COLUMN, "s.path", "s.reference_id", "s.id", "s.enable", "s.site_type", "s.serve_config").
 		From("site s").
 		ToSql()
 	if err != nil {
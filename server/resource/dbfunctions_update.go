@@ -468,60 +468,76 @@ func UpdateExchanges(initConfig *CmsConfig, db database.DatabaseConnection) {
 
 	}
 
+	allExchnages, err := GetExchangeContracts(db, nil)
+	CheckErr(err, "Failed to query existing exchanges")
+
+	initConfig.ExchangeContracts = allExchnages
+
+}
+
+// GetExchangeContracts loads the exchanges from the data_exchange table, all of them if where is nil
+func GetExchangeContracts(db database.DatabaseConnection, where squirrel.Sqlizer) ([]ExchangeContract, error) {
+
 	allExchnages := make([]ExchangeContract, 0)
 
-	s, v, err := statementbuilder.Squirrel.Select("name", "source_attributes", "source_type", "target_attributes",
+	query := statementbuilder.Squirrel.Select("id", "reference_id", "name", "source_attributes", "source_type", "target_attributes",
 		"target_type", "attributes", "options", "oauth_token_id").
-		From("data_exchange").ToSql()
+		From("data_exchange")
+	if where != nil {
+		query = query.Where(where)
+	}
+
+	s, v, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := db.Queryx(s, v...)
-	CheckErr(err, "Failed to query existing exchanges")
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	if err == nil {
-		for rows.Next() {
-
-			var name, source_type, target_type string
-			var attributes, source_attributes, target_attributes, options []byte
-			var oauth_token_id *int64
+	for rows.Next() {
 
-			var ec ExchangeContract
-			err = rows.Scan(&name, &source_attributes, &source_type, &target_attributes, &target_type, &attributes, &options, &oauth_token_id)
-			CheckErr(err, "Failed to Scan existing exchanges")
+		var name, source_type, target_type string
+		var attributes, source_attributes, target_attributes, options []byte
+		var oauth_token_id *int64
 
-			m := make(map[string]interface{})
-			err = json.Unmarshal(source_attributes, &m)
-			ec.SourceAttributes = m
-			CheckErr(err, "Failed to unmarshal source attributes")
+		var ec ExchangeContract
+		err = rows.Scan(&ec.Id, &ec.ReferenceId, &name, &source_attributes, &source_type, &target_attributes, &target_type, &attributes, &options, &oauth_token_id)
+		if CheckErr(err, "Failed to Scan existing exchanges") {
+			continue
+		}
 
-			m = make(map[string]interface{})
-			err = json.Unmarshal(target_attributes, &m)
-			ec.TargetAttributes = m
-			CheckErr(err, "Failed to unmarshal target attributes")
+		m := make(map[string]interface{})
+		err = json.Unmarshal(source_attributes, &m)
+		ec.SourceAttributes = m
+		CheckErr(err, "Failed to unmarshal source attributes")
 
-			ec.Name = name
-			ec.SourceType = source_type
-			ec.TargetType = target_type
+		m = make(map[string]interface{})
+		err = json.Unmarshal(target_attributes, &m)
+		ec.TargetAttributes = m
+		CheckErr(err, "Failed to unmarshal target attributes")
 
-			var columnMapping []ColumnMap
-			err = json.Unmarshal(attributes, &columnMapping)
-			CheckErr(err, "Failed to unmarshal column mapping")
+		ec.Name = name
+		ec.SourceType = source_type
+		ec.TargetType = target_type
 
-			ec.Attributes = columnMapping
-			err = json.Unmarshal(options, &ec.Options)
-			CheckErr(err, "Failed to unmarshal exchange options")
+		var columnMapping []ColumnMap
+		err = json.Unmarshal(attributes, &columnMapping)
+		CheckErr(err, "Failed to unmarshal column mapping")
 
-			if oauth_token_id == nil {
-			}
+		ec.Attributes = columnMapping
+		err = json.Unmarshal(options, &ec.Options)
+		CheckErr(err, "Failed to unmarshal exchange options")
 
-			ec.OauthTokenId = oauth_token_id
+		ec.OauthTokenId = oauth_token_id
 
-			allExchnages = append(allExchnages, ec)
-		}
+		allExchnages = append(allExchnages, ec)
 	}
 
-	initConfig.ExchangeContracts = allExchnages
-
+	return allExchnages, nil
 }
 
 func UpdateStateMachineDescriptions(initConfig *CmsConfig, db database.DatabaseConnection) {
@@ -690,14 +706,8 @@ func UpdateActionTable(initConfig *CmsConfig, db database.DatabaseConnection) er
 	return nil
 }
 
-func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*DbResource) {
-	importCount := len(imports)
-
-	if importCount == 0 {
-		return
-	}
-
-	log.Printf("Importing [%v] data files", importCount)
+// adminImportRequest is the request data files are imported with, made as the administrator
+func adminImportRequest(db sqlx.Ext, cruds map[string]*DbResource) api2go.Request {
 	ctx := context.TODO()
 	pr1 := http.Request{
 		Method: "POST",
@@ -720,9 +730,22 @@ func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*Db
 
 	}
 
-	req := api2go.Request{
+	return api2go.Request{
 		PlainRequest: pr,
 	}
+}
+
+// ImportDataFiles imports the data files with the permissions of the administrator and returns a report for each file
+func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*DbResource) []ImportReport {
+	reports := make([]ImportReport, 0)
+	importCount := len(imports)
+
+	if importCount == 0 {
+		return reports
+	}
+
+	log.Printf("Importing [%v] data files", importCount)
+	req := adminImportRequest(db, cruds)
 
 	for _, importFile := range imports {
 
@@ -733,7 +756,8 @@ func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*Db
 			continue
 		}
 
-		importSuccess := false
+		// rows of each entity in the file
+		entityRows := make(map[string][]map[string]interface{})
 		log.Printf("Uploaded file is type: %v", importFile.FileType)
 		switch importFile.FileType {
 
@@ -745,20 +769,13 @@ func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*Db
 				log.Errorf("Failed to read content as json to import: %v", err)
 				continue
 			}
-
-			for typeName, data := range jsonData {
-				errs := ImportDataMapArray(data, cruds[typeName], req)
-				if len(errs) > 0 {
-					for _, err := range errs {
-						log.Errorf("Error while importing json data: %v", err)
-					}
-				}
-			}
+			entityRows = jsonData
 
 		case "xlsx":
 			xlsxFile, err := xlsx.OpenBinary(fileBytes)
 			if err != nil {
 				log.Errorf("Failed to read file [%v] as xlsx file: %v", importFile.FilePath, err)
+				continue
 			}
 
 			data, _, err := GetDataArray(xlsxFile.Sheets[0])
@@ -766,167 +783,100 @@ func ImportDataFiles(imports []DataFileImport, db sqlx.Ext, cruds map[string]*Db
 				log.Errorf("Failed to sheet 0 data to import: %v", err)
 				continue
 			}
-
-			importSuccess = true
-			errors1 := ImportDataMapArray(data, cruds[importFile.Entity], req)
-			if len(errors1) > 0 {
-				for _, err := range errors1 {
-					log.Errorf("Error while importing json data: %v", err)
-				}
-			}
+			entityRows[importFile.Entity] = data
 
 		case "csv":
 
-			csvReader := csv.NewReader(bytes.NewReader(fileBytes))
-			data, err := csvReader.ReadAll()
+			data, err := CsvDataRows(fileBytes)
 			CheckErr(err, "Failed to read csv file [%v]", importFile.FilePath)
 			if err != nil {
 				continue
 			}
-
-			header := data[0]
-			importSuccess = true
-			for i, h := range header {
-				header[i] = SmallSnakeCaseText(h)
-			}
-			errors1 := ImportDataStringArray(data, header, importFile.Entity, cruds[importFile.Entity], req)
-			if len(errors1) > 0 {
-				for _, err := range errors1 {
-					log.Errorf("Error while importing json data: %v", err)
-				}
-			}
+			entityRows[importFile.Entity] = data
 
 		default:
 			CheckErr(errors.New("unknown file type"), "Failed to import [%v]: [%v]", importFile.FileType, importFile.FilePath)
+			continue
+		}
+
+		for typeName, data := range entityRows {
+			crud, ok := cruds[typeName]
+			if !ok {
+				log.Errorf("Failed to import [%v]: no such entity [%v]", importFile.FilePath, typeName)
+				continue
+			}
+			report := ImportRows(data, crud, importFile.Options, req)
+			for _, rowError := range report.RowErrors {
+				log.Errorf("Error while importing row %d of [%v]: %v", rowError.Row, importFile.FilePath, rowError.Errors)
+			}
+			reports = append(reports, report)
 		}
 
-		if importSuccess {
+		if !importFile.Options.DryRun {
 			err := os.Remove(importFile.FilePath)
 			CheckErr(err, "Failed to remove import file after import [%v]", importFile.FilePath)
 		}
 
 	}
 
+	return reports
 }
 
-func ImportDataMapArray(data []map[string]interface{}, crud *DbResource, req api2go.Request) []error {
-	errs := make([]error, 0)
-
-	uniqueColumns := make([]api2go.ColumnInfo, 0)
-
-	for _, col := range crud.TableInfo().Columns {
-
-		if col.IsUnique {
-			uniqueColumns = append(uniqueColumns, col)
-		}
+// CsvDataRows reads the rows of a csv file as maps of the column names in the header
+func CsvDataRows(fileBytes []byte) ([]map[string]interface{}, error) {
 
+	csvReader := csv.NewReader(bytes.NewReader(fileBytes))
+	data, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, row := range data {
-
-		model := api2go.NewApi2GoModelWithData(crud.tableInfo.TableName, nil, int64(crud.TableInfo().DefaultPermission), nil, row)
-		_, err := crud.Create(model, req)
-		if err != nil {
-			errs = append(errs, err)
-		}
-
-		if len(uniqueColumns) > 0 {
-			for _, uniqueCol := range uniqueColumns {
-				log.Infof("Try to update data by unique column: %v", uniqueCol.ColumnName)
-				uniqueColumnValue, ok := row[uniqueCol.ColumnName]
-				if !ok || uniqueColumnValue == nil {
-					continue
-				}
-				stringVal, isString := uniqueColumnValue.(string)
-				if isString && len(stringVal) == 0 {
-					continue
-				}
-				existingRow, err := crud.GetObjectByWhereClause(crud.tableInfo.TableName, uniqueCol.ColumnName, uniqueColumnValue)
-				if err != nil {
-					continue
-				}
-
-				for key, val := range row {
-					existingRow[key] = val
-				}
-
-				obj := api2go.NewApi2GoModelWithData(crud.tableInfo.TableName, nil, 0, nil, existingRow)
-				_, err = crud.Update(obj, req)
-				if err != nil {
-					log.Errorf("Failed to update table [%v] update row by unique column [%v]: %v", crud.tableInfo.TableName, uniqueCol.ColumnName, err)
-				}
-				break
+	rows := make([]map[string]interface{}, 0)
+	if len(data) == 0 {
+		return rows, nil
+	}
 
+	header := data[0]
+	for _, record := range data[1:] {
+		row := make(map[string]interface{})
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
 			}
 		}
-
+		rows = append(rows, row)
 	}
-	return errs
+
+	return rows, nil
 }
 
-func ImportDataStringArray(data [][]string, headers []string, entityName string, crud *DbResource, req api2go.Request) []error {
+// importReportErrors flattens the row errors of a report
+func importReportErrors(report ImportReport) []error {
 	errs := make([]error, 0)
+	for _, rowError := range report.RowErrors {
+		errs = append(errs, fmt.Errorf("row %d: %v", rowError.Row, strings.Join(rowError.Errors, ", ")))
+	}
+	return errs
+}
 
-	uniqueColumns := make([]api2go.ColumnInfo, 0)
-
-	for _, col := range crud.TableInfo().Columns {
-
-		if col.IsUnique {
-			uniqueColumns = append(uniqueColumns, col)
-		}
+func ImportDataMapArray(data []map[string]interface{}, crud *DbResource, req api2go.Request) []error {
+	return importReportErrors(ImportRows(data, crud, ImportOptions{}, req))
+}
 
-	}
+func ImportDataStringArray(data [][]string, headers []string, entityName string, crud *DbResource, req api2go.Request) []error {
 
+	rows := make([]map[string]interface{}, 0)
 	for _, rowArray := range data {
-
 		rowMap := make(map[string]interface{})
-
 		for i, header := range headers {
-			rowMap[header] = rowArray[i]
-		}
-		model := api2go.NewApi2GoModelWithData(entityName, nil, int64(crud.TableInfo().DefaultPermission), nil, rowMap)
-		_, err := crud.Create(model, req)
-		if err != nil {
-			errs = append(errs, err)
-		}
-
-		if err != nil {
-			// create row failed, try to update row by unique columns
-
-			if len(uniqueColumns) > 0 {
-				for _, uniqueCol := range uniqueColumns {
-					log.Infof("Try to update data by unique column: %v", uniqueCol.ColumnName)
-					uniqueColumnValue, ok := rowMap[uniqueCol.ColumnName]
-					if !ok || uniqueColumnValue == nil {
-						continue
-					}
-					stringVal, isString := uniqueColumnValue.(string)
-					if isString && len(stringVal) == 0 {
-						continue
-					}
-					existingRow, err := crud.GetObjectByWhereClause(entityName, uniqueCol.ColumnName, uniqueColumnValue)
-					if err != nil {
-						continue
-					}
-
-					for _, key := range headers {
-						existingRow[key] = rowMap[key]
-					}
-
-					obj := api2go.NewApi2GoModelWithData(entityName, nil, 0, nil, existingRow)
-					_, err = crud.Update(obj, req)
-					if err != nil {
-						log.Errorf("Failed to update table [%v] update row by unique column [%v]: %v", entityName, uniqueCol.ColumnName, err)
-					}
-					break
-
-				}
+			if i < len(rowArray) {
+				rowMap[header] = rowArray[i]
 			}
-
 		}
-
+		rows = append(rows, rowMap)
 	}
-	return errs
+
+	return importReportErrors(ImportRows(rows, crud, ImportOptions{}, req))
 }
 
 func UpdateWorldTable(initConfig *CmsConfig, db *sqlx.Tx) {
@@ -2,6 +2,7 @@ package resource
 
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -41,6 +42,29 @@ func (dr *DbResource) IsUserActionAllowed(userReferenceId string, userGroups []a
 
 }
 
+// CanUserReadTable tells if the user can read the rows of the table, the way the TableAccessPermissionChecker
+// decides for a GET request
+func (dr *DbResource) CanUserReadTable(sessionUser *auth.SessionUser, tableName string) bool {
+
+	if sessionUser == nil {
+		sessionUser = &auth.SessionUser{}
+	}
+	adminId := dr.GetAdminReferenceId()
+	if adminId != "" && adminId == sessionUser.UserReferenceId {
+		return true
+	}
+
+	switch dr.RoleDecision(sessionUser, tableName, "", PolicyOperationRead, nil) {
+	case PolicyAllow:
+		return true
+	case PolicyDeny:
+		return false
+	}
+
+	permission := dr.GetObjectPermissionByWhereClause("world", "table_name", tableName)
+	return permission.CanRead(sessionUser.UserReferenceId, sessionUser.Groups)
+}
+
 // Get an Action instance by `typeName` and `actionName`
 // Check Action instance for usage
 func (dr *DbResource) GetActionByName(typeName string, actionName string) (Action, error) {
@@ -817,9 +841,9 @@ func (dr *DbResource) GetUserEmailIdByUsergroupId(usergroupId int64) string {
 
 }
 
-func (dr *DbResource) GetSingleRowByReferenceId(typeName string, referenceId string) (map[string]interface{}, []map[string]interface{}, error) {
+func (dr *DbResource) GetSingleRowByReferenceId(typeName string, referenceId string, req *http.Request) (map[string]interface{}, []map[string]interface{}, error) {
 	//log.Infof("Get single row by id: [%v][%v]", typeName, referenceId)
-	s, q, err := statementbuilder.Squirrel.Select("*").From(typeName).Where(squirrel.Eq{"reference_id": referenceId}).ToSql()
+	s, q, err := dr.Cruds[typeName].ScopeToWorkspace(statementbuilder.Squirrel.Select("*").From(typeName).Where(squirrel.Eq{"reference_id": referenceId}), req, "").ToSql()
 	if err != nil {
 		log.Errorf("Failed to create select query by ref id: %v", referenceId)
 		return nil, nil, err
@@ -869,8 +893,8 @@ func (dr *DbResource) GetSingleRowById(typeName string, id int64) (map[string]in
 
 }
 
-func (dr *DbResource) GetObjectByWhereClause(typeName string, column string, val interface{}) (map[string]interface{}, error) {
-	s, q, err := statementbuilder.Squirrel.Select("*").From(typeName).Where(squirrel.Eq{column: val}).ToSql()
+func (dr *DbResource) GetObjectByWhereClause(typeName string, column string, val interface{}, req *http.Request) (map[string]interface{}, error) {
+	s, q, err := dr.Cruds[typeName].ScopeToWorkspace(statementbuilder.Squirrel.Select("*").From(typeName).Where(squirrel.Eq{column: val}), req, "").ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -968,6 +992,99 @@ func (dr *DbResource) DirectInsert(typeName string, data map[string]interface{})
 	return err
 }
 
+// Insert a row in the task_run table for one execution of the task
+// Tasks which are not stored in the task table (registered by the system at startup) are recorded without a task_id
+func (dr *DbResource) CreateTaskRun(task Task, taskRun TaskRun) error {
+
+	u, _ := uuid.NewV4()
+	adminUserId, _ := GetAdminUserIdAndUserGroupId(dr.db)
+
+	insertMap := map[string]interface{}{
+		"task_name":            taskRun.TaskName,
+		"triggered_by":         taskRun.TriggeredBy,
+		"started_at":           taskRun.StartedAt,
+		"ended_at":             taskRun.EndedAt,
+		"duration_ms":          int64(taskRun.Duration / time.Millisecond),
+		"outcome":              taskRun.Outcome,
+		"error":                taskRun.Error,
+		"response":             toJson(taskRun.Response),
+		"reference_id":         u.String(),
+		"permission":           auth.DEFAULT_PERMISSION,
+		"created_at":           time.Now(),
+		USER_ACCOUNT_ID_COLUMN: adminUserId,
+	}
+	if task.Id != 0 {
+		insertMap["task_id"] = task.Id
+	}
+
+	s, v, err := statementbuilder.Squirrel.Insert("task_run").SetMap(insertMap).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.db.Exec(s, v...)
+	return err
+}
+
+// Insert a row in the data_exchange_run table for one execution of an exchange
+func (dr *DbResource) CreateExchangeRun(exchange ExchangeContract, run ExchangeRun) error {
+
+	u, _ := uuid.NewV4()
+	adminUserId, _ := GetAdminUserIdAndUserGroupId(dr.db)
+
+	insertMap := map[string]interface{}{
+		"exchange_name":        run.ExchangeName,
+		"direction":            run.Direction,
+		"started_at":           run.StartedAt,
+		"ended_at":             run.EndedAt,
+		"duration_ms":          int64(run.Duration / time.Millisecond),
+		"outcome":              run.Outcome,
+		"response_status":      run.ResponseStatus,
+		"rows_read":            run.RowsRead,
+		"rows_written":         run.RowsWritten,
+		"rows_failed":          run.RowsFailed,
+		"sync_cursor":          run.Cursor,
+		"error":                run.Error,
+		"reference_id":         u.String(),
+		"permission":           auth.DEFAULT_PERMISSION,
+		"created_at":           time.Now(),
+		USER_ACCOUNT_ID_COLUMN: adminUserId,
+	}
+	if exchange.Id != 0 {
+		insertMap["data_exchange_id"] = exchange.Id
+	}
+
+	s, v, err := statementbuilder.Squirrel.Insert("data_exchange_run").SetMap(insertMap).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.db.Exec(s, v...)
+	return err
+}
+
+// GetExchangeCursor returns the cursor saved by the last pull of the exchange which did not fail, empty if there was none
+func (dr *DbResource) GetExchangeCursor(exchangeId int64) (string, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select("sync_cursor").
+		From("data_exchange_run").
+		Where(squirrel.Eq{"data_exchange_id": exchangeId}).
+		Where(squirrel.Eq{"direction": ExchangeDirectionPull}).
+		Where(squirrel.Eq{"outcome": []string{ExchangeRunSuccess, ExchangeRunPartial}}).
+		OrderBy("id desc").
+		Limit(1).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var cursor *string
+	err = dr.db.QueryRowx(s, v...).Scan(&cursor)
+	if err == sql.ErrNoRows || cursor == nil {
+		return "", nil
+	}
+	return *cursor, err
+}
+
 // Get all rows from the table `typeName`
 // Returns an array of Map object, each object has the column name to value mapping
 // Utility method for loading all objects having low count
@@ -120,6 +120,17 @@ func (dr *DbResource) GetContext(key string) interface{} {
 	return dr.contextCache[key]
 }
 
+// ClearContext drops all cached values, they are loaded again from the database on next use
+// The cache map is shared with the resources created for transactions, so it is emptied in place
+func (dr *DbResource) ClearContext() {
+	dr.contextLock.Lock()
+	defer dr.contextLock.Unlock()
+
+	for key := range dr.contextCache {
+		delete(dr.contextCache, key)
+	}
+}
+
 func (dr *DbResource) GetAdminReferenceId() string {
 	cacheVal := dr.GetContext("administrator_reference_id")
 	if cacheVal == nil || cacheVal == "" {
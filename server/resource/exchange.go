@@ -1,12 +1,17 @@
 package resource
 
 import (
+	"context"
+	"github.com/artpar/api2go"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	//"bytes"
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"golang.org/x/oauth2"
+	"strings"
+	"time"
 )
 
 type ExchangeInterface interface {
@@ -22,7 +27,11 @@ type ColumnMap struct {
 
 type ColumnMapping []ColumnMap
 
+// ExchangeContract moves rows from a source to a target
+// A contract with source type "self" pushes the rows created in the source table to the target,
+// a contract with source type "rest", "gsheet" or "file" pulls rows when it is run, on the schedule in Options["schedule"]
 type ExchangeContract struct {
+	Id               int64 `db:"id"`
 	Name             string
 	SourceAttributes map[string]interface{} `db:"source_attributes"`
 	SourceType       string                 `db:"source_type"`
@@ -50,26 +59,108 @@ func (c *ColumnMapping) UnmarshalJSON(payload []byte) error {
 	return errors.New("expected a JSON encoded object or array")
 }
 
+const (
+	ExchangeRunSuccess = "success"
+	ExchangeRunFailure = "failure"
+	// ExchangeRunPartial is a run where some rows could not be written, the failed rows are listed in the error of the run
+	ExchangeRunPartial = "partial"
+
+	ExchangeDirectionPush = "push"
+	ExchangeDirectionPull = "pull"
+)
+
+// ExchangeRun is one execution of an exchange, stored in the data_exchange_run table
+type ExchangeRun struct {
+	ExchangeName   string
+	Direction      string
+	StartedAt      time.Time
+	EndedAt        time.Time
+	Duration       time.Duration
+	Outcome        string
+	ResponseStatus int
+	RowsRead       int
+	RowsWritten    int
+	RowsFailed     int
+	Cursor         string
+	Error          string
+}
+
+// ExchangeSource reads the rows of a pull exchange
+type ExchangeSource interface {
+	// Read returns the rows changed after the cursor, the http status of the call, 0 if there was none, and the cursor for the next run
+	Read(cursor string, inFieldMap map[string]interface{}) ([]map[string]interface{}, int, string, error)
+}
+
+// exchangeFlusher is implemented by the targets which keep the rows and write them once at the end of a run
+type exchangeFlusher interface {
+	Flush() error
+}
+
 type ExchangeExecution struct {
 	ExchangeContract ExchangeContract
 	oauthToken       *oauth2.Token
 	oauthConfig      *oauth2.Config
+	cruds            map[string]*DbResource
+	request          api2go.Request
 }
 
-func (ec *ExchangeExecution) Execute(inFields map[string]interface{}, data []map[string]interface{}) (err error) {
-
-	var handler ExternalExchange
-
+func (ec *ExchangeExecution) targetHandler() (ExternalExchange, error) {
 	switch ec.ExchangeContract.TargetType {
 	case "self":
-		log.Errorf("exchange contract: target: 'self' is not yet implemented")
-		return errors.New("self in target, not yet implemented")
+		return NewSelfExchangeHandler(ec.ExchangeContract, ec.cruds, ec.request)
+	case "gsheet":
+		return NewGoogleSheetExchange(ec.ExchangeContract, ec.ExchangeContract.TargetAttributes, ec.oauthToken)
+	case "file":
+		return ec.fileExchange(ec.ExchangeContract.TargetAttributes)
+	default:
+		return NewRestExchangeHandler(ec.ExchangeContract, ec.oauthToken, ec.oauthConfig)
+	}
+}
+
+func (ec *ExchangeExecution) sourceHandler() (ExchangeSource, error) {
+	switch ec.ExchangeContract.SourceType {
+	case "rest":
+		return NewRestExchangeSource(ec.ExchangeContract, ec.oauthToken)
+	case "gsheet":
+		return NewGoogleSheetExchange(ec.ExchangeContract, ec.ExchangeContract.SourceAttributes, ec.oauthToken)
+	case "file":
+		return ec.fileExchange(ec.ExchangeContract.SourceAttributes)
 	default:
-		handler, err = NewRestExchangeHandler(ec.ExchangeContract, ec.oauthToken, ec.oauthConfig)
+		return nil, errors.Errorf("cannot pull from source type [%v]", ec.ExchangeContract.SourceType)
+	}
+}
+
+// fileExchange opens the file on the cloud store named in the attributes, with the token of the store
+func (ec *ExchangeExecution) fileExchange(attributes map[string]interface{}) (*FileExchange, error) {
+
+	storeName, _ := attributes["cloud_store"].(string)
+	cloudStore, err := ec.cruds["cloud_store"].GetCloudStoreByName(storeName)
+	if err != nil {
+		return nil, err
+	}
+	if cloudStore.Name == "" {
+		return nil, errors.Errorf("no such cloud store [%v] for exchange [%v]", storeName, ec.ExchangeContract.Name)
+	}
+
+	var token *oauth2.Token
+	var oauthConfig *oauth2.Config
+	if cloudStore.OAutoTokenId != "" {
+		token, oauthConfig, err = ec.cruds["oauth_token"].GetTokenByTokenReferenceId(cloudStore.OAutoTokenId)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		break
+	}
+
+	return NewFileExchange(ec.ExchangeContract, attributes, cloudStore, token, oauthConfig)
+}
+
+// writeRows sends every row to the target, a failing row does not stop the others
+// The failed rows are counted and listed in the run, rowError is the first of them and err is set when the target itself failed
+func (ec *ExchangeExecution) writeRows(inFields map[string]interface{}, data []map[string]interface{}, run *ExchangeRun) (rowError error, err error) {
+
+	handler, err := ec.targetHandler()
+	if err != nil {
+		return nil, err
 	}
 
 	targetAttrs := ec.ExchangeContract.TargetAttributes
@@ -78,23 +169,168 @@ func (ec *ExchangeExecution) Execute(inFields map[string]interface{}, data []map
 		inFields[k] = v
 	}
 
-	inFields["oauthClientId"] = ec.oauthConfig.ClientID
+	if ec.oauthConfig != nil {
+		inFields["oauthClientId"] = ec.oauthConfig.ClientID
+	}
+
+	failedRows := make([]string, 0)
+	for i, row := range data {
+		status, err := handler.ExecuteTarget(row, inFields)
+		if status != 0 {
+			run.ResponseStatus = status
+		}
+		if err != nil {
+			log.Errorf("Failed to execute target of exchange [%v] for [%v]: %v", ec.ExchangeContract.Name, row["__type"], err)
+			if rowError == nil {
+				rowError = err
+			}
+			run.RowsFailed += 1
+			failedRows = append(failedRows, fmt.Sprintf("row %d: %v", i+1, err))
+			continue
+		}
+		run.RowsWritten += 1
+	}
+	if len(failedRows) > 0 {
+		run.Error = strings.Join(failedRows, "\n")
+	}
 
-	for _, row := range data {
-		err = handler.ExecuteTarget(row, inFields)
+	if flusher, ok := handler.(exchangeFlusher); ok {
+		err = flusher.Flush()
 		if err != nil {
-			log.Errorf("Failed to execute target for [%v]: %v", row["__type"], err)
+			run.RowsWritten = 0
+			return rowError, err
 		}
 	}
 
-	return nil
+	return rowError, nil
+}
+
+func (ec *ExchangeExecution) newRun(direction string) ExchangeRun {
+	return ExchangeRun{
+		ExchangeName: ec.ExchangeContract.Name,
+		Direction:    direction,
+		StartedAt:    time.Now(),
+	}
 }
 
-func NewExchangeExecution(exchange ExchangeContract, oauthToken *oauth2.Token, oauthConfig *oauth2.Config) *ExchangeExecution {
+// finishRun records the run in the run log
+func (ec *ExchangeExecution) finishRun(run *ExchangeRun, err error) {
+	run.EndedAt = time.Now()
+	run.Duration = run.EndedAt.Sub(run.StartedAt)
+	run.Outcome = ExchangeRunSuccess
+	if run.RowsFailed > 0 {
+		run.Outcome = ExchangeRunPartial
+	}
+	if err != nil {
+		run.Outcome = ExchangeRunFailure
+		run.Error = err.Error()
+		if httpErr, ok := err.(*ExchangeHttpError); ok {
+			run.ResponseStatus = httpErr.Status
+		}
+	}
+
+	runLog, ok := ec.cruds["data_exchange_run"]
+	if !ok {
+		return
+	}
+	CheckErr(runLog.CreateExchangeRun(ec.ExchangeContract, *run), "Failed to record run of exchange [%v]", ec.ExchangeContract.Name)
+}
+
+// Execute pushes the rows to the target of the exchange
+func (ec *ExchangeExecution) Execute(inFields map[string]interface{}, data []map[string]interface{}) (err error) {
+
+	run := ec.newRun(ExchangeDirectionPush)
+	run.RowsRead = len(data)
+
+	rowError, err := ec.writeRows(inFields, data, &run)
+	if err == nil {
+		err = rowError
+	}
+	ec.finishRun(&run, err)
+
+	return err
+}
+
+// Pull reads the rows changed since the last successful run from the source and writes them to the target
+// Rows the target rejects are recorded in the run log and the cursor moves past them, so one bad row cannot stall the
+// exchange. The cursor stays where it was when the source or the target itself fails.
+func (ec *ExchangeExecution) Pull(inFields map[string]interface{}) (ExchangeRun, error) {
+
+	run := ec.newRun(ExchangeDirectionPull)
+
+	source, err := ec.sourceHandler()
+	if err != nil {
+		ec.finishRun(&run, err)
+		return run, err
+	}
+
+	cursor, err := ec.cruds["data_exchange_run"].GetExchangeCursor(ec.ExchangeContract.Id)
+	if err != nil {
+		ec.finishRun(&run, err)
+		return run, err
+	}
+	run.Cursor = cursor
+
+	for k, v := range ec.ExchangeContract.SourceAttributes {
+		inFields[k] = v
+	}
+
+	rows, status, nextCursor, err := source.Read(cursor, inFields)
+	run.ResponseStatus = status
+	run.RowsRead = len(rows)
+	if err != nil {
+		ec.finishRun(&run, err)
+		return run, err
+	}
+
+	_, err = ec.writeRows(inFields, rows, &run)
+	if err == nil {
+		run.Cursor = nextCursor
+	}
+	ec.finishRun(&run, err)
+
+	return run, err
+}
+
+func NewExchangeExecution(exchange ExchangeContract, oauthToken *oauth2.Token, oauthConfig *oauth2.Config, cruds map[string]*DbResource, req api2go.Request) *ExchangeExecution {
 
 	return &ExchangeExecution{
 		ExchangeContract: exchange,
 		oauthToken:       oauthToken,
 		oauthConfig:      oauthConfig,
+		cruds:            cruds,
+		request:          req,
+	}
+}
+
+// GetExchangeToken loads the oauth token of the exchange, refreshing it if it has expired
+// Returns nil values for an exchange without a token
+func (dr *DbResource) GetExchangeToken(exchange ExchangeContract) (*oauth2.Token, *oauth2.Config, error) {
+
+	if exchange.OauthTokenId == nil {
+		return nil, nil, nil
 	}
+
+	token, err := dr.GetTokenByTokenId(*exchange.OauthTokenId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oauthDesc, err := dr.GetOauthDescriptionByTokenId(*exchange.OauthTokenId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !token.Valid() {
+		tokenSource := oauthDesc.TokenSource(context.Background(), token)
+		token, err = tokenSource.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = dr.UpdateAccessTokenByTokenId(*exchange.OauthTokenId, token.AccessToken, token.Expiry.Unix())
+		CheckErr(err, "failed to update access token")
+	}
+
+	return token, oauthDesc, nil
 }
@@ -0,0 +1,377 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/rclone/fs"
+	"github.com/artpar/rclone/fs/config"
+	"github.com/artpar/rclone/fs/operations"
+	"github.com/daptin/daptin/server/csvmap"
+	"github.com/pkg/errors"
+	"github.com/tealeg/xlsx"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileExchange reads and writes the rows of a csv or xlsx file on a cloud store, the first row holds the column names
+// The attributes are cloud_store which is the name of the store, path of the file in the root path of the store,
+// format ("csv" or "xlsx", from the extension of the path by default), sheet for xlsx files (the first one by default)
+// and key. As a target the rows are kept in memory and the file is written once at the end of the run
+type FileExchange struct {
+	contract     ExchangeContract
+	cloudStore   CloudStore
+	oauthToken   *oauth2.Token
+	oauthConfig  *oauth2.Config
+	path         string
+	format       string
+	sheet        string
+	key          string
+	cursorColumn string
+
+	loaded   bool
+	changed  bool
+	header   []string
+	rows     []map[string]interface{}
+	keyRows  map[string]int
+	workbook *xlsx.File
+}
+
+func NewFileExchange(contract ExchangeContract, attributes map[string]interface{}, cloudStore CloudStore, oauthToken *oauth2.Token, oauthConfig *oauth2.Config) (*FileExchange, error) {
+
+	path, _ := attributes["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path is required for file exchange [%v]", contract.Name)
+	}
+
+	format, _ := attributes["format"].(string)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if format != "csv" && format != "xlsx" {
+		return nil, fmt.Errorf("unsupported file format [%v] for exchange [%v]", format, contract.Name)
+	}
+
+	fe := &FileExchange{
+		contract:    contract,
+		cloudStore:  cloudStore,
+		oauthToken:  oauthToken,
+		oauthConfig: oauthConfig,
+		path:        strings.TrimPrefix(path, "/"),
+		format:      format,
+		keyRows:     make(map[string]int),
+	}
+	fe.sheet, _ = attributes["sheet"].(string)
+	fe.key, _ = attributes["key"].(string)
+	fe.cursorColumn, _ = attributes["cursorColumn"].(string)
+
+	return fe, nil
+}
+
+// storeFs opens the root path of the cloud store, configuring the oauth token of the store if it has one
+func (fe *FileExchange) storeFs() (fs.Fs, error) {
+
+	if fe.oauthToken != nil && fe.oauthConfig != nil {
+		provider := fe.cloudStore.StoreProvider
+		jsonToken, err := json.Marshal(fe.oauthToken)
+		if err != nil {
+			return nil, err
+		}
+		config.FileSet(provider, "client_id", fe.oauthConfig.ClientID)
+		config.FileSet(provider, "type", provider)
+		config.FileSet(provider, "client_secret", fe.oauthConfig.ClientSecret)
+		config.FileSet(provider, "token", string(jsonToken))
+		config.FileSet(provider, "client_scopes", strings.Join(fe.oauthConfig.Scopes, ","))
+		config.FileSet(provider, "redirect_url", fe.oauthConfig.RedirectURL)
+	}
+
+	return fs.NewFs(fe.cloudStore.RootPath)
+}
+
+// load reads the file once per run, a file which does not exist yet has no rows
+func (fe *FileExchange) load() error {
+
+	if fe.loaded {
+		return nil
+	}
+
+	storeFs, err := fe.storeFs()
+	if err != nil {
+		return err
+	}
+
+	fe.header = make([]string, 0)
+	fe.rows = make([]map[string]interface{}, 0)
+
+	ctx := context.Background()
+	object, err := storeFs.NewObject(ctx, fe.path)
+	if err == fs.ErrorObjectNotFound {
+		fe.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reader, err := object.Open(ctx)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	if fe.format == "csv" {
+		err = fe.parseCsv(contents)
+	} else {
+		err = fe.parseXlsx(contents)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read [%v] on [%v]", fe.path, fe.cloudStore.Name)
+	}
+
+	if fe.key != "" {
+		for i, row := range fe.rows {
+			fe.keyRows[cellString(row[fe.key])] = i
+		}
+	}
+	fe.loaded = true
+
+	return nil
+}
+
+func (fe *FileExchange) parseCsv(contents []byte) error {
+
+	reader := csvmap.NewReader(bytes.NewReader(contents))
+	header, err := reader.ReadHeader()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reader.Columns = header
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	fe.header = header
+	for _, record := range records {
+		row := make(map[string]interface{})
+		for _, column := range header {
+			row[column] = record[column]
+		}
+		fe.rows = append(fe.rows, row)
+	}
+
+	return nil
+}
+
+func (fe *FileExchange) xlsxSheet(file *xlsx.File) (*xlsx.Sheet, error) {
+
+	if fe.sheet == "" {
+		if len(file.Sheets) > 0 {
+			return file.Sheets[0], nil
+		}
+		return file.AddSheet("Sheet1")
+	}
+
+	if sheet, ok := file.Sheet[fe.sheet]; ok {
+		return sheet, nil
+	}
+	return file.AddSheet(fe.sheet)
+}
+
+func (fe *FileExchange) parseXlsx(contents []byte) error {
+
+	file, err := xlsx.OpenBinary(contents)
+	if err != nil {
+		return err
+	}
+	fe.workbook = file
+
+	sheet, err := fe.xlsxSheet(file)
+	if err != nil {
+		return err
+	}
+	if len(sheet.Rows) == 0 {
+		return nil
+	}
+
+	for _, cell := range sheet.Rows[0].Cells {
+		fe.header = append(fe.header, cell.String())
+	}
+
+	for _, sheetRow := range sheet.Rows[1:] {
+		row := make(map[string]interface{})
+		empty := true
+		for i, column := range fe.header {
+			value := ""
+			if i < len(sheetRow.Cells) {
+				value = sheetRow.Cells[i].String()
+			}
+			if value != "" {
+				empty = false
+			}
+			row[column] = value
+		}
+		if !empty {
+			fe.rows = append(fe.rows, row)
+		}
+	}
+
+	return nil
+}
+
+func (fe *FileExchange) ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) (int, error) {
+
+	values, err := mapExchangeRow(row, fe.contract.Attributes, inFieldMap)
+	if err != nil {
+		return 0, err
+	}
+
+	err = fe.load()
+	if err != nil {
+		return 0, err
+	}
+
+	newColumns := make([]string, 0)
+	for column := range values {
+		if indexOf(fe.header, column) < 0 {
+			newColumns = append(newColumns, column)
+		}
+	}
+	sort.Strings(newColumns)
+	fe.header = append(fe.header, newColumns...)
+
+	fe.changed = true
+
+	if fe.key != "" && values[fe.key] != nil {
+		keyValue := cellString(values[fe.key])
+		if index, ok := fe.keyRows[keyValue]; ok {
+			for column, value := range values {
+				fe.rows[index][column] = value
+			}
+			return 0, nil
+		}
+		fe.keyRows[keyValue] = len(fe.rows)
+	}
+
+	fe.rows = append(fe.rows, values)
+	return 0, nil
+}
+
+// Flush writes the file back to the cloud store if any row was changed
+func (fe *FileExchange) Flush() error {
+
+	if !fe.changed {
+		return nil
+	}
+
+	var contents []byte
+	var err error
+	if fe.format == "csv" {
+		contents, err = fe.csvContents()
+	} else {
+		contents, err = fe.xlsxContents()
+	}
+	if err != nil {
+		return err
+	}
+
+	storeFs, err := fe.storeFs()
+	if err != nil {
+		return err
+	}
+
+	_, err = operations.Rcat(context.Background(), storeFs, fe.path, ioutil.NopCloser(bytes.NewReader(contents)), time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "failed to write [%v] on [%v]", fe.path, fe.cloudStore.Name)
+	}
+	fe.changed = false
+
+	return nil
+}
+
+func (fe *FileExchange) csvContents() ([]byte, error) {
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	err := writer.Write(fe.header)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range fe.rows {
+		record := make([]string, len(fe.header))
+		for i, column := range fe.header {
+			record[i] = cellString(row[column])
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func (fe *FileExchange) xlsxContents() ([]byte, error) {
+
+	// the other sheets of an existing workbook are kept as they are
+	file := fe.workbook
+	if file == nil {
+		file = xlsx.NewFile()
+	}
+	sheet, err := fe.xlsxSheet(file)
+	if err != nil {
+		return nil, err
+	}
+	sheet.Rows = nil
+	sheet.MaxRow = 0
+	sheet.MaxCol = 0
+
+	headerRow := sheet.AddRow()
+	for _, column := range fe.header {
+		headerRow.AddCell().SetString(column)
+	}
+
+	for _, row := range fe.rows {
+		sheetRow := sheet.AddRow()
+		for _, column := range fe.header {
+			cell := sheetRow.AddCell()
+			if row[column] == nil {
+				continue
+			}
+			cell.SetValue(row[column])
+		}
+	}
+
+	var buffer bytes.Buffer
+	err = file.Write(&buffer)
+	return buffer.Bytes(), err
+}
+
+// Read returns the rows of the file
+func (fe *FileExchange) Read(cursor string, inFieldMap map[string]interface{}) ([]map[string]interface{}, int, string, error) {
+
+	err := fe.load()
+	if err != nil {
+		return nil, 0, cursor, err
+	}
+
+	rows, nextCursor := rowsAfterCursor(fe.rows, fe.cursorColumn, cursor)
+	return rows, 0, nextCursor, nil
+}
@@ -0,0 +1,284 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/resty"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const googleSheetsApi = "https://sheets.googleapis.com"
+
+// GoogleSheetExchange reads and writes the rows of a google sheet, the first row of the sheet holds the column names
+// The attributes are sheetId, sheet which is the name of the tab ("Sheet1" by default), key, appKey and baseUrl to
+// talk to another host than the google api, like a local stand-in. As a target a row with the same value in the key
+// column is updated in place, other rows are appended. As a source the cursorColumn attribute works like for rest
+type GoogleSheetExchange struct {
+	contract     ExchangeContract
+	oauthToken   *oauth2.Token
+	sheetId      string
+	sheet        string
+	key          string
+	appKey       string
+	baseUrl      string
+	cursorColumn string
+
+	loaded   bool
+	header   []string
+	keyRows  map[string]int
+	rowCount int
+}
+
+func NewGoogleSheetExchange(contract ExchangeContract, attributes map[string]interface{}, oauthToken *oauth2.Token) (*GoogleSheetExchange, error) {
+
+	sheetId, _ := attributes["sheetId"].(string)
+	if sheetId == "" {
+		return nil, fmt.Errorf("sheetId is required for google sheet exchange [%v]", contract.Name)
+	}
+
+	gs := &GoogleSheetExchange{
+		contract:   contract,
+		oauthToken: oauthToken,
+		sheetId:    sheetId,
+		sheet:      "Sheet1",
+		baseUrl:    googleSheetsApi,
+		keyRows:    make(map[string]int),
+	}
+
+	if sheet, ok := attributes["sheet"].(string); ok && sheet != "" {
+		gs.sheet = sheet
+	}
+	if baseUrl, ok := attributes["baseUrl"].(string); ok && baseUrl != "" {
+		gs.baseUrl = strings.TrimRight(baseUrl, "/")
+	}
+	gs.key, _ = attributes["key"].(string)
+	gs.appKey, _ = attributes["appKey"].(string)
+	gs.cursorColumn, _ = attributes["cursorColumn"].(string)
+
+	return gs, nil
+}
+
+func (gs *GoogleSheetExchange) valuesUrl(valueRange string) string {
+	return fmt.Sprintf("%s/v4/spreadsheets/%s/values/%s", gs.baseUrl, url.PathEscape(gs.sheetId), url.PathEscape(valueRange))
+}
+
+func (gs *GoogleSheetExchange) request() *resty.Request {
+	request := resty.R().SetHeader("Accept", "application/json")
+	if gs.oauthToken != nil {
+		request.SetAuthToken(gs.oauthToken.AccessToken)
+	}
+	if gs.appKey != "" {
+		request.SetQueryParam("key", gs.appKey)
+	}
+	return request
+}
+
+func sheetResponseError(response *resty.Response, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	if response.StatusCode() >= 400 {
+		return response.StatusCode(), &ExchangeHttpError{
+			Status: response.StatusCode(),
+			Body:   response.String(),
+		}
+	}
+	return response.StatusCode(), nil
+}
+
+// readValues returns every row of the sheet
+func (gs *GoogleSheetExchange) readValues() ([][]interface{}, int, error) {
+
+	response, err := gs.request().Get(gs.valuesUrl(gs.sheet))
+	status, err := sheetResponseError(response, err)
+	if err != nil {
+		return nil, status, err
+	}
+
+	var values struct {
+		Values [][]interface{} `json:"values"`
+	}
+	err = json.Unmarshal(response.Body(), &values)
+	if err != nil {
+		return nil, status, errors.Wrapf(err, "failed to read values of sheet [%v]", gs.sheetId)
+	}
+
+	return values.Values, status, nil
+}
+
+// writeValues replaces one row of the sheet, rowNumber starts at 1 for the header
+func (gs *GoogleSheetExchange) writeValues(rowNumber int, values []interface{}) (int, error) {
+
+	valueRange := fmt.Sprintf("%s!A%d", gs.sheet, rowNumber)
+	response, err := gs.request().
+		SetQueryParam("valueInputOption", "RAW").
+		SetBody(map[string]interface{}{
+			"values": [][]interface{}{values},
+		}).
+		Put(gs.valuesUrl(valueRange))
+
+	return sheetResponseError(response, err)
+}
+
+func (gs *GoogleSheetExchange) appendValues(values []interface{}) (int, error) {
+
+	response, err := gs.request().
+		SetQueryParam("valueInputOption", "RAW").
+		SetQueryParam("insertDataOption", "INSERT_ROWS").
+		SetBody(map[string]interface{}{
+			"values": [][]interface{}{values},
+		}).
+		Post(gs.valuesUrl(gs.sheet+"!A1") + ":append")
+
+	return sheetResponseError(response, err)
+}
+
+// load reads the header and the row number of every key once per run
+func (gs *GoogleSheetExchange) load() (int, error) {
+
+	if gs.loaded {
+		return 0, nil
+	}
+
+	values, status, err := gs.readValues()
+	if err != nil {
+		return status, err
+	}
+
+	gs.header = make([]string, 0)
+	if len(values) > 0 {
+		for _, name := range values[0] {
+			gs.header = append(gs.header, cellString(name))
+		}
+	}
+
+	keyIndex := indexOf(gs.header, gs.key)
+	for i, row := range values {
+		if i == 0 || keyIndex < 0 || keyIndex >= len(row) {
+			continue
+		}
+		gs.keyRows[cellString(row[keyIndex])] = i + 1
+	}
+	gs.rowCount = len(values)
+	gs.loaded = true
+
+	return status, nil
+}
+
+func (gs *GoogleSheetExchange) ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) (int, error) {
+
+	values, err := mapExchangeRow(row, gs.contract.Attributes, inFieldMap)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := gs.load()
+	if err != nil {
+		return status, err
+	}
+
+	// columns missing in the sheet are added at the end of the header
+	newColumns := make([]string, 0)
+	for column := range values {
+		if indexOf(gs.header, column) < 0 {
+			newColumns = append(newColumns, column)
+		}
+	}
+	if len(newColumns) > 0 {
+		sort.Strings(newColumns)
+		gs.header = append(gs.header, newColumns...)
+		header := make([]interface{}, len(gs.header))
+		for i, name := range gs.header {
+			header[i] = name
+		}
+		status, err = gs.writeValues(1, header)
+		if err != nil {
+			return status, err
+		}
+		if gs.rowCount == 0 {
+			gs.rowCount = 1
+		}
+	}
+
+	cells := make([]interface{}, len(gs.header))
+	for i, column := range gs.header {
+		cells[i] = cellString(values[column])
+	}
+
+	keyValue := ""
+	if gs.key != "" && values[gs.key] != nil {
+		keyValue = cellString(values[gs.key])
+	}
+
+	if rowNumber, ok := gs.keyRows[keyValue]; ok && keyValue != "" {
+		return gs.writeValues(rowNumber, cells)
+	}
+
+	status, err = gs.appendValues(cells)
+	if err != nil {
+		return status, err
+	}
+	gs.rowCount += 1
+	if keyValue != "" {
+		gs.keyRows[keyValue] = gs.rowCount
+	}
+
+	return status, nil
+}
+
+// Read returns the rows of the sheet as maps of the column names in the header
+func (gs *GoogleSheetExchange) Read(cursor string, inFieldMap map[string]interface{}) ([]map[string]interface{}, int, string, error) {
+
+	values, status, err := gs.readValues()
+	if err != nil {
+		return nil, status, cursor, err
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	if len(values) < 2 {
+		return rows, status, cursor, nil
+	}
+
+	header := values[0]
+	for _, cells := range values[1:] {
+		row := make(map[string]interface{})
+		for i, name := range header {
+			if i < len(cells) {
+				row[cellString(name)] = cells[i]
+			} else {
+				row[cellString(name)] = ""
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	rows, nextCursor := rowsAfterCursor(rows, gs.cursorColumn, cursor)
+	return rows, status, nextCursor, nil
+}
+
+// cellString is the text written in a spreadsheet cell for a value
+func cellString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func indexOf(values []string, value string) int {
+	if value == "" {
+		return -1
+	}
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
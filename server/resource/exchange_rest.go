@@ -10,7 +10,8 @@ import (
 )
 
 type ExternalExchange interface {
-	ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) error
+	// ExecuteTarget writes one row to the target, the returned status is the http status of the call, 0 if there was none
+	ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) (int, error)
 }
 
 type RestExchange struct {
@@ -22,6 +23,20 @@ type RestExchange struct {
 	QueryParams map[string]interface{}
 }
 
+// ExchangeHttpError is returned when the remote end of an exchange responds with an error status
+type ExchangeHttpError struct {
+	Status int
+	Body   string
+}
+
+func (e *ExchangeHttpError) Error() string {
+	body := e.Body
+	if len(body) > 500 {
+		body = body[:500]
+	}
+	return fmt.Sprintf("exchange request failed with status %d: %s", e.Status, body)
+}
+
 var restExchanges = []RestExchange{
 	{
 
@@ -43,55 +58,127 @@ var restExchanges = []RestExchange{
 	},
 }
 
-type RestExternalExchange struct {
-	oauthToken          *oauth2.Token
-	exchangeContract    ExchangeContract
-	exchangeInformation *RestExchange
-	oauthConfig         *oauth2.Config
-}
+// restExchangeFromAttributes reads a generic "rest" exchange from the source or target attributes of the contract
+// url, method, headers, query and body are evaluated like action attributes, the row is sent as body if there is none
+func restExchangeFromAttributes(attributes map[string]interface{}) (*RestExchange, error) {
 
-func (g *RestExternalExchange) ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) error {
+	exchange := RestExchange{
+		Name:   "rest",
+		Method: "GET",
+	}
 
-	log.Infof("Execute rest external exchange")
+	url, ok := attributes["url"].(string)
+	if !ok || url == "" {
+		return nil, errors.New("url is required for a rest exchange")
+	}
+	exchange.Url = url
 
-	headersMap := make(map[string]string)
+	if method, ok := attributes["method"].(string); ok && method != "" {
+		exchange.Method = method
+	}
+	if headers, ok := attributes["headers"].(map[string]interface{}); ok {
+		exchange.Headers = headers
+	}
+	if query, ok := attributes["query"].(map[string]interface{}); ok {
+		exchange.QueryParams = query
+	}
+	if body, ok := attributes["body"].(map[string]interface{}); ok {
+		exchange.Body = body
+	}
 
-	headInterface, err := buildActionContext(g.exchangeInformation.Headers, inFieldMap)
+	return &exchange, nil
+}
+
+// evaluateStringMap evaluates every value of the map, empty values are left out
+func evaluateStringMap(values map[string]interface{}, inFieldMap map[string]interface{}) (map[string]string, error) {
+
+	result := make(map[string]string)
+	if len(values) == 0 {
+		return result, nil
+	}
+
+	evaluated, err := buildActionContext(values, inFieldMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	headers := headInterface.(map[string]interface{})
 
-	for k, v := range headers {
+	for k, v := range evaluated.(map[string]interface{}) {
 		if v == nil {
 			continue
 		}
-		headersMap[k] = v.(string)
+		value, ok := v.(string)
+		if !ok {
+			value = fmt.Sprintf("%v", v)
+		}
+		if value == "" {
+			continue
+		}
+		result[k] = value
 	}
+	return result, nil
+}
 
-	queryParamsMap := make(map[string]string)
-	queryInterface, err := buildActionContext(g.exchangeInformation.QueryParams, inFieldMap)
+// executeRestExchange makes the http call described by the exchange, a response with an error status is returned
+// along with an ExchangeHttpError
+func executeRestExchange(exchange *RestExchange, body interface{}, inFieldMap map[string]interface{}, oauthToken *oauth2.Token) (*resty.Response, error) {
+
+	headers, err := evaluateStringMap(exchange.Headers, inFieldMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	queryParams := queryInterface.(map[string]interface{})
 
-	for k, v := range queryParams {
+	queryParams, err := evaluateStringMap(exchange.QueryParams, inFieldMap)
+	if err != nil {
+		return nil, err
+	}
 
-		if v == nil {
-			continue
-		}
+	urlValue, err := evaluateString(exchange.Url, inFieldMap)
+	if err != nil {
+		return nil, err
+	}
+	url, ok := urlValue.(string)
+	if !ok || url == "" {
+		return nil, fmt.Errorf("url of exchange [%v] evaluated to [%v]", exchange.Name, urlValue)
+	}
 
-		queryParamsMap[k] = v.(string)
+	client := resty.R()
+	if body != nil {
+		client.SetBody(body)
 	}
+	client.SetHeaders(headers)
+	client.SetQueryParams(queryParams)
 
-	attrs := make(map[string]interface{})
-	urlStr, err := evaluateString(g.exchangeInformation.Url, inFieldMap)
+	if oauthToken != nil {
+		client.SetAuthToken(oauthToken.AccessToken)
+	}
+
+	response, err := client.Execute(strings.ToUpper(exchange.Method), url)
 	if err != nil {
-		return err
+		return response, err
 	}
-	attrs["url"] = urlStr
-	attrs["method"] = g.exchangeInformation.Method
+
+	log.Infof("Response from exchange [%v] %v %v: %v", exchange.Name, exchange.Method, url, response.StatusCode())
+
+	if response.StatusCode() >= 400 {
+		return response, &ExchangeHttpError{
+			Status: response.StatusCode(),
+			Body:   response.String(),
+		}
+	}
+
+	return response, nil
+}
+
+type RestExternalExchange struct {
+	oauthToken          *oauth2.Token
+	exchangeContract    ExchangeContract
+	exchangeInformation *RestExchange
+	oauthConfig         *oauth2.Config
+}
+
+func (g *RestExternalExchange) ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) (int, error) {
+
+	log.Infof("Execute rest external exchange")
 
 	body := g.exchangeInformation.Body
 
@@ -100,65 +187,39 @@ func (g *RestExternalExchange) ExecuteTarget(row map[string]interface{}, inField
 		bodyMap = row
 	} else {
 		inFieldMap["subject"] = row
+		var err error
 		bodyMap, err = buildActionContext(body, inFieldMap)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	buildAttrsInterface, err := buildActionContext(attrs, inFieldMap)
-	buildAttrs := buildAttrsInterface.(map[string]interface{})
-
-	url := buildAttrs["url"].(string)
-	method := buildAttrs["method"].(string)
-
-	resty.SetDebug(true)
-	client := resty.R()
-	client.SetBody(bodyMap)
-
-	client.SetHeaders(headersMap)
-	client.SetQueryParams(queryParamsMap)
-
-	client.SetAuthToken(g.oauthToken.AccessToken)
-
-	method = strings.ToLower(method)
-
-	var response *resty.Response
-
-	switch method {
-	case "get":
-		response, err = client.Get(url)
-		break
-	case "post":
-		response, err = client.Post(url)
-		break
-	case "put":
-		response, err = client.Put(url)
-		break
-	case "delete":
-		response, err = client.Delete(url)
-		break
-
+	response, err := executeRestExchange(g.exchangeInformation, bodyMap, inFieldMap, g.oauthToken)
+	if response != nil {
+		return response.StatusCode(), err
 	}
-	log.Infof("Response from exchange execution: %v", response.String())
-	log.Infof("Response from exchange execution: %v", err)
-
-	return nil
+	return 0, err
 }
 
 func NewRestExchangeHandler(exchangeContext ExchangeContract, oauthToken *oauth2.Token, oauthConfig *oauth2.Config) (ExternalExchange, error) {
 
-	found := false
 	var selected *RestExchange
 
-	for _, ra := range restExchanges {
+	if exchangeContext.TargetType == "rest" {
+		var err error
+		selected, err = restExchangeFromAttributes(exchangeContext.TargetAttributes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, ra := range restExchanges {
 		if ra.Name == exchangeContext.TargetType {
-			found = true
-			selected = &ra
+			selected = &restExchanges[i]
 		}
 	}
 
-	if !found {
+	if selected == nil {
 		return nil, errors.New(fmt.Sprintf("Unknown target type [%v]", exchangeContext.TargetType))
 	}
 
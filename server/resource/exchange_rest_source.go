@@ -0,0 +1,147 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"strconv"
+	"strings"
+)
+
+// RestExchangeSource reads rows from a rest api for a pull exchange
+// The url, method, headers and query source attributes describe the request, they are evaluated like action
+// attributes with "~cursor" being the cursor of the last run. The items attribute is the path of the list of rows
+// in the response, eg "data.items", the response itself is used if it is empty. The cursorColumn attribute names
+// a field of a row which only grows, like an updated timestamp or an id, the highest value read is kept as the cursor
+type RestExchangeSource struct {
+	exchange     *RestExchange
+	itemsPath    string
+	cursorColumn string
+	oauthToken   *oauth2.Token
+}
+
+func NewRestExchangeSource(contract ExchangeContract, oauthToken *oauth2.Token) (*RestExchangeSource, error) {
+
+	exchange, err := restExchangeFromAttributes(contract.SourceAttributes)
+	if err != nil {
+		return nil, err
+	}
+	exchange.Name = contract.Name
+
+	itemsPath, _ := contract.SourceAttributes["items"].(string)
+	cursorColumn, _ := contract.SourceAttributes["cursorColumn"].(string)
+
+	return &RestExchangeSource{
+		exchange:     exchange,
+		itemsPath:    itemsPath,
+		cursorColumn: cursorColumn,
+		oauthToken:   oauthToken,
+	}, nil
+}
+
+// Read fetches the rows changed after the cursor, returns the rows, the http status and the cursor for the next run
+func (rs *RestExchangeSource) Read(cursor string, inFieldMap map[string]interface{}) ([]map[string]interface{}, int, string, error) {
+
+	inFieldMap["cursor"] = cursor
+
+	response, err := executeRestExchange(rs.exchange, nil, inFieldMap, rs.oauthToken)
+	status := 0
+	if response != nil {
+		status = response.StatusCode()
+	}
+	if err != nil {
+		return nil, status, cursor, err
+	}
+
+	// numbers are kept as they were sent, a float64 would print large ids and timestamps in exponent form
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(response.Body()))
+	decoder.UseNumber()
+	err = decoder.Decode(&body)
+	if err != nil {
+		return nil, status, cursor, fmt.Errorf("response of [%v] is not json: %v", rs.exchange.Name, err)
+	}
+
+	items := body
+	if rs.itemsPath != "" {
+		items = valueAtPath(body, rs.itemsPath)
+	}
+
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil, status, cursor, fmt.Errorf("no list of rows at [%v] in response of [%v]", rs.itemsPath, rs.exchange.Name)
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	nextCursor := cursor
+	for _, item := range list {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rows = append(rows, row)
+
+		if rs.cursorColumn != "" {
+			value := valueAtPath(row, rs.cursorColumn)
+			if value != nil && cursorAfter(fmt.Sprintf("%v", value), nextCursor) {
+				nextCursor = fmt.Sprintf("%v", value)
+			}
+		}
+	}
+
+	return rows, status, nextCursor, nil
+}
+
+// cursorAfter compares cursor values as numbers when both are numeric, otherwise as strings which works for iso timestamps
+func cursorAfter(value string, cursor string) bool {
+	if cursor == "" {
+		return true
+	}
+	valueNumber, err1 := strconv.ParseFloat(value, 64)
+	cursorNumber, err2 := strconv.ParseFloat(cursor, 64)
+	if err1 == nil && err2 == nil {
+		return valueNumber > cursorNumber
+	}
+	return value > cursor
+}
+
+// rowsAfterCursor keeps the rows whose cursor column is after the cursor, for sources which always return every row
+// Returns the rows and the highest cursor value in them
+func rowsAfterCursor(rows []map[string]interface{}, cursorColumn string, cursor string) ([]map[string]interface{}, string) {
+
+	if cursorColumn == "" {
+		return rows, cursor
+	}
+
+	result := make([]map[string]interface{}, 0)
+	nextCursor := cursor
+	for _, row := range rows {
+		value := valueAtPath(row, cursorColumn)
+		if value == nil {
+			continue
+		}
+		valueString := fmt.Sprintf("%v", value)
+		if cursor != "" && !cursorAfter(valueString, cursor) {
+			continue
+		}
+		result = append(result, row)
+		if cursorAfter(valueString, nextCursor) {
+			nextCursor = valueString
+		}
+	}
+
+	return result, nextCursor
+}
+
+// valueAtPath returns the value at a dotted path in nested json objects
+func valueAtPath(value interface{}, path string) interface{} {
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
@@ -0,0 +1,138 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/artpar/api2go"
+	"net/http"
+)
+
+// columns which belong to the row they were read from and are never copied by an exchange
+var exchangeSkipColumns = map[string]bool{
+	"id":                   true,
+	"reference_id":         true,
+	"__type":               true,
+	"permission":           true,
+	"version":              true,
+	"created_at":           true,
+	"updated_at":           true,
+	USER_ACCOUNT_ID_COLUMN: true,
+}
+
+// SelfExchange writes rows into the local table named by the "name" target attribute
+// The "key" target attribute is a column which identifies a row, a row with the same value is updated instead of inserting a new one
+type SelfExchange struct {
+	contract  ExchangeContract
+	cruds     map[string]*DbResource
+	request   api2go.Request
+	tableName string
+	key       string
+}
+
+func NewSelfExchangeHandler(contract ExchangeContract, cruds map[string]*DbResource, req api2go.Request) (ExternalExchange, error) {
+
+	tableName, _ := contract.TargetAttributes["name"].(string)
+	if _, ok := cruds[tableName]; !ok {
+		return nil, fmt.Errorf("unknown target table [%v] for exchange [%v]", tableName, contract.Name)
+	}
+
+	key, _ := contract.TargetAttributes["key"].(string)
+
+	return &SelfExchange{
+		contract:  contract,
+		cruds:     cruds,
+		request:   req,
+		tableName: tableName,
+		key:       key,
+	}, nil
+}
+
+func (se *SelfExchange) requestWithMethod(method string) api2go.Request {
+	pr := &http.Request{
+		Method: method,
+	}
+	pr = pr.WithContext(se.request.PlainRequest.Context())
+	return api2go.Request{
+		PlainRequest: pr,
+		QueryParams:  map[string][]string{},
+	}
+}
+
+// ExecuteTarget writes the row as the user of the exchange, through the same validations, middlewares and
+// permission checks as a row written with the api
+func (se *SelfExchange) ExecuteTarget(row map[string]interface{}, inFieldMap map[string]interface{}) (int, error) {
+
+	values, err := mapExchangeRow(row, se.contract.Attributes, inFieldMap)
+	if err != nil {
+		return 0, err
+	}
+
+	crud := se.cruds[se.tableName]
+
+	if se.key != "" && values[se.key] != nil {
+		existing, err := crud.GetObjectByWhereClause(se.tableName, se.key, values[se.key], se.request.PlainRequest)
+		if err != nil {
+			return 0, err
+		}
+		if existing != nil {
+			// the changes of a model are what is set after it was made from the existing row
+			model := api2go.NewApi2GoModelWithData(se.tableName, nil, 0, nil, existing)
+			model.SetAttributes(values)
+			_, err = crud.Update(model, se.requestWithMethod("PATCH"))
+			return 0, err
+		}
+	}
+
+	model := api2go.NewApi2GoModelWithData(se.tableName, nil, int64(crud.TableInfo().DefaultPermission), nil, values)
+	_, err = crud.Create(model, se.requestWithMethod("POST"))
+	return 0, err
+}
+
+// mapExchangeRow builds the values to write from a row using the column mapping of the exchange
+// A source column is a dotted path in the row, or an expression like "$self.name" or "!subject.a + subject.b"
+// evaluated against the row available as subject and self. Without a mapping the row is copied as it is
+func mapExchangeRow(row map[string]interface{}, mapping []ColumnMap, inFieldMap map[string]interface{}) (map[string]interface{}, error) {
+
+	values := make(map[string]interface{})
+
+	if len(mapping) == 0 {
+		for key, value := range row {
+			if !exchangeSkipColumns[key] {
+				values[key] = value
+			}
+		}
+		return values, nil
+	}
+
+	context := make(map[string]interface{})
+	for key, value := range inFieldMap {
+		context[key] = value
+	}
+	context["subject"] = row
+	context["self"] = row
+
+	for _, column := range mapping {
+
+		targetColumn := column.TargetColumn
+		if targetColumn == "" {
+			targetColumn = column.SourceColumn
+		}
+
+		source := column.SourceColumn
+		if source == "" {
+			continue
+		}
+
+		switch source[0] {
+		case '$', '~', '!', ':':
+			value, err := evaluateString(source, context)
+			if err != nil {
+				return nil, err
+			}
+			values[targetColumn] = value
+		default:
+			values[targetColumn] = valueAtPath(row, source)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,310 @@
+package resource
+
+import (
+	"encoding/json"
+	"github.com/artpar/api2go"
+	_ "github.com/artpar/rclone/backend/local"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSheet stands in for the values api of google sheets
+type fakeSheet struct {
+	values [][]interface{}
+}
+
+func (f *fakeSheet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var body struct {
+		Values [][]interface{} `json:"values"`
+	}
+
+	switch {
+	case r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": f.values})
+		return
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, ":append"):
+		json.NewDecoder(r.Body).Decode(&body)
+		f.values = append(f.values, body.Values...)
+	case r.Method == "PUT":
+		json.NewDecoder(r.Body).Decode(&body)
+		valueRange := r.URL.Path[strings.LastIndex(r.URL.Path, "!A")+2:]
+		row := 0
+		for _, c := range valueRange {
+			row = row*10 + int(c-'0')
+		}
+		for len(f.values) < row {
+			f.values = append(f.values, []interface{}{})
+		}
+		f.values[row-1] = body.Values[0]
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func TestGoogleSheetExchangeUpdatesRowsByKey(t *testing.T) {
+
+	sheet := &fakeSheet{
+		values: [][]interface{}{
+			{"email", "name"},
+			{"a@example.com", "A"},
+		},
+	}
+	server := httptest.NewServer(sheet)
+	defer server.Close()
+
+	contract := ExchangeContract{Name: "contacts"}
+	exchange, err := NewGoogleSheetExchange(contract, map[string]interface{}{
+		"sheetId": "sheet1",
+		"key":     "email",
+		"baseUrl": server.URL,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []map[string]interface{}{
+		{"email": "a@example.com", "name": "A2"},
+		{"email": "b@example.com", "name": "B", "city": "Pune"},
+	}
+	for _, row := range rows {
+		_, err = exchange.ExecuteTarget(row, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sheet.values) != 3 {
+		t.Fatalf("expected 3 rows in the sheet, found %v", sheet.values)
+	}
+	if len(sheet.values[0]) != 3 || sheet.values[0][2] != "city" {
+		t.Errorf("expected the city column to be added to the header, found %v", sheet.values[0])
+	}
+	if sheet.values[1][1] != "A2" {
+		t.Errorf("expected the row of a@example.com to be updated, found %v", sheet.values[1])
+	}
+
+	read, _, cursor, err := exchange.Read("", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[1]["city"] != "Pune" || cursor != "" {
+		t.Errorf("unexpected rows read from the sheet: %v", read)
+	}
+}
+
+func TestFileExchangeWritesCsvAndXlsx(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "exchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store := CloudStore{Name: "local", RootPath: root, StoreProvider: "local"}
+
+	for _, path := range []string{"contacts.csv", "contacts.xlsx"} {
+
+		writer, err := NewFileExchange(ExchangeContract{Name: path}, map[string]interface{}{"path": path, "key": "code"}, store, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range []map[string]interface{}{
+			{"code": 1, "name": "A"},
+			{"code": 2, "name": "B"},
+			{"code": 1, "name": "A2"},
+		} {
+			_, err = writer.ExecuteTarget(row, map[string]interface{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = writer.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = os.Stat(filepath.Join(root, path)); err != nil {
+			t.Fatalf("expected [%v] to be written: %v", path, err)
+		}
+
+		reader, err := NewFileExchange(ExchangeContract{Name: path}, map[string]interface{}{"path": path, "cursorColumn": "code"}, store, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, _, cursor, err := reader.Read("1", map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0]["name"] != "B" || cursor != "2" {
+			t.Errorf("unexpected rows read from [%v] after cursor 1: %v, cursor %v", path, rows, cursor)
+		}
+
+		rows, _, _, err = reader.Read("", map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[0]["name"] != "A2" {
+			t.Errorf("expected the row with code 1 to be updated in [%v]: %v", path, rows)
+		}
+	}
+}
+
+// rejectingSheet fails the rows appended with a rejected value and stores the others
+type rejectingSheet struct {
+	fakeSheet
+	rejected string
+}
+
+func (r *rejectingSheet) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" {
+		body, _ := ioutil.ReadAll(req.Body)
+		if strings.Contains(string(body), r.rejected) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "rejected"}`))
+			return
+		}
+		req.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	}
+	r.fakeSheet.ServeHTTP(w, req)
+}
+
+func TestPullAdvancesCursorPastFailedRows(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table user_account (id integer primary key, email varchar(100))",
+		"create table usergroup (id integer primary key)",
+		"insert into user_account (email) values ('admin@example.com')",
+		"insert into usergroup (id) values (1)",
+		`create table data_exchange_run (id integer primary key autoincrement, data_exchange_id int, exchange_name text,
+			direction text, started_at timestamp, ended_at timestamp, duration_ms int, outcome text, response_status int,
+			rows_read int, rows_written int, rows_failed int, sync_cursor text, error text, reference_id text, permission int,
+			created_at timestamp, user_account_id int)`,
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	source := httptest.NewServer(&fakeSheet{
+		values: [][]interface{}{
+			{"code", "name"},
+			{"1", "A"},
+			{"2", "bad"},
+			{"3", "C"},
+		},
+	})
+	defer source.Close()
+	target := &rejectingSheet{fakeSheet: fakeSheet{values: [][]interface{}{{"code", "name"}}}, rejected: "bad"}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	contract := ExchangeContract{
+		Id:               1,
+		Name:             "codes",
+		SourceType:       "gsheet",
+		SourceAttributes: map[string]interface{}{"sheetId": "source", "baseUrl": source.URL, "cursorColumn": "code"},
+		TargetType:       "gsheet",
+		TargetAttributes: map[string]interface{}{"sheetId": "target", "baseUrl": targetServer.URL, "key": "code"},
+	}
+	cruds := map[string]*DbResource{"data_exchange_run": {db: db}}
+
+	run, err := NewExchangeExecution(contract, nil, nil, cruds, api2go.Request{}).Pull(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("expected a failed row to not fail the run: %v", err)
+	}
+	if run.Outcome != ExchangeRunPartial || run.RowsWritten != 2 || run.RowsFailed != 1 || run.Cursor != "3" {
+		t.Errorf("expected two rows written and one failed with the cursor at 3, got %+v", run)
+	}
+	if !strings.Contains(run.Error, "row 2:") {
+		t.Errorf("expected the failed row in the run log, got [%v]", run.Error)
+	}
+
+	// the next run starts after the failed row instead of reading it again
+	run, err = NewExchangeExecution(contract, nil, nil, cruds, api2go.Request{}).Pull(map[string]interface{}{})
+	if err != nil || run.RowsRead != 0 || run.Outcome != ExchangeRunSuccess {
+		t.Errorf("expected the second run to read nothing, got %+v: %v", run, err)
+	}
+	if len(target.values) != 3 {
+		t.Errorf("expected the other rows in the target, found %v", target.values)
+	}
+}
+
+// interceptorFunc runs a function before a write, as a middleware
+type interceptorFunc func(rows []map[string]interface{}) error
+
+func (f interceptorFunc) InterceptBefore(dr *DbResource, req *api2go.Request, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	return rows, f(rows)
+}
+
+func (f interceptorFunc) InterceptAfter(dr *DbResource, req *api2go.Request, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	return rows, nil
+}
+
+func (f interceptorFunc) String() string {
+	return "interceptorFunc"
+}
+
+func TestSelfExchangeWritesThroughTheMiddlewares(t *testing.T) {
+
+	db, crud := newImportTestResource(t)
+	defer db.Close()
+	for _, query := range []string{
+		"alter table contact add column permission int",
+		"alter table contact add column created_at timestamp",
+		"alter table contact add column updated_at timestamp",
+	} {
+		_, err := db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	created := 0
+	crud.ms = &MiddlewareSet{
+		BeforeCreate: []DatabaseRequestInterceptor{interceptorFunc(func(rows []map[string]interface{}) error {
+			created += 1
+			return nil
+		})},
+		BeforeUpdate: []DatabaseRequestInterceptor{interceptorFunc(func(rows []map[string]interface{}) error {
+			return api2go.NewHTTPError(nil, "forbidden", 403)
+		})},
+	}
+
+	contract := ExchangeContract{Name: "contacts", TargetAttributes: map[string]interface{}{"name": "contact", "key": "email"}}
+	req := api2go.Request{PlainRequest: httptest.NewRequest("POST", "/", nil)}
+	exchange, err := NewSelfExchangeHandler(contract, crud.Cruds, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = exchange.ExecuteTarget(map[string]interface{}{"email": "b@example.com", "name": "B"}, map[string]interface{}{})
+	if err != nil || created != 1 {
+		t.Errorf("expected a new row to be created through the middlewares, got %d: %v", created, err)
+	}
+
+	// the user of the exchange cannot update the stored row
+	_, err = exchange.ExecuteTarget(map[string]interface{}{"email": "a@example.com", "name": "A2"}, map[string]interface{}{})
+	var name string
+	db.Get(&name, "select name from contact where email = 'a@example.com'")
+	if err == nil || name != "A" {
+		t.Errorf("expected the update of a stored row to be refused, got [%v]: %v", name, err)
+	}
+}
@@ -1,18 +1,31 @@
 package resource
 
+import (
+	"github.com/artpar/api2go"
+	"strconv"
+)
+
 type FsmManager interface {
-	ApplyEvent(subject map[string]interface{}, stateMachineEvent StateMachineEvent) (string, error)
+	ApplyEvent(subject map[string]interface{}, stateMachineEvent StateMachineEvent, req api2go.Request) (string, error)
+	AllowedEvents(typeName string, stateReferenceId string) (string, []AllowedEvent, error)
+	History(typeName string, stateReferenceId string) ([]StateTransition, error)
+	Description(machineReferenceId string) (LoopbookFsmDescription, error)
 }
 
 type simpleStateMachinEvent struct {
 	machineReferenceId string
 	eventName          string
+	eventData          map[string]interface{}
 }
 
-func NewStateMachineEvent(machineId string, eventName string) StateMachineEvent {
+func NewStateMachineEvent(machineId string, eventName string, eventData map[string]interface{}) StateMachineEvent {
+	if eventData == nil {
+		eventData = make(map[string]interface{})
+	}
 	return &simpleStateMachinEvent{
 		machineReferenceId: machineId,
 		eventName:          eventName,
+		eventData:          eventData,
 	}
 }
 
@@ -22,8 +35,26 @@ func (f *simpleStateMachinEvent) GetStateMachineInstanceId() string {
 func (f *simpleStateMachinEvent) GetEventName() string {
 	return f.eventName
 }
+func (f *simpleStateMachinEvent) GetEventData() map[string]interface{} {
+	return f.eventData
+}
 
 type StateMachineEvent interface {
 	GetStateMachineInstanceId() string
 	GetEventName() string
+	// GetEventData returns the input fields sent along with the event
+	GetEventData() map[string]interface{}
+}
+
+// NewStateMachineEventError is returned when an event is rejected, the status is used as the http response status
+func NewStateMachineEventError(status int, code string, message string) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(nil, message, status)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(status),
+			Code:   code,
+			Title:  message,
+		},
+	}
+	return httpErr
 }
@@ -0,0 +1,270 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"regexp"
+	"strings"
+)
+
+// StateTransition is one step in the history of a state machine instance
+type StateTransition struct {
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Version int64       `json:"version"`
+	At      interface{} `json:"at"`
+}
+
+// AllowedEvent is an event which can be applied to a state machine instance, with the input fields it needs
+type AllowedEvent struct {
+	Name     string
+	Label    string
+	InFields []api2go.ColumnInfo `json:",omitempty"`
+}
+
+type stateRowInfo struct {
+	currentState string
+	machineId    int64
+	objectId     int64
+}
+
+func (fsm *fsmManager) getStateRow(typeName string, stateReferenceId string) (stateRowInfo, error) {
+
+	var row stateRowInfo
+
+	s, v, err := statementbuilder.Squirrel.Select("current_state", typeName+"_smd", "is_state_of_"+typeName).
+		From(typeName + "_state").
+		Where(squirrel.Eq{"reference_id": stateReferenceId}).ToSql()
+	if err != nil {
+		return row, err
+	}
+
+	err = fsm.db.QueryRowx(s, v...).Scan(&row.currentState, &row.machineId, &row.objectId)
+	return row, err
+}
+
+// AllowedEvents returns the current state of the instance and the events which can be applied in it
+// Guards are evaluated against the subject, a guard which needs the data sent with the event cannot be
+// evaluated yet and leaves the event in the list. Only the name, label and input fields of an event are returned
+func (fsm *fsmManager) AllowedEvents(typeName string, stateReferenceId string) (string, []AllowedEvent, error) {
+
+	stateRow, err := fsm.getStateRow(typeName, stateReferenceId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	currentState, events, err := fsm.stateMachineEventsFor(stateRow.currentState, stateRow.machineId)
+	if err != nil {
+		return currentState, nil, err
+	}
+
+	subject, err := fsm.cruds[typeName].GetIdToObject(typeName, stateRow.objectId)
+	if err != nil {
+		return currentState, nil, err
+	}
+	context := eventContext(subject, NewStateMachineEvent(stateReferenceId, "", nil))
+
+	allowed := make([]AllowedEvent, 0)
+	for _, event := range events {
+		if findEvent([]LoopbackEventDesc{event}, event.Name, currentState) == nil {
+			continue
+		}
+		if event.Guard != "" {
+			if permitted, err := evaluateCondition(event.Guard, context); err == nil && !permitted {
+				continue
+			}
+		}
+		allowed = append(allowed, AllowedEvent{
+			Name:     event.Name,
+			Label:    event.Label,
+			InFields: event.InFields,
+		})
+	}
+
+	return currentState, allowed, nil
+}
+
+// History lists the transitions of the instance, oldest first, from the audit table of the state table
+// Every audit row holds the state before a change, changes which kept the state are left out
+func (fsm *fsmManager) History(typeName string, stateReferenceId string) ([]StateTransition, error) {
+
+	stateRow, err := fsm.getStateRow(typeName, stateReferenceId)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]StateTransition, 0)
+
+	auditTable := typeName + "_state_audit"
+	if _, ok := fsm.cruds[auditTable]; !ok {
+		return history, nil
+	}
+
+	// audit rows keep the reference ids of the subject and the state machine in place of the foreign keys
+	objectReferenceId, err := fsm.cruds[typeName].GetIdToReferenceId(typeName, stateRow.objectId)
+	if err != nil {
+		return nil, err
+	}
+	machineReferenceId, err := fsm.cruds["smd"].GetIdToReferenceId("smd", stateRow.machineId)
+	if err != nil {
+		return nil, err
+	}
+
+	s, v, err := statementbuilder.Squirrel.Select("current_state", "version", "created_at").
+		From(auditTable).
+		Where(squirrel.Eq{"is_state_of_" + typeName: objectReferenceId}).
+		Where(squirrel.Eq{typeName + "_smd": machineReferenceId}).
+		OrderBy("version", "id").ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := fsm.db.Queryx(s, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transition StateTransition
+		err = rows.Scan(&transition.From, &transition.Version, &transition.At)
+		if err != nil {
+			return nil, err
+		}
+		if asBytes, ok := transition.At.([]uint8); ok {
+			transition.At = string(asBytes)
+		}
+		if len(history) > 0 {
+			history[len(history)-1].To = transition.From
+		}
+		history = append(history, transition)
+	}
+
+	if len(history) > 0 {
+		history[len(history)-1].To = stateRow.currentState
+	}
+
+	transitions := make([]StateTransition, 0)
+	for _, transition := range history {
+		if transition.From != transition.To {
+			transitions = append(transitions, transition)
+		}
+	}
+
+	return transitions, nil
+}
+
+// Description loads a state machine definition from the smd table
+func (fsm *fsmManager) Description(machineReferenceId string) (LoopbookFsmDescription, error) {
+
+	var description LoopbookFsmDescription
+
+	s, v, err := statementbuilder.Squirrel.Select("name", "label", "initial_state", "events").
+		From("smd").
+		Where(squirrel.Eq{"reference_id": machineReferenceId}).ToSql()
+	if err != nil {
+		return description, err
+	}
+
+	var eventsJson string
+	err = fsm.db.QueryRowx(s, v...).Scan(&description.Name, &description.Label, &description.InitialState, &eventsJson)
+	if err != nil {
+		return description, err
+	}
+
+	err = json.Unmarshal([]byte(eventsJson), &description.Events)
+	return description, err
+}
+
+func eventLabel(event LoopbackEventDesc) string {
+	label := event.Label
+	if label == "" {
+		label = event.Name
+	}
+	if event.After != "" {
+		label = label + " (after " + event.After + ")"
+	}
+	return label
+}
+
+func dotQuote(value string) string {
+	return `"` + strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// StateMachineToDot renders the state machine as a graphviz digraph
+func StateMachineToDot(description LoopbookFsmDescription) string {
+
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "digraph %s {\n", dotQuote(description.Name))
+	if description.Label != "" {
+		fmt.Fprintf(&out, "  label=%s;\n", dotQuote(description.Label))
+	}
+	out.WriteString("  rankdir=LR;\n")
+	out.WriteString("  node [shape=box, style=rounded];\n")
+	out.WriteString("  \"__start\" [shape=point];\n")
+	fmt.Fprintf(&out, "  \"__start\" -> %s;\n", dotQuote(description.InitialState))
+
+	for _, event := range description.Events {
+		attributes := "label=" + dotQuote(eventLabel(event))
+		if event.Color != "" {
+			attributes = attributes + ", color=" + dotQuote(event.Color)
+		}
+		if event.After != "" {
+			attributes = attributes + ", style=dashed"
+		}
+		for _, src := range event.Src {
+			fmt.Fprintf(&out, "  %s -> %s [%s];\n", dotQuote(src), dotQuote(event.Dst), attributes)
+		}
+	}
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+var mermaidUnsafeCharacters = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// StateMachineToMermaid renders the state machine as a mermaid state diagram
+// States with characters mermaid does not accept in an id are declared with an alias, a number is added to an
+// alias which is already taken, so "in-review" and "in_review" stay two states
+func StateMachineToMermaid(description LoopbookFsmDescription) string {
+
+	var out bytes.Buffer
+	out.WriteString("stateDiagram-v2\n")
+
+	ids := make(map[string]string)
+	taken := make(map[string]bool)
+	stateId := func(state string) string {
+		if id, ok := ids[state]; ok {
+			return id
+		}
+		base := mermaidUnsafeCharacters.ReplaceAllString(state, "_")
+		id := base
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		ids[state] = id
+		taken[id] = true
+		if id != state {
+			fmt.Fprintf(&out, "    state \"%s\" as %s\n", strings.Replace(state, `"`, "'", -1), id)
+		}
+		return id
+	}
+
+	fmt.Fprintf(&out, "    [*] --> %s\n", stateId(description.InitialState))
+
+	for _, event := range description.Events {
+		label := strings.Replace(eventLabel(event), "\n", " ", -1)
+		for _, src := range event.Src {
+			from := stateId(src)
+			to := stateId(event.Dst)
+			fmt.Fprintf(&out, "    %s --> %s : %s\n", from, to, label)
+		}
+	}
+
+	return out.String()
+}
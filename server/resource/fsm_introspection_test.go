@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"encoding/json"
+	"github.com/artpar/api2go"
+	"strings"
+	"testing"
+)
+
+var ticketStateMachine = LoopbookFsmDescription{
+	Name:         "ticket",
+	Label:        "Ticket",
+	InitialState: "new",
+	Events: []LoopbackEventDesc{
+		{Name: "resolve", Label: "Resolve", Src: []string{"new", "in progress"}, Dst: "resolved"},
+		{Name: "close", Src: []string{"resolved"}, Dst: "closed", After: "7d"},
+	},
+}
+
+func TestStateMachineToDot(t *testing.T) {
+
+	dot := StateMachineToDot(ticketStateMachine)
+
+	expected := []string{
+		`digraph "ticket" {`,
+		`"__start" -> "new";`,
+		`"new" -> "resolved" [label="Resolve"];`,
+		`"in progress" -> "resolved" [label="Resolve"];`,
+		`"resolved" -> "closed" [label="close (after 7d)", style=dashed];`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(dot, line) {
+			t.Errorf("expected [%v] in dot output:\n%v", line, dot)
+		}
+	}
+}
+
+func TestStateMachineToMermaid(t *testing.T) {
+
+	mermaid := StateMachineToMermaid(ticketStateMachine)
+
+	expected := []string{
+		"stateDiagram-v2",
+		"[*] --> new",
+		`state "in progress" as in_progress`,
+		"in_progress --> resolved : Resolve",
+		"resolved --> closed : close (after 7d)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(mermaid, line) {
+			t.Errorf("expected [%v] in mermaid output:\n%v", line, mermaid)
+		}
+	}
+	if strings.Count(mermaid, `state "in progress"`) != 1 {
+		t.Errorf("expected a state to be declared once:\n%v", mermaid)
+	}
+}
+
+func TestStateMachineToMermaidKeepsSimilarStatesApart(t *testing.T) {
+
+	mermaid := StateMachineToMermaid(LoopbookFsmDescription{
+		Name:         "review",
+		InitialState: "in-review",
+		Events: []LoopbackEventDesc{
+			{Name: "move", Src: []string{"in-review"}, Dst: "in_review"},
+		},
+	})
+
+	expected := []string{
+		`state "in-review" as in_review`,
+		`state "in_review" as in_review_2`,
+		"in_review --> in_review_2 : move",
+	}
+	for _, line := range expected {
+		if !strings.Contains(mermaid, line) {
+			t.Errorf("expected [%v] in mermaid output:\n%v", line, mermaid)
+		}
+	}
+}
+
+func TestAllowedEventsAreFilteredByGuard(t *testing.T) {
+
+	db, fsm := newStateMachineTestResource(t, `[
+		{"Name": "approve", "Label": "Approve", "Src": ["new"], "Dst": "approved", "Guard": "!subject.amount < 1000",
+			"OnEnter": [{"Action": "notify"}]},
+		{"Name": "escalate", "Src": ["new"], "Dst": "escalated", "Guard": "!subject.amount > 1000"},
+		{"Name": "reject", "Src": ["new"], "Dst": "rejected", "InFields": [{"Name": "reason", "ColumnName": "reason", "ColumnType": "label"}]},
+		{"Name": "close", "Src": ["approved"], "Dst": "closed"}
+	]`)
+	defer db.Close()
+
+	currentState, events, err := fsm.AllowedEvents("ticket", "s1")
+	if err != nil || currentState != "new" {
+		t.Fatalf("expected the allowed events of a new ticket, got %v: %v", currentState, err)
+	}
+
+	names := make([]string, 0)
+	for _, event := range events {
+		names = append(names, event.Name)
+	}
+	if strings.Join(names, ",") != "approve,reject" {
+		t.Errorf("expected the events of the state with a passing guard, got %v", names)
+	}
+	if len(events) == 2 && (events[0].Label != "Approve" || len(events[1].InFields) != 1) {
+		t.Errorf("expected the label and the input fields of the events, got %+v", events)
+	}
+
+	asJson, _ := json.Marshal(events)
+	if strings.Contains(string(asJson), "Guard") || strings.Contains(string(asJson), "OnEnter") {
+		t.Errorf("expected only the name, label and input fields of the events, got %s", asJson)
+	}
+}
+
+func TestStateHistoryFromTheAuditTable(t *testing.T) {
+
+	db, fsm := newStateMachineTestResource(t, `[]`)
+	defer db.Close()
+
+	for _, query := range []string{
+		"create table ticket_state_audit (id integer primary key, current_state varchar(100), ticket_smd varchar(40), is_state_of_ticket varchar(40), " +
+			"version int, created_at timestamp)",
+		"insert into ticket_state_audit (current_state, ticket_smd, is_state_of_ticket, version, created_at) values " +
+			"('new', 'm1', 't1', 1, '2026-01-01 10:00:00'), ('approved', 'm1', 't1', 2, '2026-01-02 10:00:00'), " +
+			"('approved', 'm1', 't1', 3, '2026-01-03 10:00:00'), ('new', 'm1', 'other', 1, '2026-01-01 10:00:00')",
+		"update ticket_state set current_state = 'closed' where reference_id = 's1'",
+	} {
+		_, err := db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare the audit table: %v", err)
+		}
+	}
+	for _, tableName := range []string{"smd", "ticket_state_audit"} {
+		table := TableInfo{TableName: tableName}
+		fsm.cruds[tableName] = NewDbResource(api2go.NewApi2GoModel(tableName, nil, 0, nil), db, nil, fsm.cruds, nil, table)
+	}
+
+	history, err := fsm.History("ticket", "s1")
+	if err != nil {
+		t.Fatalf("failed to read the history: %v", err)
+	}
+
+	// the change which kept the ticket approved is left out
+	if len(history) != 2 ||
+		history[0].From != "new" || history[0].To != "approved" || history[0].Version != 1 ||
+		history[1].From != "approved" || history[1].To != "closed" || history[1].Version != 3 {
+		t.Errorf("expected the ticket to move from new to approved to closed, got %+v", history)
+	}
+}
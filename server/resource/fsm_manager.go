@@ -3,12 +3,14 @@ package resource
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/artpar/api2go"
 	"github.com/daptin/daptin/server/database"
 	"github.com/daptin/daptin/server/statementbuilder"
 	loopfsm "github.com/looplab/fsm"
-	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/Masterminds/squirrel"
+	"net/http"
+	"time"
 )
 
 type fsmManager struct {
@@ -55,6 +57,15 @@ func (fsm *fsmManager) getStateMachineInstance(objType string, objId int64, mach
 	return res, nil
 }
 
+// StateMachineEventAction is an action executed as part of a transition
+// Attributes are evaluated like the attributes of an outcome, against the subject and the event data
+type StateMachineEventAction struct {
+	Action string
+	// OnType is the entity the action is defined on, defaults to the type of the subject
+	OnType     string
+	Attributes map[string]interface{}
+}
+
 type LoopbackEventDesc struct {
 	// Name is the event name used when calling for a transition.
 	Name  string
@@ -68,6 +79,24 @@ type LoopbackEventDesc struct {
 	// Dst is the destination state that the FSM will be in if the transition
 	// succeeds.
 	Dst string
+
+	// Guard is evaluated against the subject and the event data before the transition,
+	// using the same syntax as an outcome condition, eg "!subject.amount < 1000"
+	// The event is rejected unless the guard is true
+	Guard string `json:",omitempty"`
+
+	// InFields have to be sent along with the event, they are checked like the InFields of an action
+	InFields []api2go.ColumnInfo `json:",omitempty"`
+
+	// OnExit actions run before leaving the source state, a failing action cancels the transition
+	OnExit []StateMachineEventAction `json:",omitempty"`
+
+	// OnEnter actions run after the destination state is stored
+	OnEnter []StateMachineEventAction `json:",omitempty"`
+
+	// After makes the event fire on its own once the object has been in one of the Src states for this long, eg "1h" or "7d"
+	// Timed events are checked every minute, they cannot have InFields
+	After string `json:",omitempty"`
 }
 
 type LoopbookFsmDescription struct {
@@ -77,11 +106,11 @@ type LoopbookFsmDescription struct {
 	Events       []LoopbackEventDesc
 }
 
-func (fsm *fsmManager) stateMachineRunnerFor(currentState string, typeName string, machineId int64) (*loopfsm.FSM, error) {
+func (fsm *fsmManager) stateMachineEventsFor(currentState string, machineId int64) (string, []LoopbackEventDesc, error) {
 
 	s, v, err := statementbuilder.Squirrel.Select("initial_state", "events").From("smd").Where(squirrel.Eq{"id": machineId}).ToSql()
 	if err != nil {
-		return nil, err
+		return currentState, nil, err
 	}
 
 	var jsonValue string
@@ -91,7 +120,7 @@ func (fsm *fsmManager) stateMachineRunnerFor(currentState string, typeName strin
 	if currentState == "" {
 
 		if err != nil {
-			return nil, err
+			return currentState, nil, err
 		}
 		currentState = initialState
 	}
@@ -99,9 +128,14 @@ func (fsm *fsmManager) stateMachineRunnerFor(currentState string, typeName strin
 	var events []LoopbackEventDesc
 	err = json.Unmarshal([]byte(jsonValue), &events)
 	if err != nil {
-		return nil, err
+		return currentState, nil, err
 	}
 
+	return currentState, events, nil
+}
+
+func (fsm *fsmManager) stateMachineRunnerFor(currentState string, events []LoopbackEventDesc, callbacks map[string]loopfsm.Callback) *loopfsm.FSM {
+
 	listOfEvents := make([]loopfsm.EventDesc, 0)
 	for _, e := range events {
 		e1 := loopfsm.EventDesc{
@@ -112,11 +146,114 @@ func (fsm *fsmManager) stateMachineRunnerFor(currentState string, typeName strin
 		listOfEvents = append(listOfEvents, e1)
 	}
 
-	fsmI := loopfsm.NewFSM(currentState, listOfEvents, map[string]loopfsm.Callback{})
-	return fsmI, nil
+	return loopfsm.NewFSM(currentState, listOfEvents, callbacks)
+}
+
+// findEvent returns the description of the event which applies in the current state
+// an event name can be listed more than once with different source states
+func findEvent(events []LoopbackEventDesc, eventName string, currentState string) *LoopbackEventDesc {
+	for i, e := range events {
+		if e.Name != eventName {
+			continue
+		}
+		for _, src := range e.Src {
+			if src == currentState {
+				return &events[i]
+			}
+		}
+	}
+	return nil
+}
+
+// the context guards and action attributes are evaluated against, the event data is available at top level like action inputs
+func eventContext(subject map[string]interface{}, stateMachineEvent StateMachineEvent) map[string]interface{} {
+	context := make(map[string]interface{})
+	for key, val := range stateMachineEvent.GetEventData() {
+		context[key] = val
+	}
+	context["attributes"] = stateMachineEvent.GetEventData()
+	context["subject"] = subject
+	return context
+}
+
+func (fsm *fsmManager) checkEvent(eventDesc *LoopbackEventDesc, stateMachineEvent StateMachineEvent, context map[string]interface{}) error {
+
+	if len(eventDesc.InFields) > 0 {
+		_, err := GetValidatedInFields(&ActionRequest{
+			Attributes: stateMachineEvent.GetEventData(),
+		}, Action{
+			InFields: eventDesc.InFields,
+		})
+		if err != nil {
+			return NewStateMachineEventError(400, "missing-field", err.Error())
+		}
+	}
+
+	if eventDesc.Guard != "" {
+		allowed, err := evaluateCondition(eventDesc.Guard, context)
+		if err != nil {
+			log.Errorf("Failed to evaluate guard of event [%v]: %v", eventDesc.Name, err)
+			return NewStateMachineEventError(422, "guard-failed", fmt.Sprintf("Event [%v] is not allowed, the guard could not be evaluated", eventDesc.Name))
+		}
+		if !allowed {
+			return NewStateMachineEventError(422, "guard-failed", fmt.Sprintf("Event [%v] is not allowed for this object", eventDesc.Name))
+		}
+	}
+
+	return nil
+}
+
+func (fsm *fsmManager) runEventActions(eventActions []StateMachineEventAction, subject map[string]interface{}, context map[string]interface{}, req api2go.Request) error {
+
+	subjectType := subject["__type"].(string)
+
+	for _, eventAction := range eventActions {
+
+		onType := eventAction.OnType
+		if onType == "" {
+			onType = subjectType
+		}
+
+		attributes := make(map[string]interface{})
+		if len(eventAction.Attributes) > 0 {
+			evaluated, err := buildActionContext(eventAction.Attributes, context)
+			if err != nil {
+				return err
+			}
+			attributes = evaluated.(map[string]interface{})
+		}
+
+		if _, ok := attributes[onType+"_id"]; !ok && onType == subjectType {
+			attributes[onType+"_id"] = subject["reference_id"]
+		}
+
+		actionCrudResource, ok := fsm.cruds[onType]
+		if !ok {
+			actionCrudResource = fsm.cruds["world"]
+		}
+
+		// every action gets its own request, HandleActionRequest changes the method
+		actionRequest := api2go.Request{
+			PlainRequest: (&http.Request{
+				Method: "POST",
+			}).WithContext(req.PlainRequest.Context()),
+		}
+
+		_, err := actionCrudResource.HandleActionRequest(&ActionRequest{
+			Type:       onType,
+			Action:     eventAction.Action,
+			Attributes: attributes,
+		}, actionRequest)
+		if err != nil {
+			return fmt.Errorf("action [%v] on [%v] failed: %v", eventAction.Action, onType, err)
+		}
+	}
+
+	return nil
 }
 
-func (fsm *fsmManager) ApplyEvent(subject map[string]interface{}, stateMachineEvent StateMachineEvent) (string, error) {
+// ApplyEvent moves the object to the next state and stores it, the OnEnter actions run once the new state is stored
+func (fsm *fsmManager) ApplyEvent(subject map[string]interface{}, stateMachineEvent StateMachineEvent, req api2go.Request) (string, error) {
 
 	objType := subject["__type"].(string)
 	objReferenceId := subject["reference_id"].(string)
@@ -132,26 +269,93 @@ func (fsm *fsmManager) ApplyEvent(subject map[string]interface{}, stateMachineEv
 		return "", err
 	}
 
-	stateMachineRunner, err := fsm.stateMachineRunnerFor(stateMachineInstance.CurrestState, objType, stateMachineInstance.StateMachineId)
+	currentState, events, err := fsm.stateMachineEventsFor(stateMachineInstance.CurrestState, stateMachineInstance.StateMachineId)
 	if err != nil {
 		return "", err
 	}
 
-	if stateMachineRunner.Can(stateMachineEvent.GetEventName()) {
-		err := stateMachineRunner.Event(stateMachineEvent.GetEventName())
+	eventName := stateMachineEvent.GetEventName()
+	eventDesc := findEvent(events, eventName, currentState)
+	if eventDesc == nil {
+		return stateMachineInstance.CurrestState,
+			NewStateMachineEventError(400, "invalid-event", fmt.Sprintf("Cannot apply event %s at this state [%v]",
+				eventName, stateMachineInstance.CurrestState),
+			)
+	}
+
+	context := eventContext(subject, stateMachineEvent)
+
+	callbacks := map[string]loopfsm.Callback{
+		"before_" + eventName: func(e *loopfsm.Event) {
+			err := fsm.checkEvent(eventDesc, stateMachineEvent, context)
+			if err != nil {
+				e.Cancel(err)
+			}
+		},
+		"leave_state": func(e *loopfsm.Event) {
+			err := fsm.runEventActions(eventDesc.OnExit, subject, context, req)
+			if err != nil {
+				e.Cancel(NewStateMachineEventError(422, "exit-action-failed", err.Error()))
+			}
+		},
+	}
+
+	stateMachineRunner := fsm.stateMachineRunnerFor(currentState, events, callbacks)
+
+	if stateMachineRunner.Can(eventName) {
+		err := stateMachineRunner.Event(eventName)
 		nextState := stateMachineRunner.Current()
-		if err == nil || err.Error() == "no transition" {
-			return nextState, nil
+		if canceled, ok := err.(loopfsm.CanceledError); ok && canceled.Err != nil {
+			return stateMachineInstance.CurrestState, canceled.Err
+		}
+		entered := err == nil
+		if err != nil && err.Error() != "no transition" {
+			return nextState, err
 		}
-		return nextState, err
+
+		err = fsm.storeState(objType, stateMachineEvent.GetStateMachineInstanceId(), stateMachineInstance.CurrestState, nextState)
+		if err != nil {
+			return stateMachineInstance.CurrestState, err
+		}
+
+		if entered {
+			// the new state is stored, a failing action does not undo it
+			err = fsm.runEventActions(eventDesc.OnEnter, subject, context, req)
+			CheckErr(err, "Failed to run enter actions of event [%v]", eventName)
+		}
+		return nextState, nil
 	} else {
 		return stateMachineInstance.CurrestState,
-			errors.New(fmt.Sprintf("Cannot apply event %s at this state [%v]",
-				stateMachineEvent.GetEventName(), stateMachineInstance.CurrestState),
+			NewStateMachineEventError(400, "invalid-event", fmt.Sprintf("Cannot apply event %s at this state [%v]",
+				eventName, stateMachineInstance.CurrestState),
 			)
 	}
 
 }
+
+// storeState moves the state row to nextState, unless the row left currentState while the event was applied
+func (fsm *fsmManager) storeState(objType string, stateReferenceId string, currentState string, nextState string) error {
+
+	s, v, err := statementbuilder.Squirrel.Update(objType+"_state").
+		Set("current_state", nextState).
+		Set("version", squirrel.Expr("version + 1")).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"reference_id": stateReferenceId}).
+		Where(squirrel.Eq{"current_state": currentState}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	result, err := fsm.db.Exec(s, v...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return NewStateMachineEventError(409, "state-changed", fmt.Sprintf("The state changed from [%v] while the event was applied", currentState))
+	}
+	return nil
+}
+
 func ReferenceIdToIntegerId(typeName string, referenceId string, db database.DatabaseConnection) (int64, error) {
 
 	s, v, err := statementbuilder.Squirrel.Select("id").From(typeName).Where(squirrel.Eq{"reference_id": referenceId}).ToSql()
@@ -0,0 +1,127 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"testing"
+)
+
+func TestStateMachineEventGuardsAndInFields(t *testing.T) {
+
+	events := []LoopbackEventDesc{
+		{Name: "approve", Src: []string{"new"}, Dst: "approved", Guard: "!subject.amount < 1000"},
+		{Name: "reject", Src: []string{"new", "approved"}, Dst: "rejected", InFields: []api2go.ColumnInfo{
+			{Name: "reason", ColumnName: "reason", ColumnType: "label"},
+		}},
+	}
+
+	if findEvent(events, "approve", "approved") != nil {
+		t.Errorf("expected approve to not apply to an approved object")
+	}
+	approve := findEvent(events, "approve", "new")
+	reject := findEvent(events, "reject", "approved")
+	if approve == nil || reject == nil {
+		t.Fatalf("expected the events to apply to their source states")
+	}
+
+	fsm := &fsmManager{}
+
+	cases := []struct {
+		name    string
+		event   *LoopbackEventDesc
+		subject map[string]interface{}
+		data    map[string]interface{}
+		status  int
+	}{
+		{"guard passes", approve, map[string]interface{}{"amount": 500}, map[string]interface{}{}, 0},
+		{"guard fails", approve, map[string]interface{}{"amount": 5000}, map[string]interface{}{}, 422},
+		{"in field missing", reject, map[string]interface{}{}, map[string]interface{}{}, 400},
+		{"in field given", reject, map[string]interface{}{}, map[string]interface{}{"reason": "duplicate"}, 0},
+	}
+
+	for _, c := range cases {
+		stateMachineEvent := NewStateMachineEvent("machine", c.event.Name, c.data)
+		err := fsm.checkEvent(c.event, stateMachineEvent, eventContext(c.subject, stateMachineEvent))
+		if c.status == 0 {
+			if err != nil {
+				t.Errorf("%v: expected the event to be allowed, got %v", c.name, err)
+			}
+			continue
+		}
+		httpErr, ok := err.(api2go.HTTPError)
+		if !ok || httpErr.Status() != c.status {
+			t.Errorf("%v: expected status %d, got %v", c.name, c.status, err)
+		}
+	}
+}
+
+// newStateMachineTestResource has a ticket table tracked by a state machine, the ticket "t1" is in the state "new"
+func newStateMachineTestResource(t *testing.T, events string) (*sqlx.DB, *fsmManager) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table smd (id integer primary key, reference_id varchar(40), name varchar(100), label varchar(100), initial_state varchar(100), events text, permission int)",
+		"create table ticket (id integer primary key, reference_id varchar(40), amount int, permission int, created_at timestamp, updated_at timestamp)",
+		"create table ticket_state (id integer primary key, reference_id varchar(40), current_state varchar(100), event_name varchar(100), next_state varchar(100), " +
+			"is_automatic bool, ticket_smd int, is_state_of_ticket int, version int, permission int, created_at timestamp, updated_at timestamp)",
+		"insert into ticket (id, reference_id, amount) values (1, 't1', 500)",
+		"insert into ticket_state (reference_id, current_state, ticket_smd, is_state_of_ticket, version, created_at) values ('s1', 'new', 1, 1, 1, current_timestamp)",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+	_, err = db.Exec("insert into smd (id, reference_id, name, initial_state, events) values (1, 'm1', 'ticket_flow', 'new', ?)", events)
+	if err != nil {
+		t.Fatalf("failed to create state machine: %v", err)
+	}
+
+	cruds := make(map[string]*DbResource)
+	for _, table := range []TableInfo{
+		{TableName: "ticket", Columns: []api2go.ColumnInfo{
+			{Name: "id", ColumnName: "id", ColumnType: "id"},
+			{Name: "amount", ColumnName: "amount", ColumnType: "measurement"},
+		}},
+		{TableName: "ticket_state", Columns: []api2go.ColumnInfo{
+			{Name: "id", ColumnName: "id", ColumnType: "id"},
+			{Name: "current_state", ColumnName: "current_state", ColumnType: "label"},
+			{Name: "version", ColumnName: "version", ColumnType: "measurement"},
+		}},
+	} {
+		cruds[table.TableName] = NewDbResource(api2go.NewApi2GoModel(table.TableName, table.Columns, 0, nil), db, nil, cruds, nil, table)
+	}
+
+	return db, &fsmManager{db: db, cruds: cruds}
+}
+
+func TestApplyEventStoresTheState(t *testing.T) {
+
+	db, fsm := newStateMachineTestResource(t, `[{"Name": "approve", "Src": ["new"], "Dst": "approved"}]`)
+	defer db.Close()
+
+	subject := map[string]interface{}{"__type": "ticket", "reference_id": "t1", "amount": 500}
+	nextState, err := fsm.ApplyEvent(subject, NewStateMachineEvent("s1", "approve", nil), api2go.Request{})
+	if err != nil || nextState != "approved" {
+		t.Fatalf("expected the ticket to be approved, got %v: %v", nextState, err)
+	}
+
+	var currentState string
+	var version int
+	err = db.QueryRowx("select current_state, version from ticket_state where reference_id = 's1'").Scan(&currentState, &version)
+	if err != nil || currentState != "approved" || version != 2 {
+		t.Errorf("expected the new state to be stored, got %v %v: %v", currentState, version, err)
+	}
+
+	// a transition made by someone else while the event was applied is not overwritten
+	err = fsm.storeState("ticket", "s1", "new", "rejected")
+	if httpErr, ok := err.(api2go.HTTPError); !ok || httpErr.Status() != 409 {
+		t.Errorf("expected a state which changed meanwhile to be a conflict, got %v", err)
+	}
+}
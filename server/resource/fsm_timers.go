@@ -0,0 +1,181 @@
+package resource
+
+import (
+	"encoding/json"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseStateTimerDuration accepts go durations like "90m" or "36h", and whole days like "7d"
+func parseStateTimerDuration(after string) (time.Duration, error) {
+	if strings.HasSuffix(after, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(after, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(after)
+}
+
+// RunStateTimers applies the events with an After duration to every state row which has been in a source state
+// of the event for longer than the duration. Returns the number of transitions applied
+func (fsm *fsmManager) RunStateTimers(req api2go.Request) (int, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select("id", "events").From("smd").ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := fsm.db.Queryx(s, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	timedEvents := make(map[int64][]LoopbackEventDesc)
+	for rows.Next() {
+		var machineId int64
+		var eventsJson string
+		err = rows.Scan(&machineId, &eventsJson)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		var events []LoopbackEventDesc
+		err = json.Unmarshal([]byte(eventsJson), &events)
+		if CheckErr(err, "Failed to read events of state machine [%v]", machineId) {
+			continue
+		}
+		for _, event := range events {
+			if event.After != "" {
+				timedEvents[machineId] = append(timedEvents[machineId], event)
+			}
+		}
+	}
+	rows.Close()
+
+	if len(timedEvents) == 0 {
+		return 0, nil
+	}
+
+	applied := 0
+	// every table with a state table can be tracked by any state machine
+	for typeName := range fsm.cruds {
+		if _, ok := fsm.cruds[typeName+"_state"]; !ok {
+			continue
+		}
+
+		for machineId, events := range timedEvents {
+			for _, event := range events {
+				after, err := parseStateTimerDuration(event.After)
+				if CheckErr(err, "Invalid After [%v] on event [%v]", event.After, event.Name) {
+					continue
+				}
+				for _, src := range event.Src {
+					count, err := fsm.runStateTimer(typeName, machineId, src, event, time.Now().Add(-after), req)
+					CheckErr(err, "Failed to run timed event [%v] on [%v]", event.Name, typeName)
+					applied += count
+				}
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+type expiredState struct {
+	referenceId string
+	subjectId   int64
+}
+
+// TransitionAuditModel is the audit row of a state row which left its state, it records the event and the next state
+// An automatic transition was made by a timed event rather than by a caller
+func TransitionAuditModel(stateRow *api2go.Api2GoModel, eventName string, nextState string, automatic bool) *api2go.Api2GoModel {
+	stateAudit := stateRow.GetAuditModel()
+	stateAudit.Data["event_name"] = eventName
+	stateAudit.Data["next_state"] = nextState
+	stateAudit.Data["is_automatic"] = automatic
+	return stateAudit
+}
+
+func (fsm *fsmManager) runStateTimer(typeName string, machineId int64, src string, event LoopbackEventDesc, enteredBefore time.Time, req api2go.Request) (int, error) {
+
+	stateTable := typeName + "_state"
+
+	// updated_at is set by every transition, rows which never moved are timed from their creation
+	s, v, err := statementbuilder.Squirrel.Select("reference_id", "is_state_of_"+typeName).
+		From(stateTable).
+		Where(squirrel.Eq{typeName + "_smd": machineId}).
+		Where(squirrel.Eq{"current_state": src}).
+		Where("coalesce(updated_at, created_at) < ?", enteredBefore).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := fsm.db.Queryx(s, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := make([]expiredState, 0)
+	for rows.Next() {
+		var state expiredState
+		err = rows.Scan(&state.referenceId, &state.subjectId)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, state)
+	}
+	rows.Close()
+
+	applied := 0
+	for _, state := range expired {
+
+		// read directly, the timers run as a system task and are not limited by row permissions
+		stateData, err := fsm.cruds[stateTable].GetReferenceIdToObject(stateTable, state.referenceId)
+		if CheckErr(err, "Failed to load state [%v] of [%v]", state.referenceId, typeName) {
+			continue
+		}
+		stateModel := fsm.cruds[stateTable].model
+		stateRow := api2go.NewApi2GoModelWithData(stateTable, stateModel.GetColumns(), stateModel.GetDefaultPermission(), nil, stateData)
+
+		subject, err := fsm.cruds[typeName].GetIdToObject(typeName, state.subjectId)
+		if err != nil || subject == nil {
+			log.Errorf("Failed to load [%v] [%v] for timed event [%v]: %v", typeName, state.subjectId, event.Name, err)
+			continue
+		}
+		subject["__type"] = typeName
+
+		// the state is stored only if it did not change meanwhile, so a transition made meanwhile is not overwritten
+		nextState, err := fsm.ApplyEvent(subject, NewStateMachineEvent(state.referenceId, event.Name, nil), req)
+		if err != nil {
+			log.Infof("Timed event [%v] not applied to [%v] [%v]: %v", event.Name, typeName, subject["reference_id"], err)
+			continue
+		}
+		applied += 1
+		log.Infof("Timed event [%v] moved [%v] [%v] from [%v] to [%v]", event.Name, typeName, subject["reference_id"], src, nextState)
+
+		stateAudit := TransitionAuditModel(stateRow, event.Name, nextState, true)
+		creator, ok := fsm.cruds[stateAudit.GetTableName()]
+		if ok {
+			auditRequest := api2go.Request{
+				PlainRequest: (&http.Request{
+					Method: "POST",
+				}).WithContext(req.PlainRequest.Context()),
+				QueryParams: map[string][]string{},
+			}
+			_, err := creator.Create(stateAudit, auditRequest)
+			CheckErr(err, "Failed to create audit for [%v]", stateTable)
+		}
+	}
+
+	return applied, nil
+}
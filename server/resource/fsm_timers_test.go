@@ -0,0 +1,77 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	"testing"
+	"time"
+)
+
+func TestParseStateTimerDuration(t *testing.T) {
+
+	durations := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"90m": 90 * time.Minute,
+		"36h": 36 * time.Hour,
+		"1h":  time.Hour,
+	}
+
+	for after, expected := range durations {
+		duration, err := parseStateTimerDuration(after)
+		if err != nil || duration != expected {
+			t.Errorf("expected [%v] to be %v, got %v: %v", after, expected, duration, err)
+		}
+	}
+
+	for _, after := range []string{"", "d", "7 days", "soon"} {
+		if _, err := parseStateTimerDuration(after); err == nil {
+			t.Errorf("expected [%v] to be rejected", after)
+		}
+	}
+}
+
+func TestStateTimerMovesExpiredStatesAndAuditsTheTransition(t *testing.T) {
+
+	db, fsm := newStateMachineTestResource(t, `[{"Name": "close", "Src": ["new"], "Dst": "closed", "After": "1h"}]`)
+	defer db.Close()
+
+	_, err := db.Exec("create table ticket_state_audit (id integer primary key, reference_id varchar(40), current_state varchar(100), event_name varchar(100), " +
+		"next_state varchar(100), is_automatic bool, version int, permission int, created_at timestamp, updated_at timestamp)")
+	if err != nil {
+		t.Fatalf("failed to create audit table: %v", err)
+	}
+	for _, table := range []TableInfo{
+		{TableName: "world"},
+		{TableName: "ticket_state_audit", Columns: StateTableColumns()},
+	} {
+		columns := append([]api2go.ColumnInfo{{Name: "reference_id", ColumnName: "reference_id", ColumnType: "alias"}}, table.Columns...)
+		fsm.cruds[table.TableName] = NewDbResource(api2go.NewApi2GoModel(table.TableName, columns, 0, nil), db, &MiddlewareSet{}, fsm.cruds, nil, table)
+	}
+
+	performer := &StateTimerActionPerformer{cruds: fsm.cruds, fsm: fsm}
+
+	// the ticket became new just now, the timer does not fire yet
+	_, _, errs := performer.DoAction(Outcome{}, map[string]interface{}{})
+	var currentState string
+	err = db.QueryRowx("select current_state from ticket_state where reference_id = 's1'").Scan(&currentState)
+	if len(errs) > 0 || err != nil || currentState != "new" {
+		t.Fatalf("expected a ticket new for less than an hour to stay new, got %v: %v %v", currentState, errs, err)
+	}
+
+	_, err = db.Exec("update ticket_state set updated_at = ? where reference_id = 's1'", time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to age the state: %v", err)
+	}
+
+	_, _, errs = performer.DoAction(Outcome{}, map[string]interface{}{})
+	err = db.QueryRowx("select current_state from ticket_state where reference_id = 's1'").Scan(&currentState)
+	if len(errs) > 0 || err != nil || currentState != "closed" {
+		t.Fatalf("expected the timer to close the ticket, got %v: %v %v", currentState, errs, err)
+	}
+
+	var auditState, eventName, nextState string
+	var automatic bool
+	err = db.QueryRowx("select current_state, event_name, next_state, is_automatic from ticket_state_audit").Scan(&auditState, &eventName, &nextState, &automatic)
+	if err != nil || auditState != "new" || eventName != "close" || nextState != "closed" || !automatic {
+		t.Errorf("expected the audit row to record the automatic close of a new ticket, got %v %v %v %v: %v", auditState, eventName, nextState, automatic, err)
+	}
+}
@@ -0,0 +1,387 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/database"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// Topics published on the invalidation bus, the key of the message identifies the changed item
+const (
+	InvalidationTopicConfig    = "config"
+	InvalidationTopicTask      = "task"
+	InvalidationTopicSite      = "site"
+	InvalidationTopicContext   = "context"
+	InvalidationTopicRestart   = "restart"
+	InvalidationTopicWorkspace = "workspace"
+)
+
+type InvalidationMessage struct {
+	Topic  string
+	Key    string
+	Origin string
+}
+
+type InvalidationHandler func(message InvalidationMessage)
+
+// InvalidationBus carries invalidation messages between all daptin instances connected to the same database
+// Handlers are called for messages from every instance including this one, compare the Origin
+// with InstanceId() to skip changes which were already applied locally
+type InvalidationBus interface {
+	Publish(topic string, key string) error
+	Subscribe(topic string, handler InvalidationHandler)
+	Start()
+	Stop()
+}
+
+var ErrUnknownInvalidationBus = errors.New("unknown invalidation bus type")
+
+// NewInvalidationBus creates the bus selected by busType
+// poll: instances poll a change log table, works on every database
+// postgres: uses LISTEN/NOTIFY, connectionString is used to open the listening connection
+// none: messages are delivered only inside this instance
+func NewInvalidationBus(busType string, db database.DatabaseConnection, connectionString string) (InvalidationBus, error) {
+	switch busType {
+	case "", "poll":
+		return NewChangeLogInvalidationBus(db)
+	case "postgres":
+		if db.DriverName() != "postgres" {
+			return nil, fmt.Errorf("postgres invalidation bus needs a postgres database, found [%v]", db.DriverName())
+		}
+		return NewPostgresInvalidationBus(db, connectionString), nil
+	case "none":
+		return NewLocalInvalidationBus(), nil
+	}
+	return nil, ErrUnknownInvalidationBus
+}
+
+var instanceId string
+var instanceIdOnce sync.Once
+
+// InstanceId identifies this daptin process in the cluster, it stays the same across restarts of the server
+func InstanceId() string {
+	instanceIdOnce.Do(func() {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		u, _ := uuid.NewV4()
+		instanceId = fmt.Sprintf("%v-%v-%v", hostname, os.Getpid(), u.String()[0:8])
+	})
+	return instanceId
+}
+
+type invalidationSubscribers struct {
+	handlers map[string][]InvalidationHandler
+	lock     sync.RWMutex
+}
+
+func (is *invalidationSubscribers) Subscribe(topic string, handler InvalidationHandler) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+	if is.handlers == nil {
+		is.handlers = make(map[string][]InvalidationHandler)
+	}
+	is.handlers[topic] = append(is.handlers[topic], handler)
+}
+
+func (is *invalidationSubscribers) dispatch(message InvalidationMessage) {
+	is.lock.RLock()
+	handlers := is.handlers[message.Topic]
+	is.lock.RUnlock()
+
+	log.Debugf("Invalidation [%v][%v] from [%v]", message.Topic, message.Key, message.Origin)
+	for _, handler := range handlers {
+		handler(message)
+	}
+}
+
+// LocalInvalidationBus delivers messages only to the handlers of this instance
+type LocalInvalidationBus struct {
+	invalidationSubscribers
+}
+
+func NewLocalInvalidationBus() *LocalInvalidationBus {
+	return &LocalInvalidationBus{}
+}
+
+func (lb *LocalInvalidationBus) Publish(topic string, key string) error {
+	lb.dispatch(InvalidationMessage{
+		Topic:  topic,
+		Key:    key,
+		Origin: InstanceId(),
+	})
+	return nil
+}
+
+func (lb *LocalInvalidationBus) Start() {
+}
+
+func (lb *LocalInvalidationBus) Stop() {
+}
+
+var changeLogTableName = "_change_log"
+
+// how often the change log is checked for messages from other instances
+var changeLogPollInterval = 2 * time.Second
+
+// change log entries older than this are removed, every instance has seen them by then
+var changeLogRetention = time.Hour
+
+var ChangeLogTableStructure = TableInfo{
+	TableName: changeLogTableName,
+	Columns: []api2go.ColumnInfo{
+		{
+			Name:            "id",
+			ColumnName:      "id",
+			ColumnType:      "id",
+			DataType:        "INTEGER",
+			IsPrimaryKey:    true,
+			IsAutoIncrement: true,
+		},
+		{
+			Name:       "topic",
+			ColumnName: "topic",
+			ColumnType: "string",
+			DataType:   "varchar(50)",
+			IsNullable: false,
+		},
+		{
+			Name:       "item",
+			ColumnName: "item",
+			ColumnType: "string",
+			DataType:   "varchar(200)",
+			IsNullable: false,
+		},
+		{
+			Name:       "origin",
+			ColumnName: "origin",
+			ColumnType: "string",
+			DataType:   "varchar(100)",
+			IsNullable: false,
+		},
+		{
+			Name:       "created_at",
+			ColumnName: "created_at",
+			ColumnType: "measurement",
+			DataType:   "bigint",
+			IsNullable: false,
+			IsIndexed:  true,
+		},
+	},
+}
+
+// ChangeLogInvalidationBus writes every message to the _change_log table, each instance polls
+// the table for rows newer than the last one it has seen
+type ChangeLogInvalidationBus struct {
+	invalidationSubscribers
+	db     database.DatabaseConnection
+	lastId int64
+	done   chan bool
+}
+
+func NewChangeLogInvalidationBus(db database.DatabaseConnection) (*ChangeLogInvalidationBus, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select("count(*)").From(changeLogTableName).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = db.QueryRowx(s, v...).Scan(&count)
+	if err != nil {
+		createTableQuery := MakeCreateTableQuery(&ChangeLogTableStructure, db.DriverName())
+		_, err = db.Exec(createTableQuery)
+		if err != nil {
+			log.Printf("create change log table query: %v", createTableQuery)
+			return nil, err
+		}
+	}
+
+	return &ChangeLogInvalidationBus{
+		db: db,
+	}, nil
+}
+
+func (cb *ChangeLogInvalidationBus) Publish(topic string, key string) error {
+
+	s, v, err := statementbuilder.Squirrel.Insert(changeLogTableName).
+		Columns("topic", "item", "origin", "created_at").
+		Values(topic, key, InstanceId(), toMillis(time.Now())).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.db.Exec(s, v...)
+	return err
+}
+
+// Start delivers only the messages published after this point, everything older is already reflected in the database
+func (cb *ChangeLogInvalidationBus) Start() {
+
+	s, v, err := statementbuilder.Squirrel.Select("coalesce(max(id), 0)").From(changeLogTableName).ToSql()
+	CheckErr(err, "Failed to create change log query")
+	err = cb.db.QueryRowx(s, v...).Scan(&cb.lastId)
+	CheckErr(err, "Failed to read last change log id")
+
+	cb.done = make(chan bool)
+	go cb.poll(cb.done)
+}
+
+func (cb *ChangeLogInvalidationBus) Stop() {
+	if cb.done != nil {
+		close(cb.done)
+		cb.done = nil
+	}
+}
+
+func (cb *ChangeLogInvalidationBus) poll(done chan bool) {
+
+	ticker := time.NewTicker(changeLogPollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := cb.readChanges()
+			CheckErr(err, "Failed to read change log")
+
+			if time.Since(lastCleanup) > changeLogRetention/4 {
+				lastCleanup = time.Now()
+				err = cb.cleanup()
+				CheckErr(err, "Failed to clean up change log")
+			}
+		}
+	}
+}
+
+func (cb *ChangeLogInvalidationBus) readChanges() error {
+
+	s, v, err := statementbuilder.Squirrel.Select("id", "topic", "item", "origin").
+		From(changeLogTableName).
+		Where(squirrel.Gt{"id": cb.lastId}).
+		OrderBy("id").ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := cb.db.Queryx(s, v...)
+	if err != nil {
+		return err
+	}
+
+	messages := make([]InvalidationMessage, 0)
+	for rows.Next() {
+		var message InvalidationMessage
+		err = rows.Scan(&cb.lastId, &message.Topic, &message.Key, &message.Origin)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+
+	// handlers may query the database, so they run after the rows are closed
+	for _, message := range messages {
+		cb.dispatch(message)
+	}
+
+	return nil
+}
+
+func (cb *ChangeLogInvalidationBus) cleanup() error {
+
+	s, v, err := statementbuilder.Squirrel.Delete(changeLogTableName).
+		Where(squirrel.Lt{"created_at": toMillis(time.Now().Add(-changeLogRetention))}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.db.Exec(s, v...)
+	return err
+}
+
+var postgresInvalidationChannel = "daptin_invalidation"
+
+// PostgresInvalidationBus sends messages with NOTIFY and receives them on a dedicated LISTEN connection
+// Messages are not stored, an instance which is disconnected while a message is sent does not receive it
+type PostgresInvalidationBus struct {
+	invalidationSubscribers
+	db               database.DatabaseConnection
+	connectionString string
+	listener         *pq.Listener
+}
+
+func NewPostgresInvalidationBus(db database.DatabaseConnection, connectionString string) *PostgresInvalidationBus {
+	return &PostgresInvalidationBus{
+		db:               db,
+		connectionString: connectionString,
+	}
+}
+
+func (pb *PostgresInvalidationBus) Publish(topic string, key string) error {
+
+	payload, err := json.Marshal(InvalidationMessage{
+		Topic:  topic,
+		Key:    key,
+		Origin: InstanceId(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = pb.db.Exec("select pg_notify($1, $2)", postgresInvalidationChannel, string(payload))
+	return err
+}
+
+func (pb *PostgresInvalidationBus) Start() {
+
+	pb.listener = pq.NewListener(pb.connectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Errorf("Invalidation listener event [%v]: %v", event, err)
+		}
+	})
+
+	err := pb.listener.Listen(postgresInvalidationChannel)
+	if CheckErr(err, "Failed to listen on [%v]", postgresInvalidationChannel) {
+		return
+	}
+
+	go func(listener *pq.Listener) {
+		for notification := range listener.Notify {
+			if notification == nil {
+				// sent after the connection was re-established, messages sent meanwhile are lost
+				log.Warnf("Invalidation listener reconnected, changes from other instances may have been missed")
+				continue
+			}
+			var message InvalidationMessage
+			err := json.Unmarshal([]byte(notification.Extra), &message)
+			if CheckErr(err, "Failed to read invalidation message: %v", notification.Extra) {
+				continue
+			}
+			pb.dispatch(message)
+		}
+	}(pb.listener)
+}
+
+func (pb *PostgresInvalidationBus) Stop() {
+	if pb.listener != nil {
+		err := pb.listener.Close()
+		CheckErr(err, "Failed to close invalidation listener")
+		pb.listener = nil
+	}
+}
@@ -0,0 +1,58 @@
+package resource
+
+import (
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"testing"
+)
+
+func TestChangeLogInvalidationBusDeliversNewMessages(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	publisher, err := NewChangeLogInvalidationBus(db)
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	subscriber, err := NewChangeLogInvalidationBus(db)
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+
+	received := make([]InvalidationMessage, 0)
+	subscriber.Subscribe(InvalidationTopicTask, func(message InvalidationMessage) {
+		received = append(received, message)
+	})
+
+	// a message from before the start is already reflected in the database
+	err = publisher.Publish(InvalidationTopicTask, "old")
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	subscriber.Start()
+	// the changes are read by the test instead of the polling loop
+	subscriber.Stop()
+
+	publisher.Publish(InvalidationTopicTask, "task-1")
+	publisher.Publish(InvalidationTopicConfig, "hostname")
+
+	err = subscriber.readChanges()
+	if err != nil {
+		t.Fatalf("failed to read changes: %v", err)
+	}
+
+	if len(received) != 1 || received[0].Key != "task-1" || received[0].Origin != InstanceId() {
+		t.Errorf("expected only the new task message, got %v", received)
+	}
+
+	err = subscriber.readChanges()
+	if err != nil || len(received) != 1 {
+		t.Errorf("expected a message to be delivered once, got %v: %v", received, err)
+	}
+}
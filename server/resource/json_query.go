@@ -0,0 +1,282 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/daptin/daptin/server/database"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JsonIndex is an index on a key inside a json column, declared on a table as {"ColumnName": "attributes",
+// "Path": "owner.email"}. It is an expression index on sqlite and postgres and an index on a generated column on mysql
+type JsonIndex struct {
+	ColumnName string
+	Path       string
+}
+
+// jsonPathKey is one step of a path into a json value, a key of an object or the index of an array
+var jsonPathKey = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// ErrJsonFunctionsMissing is returned for a filter, sort or group on a json path when the database cannot evaluate it
+var ErrJsonFunctionsMissing = errors.New("json paths need the json functions of the database, on sqlite daptin has to be built with -tags sqlite_json")
+
+// HasJsonFunctions tells if the database can evaluate json paths, sqlite only has the json functions when the
+// driver is built with the sqlite_json tag
+func HasJsonFunctions(db database.DatabaseConnection) bool {
+	if db.DriverName() != "sqlite3" {
+		return true
+	}
+	var value interface{}
+	err := db.QueryRowx(`select json_extract('{"a": 1}', '$.a')`).Scan(&value)
+	return err == nil
+}
+
+// requireJsonFunctions fails with ErrJsonFunctionsMissing when one of the names is a json path of the table and the
+// database cannot evaluate it, instead of sending a query the database rejects
+func (dr *DbResource) requireJsonFunctions(names ...string) error {
+	for _, name := range names {
+		if _, isJsonPath := ParseJsonPath(dr.tableInfo, name); !isJsonPath {
+			continue
+		}
+		available, ok := dr.GetContext("json_functions").(bool)
+		if !ok {
+			available = HasJsonFunctions(dr.connection)
+			dr.PutContext("json_functions", available)
+		}
+		if !available {
+			return ErrJsonFunctionsMissing
+		}
+		return nil
+	}
+	return nil
+}
+
+// JsonPath is a column name like attributes.tags.0 which reaches into the value of the json column attributes
+type JsonPath struct {
+	ColumnName string
+	Path       []string
+}
+
+// ParseJsonPath splits a column name on dots when the first part is a json column of the table
+func ParseJsonPath(tableInfo *TableInfo, name string) (JsonPath, bool) {
+
+	parts := strings.Split(name, ".")
+	if tableInfo == nil || len(parts) < 2 {
+		return JsonPath{}, false
+	}
+
+	isJson := false
+	for _, column := range tableInfo.Columns {
+		if column.ColumnName == parts[0] && column.ColumnType == "json" {
+			isJson = true
+			break
+		}
+	}
+	if !isJson {
+		return JsonPath{}, false
+	}
+
+	for _, key := range parts[1:] {
+		if !jsonPathKey.MatchString(key) {
+			log.Errorf("Invalid key [%v] in json path [%v]", key, name)
+			return JsonPath{}, false
+		}
+	}
+
+	return JsonPath{
+		ColumnName: parts[0],
+		Path:       parts[1:],
+	}, true
+}
+
+// Name is the path as it was written, attributes.tags
+func (p JsonPath) Name() string {
+	return p.ColumnName + "." + strings.Join(p.Path, ".")
+}
+
+// jsonSelector is the path in the syntax of json_extract, $.tags[0]
+func (p JsonPath) jsonSelector() string {
+	selector := "$"
+	for _, key := range p.Path {
+		if _, err := strconv.Atoi(key); err == nil {
+			selector += "[" + key + "]"
+		} else {
+			selector += "." + key
+		}
+	}
+	return selector
+}
+
+// jsonColumn is the json column, an empty text is read as null instead of failing as malformed json
+func (p JsonPath) jsonColumn(prefix string) string {
+	return fmt.Sprintf("nullif(%s, '')", prefix+p.ColumnName)
+}
+
+// jsonNode is the json value at the path, not unquoted, to test its type and what it contains
+func (p JsonPath) jsonNode(driverName string, prefix string) string {
+	column := p.jsonColumn(prefix)
+	switch driverName {
+	case "postgres":
+		return fmt.Sprintf("(%s::jsonb #> '{%s}')", column, strings.Join(p.Path, ","))
+	default:
+		return fmt.Sprintf("json_extract(%s, '%s')", column, p.jsonSelector())
+	}
+}
+
+// Expression is the value at the path as text on mysql and postgres and as the stored type on sqlite. Indexes
+// declared with JsonIndex are made on this same expression so the database can use them for filters and sorts
+func (p JsonPath) Expression(driverName string, prefix string) string {
+	column := p.jsonColumn(prefix)
+	switch driverName {
+	case "postgres":
+		return fmt.Sprintf("(%s::jsonb #>> '{%s}')", column, strings.Join(p.Path, ","))
+	case "mysql":
+		return fmt.Sprintf("json_unquote(json_extract(%s, '%s'))", column, p.jsonSelector())
+	default:
+		return fmt.Sprintf("json_extract(%s, '%s')", column, p.jsonSelector())
+	}
+}
+
+// containsCondition is true when the value at the path is an array with the value in it, or text with the value in it
+func (p JsonPath) containsCondition(driverName string, prefix string, value interface{}) (string, []interface{}) {
+
+	node := p.jsonNode(driverName, prefix)
+	like := "%" + fmt.Sprintf("%v", value) + "%"
+
+	switch driverName {
+	case "postgres":
+		member, _ := json.Marshal([]interface{}{value})
+		return fmt.Sprintf("((jsonb_typeof(%s) = 'array' and %s @> ?::jsonb) or (jsonb_typeof(%s) = 'string' and %s like ?))",
+			node, node, node, p.Expression(driverName, prefix)), []interface{}{string(member), like}
+	case "mysql":
+		member, _ := json.Marshal(value)
+		return fmt.Sprintf("((json_type(%s) = 'ARRAY' and json_contains(%s, ?)) or (json_type(%s) = 'STRING' and %s like ?))",
+			node, node, node, p.Expression(driverName, prefix)), []interface{}{string(member), like}
+	default:
+		column := p.jsonColumn(prefix)
+		return fmt.Sprintf("((json_type(%s, '%s') = 'array' and exists (select 1 from json_each(%s, '%s') where json_each.value = ?)) or (json_type(%s, '%s') = 'text' and %s like ?))",
+			column, p.jsonSelector(), column, p.jsonSelector(), column, p.jsonSelector(), p.Expression(driverName, prefix)), []interface{}{value, like}
+	}
+}
+
+// columnExpression is the sql for a column name used in a query, a sort or a group, json paths are resolved for
+// the json columns of the table
+func (dr *DbResource) columnExpression(prefix string, name string) string {
+	if path, ok := ParseJsonPath(dr.tableInfo, name); ok {
+		return path.Expression(dr.connection.DriverName(), prefix)
+	}
+	return prefix + name
+}
+
+// comparedExpression casts the text at a json path to a number on postgres when it is compared with a number
+func (dr *DbResource) comparedExpression(prefix string, name string, value interface{}) string {
+	expression := dr.columnExpression(prefix, name)
+	if _, isJson := ParseJsonPath(dr.tableInfo, name); !isJson || dr.connection.DriverName() != "postgres" {
+		return expression
+	}
+	switch value.(type) {
+	case float64, float32, int, int64:
+		return fmt.Sprintf("cast(%s as numeric)", expression)
+	}
+	return expression
+}
+
+// addJsonContains adds the filter for contains and not contains on a json path
+func (dr *DbResource) addJsonContains(queryBuilder squirrel.SelectBuilder, path JsonPath, prefix string, value interface{}, negate bool) squirrel.SelectBuilder {
+	condition, args := path.containsCondition(dr.connection.DriverName(), prefix, value)
+	if negate {
+		condition = "not " + condition
+	}
+	return queryBuilder.Where(condition, args...)
+}
+
+// CreateJsonIndexes makes the indexes declared on the json columns of the tables
+func CreateJsonIndexes(initConfig *CmsConfig, db *sqlx.Tx) {
+
+	for _, table := range initConfig.Tables {
+		for _, jsonIndex := range table.JsonIndexes {
+
+			path, ok := ParseJsonPath(&table, jsonIndex.ColumnName+"."+jsonIndex.Path)
+			if !ok {
+				log.Errorf("Table[%v]: [%v.%v] is not a path in a json column, no index created", table.TableName, jsonIndex.ColumnName, jsonIndex.Path)
+				continue
+			}
+
+			indexName := "j" + GetMD5Hash("index_"+table.TableName+"_"+path.Name()+"_index")
+			var queries []string
+			switch db.DriverName() {
+			case "mysql":
+				// mysql can only index json through a generated column, queries on the same expression use it
+				generatedColumn := "jsonindex_" + GetMD5Hash(path.Name())
+				queries = []string{
+					fmt.Sprintf("alter table %s add column %s varchar(255) generated always as (%s) virtual",
+						table.TableName, generatedColumn, path.Expression("mysql", "")),
+					fmt.Sprintf("create index %s on %s (%s)", indexName, table.TableName, generatedColumn),
+				}
+			default:
+				queries = []string{
+					fmt.Sprintf("create index %s on %s ((%s))", indexName, table.TableName, path.Expression(db.DriverName(), "")),
+				}
+			}
+
+			for _, query := range queries {
+				_, err := db.Exec(query)
+				if err != nil {
+					log.Infof("Failed to create json index on Table[%v] Path[%v], probably it exists: %v", table.TableName, path.Name(), err)
+					break
+				}
+			}
+		}
+	}
+}
+
+// rowValue reads a column of a row, a name like attributes.tags which is not a column of the row is looked up in the
+// json value of the attributes column
+func rowValue(row map[string]interface{}, name string) interface{} {
+
+	if value, ok := row[name]; ok {
+		return value
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return nil
+	}
+
+	var current interface{}
+	switch root := row[parts[0]].(type) {
+	case string:
+		if json.Unmarshal([]byte(root), &current) != nil {
+			return nil
+		}
+	case []byte:
+		if json.Unmarshal(root, &current) != nil {
+			return nil
+		}
+	default:
+		current = root
+	}
+
+	for _, key := range parts[1:] {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			current = node[index]
+		default:
+			return nil
+		}
+	}
+
+	return current
+}
@@ -0,0 +1,121 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"testing"
+)
+
+func TestJsonPathExpression(t *testing.T) {
+
+	tableInfo := &TableInfo{
+		TableName: "item",
+		Columns: []api2go.ColumnInfo{
+			{ColumnName: "attributes", ColumnType: "json"},
+			{ColumnName: "name", ColumnType: "label"},
+		},
+	}
+
+	if _, ok := ParseJsonPath(tableInfo, "name.first"); ok {
+		t.Errorf("name is not a json column")
+	}
+	if _, ok := ParseJsonPath(tableInfo, "attributes.tags') or 1=1 --"); ok {
+		t.Errorf("path with quotes should not be read")
+	}
+
+	path, ok := ParseJsonPath(tableInfo, "attributes.tags.0")
+	if !ok {
+		t.Fatalf("attributes.tags.0 should be a json path")
+	}
+
+	expected := map[string]string{
+		"sqlite3":  "json_extract(nullif(item.attributes, ''), '$.tags[0]')",
+		"mysql":    "json_unquote(json_extract(nullif(item.attributes, ''), '$.tags[0]'))",
+		"postgres": "(nullif(item.attributes, '')::jsonb #>> '{tags,0}')",
+	}
+	for driverName, expression := range expected {
+		if got := path.Expression(driverName, "item."); got != expression {
+			t.Errorf("[%v] expected %v, found %v", driverName, expression, got)
+		}
+	}
+}
+
+func TestRowValueOfJsonPath(t *testing.T) {
+
+	row := map[string]interface{}{
+		"attributes": `{"owner": {"email": "a@b.c"}, "tags": ["x", "y"]}`,
+	}
+
+	if value := rowValue(row, "attributes.owner.email"); value != "a@b.c" {
+		t.Errorf("expected a@b.c, found %v", value)
+	}
+	if value := rowValue(row, "attributes.tags.1"); value != "y" {
+		t.Errorf("expected y, found %v", value)
+	}
+	if value := rowValue(row, "attributes.missing.key"); value != nil {
+		t.Errorf("expected nil, found %v", value)
+	}
+}
+
+func TestJsonPathFilterOnSqlite(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table product (id integer primary key, attributes text)",
+		`insert into product (attributes) values ('{"color": "red", "tags": ["sale", "new"]}')`,
+		`insert into product (attributes) values ('{"color": "blue", "tags": ["new"]}')`,
+		`insert into product (attributes) values ('')`,
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	table := TableInfo{
+		TableName: "product",
+		Columns:   []api2go.ColumnInfo{{Name: "attributes", ColumnName: "attributes", ColumnType: "json"}},
+	}
+	dr := NewDbResource(api2go.NewApi2GoModel(table.TableName, table.Columns, 0, nil), db, nil, map[string]*DbResource{}, nil, table)
+
+	err = dr.requireJsonFunctions("id", "attributes.color")
+	if !HasJsonFunctions(db) {
+		// built without the sqlite_json tag, the filter is rejected with an error which tells how to build
+		if err != ErrJsonFunctionsMissing {
+			t.Errorf("expected json paths to be rejected without json functions, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("expected json paths to be allowed: %v", err)
+	}
+
+	cases := []struct {
+		queries  []Query
+		expected []int64
+	}{
+		{[]Query{{ColumnName: "attributes.color", Operator: "is", Value: "red"}}, []int64{1}},
+		{[]Query{{ColumnName: "attributes.tags", Operator: "contains", Value: "new"}}, []int64{1, 2}},
+		{[]Query{{ColumnName: "attributes.tags.0", Operator: "is", Value: "new"}}, []int64{2}},
+		{[]Query{{ColumnName: "attributes.color", Operator: "is empty"}}, []int64{3}},
+	}
+	for _, c := range cases {
+		s, v, err := dr.addFilters(statementbuilder.Squirrel.Select("id").From("product").OrderBy("id"), c.queries, "").ToSql()
+		if err != nil {
+			t.Fatalf("failed to build query: %v", err)
+		}
+		ids := make([]int64, 0)
+		err = db.Select(&ids, s, v...)
+		if err != nil || !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("expected %v to match %v, got %v: %v", c.queries, c.expected, ids, err)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ghodss/yaml"
+	"github.com/russross/blackfriday"
+	log "github.com/sirupsen/logrus"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of a site. A static site is served as it is in its cloud store, a markdown site is built into html pages
+// after every sync of its cloud store
+const (
+	SiteTypeStatic   = "static"
+	SiteTypeMarkdown = "markdown"
+)
+
+// markdownLayoutFolder holds the html/template layouts of a markdown site, a page picks one with "layout" in its front
+// matter, and "default" otherwise
+const markdownLayoutFolder = "_layouts"
+
+const markdownSearchIndexName = "search-index.json"
+
+const defaultMarkdownLayout = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Page.Title}}</title></head>
+<body>
+<nav>{{template "nav" .Nav}}</nav>
+<main>{{.Content}}</main>
+</body>
+</html>
+{{define "nav"}}<ul>{{range .}}<li><a href="{{.Url}}">{{.Title}}</a>{{if .Children}}{{template "nav" .Children}}{{end}}</li>{{end}}</ul>{{end}}`
+
+// MarkdownPage is a page built from a markdown file, with the values of its front matter
+type MarkdownPage struct {
+	Source string                 `json:"-"`
+	Url    string                 `json:"url"`
+	Title  string                 `json:"title"`
+	Weight int                    `json:"-"`
+	Layout string                 `json:"-"`
+	Draft  bool                   `json:"-"`
+	Params map[string]interface{} `json:"-"`
+	Text   string                 `json:"text"`
+
+	content template.HTML
+	modTime time.Time
+	size    int64
+}
+
+// MarkdownNavNode is an entry of the navigation tree, a folder has the pages in it as children
+type MarkdownNavNode struct {
+	Title    string
+	Url      string
+	Weight   int
+	Children []*MarkdownNavNode
+}
+
+type markdownSourceFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// MarkdownSite builds the markdown files of a site into html pages with layouts, a navigation tree and a search
+// index. A build after a sync only writes the files which changed, every page is built again when a layout or the
+// navigation changes
+type MarkdownSite struct {
+	SourceRoot string
+	OutputRoot string
+	lock       sync.Mutex
+	pages      map[string]*MarkdownPage
+	files      map[string]markdownSourceFile
+	layouts    map[string]markdownSourceFile
+	nav        []byte
+}
+
+func NewMarkdownSite(sourceRoot string, outputRoot string) *MarkdownSite {
+	return &MarkdownSite{
+		SourceRoot: sourceRoot,
+		OutputRoot: outputRoot,
+		pages:      make(map[string]*MarkdownPage),
+		files:      make(map[string]markdownSourceFile),
+		layouts:    make(map[string]markdownSourceFile),
+	}
+}
+
+// markdownPageUrl is the url of the page built from a markdown file, index.md is the index of its folder
+func markdownPageUrl(source string) string {
+	withoutExtension := strings.TrimSuffix(filepath.ToSlash(source), filepath.Ext(source))
+	if filepath.Base(withoutExtension) == "index" {
+		return "/" + strings.TrimSuffix(withoutExtension, "index")
+	}
+	return "/" + withoutExtension + ".html"
+}
+
+func markdownPageOutput(url string) string {
+	if strings.HasSuffix(url, "/") {
+		return url + "index.html"
+	}
+	return url
+}
+
+// ParseMarkdownPage reads the yaml front matter between --- lines at the top of a markdown file and renders the rest
+func ParseMarkdownPage(source string, contents []byte) (*MarkdownPage, error) {
+
+	page := &MarkdownPage{
+		Source: source,
+		Url:    markdownPageUrl(source),
+		Layout: "default",
+		Params: make(map[string]interface{}),
+	}
+
+	body := contents
+	if bytes.HasPrefix(contents, []byte("---\n")) || bytes.HasPrefix(contents, []byte("---\r\n")) {
+		rest := contents[bytes.IndexByte(contents, '\n')+1:]
+		end := bytes.Index(rest, []byte("\n---"))
+		if end < 0 {
+			return nil, fmt.Errorf("front matter of [%v] is not closed", source)
+		}
+		err := yaml.Unmarshal(rest[:end], &page.Params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid front matter in [%v]: %v", source, err)
+		}
+		body = rest[end+4:]
+		if newLine := bytes.IndexByte(body, '\n'); newLine >= 0 {
+			body = body[newLine+1:]
+		}
+	}
+
+	if title, ok := page.Params["title"].(string); ok {
+		page.Title = title
+	} else {
+		page.Title = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+	if weight, ok := page.Params["weight"].(float64); ok {
+		page.Weight = int(weight)
+	}
+	if layout, ok := page.Params["layout"].(string); ok && layout != "" {
+		page.Layout = layout
+	}
+	page.Draft, _ = page.Params["draft"].(bool)
+
+	html := blackfriday.Run(body)
+	page.content = template.HTML(html)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err == nil {
+		page.Text = strings.Join(strings.Fields(doc.Text()), " ")
+	}
+
+	return page, nil
+}
+
+// BuildMarkdownNav arranges pages into a tree by their folders, ordered by weight and then title
+func BuildMarkdownNav(pages []*MarkdownPage) []*MarkdownNavNode {
+
+	root := &MarkdownNavNode{}
+	folders := map[string]*MarkdownNavNode{"": root}
+
+	var folderOf func(path string) *MarkdownNavNode
+	folderOf = func(path string) *MarkdownNavNode {
+		if node, ok := folders[path]; ok {
+			return node
+		}
+		parent := folderOf(strings.Trim(filepath.ToSlash(filepath.Dir(path)), "."))
+		node := &MarkdownNavNode{
+			Title: filepath.Base(path),
+			Url:   "/" + path + "/",
+		}
+		parent.Children = append(parent.Children, node)
+		folders[path] = node
+		return node
+	}
+
+	for _, page := range pages {
+		folder := strings.Trim(filepath.ToSlash(filepath.Dir(page.Source)), ".")
+		if strings.HasSuffix(page.Url, "/") {
+			if folder == "" {
+				continue
+			}
+			node := folderOf(folder)
+			node.Title = page.Title
+			node.Weight = page.Weight
+			continue
+		}
+		parent := folderOf(folder)
+		parent.Children = append(parent.Children, &MarkdownNavNode{
+			Title:  page.Title,
+			Url:    page.Url,
+			Weight: page.Weight,
+		})
+	}
+
+	var sortNodes func(nodes []*MarkdownNavNode)
+	sortNodes = func(nodes []*MarkdownNavNode) {
+		sort.SliceStable(nodes, func(i, j int) bool {
+			if nodes[i].Weight != nodes[j].Weight {
+				return nodes[i].Weight < nodes[j].Weight
+			}
+			return nodes[i].Title < nodes[j].Title
+		})
+		for _, node := range nodes {
+			sortNodes(node.Children)
+		}
+	}
+	sortNodes(root.Children)
+
+	return root.Children
+}
+
+func (ms *MarkdownSite) layoutTemplates(siteLayouts map[string]markdownSourceFile) (*template.Template, error) {
+	layouts := template.New("").Funcs(template.FuncMap{
+		"raw": func(value string) template.HTML {
+			return template.HTML(value)
+		},
+	})
+	_, err := layouts.New("default").Parse(defaultMarkdownLayout)
+	if err != nil {
+		return nil, err
+	}
+	for name := range siteLayouts {
+		contents, err := ioutil.ReadFile(filepath.Join(ms.SourceRoot, markdownLayoutFolder, name))
+		if err != nil {
+			return nil, err
+		}
+		_, err = layouts.New(strings.TrimSuffix(name, filepath.Ext(name))).Parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("invalid layout [%v]: %v", name, err)
+		}
+	}
+	return layouts, nil
+}
+
+func markdownFileChanged(known map[string]markdownSourceFile, path string, info os.FileInfo) bool {
+	file, ok := known[path]
+	return !ok || file.size != info.Size() || !file.modTime.Equal(info.ModTime())
+}
+
+// Build writes the pages, files, navigation and search index of the site into the output folder. What was built is
+// remembered only when the whole build succeeds, so a failed build is done again in full by the next one
+func (ms *MarkdownSite) Build() error {
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	start := time.Now()
+	err := os.MkdirAll(ms.OutputRoot, 0755)
+	if err != nil {
+		return err
+	}
+
+	sitePages := make(map[string]*MarkdownPage)
+	for relativePath, page := range ms.pages {
+		sitePages[relativePath] = page
+	}
+	siteFiles := make(map[string]markdownSourceFile)
+	for relativePath, file := range ms.files {
+		siteFiles[relativePath] = file
+	}
+	siteLayouts := make(map[string]markdownSourceFile)
+	for name, file := range ms.layouts {
+		siteLayouts[name] = file
+	}
+	commit := func(navJson []byte) {
+		ms.pages, ms.files, ms.layouts, ms.nav = sitePages, siteFiles, siteLayouts, navJson
+	}
+
+	seenPages := make(map[string]bool)
+	seenFiles := make(map[string]bool)
+	seenLayouts := make(map[string]bool)
+	changedPages := make(map[string]bool)
+	layoutsChanged := false
+	written := 0
+
+	err = filepath.Walk(ms.SourceRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(ms.SourceRoot, path)
+		if relativePath == "." {
+			return nil
+		}
+		name := info.Name()
+
+		if info.IsDir() {
+			if relativePath == markdownLayoutFolder {
+				return nil
+			}
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filepath.Dir(relativePath) == markdownLayoutFolder {
+			seenLayouts[name] = true
+			if markdownFileChanged(siteLayouts, name, info) {
+				layoutsChanged = true
+				siteLayouts[name] = markdownSourceFile{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return nil
+		}
+
+		if filepath.Ext(name) == ".md" {
+			seenPages[relativePath] = true
+			page, ok := sitePages[relativePath]
+			if !ok || page.size != info.Size() || !page.modTime.Equal(info.ModTime()) {
+				contents, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				page, err = ParseMarkdownPage(relativePath, contents)
+				if err != nil {
+					return err
+				}
+				page.modTime = info.ModTime()
+				page.size = info.Size()
+				sitePages[relativePath] = page
+				changedPages[relativePath] = true
+			}
+			return nil
+		}
+
+		seenFiles[relativePath] = true
+		if markdownFileChanged(siteFiles, relativePath, info) {
+			err = copyMarkdownSiteFile(path, filepath.Join(ms.OutputRoot, relativePath))
+			if err != nil {
+				return err
+			}
+			siteFiles[relativePath] = markdownSourceFile{modTime: info.ModTime(), size: info.Size()}
+			written += 1
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range siteLayouts {
+		if !seenLayouts[name] {
+			delete(siteLayouts, name)
+			layoutsChanged = true
+		}
+	}
+	for relativePath := range siteFiles {
+		if !seenFiles[relativePath] {
+			os.Remove(filepath.Join(ms.OutputRoot, relativePath))
+			delete(siteFiles, relativePath)
+		}
+	}
+	removedPages := false
+	for relativePath, page := range sitePages {
+		if !seenPages[relativePath] {
+			os.Remove(filepath.Join(ms.OutputRoot, markdownPageOutput(page.Url)))
+			delete(sitePages, relativePath)
+			removedPages = true
+		}
+	}
+
+	pages := make([]*MarkdownPage, 0)
+	for _, page := range sitePages {
+		if !page.Draft {
+			pages = append(pages, page)
+		} else if changedPages[page.Source] {
+			os.Remove(filepath.Join(ms.OutputRoot, markdownPageOutput(page.Url)))
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Source < pages[j].Source
+	})
+
+	nav := BuildMarkdownNav(pages)
+	navJson, _ := json.Marshal(nav)
+	navChanged := !bytes.Equal(navJson, ms.nav)
+
+	if len(changedPages) == 0 && !removedPages && !layoutsChanged && !navChanged {
+		commit(navJson)
+		log.Infof("Built markdown site [%v] in %v, %d files changed", ms.SourceRoot, time.Since(start), written)
+		return nil
+	}
+
+	layouts, err := ms.layoutTemplates(siteLayouts)
+	if err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		if !changedPages[page.Source] && !layoutsChanged && !navChanged {
+			continue
+		}
+		layout := layouts.Lookup(page.Layout)
+		if layout == nil {
+			return fmt.Errorf("no layout [%v] for [%v]", page.Layout, page.Source)
+		}
+		var out bytes.Buffer
+		err = layout.Execute(&out, map[string]interface{}{
+			"Page":    page,
+			"Content": page.content,
+			"Nav":     nav,
+			"Pages":   pages,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to build [%v]: %v", page.Source, err)
+		}
+		outputPath := filepath.Join(ms.OutputRoot, markdownPageOutput(page.Url))
+		err = os.MkdirAll(filepath.Dir(outputPath), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(outputPath, out.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+		written += 1
+	}
+
+	searchIndex, err := json.Marshal(pages)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(ms.OutputRoot, markdownSearchIndexName), searchIndex, 0644)
+	if err != nil {
+		return err
+	}
+	commit(navJson)
+
+	log.Infof("Built markdown site [%v] in %v, %d files changed", ms.SourceRoot, time.Since(start), written)
+	return nil
+}
+
+func copyMarkdownSiteFile(source string, destination string) error {
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSiteFile(t *testing.T, root string, path string, contents string) {
+	fullPath := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fullPath, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarkdownSiteBuild(t *testing.T) {
+
+	source, _ := ioutil.TempDir("", "markdown-source")
+	output, _ := ioutil.TempDir("", "markdown-output")
+	defer os.RemoveAll(source)
+	defer os.RemoveAll(output)
+
+	writeSiteFile(t, source, "index.md", "---\ntitle: Home\n---\n# Welcome\n")
+	writeSiteFile(t, source, "guide/index.md", "---\ntitle: Guide\nweight: 1\n---\nThe guide\n")
+	writeSiteFile(t, source, "guide/install.md", "---\ntitle: Install\n---\nRun the *installer*\n")
+	writeSiteFile(t, source, "guide/secret.md", "---\ntitle: Secret\ndraft: true\n---\nnot yet\n")
+	writeSiteFile(t, source, "css/site.css", "body {}")
+	writeSiteFile(t, source, "_layouts/default.html", `<title>{{.Page.Title}}</title>{{template "nav" .Nav}}{{.Content}}`)
+
+	site := NewMarkdownSite(source, output)
+	if err := site.Build(); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	install, err := ioutil.ReadFile(filepath.Join(output, "guide/install.html"))
+	if err != nil {
+		t.Fatalf("expected install page: %v", err)
+	}
+	if !strings.Contains(string(install), "<title>Install</title>") || !strings.Contains(string(install), "<em>installer</em>") {
+		t.Errorf("unexpected page: %s", install)
+	}
+	if !strings.Contains(string(install), `href="/guide/install.html"`) {
+		t.Errorf("expected navigation in page: %s", install)
+	}
+	if _, err := os.Stat(filepath.Join(output, "guide/index.html")); err != nil {
+		t.Errorf("expected folder index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "guide/secret.html")); err == nil {
+		t.Errorf("draft should not be built")
+	}
+	if _, err := os.Stat(filepath.Join(output, "css/site.css")); err != nil {
+		t.Errorf("expected files to be copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "_layouts")); err == nil {
+		t.Errorf("layouts should not be copied")
+	}
+
+	searchIndex, _ := ioutil.ReadFile(filepath.Join(output, markdownSearchIndexName))
+	if !strings.Contains(string(searchIndex), `"text":"Run the installer"`) {
+		t.Errorf("unexpected search index: %s", searchIndex)
+	}
+
+	// only the changed page is written again when the navigation does not change
+	home, _ := os.Stat(filepath.Join(output, "index.html"))
+	time.Sleep(10 * time.Millisecond)
+	writeSiteFile(t, source, "guide/install.md", "---\ntitle: Install\n---\nRun the setup\n")
+	if err := site.Build(); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	homeAfter, _ := os.Stat(filepath.Join(output, "index.html"))
+	if !homeAfter.ModTime().Equal(home.ModTime()) {
+		t.Errorf("unchanged page should not be built again")
+	}
+	install, _ = ioutil.ReadFile(filepath.Join(output, "guide/install.html"))
+	if !strings.Contains(string(install), "Run the setup") {
+		t.Errorf("changed page should be built again: %s", install)
+	}
+
+	os.Remove(filepath.Join(source, "guide/install.md"))
+	if err := site.Build(); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "guide/install.html")); err == nil {
+		t.Errorf("removed page should be removed from the output")
+	}
+}
+
+func TestBuildMarkdownNav(t *testing.T) {
+	pages := []*MarkdownPage{
+		{Source: "b.md", Url: "/b.html", Title: "B"},
+		{Source: "a.md", Url: "/a.html", Title: "A"},
+		{Source: "docs/index.md", Url: "/docs/", Title: "Docs", Weight: -1},
+		{Source: "docs/x.md", Url: "/docs/x.html", Title: "X"},
+	}
+	nav := BuildMarkdownNav(pages)
+	if len(nav) != 3 || nav[0].Title != "Docs" || nav[1].Title != "A" || nav[2].Title != "B" {
+		t.Fatalf("unexpected navigation: %+v", nav)
+	}
+	if len(nav[0].Children) != 1 || nav[0].Children[0].Url != "/docs/x.html" {
+		t.Errorf("expected page in folder: %+v", nav[0].Children)
+	}
+}
+
+func TestMarkdownSiteBuildsAgainAfterAFailedBuild(t *testing.T) {
+
+	source, _ := ioutil.TempDir("", "markdown-source")
+	output, _ := ioutil.TempDir("", "markdown-output")
+	defer os.RemoveAll(source)
+	defer os.RemoveAll(output)
+
+	writeSiteFile(t, source, "index.md", "---\ntitle: Home\n---\n# Welcome\n")
+	writeSiteFile(t, source, "about.md", "---\ntitle: About\n---\nAbout us\n")
+	writeSiteFile(t, source, "css/site.css", "body {}")
+
+	// a folder where the page is written makes the build fail
+	os.MkdirAll(filepath.Join(output, "about.html"), 0755)
+
+	site := NewMarkdownSite(source, output)
+	if err := site.Build(); err == nil {
+		t.Fatalf("expected the build to fail")
+	}
+
+	os.RemoveAll(filepath.Join(output, "about.html"))
+	os.RemoveAll(filepath.Join(output, "css"))
+	if err := site.Build(); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	about, err := ioutil.ReadFile(filepath.Join(output, "about.html"))
+	if err != nil || !strings.Contains(string(about), "About us") {
+		t.Errorf("expected the page of the failed build to be built again: %s %v", about, err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "css/site.css")); err != nil {
+		t.Errorf("expected the files of the failed build to be copied again: %v", err)
+	}
+}
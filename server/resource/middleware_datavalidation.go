@@ -7,15 +7,15 @@ import (
 	//"github.com/go-playground/validator"
 	"fmt"
 	"github.com/artpar/conform"
-	"github.com/go-playground/locales/en"
 	"github.com/go-playground/universal-translator"
+	"github.com/jmoiron/sqlx"
 	"gopkg.in/go-playground/validator.v9"
+	"sync"
 )
 
 type DataValidationMiddleware struct {
 	config       *CmsConfig
 	tableInfoMap map[string]TableInfo
-	translator   ut.Translator
 }
 
 func (dvm DataValidationMiddleware) String() string {
@@ -45,6 +45,10 @@ func (dvm *DataValidationMiddleware) InterceptBefore(dr *DbResource, req *api2go
 		validations := dvm.tableInfoMap[dr.model.GetName()].Validations
 		conformations := dvm.tableInfoMap[dr.model.GetName()].Conformations
 
+		translator := GetTranslator(requestLanguage(req))
+		validationErrors := make([]api2go.Error, 0)
+		pendingChecks := make([]dataValidatorCheck, 0)
+
 		//log.Infof("We have %d objects to validate", len(objects))
 
 		for i, obj := range objects {
@@ -55,19 +59,57 @@ func (dvm *DataValidationMiddleware) InterceptBefore(dr *DbResource, req *api2go
 				if !ok {
 					continue
 				}
-				errs := ValidatorInstance.VarWithValue(colValue, obj, validate.Tags)
-
-				if errs != nil {
-					validationErrors, ok := errs.(validator.ValidationErrors)
-					if !ok {
-						return nil, api2go.NewHTTPError(errs, "failed to validate incoming data", 400)
+				pointer := validationPointer(len(objects), i, validate.ColumnName)
+
+				tags, dataValidators := SplitValidationTags(validate.Tags)
+				if tags != "" {
+					errs := ValidatorInstance.VarWithValue(colValue, obj, tags)
+					if errs != nil {
+						fieldErrors, ok := errs.(validator.ValidationErrors)
+						if !ok {
+							return nil, api2go.NewHTTPError(errs, "failed to validate incoming data", 400)
+						}
+						for _, fieldError := range fieldErrors {
+							validationErrors = append(validationErrors, validationError(fieldError.Tag(),
+								fieldMessage(fieldError, translator, validate.ColumnName), pointer))
+						}
+						// the stored rows are not checked against a value which is not valid
+						continue
 					}
-					httpErr := api2go.NewHTTPError(errs, strings.Replace(validationErrors[0].Translate(dvm.translator), "for ''", fmt.Sprintf("'%v'", validate.ColumnName), 1), 400)
-					return nil, httpErr
+				}
+
+				for _, dataValidator := range dataValidators {
+					pendingChecks = append(pendingChecks, dataValidatorCheck{
+						DataValidatorTag: dataValidator,
+						columnName:       validate.ColumnName,
+						value:            colValue,
+						obj:              obj,
+						pointer:          pointer,
+					})
 				}
 
 			}
+		}
+
+		failedChecks, err := dvm.runDataValidators(dr, req, pendingChecks)
+		if err != nil {
+			return nil, api2go.NewHTTPError(err, "failed to validate incoming data", 500)
+		}
+		for _, check := range failedChecks {
+			message, err := translator.T(check.Tag, check.columnName)
+			if err != nil {
+				message = fmt.Sprintf("%v failed on the '%v' check", check.columnName, check.Tag)
+			}
+			validationErrors = append(validationErrors, validationError(check.Tag, message, check.pointer))
+		}
+
+		if len(validationErrors) > 0 {
+			httpErr := api2go.NewHTTPError(nil, validationErrors[0].Detail, 400)
+			httpErr.Errors = validationErrors
+			return nil, httpErr
+		}
 
+		for i, obj := range objects {
 			for _, conformation := range conformations {
 				colValue, ok := obj[conformation.ColumnName]
 				if !ok {
@@ -93,6 +135,105 @@ func (dvm *DataValidationMiddleware) InterceptBefore(dr *DbResource, req *api2go
 
 }
 
+// dataValidatorCheck is a data validator to be run on the value of a column of an object
+type dataValidatorCheck struct {
+	DataValidatorTag
+	columnName string
+	value      interface{}
+	obj        map[string]interface{}
+	pointer    string
+}
+
+// maxDataValidatorWorkers is the most checks against the stored rows which run at the same time for a request
+const maxDataValidatorWorkers = 4
+
+// runDataValidators runs the checks against the stored rows a few at a time and gives the checks which failed, in
+// the order they were asked for. The checks of a request in a transaction run one after the other, as the
+// transaction has a single connection
+func (dvm *DataValidationMiddleware) runDataValidators(dr *DbResource, req *api2go.Request, checks []dataValidatorCheck) ([]dataValidatorCheck, error) {
+
+	valid := make([]bool, len(checks))
+	errs := make([]error, len(checks))
+
+	workers := maxDataValidatorWorkers
+	if _, ok := dr.db.(*sqlx.Tx); ok {
+		workers = 1
+	}
+	if workers > len(checks) {
+		workers = len(checks)
+	}
+
+	pending := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				check := checks[i]
+				valid[i], errs[i] = check.Validator(dr, req, check.columnName, check.value, check.Param, check.obj)
+			}
+		}()
+	}
+	for i := range checks {
+		pending <- i
+	}
+	close(pending)
+	wg.Wait()
+
+	failed := make([]dataValidatorCheck, 0)
+	for i, check := range checks {
+		if errs[i] != nil {
+			log.Errorf("Failed to run [%v] on [%v]: %v", check.Tag, check.columnName, errs[i])
+			return nil, errs[i]
+		}
+		if !valid[i] {
+			failed = append(failed, check)
+		}
+	}
+	return failed, nil
+}
+
+// requestLanguage gives the Accept-Language of a request, the requests made for an update carry the headers apart
+// from the plain request
+func requestLanguage(req *api2go.Request) string {
+	if language := req.Header.Get("Accept-Language"); language != "" {
+		return language
+	}
+	return req.PlainRequest.Header.Get("Accept-Language")
+}
+
+// validationPointer points to the attribute of an object in the request document
+func validationPointer(objectCount int, index int, columnName string) string {
+	if objectCount == 1 {
+		return "/data/attributes/" + columnName
+	}
+	return fmt.Sprintf("/data/%d/attributes/%v", index, columnName)
+}
+
+func validationError(code string, detail string, pointer string) api2go.Error {
+	return api2go.Error{
+		Status: "400",
+		Code:   code,
+		Title:  "validation failed",
+		Detail: detail,
+		Source: &api2go.ErrorSource{
+			Pointer: pointer,
+		},
+	}
+}
+
+// fieldMessage translates a validation error. The value is validated without a field name, so the name of the
+// column takes the place of the empty field name leading the message
+func fieldMessage(fieldError validator.FieldError, translator ut.Translator, columnName string) string {
+	message := fieldError.Translate(translator)
+	if strings.Index(message, "for ''") > -1 {
+		// there is no translation of the tag
+		return strings.Replace(message, "for ''", fmt.Sprintf("for '%v'", columnName), 1)
+	}
+	return columnName + message
+}
+
 func NewDataValidationMiddleware(cmsConfig *CmsConfig, cruds *map[string]*DbResource) DatabaseRequestInterceptor {
 
 	tableInfoMap := make(map[string]TableInfo)
@@ -101,13 +242,8 @@ func NewDataValidationMiddleware(cmsConfig *CmsConfig, cruds *map[string]*DbReso
 		tableInfoMap[tabInfo.TableName] = tabInfo
 	}
 
-	e := en.New()
-	uni := ut.New(e, e)
-	en1, _ := uni.GetTranslator("en") // or fallback if fails to find 'en'
-
 	return &DataValidationMiddleware{
 		config:       cmsConfig,
 		tableInfoMap: tableInfoMap,
-		translator:   en1,
 	}
 }
@@ -1,9 +1,9 @@
 package resource
 
 import (
-	"context"
 	"github.com/artpar/api2go"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"strings"
 )
 
@@ -91,15 +91,8 @@ func NewExchangeMiddleware(cmsConfig *CmsConfig, cruds *map[string]*DbResource)
 
 			m = append(m, exc)
 			exchangeMap[exc.SourceAttributes["name"].(string)] = m
-		} else if exc.TargetType == "self" {
-			m, ok := exchangeMap[exc.TargetAttributes["name"].(string)]
-			if !ok {
-				m = make([]ExchangeContract, 0)
-			}
-
-			m = append(m, exc)
-			exchangeMap[exc.TargetAttributes["name"].(string)] = m
 		}
+		// exchanges with another source are pulled by the run_exchange action
 
 	}
 
@@ -146,43 +139,25 @@ func (em *exchangeMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request
 
 				for _, exchange := range exchanges {
 
-					if exchange.OauthTokenId == nil {
+					// the predefined targets like gsheet-append need a token, the other targets may work without one
+					if exchange.OauthTokenId == nil && exchange.TargetType != "self" && exchange.TargetType != "rest" &&
+						exchange.TargetType != "gsheet" && exchange.TargetType != "file" {
 						log.Infof("Oauth token for exchange [%v] is not set", exchange.Name)
 						continue
 					}
 
-					token, err := dr.GetTokenByTokenId(*exchange.OauthTokenId)
-					if err != nil {
-						log.Errorf("No token selected for [%v][%v]: %v", exchange.Name, exchange.OauthTokenId, err)
-					}
-
-					oauthDesc, err := dr.GetOauthDescriptionByTokenId(*exchange.OauthTokenId)
-
-					if err != nil {
-						err = nil
-						log.Errorf("No oauth description for [%v][%v]: %v", exchange.Name, exchange.OauthTokenId, err)
-					}
-					ctx := context.Background()
-
-					if !token.Valid() {
-						tokenSource := oauthDesc.TokenSource(ctx, token)
-						token, err = tokenSource.Token()
-						CheckErr(err, "Failed to get new access token")
-						if err != nil {
-							return results, err
-						}
-
-						err = dr.UpdateAccessTokenByTokenId(*exchange.OauthTokenId, token.AccessToken, token.Expiry.Unix())
-						CheckErr(err, "failed to update access token")
-					}
-
+					token, oauthDesc, err := dr.GetExchangeToken(exchange)
 					if err != nil {
+						log.Errorf("Failed to get token for exchange [%v][%v]: %v", exchange.Name, exchange.OauthTokenId, err)
 						return results, err
 					}
 
-					//client := oauthDesc.Client(ctx, token)
-
-					exchangeExecution := NewExchangeExecution(exchange, token, oauthDesc)
+					exchangeRequest := api2go.Request{
+						PlainRequest: (&http.Request{
+							Method: "POST",
+						}).WithContext(req.PlainRequest.Context()),
+					}
+					exchangeExecution := NewExchangeExecution(exchange, token, oauthDesc, *em.cruds, exchangeRequest)
 
 					inFields := make(map[string]interface{})
 
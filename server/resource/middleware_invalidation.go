@@ -0,0 +1,70 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+)
+
+// tables whose changes have to be picked up by the other instances, and the topic they are published on
+var invalidationTopicsByTable = map[string]string{
+	"task":        InvalidationTopicTask,
+	"site":        InvalidationTopicSite,
+	"cloud_store": InvalidationTopicSite,
+	"usergroup":   InvalidationTopicContext,
+	"user_account_user_account_id_has_usergroup_usergroup_id": InvalidationTopicContext,
+	"role":        InvalidationTopicContext,
+	"role_policy": InvalidationTopicContext,
+	"user_account_user_account_id_has_role_role_id": InvalidationTopicContext,
+	"workspace":        InvalidationTopicWorkspace,
+	"workspace_member": InvalidationTopicWorkspace,
+}
+
+// The InvalidationMiddleware publishes a message on the invalidation bus after a change to a table
+// which other instances keep state for, like the task schedule or the local copy of a site
+type InvalidationMiddleware struct {
+	bus InvalidationBus
+}
+
+func NewInvalidationMiddleware(bus InvalidationBus) DatabaseRequestInterceptor {
+	return &InvalidationMiddleware{
+		bus: bus,
+	}
+}
+
+func (im *InvalidationMiddleware) String() string {
+	return "InvalidationMiddleware"
+}
+
+func (im *InvalidationMiddleware) InterceptBefore(dr *DbResource, req *api2go.Request, objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	return objects, nil
+}
+
+func (im *InvalidationMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	topic, ok := invalidationTopicsByTable[dr.model.GetName()]
+	if !ok {
+		return results, nil
+	}
+
+	switch req.PlainRequest.Method {
+	case "POST", "PATCH", "PUT", "DELETE":
+	default:
+		return results, nil
+	}
+
+	// the site topic is keyed by the site, any other change publishes an empty key which means everything
+	keys := []string{""}
+	if dr.model.GetName() == "site" && len(results) > 0 {
+		keys = make([]string, 0)
+		for _, result := range results {
+			referenceId, _ := result["reference_id"].(string)
+			keys = append(keys, referenceId)
+		}
+	}
+
+	for _, key := range keys {
+		err := im.bus.Publish(topic, key)
+		CheckErr(err, "Failed to publish change in [%v]", dr.model.GetName())
+	}
+
+	return results, nil
+}
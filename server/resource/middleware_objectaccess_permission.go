@@ -41,6 +41,7 @@ func (pc *ObjectAccessPermissionChecker) InterceptAfter(dr *DbResource, req *api
 	if isAdmin {
 		return results, nil
 	}
+	workspace := GetWorkspace(req.PlainRequest)
 
 	notIncludedMapCache := make(map[string]bool)
 	includedMapCache := make(map[string]bool)
@@ -58,6 +59,12 @@ func (pc *ObjectAccessPermissionChecker) InterceptAfter(dr *DbResource, req *api
 			continue
 		}
 
+		// the administrators of a workspace see every row of the workspace, included rows are of any type
+		if crud, ok := dr.Cruds[result["__type"].(string)]; ok && workspace != nil && workspace.IsAdmin && crud.IsWorkspaceScoped() {
+			returnMap = append(returnMap, result)
+			continue
+		}
+
 		//log.Infof("Check permission for : %v", result)
 
 		referenceId := result["reference_id"].(string)
@@ -75,7 +82,13 @@ func (pc *ObjectAccessPermissionChecker) InterceptAfter(dr *DbResource, req *api
 
 		//log.Infof("Row Permission for [%v] for [%v]", permission, result)
 
-		if req.PlainRequest.Method == "GET" {
+		decision := dr.RoleDecision(sessionUser, result["__type"].(string), "", PolicyOperationRead, &permission)
+		if decision == PolicyAllow {
+			returnMap = append(returnMap, result)
+			includedMapCache[referenceId] = true
+		} else if decision == PolicyDeny {
+			notIncludedMapCache[referenceId] = true
+		} else if req.PlainRequest.Method == "GET" {
 			if permission.CanRead(sessionUser.UserReferenceId, sessionUser.Groups) {
 				returnMap = append(returnMap, result)
 				includedMapCache[referenceId] = true
@@ -118,7 +131,7 @@ func (pc *ObjectAccessPermissionChecker) InterceptBefore(dr *DbResource, req *ap
 	}
 
 	adminId := dr.GetAdminReferenceId()
-	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId || dr.IsWorkspaceAdmin(req.PlainRequest)
 
 	if isAdmin {
 		return results, nil
@@ -163,7 +176,14 @@ func (pc *ObjectAccessPermissionChecker) InterceptBefore(dr *DbResource, req *ap
 		//log.Infof("[ObjectAccessPermissionChecker] PermissionInstance check for type: [%v] on [%v] @%v", req.PlainRequest.Method, dr.model.GetName(), permission.PermissionInstance)
 		//log.Infof("Row Permission for [%v] for [%v]", permission, result)
 
-		if req.PlainRequest.Method == "GET" {
+		typeName, _ := result["__type"].(string)
+		decision := dr.RoleDecision(sessionUser, typeName, "", PolicyOperationForMethod(req.PlainRequest.Method), &permission)
+		if decision == PolicyAllow {
+			returnMap = append(returnMap, result)
+			includedMapCache[referenceId] = true
+		} else if decision == PolicyDeny {
+			notIncludedMapCache[referenceId] = true
+		} else if req.PlainRequest.Method == "GET" {
 			if permission.CanPeek(sessionUser.UserReferenceId, sessionUser.Groups) {
 				returnMap = append(returnMap, result)
 				includedMapCache[referenceId] = true
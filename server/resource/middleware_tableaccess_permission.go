@@ -34,12 +34,19 @@ func (pc *TableAccessPermissionChecker) InterceptAfter(dr *DbResource, req *api2
 	}
 
 	adminId := dr.GetAdminReferenceId()
-	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId || dr.IsWorkspaceAdmin(req.PlainRequest)
 
 	if isAdmin {
 		return results, nil
 	}
 
+	switch dr.RoleDecision(sessionUser, dr.model.GetName(), "", PolicyOperationRead, nil) {
+	case PolicyAllow:
+		return results, nil
+	case PolicyDeny:
+		return nil, api2go.NewHTTPError(ErrUnauthorized, pc.String(), 403)
+	}
+
 	tableOwnership := dr.GetObjectPermissionByWhereClause("world", "table_name", dr.model.GetName())
 
 	//log.Printf("Row Permission for [%v] for [%v]", dr.model.GetName(), tableOwnership)
@@ -81,12 +88,20 @@ func (pc *TableAccessPermissionChecker) InterceptBefore(dr *DbResource, req *api
 	}
 
 	adminId := dr.GetAdminReferenceId()
-	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId || dr.IsWorkspaceAdmin(req.PlainRequest)
 
 	if isAdmin {
 		return results, nil
 	}
 
+	// the policies of the roles of the user decide before the permissions of the table
+	switch dr.RoleDecision(sessionUser, dr.model.GetName(), "", PolicyOperationForMethod(req.PlainRequest.Method), nil) {
+	case PolicyAllow:
+		return results, nil
+	case PolicyDeny:
+		return nil, api2go.NewHTTPError(ErrUnauthorized, pc.String(), 403)
+	}
+
 	//log.Printf("User Id: %v", sessionUser.UserReferenceId)
 	//log.Printf("User Groups: %v", sessionUser.Groups)
 
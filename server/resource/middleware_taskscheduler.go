@@ -0,0 +1,41 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+)
+
+// The TaskSchedulerMiddleware keeps the cron entries of the task scheduler in sync with the task table
+// Any create, update or delete on the task table reschedules the affected jobs without a restart
+type TaskSchedulerMiddleware struct {
+	taskScheduler TaskScheduler
+}
+
+func NewTaskSchedulerMiddleware(taskScheduler TaskScheduler) DatabaseRequestInterceptor {
+	return &TaskSchedulerMiddleware{
+		taskScheduler: taskScheduler,
+	}
+}
+
+func (tsm *TaskSchedulerMiddleware) String() string {
+	return "TaskSchedulerMiddleware"
+}
+
+// Intercept before does nothing, the schedule is changed only after the change to the task table is complete
+func (tsm *TaskSchedulerMiddleware) InterceptBefore(dr *DbResource, req *api2go.Request, objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	return objects, nil
+}
+
+func (tsm *TaskSchedulerMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	if dr.model.GetName() != "task" {
+		return results, nil
+	}
+
+	switch req.PlainRequest.Method {
+	case "POST", "PATCH", "PUT", "DELETE":
+		err := tsm.taskScheduler.SyncTasks()
+		CheckErr(err, "Failed to sync scheduled tasks after change in task table")
+	}
+
+	return results, nil
+}
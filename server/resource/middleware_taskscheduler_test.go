@@ -0,0 +1,49 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	"net/http"
+	"testing"
+)
+
+type countingTaskScheduler struct {
+	TaskScheduler
+	syncs int
+}
+
+func (cts *countingTaskScheduler) SyncTasks() error {
+	cts.syncs += 1
+	return nil
+}
+
+func TestTaskSchedulerMiddlewareSyncsOnTaskChanges(t *testing.T) {
+
+	scheduler := &countingTaskScheduler{}
+	middleware := NewTaskSchedulerMiddleware(scheduler)
+
+	taskResource := &DbResource{model: api2go.NewApi2GoModel("task", nil, 0, nil)}
+	worldResource := &DbResource{model: api2go.NewApi2GoModel("world", nil, 0, nil)}
+
+	cases := []struct {
+		dr     *DbResource
+		method string
+		syncs  int
+	}{
+		{taskResource, "GET", 0},
+		{taskResource, "POST", 1},
+		{taskResource, "PATCH", 2},
+		{taskResource, "DELETE", 3},
+		{worldResource, "POST", 3},
+	}
+
+	for _, c := range cases {
+		plainRequest, _ := http.NewRequest(c.method, "/api/"+c.dr.model.GetName(), nil)
+		_, err := middleware.InterceptAfter(c.dr, &api2go.Request{PlainRequest: plainRequest}, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if scheduler.syncs != c.syncs {
+			t.Errorf("expected %d syncs after %v on %v, got %d", c.syncs, c.method, c.dr.model.GetName(), scheduler.syncs)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+)
+
+// WorkspaceScopeChecker keeps the rows of a workspace inside the workspace. Only the rows of the workspace of the
+// request are read, changed or deleted, and only the members of a workspace can write to it
+type WorkspaceScopeChecker struct {
+}
+
+func (wc *WorkspaceScopeChecker) String() string {
+	return "WorkspaceScopeChecker"
+}
+
+func (wc *WorkspaceScopeChecker) InterceptBefore(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	if !dr.IsWorkspaceScoped() {
+		return results, nil
+	}
+
+	workspace := GetWorkspace(req.PlainRequest)
+	if workspace != nil && !workspace.IsMember && req.PlainRequest.Method != "GET" && !isAdministrator(dr, req) {
+		return nil, api2go.NewHTTPError(fmt.Errorf("%v", "forbidden"), wc.String(), 403)
+	}
+
+	if req.PlainRequest.Method == "POST" {
+		return results, nil
+	}
+
+	returnMap := make([]map[string]interface{}, 0)
+	for _, result := range results {
+		referenceId, ok := result["reference_id"].(string)
+		if !ok || result["__type"] != dr.model.GetName() {
+			returnMap = append(returnMap, result)
+			continue
+		}
+		if wc.inWorkspace(dr, workspace, referenceId) {
+			returnMap = append(returnMap, result)
+		}
+	}
+
+	if len(results) != 0 && len(returnMap) == 0 {
+		// rows of other workspaces are not found, rather than forbidden, to not tell that they exist
+		return returnMap, api2go.NewHTTPError(fmt.Errorf("%v", "not found"), wc.String(), 404)
+	}
+
+	return returnMap, nil
+}
+
+func (wc *WorkspaceScopeChecker) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	if req.PlainRequest.Method != "GET" || len(results) == 0 {
+		return results, nil
+	}
+
+	workspace := GetWorkspace(req.PlainRequest)
+	workspaceReferenceId := ""
+	if workspace != nil {
+		workspaceReferenceId = workspace.WorkspaceReferenceId
+	}
+
+	// the included rows can be of any type, each is checked against its own table
+	returnMap := make([]map[string]interface{}, 0)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		typeName, _ := result["__type"].(string)
+		crud, ok := dr.Cruds[typeName]
+		if !ok || !crud.IsWorkspaceScoped() {
+			returnMap = append(returnMap, result)
+			continue
+		}
+
+		if rowWorkspace, ok := result[WORKSPACE_ID_COLUMN]; ok {
+			rowWorkspaceReferenceId, _ := rowWorkspace.(string)
+			if rowWorkspaceReferenceId == workspaceReferenceId {
+				returnMap = append(returnMap, result)
+			}
+			continue
+		}
+
+		referenceId, ok := result["reference_id"].(string)
+		if ok && wc.inWorkspace(crud, workspace, referenceId) {
+			returnMap = append(returnMap, result)
+		}
+	}
+
+	return returnMap, nil
+}
+
+func (wc *WorkspaceScopeChecker) inWorkspace(dr *DbResource, workspace *auth.SessionWorkspace, referenceId string) bool {
+	rowWorkspaceId, err := dr.GetRowWorkspaceId(dr.model.GetName(), referenceId)
+	if err == sql.ErrNoRows {
+		// a row which does not exist is left for the request to not find
+		return true
+	} else if err != nil {
+		return false
+	}
+	if workspace == nil {
+		return rowWorkspaceId == 0
+	}
+	return rowWorkspaceId == workspace.WorkspaceId
+}
+
+func isAdministrator(dr *DbResource, req *api2go.Request) bool {
+	sessionUser, ok := req.PlainRequest.Context().Value("user").(*auth.SessionUser)
+	if !ok {
+		return false
+	}
+	adminId := dr.GetAdminReferenceId()
+	return adminId != "" && adminId == sessionUser.UserReferenceId
+}
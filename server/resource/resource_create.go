@@ -90,6 +90,10 @@ func (dr *DbResource) CreateWithoutFilter(obj interface{}, req api2go.Request) (
 			continue
 		}
 
+		if col.ColumnName == WORKSPACE_ID_COLUMN && dr.IsWorkspaceScoped() {
+			continue
+		}
+
 		//log.Infof("Check column: %v", col.ColumnName)
 
 		val, ok := attrs[col.ColumnName]
@@ -346,6 +350,11 @@ func (dr *DbResource) CreateWithoutFilter(obj interface{}, req api2go.Request) (
 		valsList = append(valsList, sessionUser.UserId)
 	}
 
+	if workspace := GetWorkspace(req.PlainRequest); workspace != nil && dr.IsWorkspaceScoped() {
+		colsList = append(colsList, WORKSPACE_ID_COLUMN)
+		valsList = append(valsList, workspace.WorkspaceId)
+	}
+
 	query, vals, err := statementbuilder.Squirrel.Insert(dr.model.GetName()).Columns(colsList...).Values(valsList...).ToSql()
 	if err != nil {
 		log.Errorf("Failed to create insert query: %v", err)
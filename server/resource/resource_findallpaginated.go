@@ -173,6 +173,18 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 		sortOrder = strings.Split(dr.tableInfo.DefaultOrder, ",")
 	}
 
+	queriedColumns := make([]string, 0)
+	for _, filterQuery := range queries {
+		queriedColumns = append(queriedColumns, filterQuery.ColumnName)
+	}
+	for _, so := range sortOrder {
+		queriedColumns = append(queriedColumns, strings.TrimLeft(so, "-+"))
+	}
+	err = dr.requireJsonFunctions(queriedColumns...)
+	if err != nil {
+		return nil, nil, nil, api2go.NewHTTPError(err, err.Error(), 400)
+	}
+
 	var filters []string
 
 	if len(req.QueryParams["filter"]) > 0 && len(queries) == 0 {
@@ -313,7 +325,10 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 		}
 	}
 
-	queryBuilder = addFilters(queryBuilder, queries, prefix)
+	queryBuilder = dr.addFilters(queryBuilder, queries, prefix)
+
+	queryBuilder = dr.ScopeToWorkspace(queryBuilder, req.PlainRequest, prefix)
+	countQueryBuilder = dr.ScopeToWorkspace(countQueryBuilder, req.PlainRequest, prefix)
 
 	if len(groupings) > 0 && false {
 		for _, groupBy := range groupings {
@@ -455,18 +470,18 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 		}
 		//log.Infof("Sort order: %v", so)
 		if so[0] == '-' {
-			ord := prefix + so[1:] + " desc"
+			ord := dr.columnExpression(prefix, so[1:]) + " desc"
 			queryBuilder = queryBuilder.OrderBy(ord)
 			countQueryBuilder = countQueryBuilder.OrderBy(ord)
 			orders = append(orders, ord)
 		} else {
 			if so[0] == '+' {
-				ord := prefix + so[1:] + " asc"
+				ord := dr.columnExpression(prefix, so[1:]) + " asc"
 				queryBuilder = queryBuilder.OrderBy(ord)
 				countQueryBuilder = countQueryBuilder.OrderBy(ord)
 				orders = append(orders, ord)
 			} else {
-				ord := prefix + so + " asc"
+				ord := dr.columnExpression(prefix, so) + " asc"
 				queryBuilder = queryBuilder.OrderBy(ord)
 				countQueryBuilder = countQueryBuilder.OrderBy(ord)
 				orders = append(orders, ord)
@@ -568,28 +583,38 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 	return results, includes, paginationData, err
 
 }
-func addFilters(queryBuilder squirrel.SelectBuilder, queries []Query, prefix string) squirrel.SelectBuilder {
+func (dr *DbResource) addFilters(queryBuilder squirrel.SelectBuilder, queries []Query, prefix string) squirrel.SelectBuilder {
 
 	if len(queries) == 0 {
 		return queryBuilder
 	}
 
 	for _, filterQuery := range queries {
+		column := dr.comparedExpression(prefix, filterQuery.ColumnName, filterQuery.Value)
+		jsonPath, isJsonPath := ParseJsonPath(dr.tableInfo, filterQuery.ColumnName)
 		switch filterQuery.Operator {
 		case "contains":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s like ?", prefix+filterQuery.ColumnName), "%"+fmt.Sprintf("%v", filterQuery.Value)+"%")
+			if isJsonPath {
+				queryBuilder = dr.addJsonContains(queryBuilder, jsonPath, prefix, filterQuery.Value, false)
+				continue
+			}
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s like ?", column), "%"+fmt.Sprintf("%v", filterQuery.Value)+"%")
 		case "not contains":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s not like ?", prefix+filterQuery.ColumnName), "%"+fmt.Sprintf("%v", filterQuery.Value)+"%")
+			if isJsonPath {
+				queryBuilder = dr.addJsonContains(queryBuilder, jsonPath, prefix, filterQuery.Value, true)
+				continue
+			}
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s not like ?", column), "%"+fmt.Sprintf("%v", filterQuery.Value)+"%")
 		case "is":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s = ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s = ?", column), filterQuery.Value)
 		case "is not":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s != ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s != ?", column), filterQuery.Value)
 		case "before":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s < ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s < ?", column), filterQuery.Value)
 		case "after":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s > ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s > ?", column), filterQuery.Value)
 		case "more then":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s > ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s > ?", column), filterQuery.Value)
 		case "any of":
 			vals := strings.Split(fmt.Sprintf("%v", filterQuery.Value), ",")
 			valsInterface := make([]interface{}, len(vals))
@@ -597,7 +622,7 @@ func addFilters(queryBuilder squirrel.SelectBuilder, queries []Query, prefix str
 				valsInterface[i] = v
 			}
 			questions := strings.Join(strings.Split(strings.Repeat("?", len(vals)), ""), ", ")
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s in (%s)", prefix+filterQuery.ColumnName, questions), valsInterface...)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s in (%s)", column, questions), valsInterface...)
 		case "none of":
 			vals := strings.Split(fmt.Sprintf("%v", filterQuery.Value), ",")
 			valsInterface := make([]interface{}, len(vals))
@@ -605,13 +630,13 @@ func addFilters(queryBuilder squirrel.SelectBuilder, queries []Query, prefix str
 				valsInterface[i] = v
 			}
 			questions := strings.Join(strings.Split(strings.Repeat("?", len(vals)), ""), ", ")
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s not in (%s)", prefix+filterQuery.ColumnName, questions), valsInterface...)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s not in (%s)", column, questions), valsInterface...)
 		case "less then":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s < ?", prefix+filterQuery.ColumnName), filterQuery.Value)
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s < ?", column), filterQuery.Value)
 		case "is empty":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s is null or %s = ''", prefix+filterQuery.ColumnName, prefix+filterQuery.ColumnName))
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("(%s is null or %s = '')", column, column))
 		case "is not empty":
-			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s is not null and %s != ''", prefix+filterQuery.ColumnName, prefix+filterQuery.ColumnName))
+			queryBuilder = queryBuilder.Where(fmt.Sprintf("%s is not null and %s != ''", column, column))
 		}
 	}
 
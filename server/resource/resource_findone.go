@@ -46,7 +46,7 @@ func (dr *DbResource) FindOne(referenceId string, req api2go.Request) (api2go.Re
 	//	parts := strings.Split(modelName, "_has_")
 	//}
 
-	data, include, err := dr.GetSingleRowByReferenceId(modelName, referenceId)
+	data, include, err := dr.GetSingleRowByReferenceId(modelName, referenceId, req.PlainRequest)
 
 	//log.Printf("Single row result: %v", data)
 	for _, bf := range dr.ms.AfterFindOne {
@@ -6,6 +6,7 @@ import (
 	"github.com/daptin/daptin/server/statementbuilder"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"regexp"
 	"sort"
 	"strings"
@@ -24,6 +25,8 @@ type AggregationRequest struct {
 	TimeSample    TimeStamp
 	TimeFrom      string
 	TimeTo        string
+	// PlainRequest is the request the aggregate is read for, only the rows of its workspace are aggregated
+	PlainRequest *http.Request
 }
 
 // PaginatedFindAll(req Request) (totalCount uint, response Responder, err error)
@@ -42,30 +45,82 @@ func InArray(val []string, ar string) (exists bool) {
 	return false
 }
 
+// aggregationSyntax is a projection like sum(attributes.price) as total
+var aggregationSyntax = regexp.MustCompile(`^([a-zA-Z0-9_]+)\(([^()]+)\)(.*)$`)
+
+// aggregateExpression resolves the json path in a projection, a column or a function of a column
+func (dr *DbResource) aggregateExpression(projection string) string {
+	parts := aggregationSyntax.FindStringSubmatch(strings.TrimSpace(projection))
+	if parts == nil {
+		expression := dr.columnExpression("", projection)
+		if expression != projection {
+			expression = expression + " as " + strings.Replace(projection, ".", "_", -1)
+		}
+		return expression
+	}
+	return parts[1] + "(" + dr.columnExpression("", strings.TrimSpace(parts[2])) + ")" + parts[3]
+}
+
 func (dr *DbResource) DataStats(req AggregationRequest) (AggregateData, error) {
 
+	queriedColumns := append([]string{}, req.GroupBy...)
+	for _, project := range req.ProjectColumn {
+		if parts := aggregationSyntax.FindStringSubmatch(strings.TrimSpace(project)); parts != nil {
+			project = parts[2]
+		}
+		queriedColumns = append(queriedColumns, strings.TrimSpace(project))
+	}
+	for _, order := range req.Order {
+		queriedColumns = append(queriedColumns, strings.SplitN(order, " ", 2)[0])
+	}
+	for _, query := range req.Query {
+		queriedColumns = append(queriedColumns, query.ColumnName)
+	}
+	err := dr.requireJsonFunctions(queriedColumns...)
+	if err != nil {
+		return AggregateData{}, err
+	}
+
 	sort.Strings(req.GroupBy)
 	projections := req.ProjectColumn
 
 	for i, project := range projections {
 		if project == "count" {
 			projections[i] = "count(*) as count"
+		} else {
+			projections[i] = dr.aggregateExpression(project)
 		}
 	}
 
+	groupBy := make([]string, 0)
 	for _, group := range req.GroupBy {
-		projections = append(projections, group)
+		expression := dr.columnExpression("", group)
+		groupBy = append(groupBy, expression)
+		if expression != group {
+			// the group of a json path is named like the path, with underscores
+			expression = expression + " as " + strings.Replace(group, ".", "_", -1)
+		}
+		projections = append(projections, expression)
 	}
 
 	if len(projections) == 0 {
 		projections = append(projections, "count(*) as count")
 	}
 
+	orders := make([]string, 0)
+	for _, order := range req.Order {
+		parts := strings.SplitN(order, " ", 2)
+		parts[0] = dr.columnExpression("", parts[0])
+		orders = append(orders, strings.Join(parts, " "))
+	}
+
 	selectBuilder := statementbuilder.Squirrel.Select(projections...)
 	builder := selectBuilder.From(req.RootEntity)
-	builder = builder.GroupBy(req.GroupBy...)
+	builder = builder.GroupBy(groupBy...)
 
-	builder = builder.OrderBy(req.Order...)
+	builder = builder.OrderBy(orders...)
+	builder = dr.addFilters(builder, req.Query, "")
+	builder = dr.ScopeToWorkspace(builder, req.PlainRequest, "")
 
 	// functionName(param1, param2)
 	querySyntax, err := regexp.Compile("([a-zA-Z0-9]+)\\(([^,]+?),(.+)\\)")
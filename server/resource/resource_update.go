@@ -89,6 +89,11 @@ func (dr *DbResource) UpdateWithoutFilters(obj interface{}, req api2go.Request)
 				continue
 			}
 
+			// rows stay in the workspace they were created in
+			if col.ColumnName == WORKSPACE_ID_COLUMN && dr.IsWorkspaceScoped() {
+				continue
+			}
+
 			change, ok := allChanges[col.ColumnName]
 			if !ok {
 				continue
@@ -0,0 +1,261 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// The rows a policy applies to, relative to the user. A policy on the rows the user owns, or shares a group with,
+// is more specific than a policy on any row and wins over it
+const (
+	PolicyOwnershipAny   = "any"
+	PolicyOwnershipOwn   = "own"
+	PolicyOwnershipGroup = "group"
+)
+
+const (
+	PolicyEffectAllow = "allow"
+	PolicyEffectDeny  = "deny"
+)
+
+// Operations named in a policy, read covers both peek and read of the permission bitmask
+const (
+	PolicyOperationRead    = "read"
+	PolicyOperationCreate  = "create"
+	PolicyOperationUpdate  = "update"
+	PolicyOperationDelete  = "delete"
+	PolicyOperationExecute = "execute"
+)
+
+// RolePolicy allows or denies the users with a role some operations on the rows of a table, or the execution of an
+// action of the table when it names an action
+type RolePolicy struct {
+	Role       string
+	TableName  string `db:"table_name"`
+	ActionName string `db:"action_name"`
+	Operations string
+	Ownership  string
+	Effect     string
+}
+
+// PolicyDecision is the result of the policies of the roles of a user, without a decision the permission bitmask
+// decides
+type PolicyDecision int
+
+const (
+	PolicyNoDecision PolicyDecision = iota
+	PolicyAllow
+	PolicyDeny
+)
+
+// PolicyOperationForMethod gives the operation of a request method
+func PolicyOperationForMethod(method string) string {
+	switch method {
+	case "POST":
+		return PolicyOperationCreate
+	case "PUT", "PATCH":
+		return PolicyOperationUpdate
+	case "DELETE":
+		return PolicyOperationDelete
+	}
+	return PolicyOperationRead
+}
+
+func (p RolePolicy) covers(tableName string, actionName string, operation string) bool {
+	if p.TableName != "*" && p.TableName != tableName {
+		return false
+	}
+	if p.ActionName != actionName {
+		return false
+	}
+	for _, op := range strings.Split(p.Operations, ",") {
+		op = strings.TrimSpace(op)
+		if op == "*" || op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RolePolicy) ownership() string {
+	if p.Ownership == "" {
+		return PolicyOwnershipAny
+	}
+	return p.Ownership
+}
+
+// ownsRow tells if the row is owned by the user, or shares a group with the user, as the ownership of the policy asks
+func ownsRow(ownership string, row PermissionInstance, sessionUser *auth.SessionUser) bool {
+	switch ownership {
+	case PolicyOwnershipAny:
+		return true
+	case PolicyOwnershipOwn:
+		return row.UserId != "" && row.UserId == sessionUser.UserReferenceId
+	case PolicyOwnershipGroup:
+		for _, userGroup := range sessionUser.Groups {
+			for _, rowGroup := range row.UserGroupId {
+				if userGroup.GroupReferenceId == rowGroup.GroupReferenceId {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// EvaluateRolePolicies decides an operation on a table, or on a row of it when the row is given. Without a row, any
+// allowing policy lets the request through to the checks of the rows, and only a deny on any row stops it. With a
+// row, the most specific ownership which matches the row decides, a deny winning over an allow of the same ownership.
+// An allow limited to the rows the user owns, or shares a group with, denies the operation on the other rows
+func EvaluateRolePolicies(policies []RolePolicy, roles []string, tableName string, actionName string, operation string,
+	row *PermissionInstance, sessionUser *auth.SessionUser) PolicyDecision {
+
+	hasRole := make(map[string]bool)
+	for _, role := range roles {
+		hasRole[role] = true
+	}
+
+	applicable := make([]RolePolicy, 0)
+	for _, policy := range policies {
+		if hasRole[policy.Role] && policy.covers(tableName, actionName, operation) {
+			applicable = append(applicable, policy)
+		}
+	}
+	if len(applicable) == 0 {
+		return PolicyNoDecision
+	}
+
+	if row == nil {
+		decision := PolicyNoDecision
+		for _, policy := range applicable {
+			if policy.Effect != PolicyEffectDeny {
+				return PolicyAllow
+			}
+			if policy.ownership() == PolicyOwnershipAny {
+				decision = PolicyDeny
+			}
+		}
+		return decision
+	}
+
+	restricted := false
+	for _, ownership := range []string{PolicyOwnershipOwn, PolicyOwnershipGroup, PolicyOwnershipAny} {
+		if !ownsRow(ownership, *row, sessionUser) {
+			for _, policy := range applicable {
+				if policy.ownership() == ownership && policy.Effect != PolicyEffectDeny {
+					restricted = true
+				}
+			}
+			continue
+		}
+		decision := PolicyNoDecision
+		for _, policy := range applicable {
+			if policy.ownership() != ownership {
+				continue
+			}
+			if policy.Effect == PolicyEffectDeny {
+				return PolicyDeny
+			}
+			decision = PolicyAllow
+		}
+		if decision != PolicyNoDecision {
+			return decision
+		}
+	}
+
+	if restricted {
+		return PolicyDeny
+	}
+	return PolicyNoDecision
+}
+
+// GetRolePolicies loads the policies of every role, they are cached until a role or a policy changes
+func (dr *DbResource) GetRolePolicies() []RolePolicy {
+
+	if cached, ok := dr.GetContext("role_policies").([]RolePolicy); ok {
+		return cached
+	}
+
+	policies := make([]RolePolicy, 0)
+	s, v, err := statementbuilder.Squirrel.Select("r.name as role", "p.table_name", "coalesce(p.action_name, '') as action_name",
+		"p.operations", "p.ownership", "p.effect").
+		From("role_policy p").Join("role r on r.id = p.role_id").ToSql()
+	if err != nil {
+		log.Errorf("Failed to create role policy query: %v", err)
+		return policies
+	}
+
+	rows, err := dr.db.Queryx(s, v...)
+	if err != nil {
+		log.Errorf("Failed to load role policies: %v", err)
+		return policies
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy RolePolicy
+		err = rows.StructScan(&policy)
+		if err != nil {
+			log.Errorf("Failed to scan role policy: %v", err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	dr.PutContext("role_policies", policies)
+	return policies
+}
+
+// GetUserRoles gives the names of the roles of a user, cached until the roles of a user change
+func (dr *DbResource) GetUserRoles(userId int64) []string {
+
+	cacheKey := fmt.Sprintf("user_roles.%d", userId)
+	if cached, ok := dr.GetContext(cacheKey).([]string); ok {
+		return cached
+	}
+
+	roles := make([]string, 0)
+	s, v, err := statementbuilder.Squirrel.Select("r.name").From("role r").
+		Join("user_account_user_account_id_has_role_role_id ur on ur.role_id = r.id").
+		Where(squirrel.Eq{"ur." + USER_ACCOUNT_ID_COLUMN: userId}).ToSql()
+	if err != nil {
+		log.Errorf("Failed to create user roles query: %v", err)
+		return roles
+	}
+
+	rows, err := dr.db.Queryx(s, v...)
+	if err != nil {
+		log.Errorf("Failed to load roles of user [%v]: %v", userId, err)
+		return roles
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		err = rows.Scan(&role)
+		if err != nil {
+			log.Errorf("Failed to scan role: %v", err)
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	dr.PutContext(cacheKey, roles)
+	return roles
+}
+
+// RoleDecision evaluates the policies of the roles of the user for an operation on a table or one of its rows
+func (dr *DbResource) RoleDecision(sessionUser *auth.SessionUser, tableName string, actionName string, operation string, row *PermissionInstance) PolicyDecision {
+	if sessionUser == nil || sessionUser.UserId == 0 {
+		return PolicyNoDecision
+	}
+	policies := dr.GetRolePolicies()
+	if len(policies) == 0 {
+		return PolicyNoDecision
+	}
+	return EvaluateRolePolicies(policies, dr.GetUserRoles(sessionUser.UserId), tableName, actionName, operation, row, sessionUser)
+}
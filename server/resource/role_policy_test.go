@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"github.com/daptin/daptin/server/auth"
+	"testing"
+)
+
+func TestEvaluateRolePolicies(t *testing.T) {
+
+	policies := []RolePolicy{
+		{Role: "editor", TableName: "blog_post", Operations: "read,update", Ownership: PolicyOwnershipAny, Effect: PolicyEffectAllow},
+		{Role: "editor", TableName: "blog_post", Operations: "delete", Ownership: PolicyOwnershipAny, Effect: PolicyEffectDeny},
+		{Role: "editor", TableName: "blog_post", Operations: "delete", Ownership: PolicyOwnershipOwn, Effect: PolicyEffectAllow},
+		{Role: "editor", TableName: "blog_post", ActionName: "publish", Operations: "execute", Ownership: PolicyOwnershipGroup, Effect: PolicyEffectAllow},
+	}
+
+	sessionUser := &auth.SessionUser{
+		UserId:          2,
+		UserReferenceId: "editor-user",
+		Groups:          []auth.GroupPermission{{GroupReferenceId: "writers"}},
+	}
+	roles := []string{"editor"}
+
+	ownRow := &PermissionInstance{UserId: "editor-user"}
+	otherRow := &PermissionInstance{UserId: "other-user"}
+	groupRow := &PermissionInstance{UserId: "other-user", UserGroupId: []auth.GroupPermission{{GroupReferenceId: "writers"}}}
+
+	cases := []struct {
+		name      string
+		action    string
+		operation string
+		row       *PermissionInstance
+		roles     []string
+		expected  PolicyDecision
+	}{
+		{"update any row", "", PolicyOperationUpdate, otherRow, roles, PolicyAllow},
+		{"delete own row", "", PolicyOperationDelete, ownRow, roles, PolicyAllow},
+		{"delete others row", "", PolicyOperationDelete, otherRow, roles, PolicyDeny},
+		{"delete on table", "", PolicyOperationDelete, nil, roles, PolicyAllow},
+		{"create on table", "", PolicyOperationCreate, nil, roles, PolicyNoDecision},
+		{"execute on group row", "publish", PolicyOperationExecute, groupRow, roles, PolicyAllow},
+		{"execute on others row", "publish", PolicyOperationExecute, otherRow, roles, PolicyDeny},
+		{"without the role", "", PolicyOperationUpdate, otherRow, []string{"viewer"}, PolicyNoDecision},
+	}
+
+	for _, c := range cases {
+		decision := EvaluateRolePolicies(policies, c.roles, "blog_post", c.action, c.operation, c.row, sessionUser)
+		if decision != c.expected {
+			t.Errorf("%v: expected decision %v, got %v", c.name, c.expected, decision)
+		}
+	}
+
+	denyAll := []RolePolicy{
+		{Role: "guest", TableName: "*", Operations: "*", Ownership: PolicyOwnershipAny, Effect: PolicyEffectDeny},
+	}
+	if decision := EvaluateRolePolicies(denyAll, []string{"guest"}, "todo", "", PolicyOperationRead, nil, sessionUser); decision != PolicyDeny {
+		t.Errorf("expected a deny on every table, got %v", decision)
+	}
+}
+
+func TestOwnOnlyPolicyDeniesOtherRows(t *testing.T) {
+
+	// editors can update any blog post but only delete their own
+	policies := []RolePolicy{
+		{Role: "editor", TableName: "blog_post", Operations: "read,update", Ownership: PolicyOwnershipAny, Effect: PolicyEffectAllow},
+		{Role: "editor", TableName: "blog_post", Operations: "delete", Ownership: PolicyOwnershipOwn, Effect: PolicyEffectAllow},
+		{Role: "editor", TableName: "blog_post", Operations: "create", Ownership: PolicyOwnershipOwn, Effect: PolicyEffectDeny},
+	}
+	sessionUser := &auth.SessionUser{UserId: 2, UserReferenceId: "editor-user"}
+	roles := []string{"editor"}
+
+	ownRow := &PermissionInstance{UserId: "editor-user", Permission: auth.GuestCRUD}
+	otherRow := &PermissionInstance{UserId: "other-user", Permission: auth.GuestCRUD}
+
+	cases := []struct {
+		name      string
+		operation string
+		row       *PermissionInstance
+		expected  PolicyDecision
+	}{
+		{"update own row", PolicyOperationUpdate, ownRow, PolicyAllow},
+		{"update others row", PolicyOperationUpdate, otherRow, PolicyAllow},
+		{"delete own row", PolicyOperationDelete, ownRow, PolicyAllow},
+		// the permission of the row would let anyone delete it, the policy does not
+		{"delete others row", PolicyOperationDelete, otherRow, PolicyDeny},
+		{"delete on table", PolicyOperationDelete, nil, PolicyAllow},
+		// a deny of the own rows says nothing about the other rows
+		{"create on others row", PolicyOperationCreate, otherRow, PolicyNoDecision},
+	}
+
+	for _, c := range cases {
+		decision := EvaluateRolePolicies(policies, roles, "blog_post", "", c.operation, c.row, sessionUser)
+		if decision != c.expected {
+			t.Errorf("%v: expected decision %v, got %v", c.name, c.expected, decision)
+		}
+	}
+}
+
+func TestPolicyOperationForMethod(t *testing.T) {
+	methods := map[string]string{
+		"GET":    PolicyOperationRead,
+		"POST":   PolicyOperationCreate,
+		"PATCH":  PolicyOperationUpdate,
+		"PUT":    PolicyOperationUpdate,
+		"DELETE": PolicyOperationDelete,
+	}
+	for method, operation := range methods {
+		if PolicyOperationForMethod(method) != operation {
+			t.Errorf("expected operation [%v] for [%v]", operation, method)
+		}
+	}
+}
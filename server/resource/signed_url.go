@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UrlSigner makes urls which can be used without a jwt token until they expire. A signed url acts as the user who
+// signed it, so it stops working when that user loses access to what it points to
+type UrlSigner struct {
+	secret    []byte
+	maxExpiry time.Duration
+	userCrud  *DbResource
+}
+
+// NewUrlSigner reads the secret from url.signing.secret and the longest time a url can be signed for, in seconds,
+// from url.signing.max.expiry
+func NewUrlSigner(configStore *ConfigStore, userCrud *DbResource) *UrlSigner {
+
+	secret, err := configStore.GetConfigValueFor("url.signing.secret", "backend")
+	if err != nil || secret == "" {
+		u, _ := uuid.NewV4()
+		secret = u.String()
+		configStore.SetConfigValueFor("url.signing.secret", secret, "backend")
+	}
+
+	maxExpiry, err := configStore.GetConfigIntValueFor("url.signing.max.expiry", "backend")
+	if err != nil || maxExpiry < 1 {
+		maxExpiry = 7 * 24 * 3600
+		configStore.SetConfigIntValueFor("url.signing.max.expiry", maxExpiry, "backend")
+	}
+
+	return &UrlSigner{
+		secret:    []byte(secret),
+		maxExpiry: time.Duration(maxExpiry) * time.Second,
+		userCrud:  userCrud,
+	}
+}
+
+// signature is the hmac of the method, the path and every query param except the signature
+func (s *UrlSigner) signature(method string, path string, query url.Values) string {
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	canonical := []string{strings.ToUpper(method), path}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			canonical = append(canonical, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join(canonical, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign adds the signer, the expiry and the signature to the query of a path
+func (s *UrlSigner) Sign(method string, path string, query url.Values, signer string, expiresIn time.Duration) (string, time.Time, error) {
+
+	if expiresIn <= 0 || expiresIn > s.maxExpiry {
+		return "", time.Time{}, errors.New("expiry should be more than 0 and at most " + s.maxExpiry.String())
+	}
+
+	expires := time.Now().Add(expiresIn)
+	signed := url.Values{}
+	for key, values := range query {
+		signed[key] = values
+	}
+	signed.Set("signer", signer)
+	signed.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	signed.Set("signature", s.signature(method, path, signed))
+
+	return path + "?" + signed.Encode(), expires, nil
+}
+
+// IsSigned is true when the query has a signature, the request is then checked with Verify instead of its jwt token
+func IsSigned(query url.Values) bool {
+	return query.Get("signature") != ""
+}
+
+// Verify checks the signature and the expiry of a signed url and returns the user who signed it
+func (s *UrlSigner) Verify(method string, path string, query url.Values) (*auth.SessionUser, error) {
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid expiry")
+	}
+	if time.Now().Unix() > expires {
+		return nil, errors.New("url has expired")
+	}
+
+	expected := s.signature(method, path, query)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, errors.New("invalid signature")
+	}
+
+	signer := query.Get("signer")
+	if signer == "" {
+		return &auth.SessionUser{
+			Groups: []auth.GroupPermission{},
+		}, nil
+	}
+	userId, err := s.userCrud.GetReferenceIdToId(USER_ACCOUNT_TABLE_NAME, signer)
+	if err != nil {
+		return nil, errors.New("signer not found")
+	}
+
+	return &auth.SessionUser{
+		UserId:          userId,
+		UserReferenceId: signer,
+		Groups:          s.userCrud.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "id", userId),
+	}, nil
+}
@@ -0,0 +1,51 @@
+package resource
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedUrl(t *testing.T) {
+
+	signer := &UrlSigner{
+		secret:    []byte("secret"),
+		maxExpiry: time.Hour,
+	}
+
+	signed, _, err := signer.Sign("GET", "/asset/item/abc/photo", url.Values{}, "", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	parts := strings.SplitN(signed, "?", 2)
+	query, _ := url.ParseQuery(parts[1])
+
+	if !IsSigned(query) {
+		t.Fatalf("expected a signature in %v", signed)
+	}
+	if _, err := signer.Verify("GET", parts[0], query); err != nil {
+		t.Errorf("expected a valid signature: %v", err)
+	}
+	if _, err := signer.Verify("PUT", parts[0], query); err == nil {
+		t.Errorf("signature should not be valid for another method")
+	}
+	if _, err := signer.Verify("GET", "/asset/item/abd/photo", query); err == nil {
+		t.Errorf("signature should not be valid for another path")
+	}
+
+	query.Set("filename", "other.png")
+	if _, err := signer.Verify("GET", parts[0], query); err == nil {
+		t.Errorf("signature should not be valid with an added param")
+	}
+	query.Del("filename")
+
+	query.Set("expires", "1")
+	if _, err := signer.Verify("GET", parts[0], query); err == nil {
+		t.Errorf("signature should not be valid after it expires")
+	}
+
+	if _, _, err := signer.Sign("GET", "/asset/item/abc/photo", url.Values{}, "", 2*time.Hour); err == nil {
+		t.Errorf("expiry beyond the max should not be signed")
+	}
+}
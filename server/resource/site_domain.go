@@ -0,0 +1,292 @@
+package resource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Ways to prove the control of a domain. A dns check looks for the token in a TXT record, a http check fetches the
+// token from the domain, which daptin serves itself, so it proves that the domain points to this server. A http check
+// can not prove a wildcard domain
+const (
+	DomainVerificationDns  = "dns"
+	DomainVerificationHttp = "http"
+)
+
+// DomainVerificationRecord is the name of the TXT record, under the domain, which holds the token
+const DomainVerificationRecord = "_daptin-verification"
+
+// DomainVerificationPath is the path on the domain which serves the token, it is answered by daptin and never from the
+// files of a site
+const DomainVerificationPath = "/.well-known/daptin-verification.txt"
+
+var hostnamePattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z][a-z0-9-]*[a-z0-9]$`)
+
+// SiteDomain is a hostname claimed by a site. The domain which matches the hostname of the site makes the hostname
+// active, every other verified domain of the site redirects to the hostname of the site
+type SiteDomain struct {
+	Id                 int64
+	ReferenceId        string `db:"reference_id"`
+	SiteId             int64  `db:"site_id"`
+	Hostname           string
+	VerificationMethod string `db:"verification_method"`
+	VerificationProof  string `db:"verification_proof"`
+}
+
+// DomainVerifier gives the token a domain has to publish, and checks that it does. The proof of a verified domain is
+// signed, so it can not be set by editing the row
+type DomainVerifier struct {
+	secret    []byte
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+	Client    *http.Client
+}
+
+// NewDomainVerifier reads the secret from domain.verification.secret, and the nameserver, as host:port, to look up
+// records with from domain.verification.nameserver, the system resolver is used when it is empty
+func NewDomainVerifier(configStore *ConfigStore) *DomainVerifier {
+
+	secret, err := configStore.GetConfigValueFor("domain.verification.secret", "backend")
+	if err != nil || secret == "" {
+		u, _ := uuid.NewV4()
+		secret = u.String()
+		configStore.SetConfigValueFor("domain.verification.secret", secret, "backend")
+	}
+
+	nameserver, err := configStore.GetConfigValueFor("domain.verification.nameserver", "backend")
+	if err != nil {
+		configStore.SetConfigValueFor("domain.verification.nameserver", "", "backend")
+	}
+
+	return NewDomainVerifierWithNameserver(secret, nameserver)
+}
+
+func NewDomainVerifierWithNameserver(secret string, nameserver string) *DomainVerifier {
+	resolver := net.DefaultResolver
+	if nameserver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dialer := net.Dialer{}
+				return dialer.DialContext(ctx, network, nameserver)
+			},
+		}
+	}
+
+	return &DomainVerifier{
+		secret:    []byte(secret),
+		LookupTXT: resolver.LookupTXT,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (dv *DomainVerifier) sign(purpose string, domain SiteDomain) string {
+	mac := hmac.New(sha256.New, dv.secret)
+	mac.Write([]byte(strings.Join([]string{purpose, domain.ReferenceId, strings.ToLower(domain.Hostname)}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Token is what the domain has to publish, it changes with the hostname
+func (dv *DomainVerifier) Token(domain SiteDomain) string {
+	return dv.sign("token", domain)[:32]
+}
+
+// Proof is stored on a domain once it is verified
+func (dv *DomainVerifier) Proof(domain SiteDomain) string {
+	return dv.sign("proof", domain)
+}
+
+// IsVerified tells if the domain was verified with its current hostname
+func (dv *DomainVerifier) IsVerified(domain SiteDomain) bool {
+	return domain.VerificationProof != "" && hmac.Equal([]byte(domain.VerificationProof), []byte(dv.Proof(domain)))
+}
+
+// Instructions tell the user where to publish the token of the domain
+func (dv *DomainVerifier) Instructions(domain SiteDomain) string {
+	if domain.VerificationMethod == DomainVerificationHttp {
+		return fmt.Sprintf("point %v to this server, which serves %v at http://%v%v", domain.Hostname, dv.Token(domain),
+			domain.Hostname, DomainVerificationPath)
+	}
+	return fmt.Sprintf("add a TXT record %v.%v with the value %v", DomainVerificationRecord,
+		strings.TrimPrefix(domain.Hostname, "*."), dv.Token(domain))
+}
+
+// Verify checks that the domain publishes its token
+func (dv *DomainVerifier) Verify(domain SiteDomain) error {
+
+	if !ValidHostname(domain.Hostname) {
+		return fmt.Errorf("[%v] is not a valid hostname", domain.Hostname)
+	}
+	token := dv.Token(domain)
+
+	switch domain.VerificationMethod {
+	case DomainVerificationHttp:
+		if strings.HasPrefix(domain.Hostname, "*.") {
+			return fmt.Errorf("a wildcard domain can only be verified with a dns record")
+		}
+		response, err := dv.Client.Get("http://" + domain.Hostname + DomainVerificationPath)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		if err != nil {
+			return err
+		}
+		// every domain claiming the hostname has its token on a line
+		for _, line := range strings.Split(string(body), "\n") {
+			if response.StatusCode == 200 && strings.TrimSpace(line) == token {
+				return nil
+			}
+		}
+	case DomainVerificationDns, "":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		records, err := dv.LookupTXT(ctx, DomainVerificationRecord+"."+strings.TrimPrefix(domain.Hostname, "*."))
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if strings.TrimSpace(record) == token {
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("unknown verification method [%v]", domain.VerificationMethod)
+	}
+
+	return fmt.Errorf("token of [%v] not found", domain.Hostname)
+}
+
+// ValidHostname tells if the hostname can be claimed by a site, a wildcard can only be the first part
+func ValidHostname(hostname string) bool {
+	return len(hostname) <= 253 && hostnamePattern.MatchString(strings.ToLower(hostname))
+}
+
+// MatchHostname matches a hostname against a hostname or a wildcard hostname, the wildcard is one part of the name
+func MatchHostname(pattern string, hostname string) bool {
+	pattern, hostname = strings.ToLower(pattern), strings.ToLower(hostname)
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == hostname
+	}
+	if pattern == hostname {
+		return true
+	}
+	suffix := pattern[1:]
+	if !strings.HasSuffix(hostname, suffix) {
+		return false
+	}
+	label := strings.TrimSuffix(hostname, suffix)
+	return label != "" && !strings.Contains(label, ".")
+}
+
+// SiteHostnameVerified tells if a site can be served on its hostname. The sites of the administrator can use any
+// hostname, the other sites need a verified domain of the site which covers the hostname
+func (dv *DomainVerifier) SiteHostnameVerified(site SubSite, domains []SiteDomain, adminUserId int64) bool {
+	if site.UserId != nil && *site.UserId == adminUserId {
+		return true
+	}
+	for _, domain := range domains {
+		if domain.SiteId == site.Id && dv.IsVerified(domain) && MatchHostname(domain.Hostname, site.Hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (dr *DbResource) getSiteDomains(where squirrel.Sqlizer) ([]SiteDomain, error) {
+
+	domains := make([]SiteDomain, 0)
+	query := statementbuilder.Squirrel.
+		Select("id", "reference_id", "coalesce(site_id, 0) as site_id", "hostname",
+			"coalesce(verification_method, '') as verification_method", "coalesce(verification_proof, '') as verification_proof").
+		From("site_domain")
+	if where != nil {
+		query = query.Where(where)
+	}
+	s, v, err := query.ToSql()
+	if err != nil {
+		return domains, err
+	}
+
+	rows, err := dr.db.Queryx(s, v...)
+	if err != nil {
+		return domains, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain SiteDomain
+		err = rows.StructScan(&domain)
+		if err != nil {
+			return domains, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// GetAllSiteDomains loads the domains of every site
+func (dr *DbResource) GetAllSiteDomains() ([]SiteDomain, error) {
+	return dr.getSiteDomains(nil)
+}
+
+// GetSiteDomainByReferenceId loads a domain by its reference id
+func (dr *DbResource) GetSiteDomainByReferenceId(referenceId string) (SiteDomain, error) {
+	domains, err := dr.getSiteDomains(squirrel.Eq{"reference_id": referenceId})
+	if err != nil {
+		return SiteDomain{}, err
+	}
+	if len(domains) == 0 {
+		return SiteDomain{}, fmt.Errorf("no such domain [%v]", referenceId)
+	}
+	return domains[0], nil
+}
+
+// GetSiteDomainVerificationTokens loads the tokens to serve on a hostname, of the domains verified over http
+func (dr *DbResource) GetSiteDomainVerificationTokens(hostname string) ([]string, error) {
+
+	tokens := make([]string, 0)
+	s, v, err := statementbuilder.Squirrel.Select("verification_token").From("site_domain").
+		Where(squirrel.Expr("lower(hostname) = ?", strings.ToLower(hostname))).
+		Where(squirrel.Eq{"verification_method": DomainVerificationHttp}).
+		Where(squirrel.NotEq{"verification_token": nil}).
+		Where(squirrel.NotEq{"verification_token": ""}).
+		OrderBy("id").ToSql()
+	if err != nil {
+		return tokens, err
+	}
+
+	err = sqlx.Select(dr.db, &tokens, s, v...)
+	return tokens, err
+}
+
+// updateSiteDomainVerification stores the token shown to the user and the proof of a verified domain
+func (dr *DbResource) updateSiteDomainVerification(domain SiteDomain, token string, proof string) error {
+	update := statementbuilder.Squirrel.Update("site_domain").
+		Set("verification_token", token).
+		Set("verification_proof", proof).
+		Set("updated_at", time.Now())
+	if proof != "" {
+		update = update.Set("verified_at", time.Now())
+	}
+	s, v, err := update.Where(squirrel.Eq{"id": domain.Id}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = dr.db.Exec(s, v...)
+	return err
+}
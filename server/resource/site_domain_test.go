@@ -0,0 +1,134 @@
+package resource
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveTxtRecords answers TXT queries for the records on a local udp port, a stand-in for a real nameserver
+func serveTxtRecords(t *testing.T, records map[string][]string) string {
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := buffer[:n]
+
+			// the name of the question starts after the 12 byte header
+			labels := make([]string, 0)
+			offset := 12
+			for offset < n && query[offset] != 0 {
+				length := int(query[offset])
+				labels = append(labels, string(query[offset+1:offset+1+length]))
+				offset += length + 1
+			}
+			questionEnd := offset + 5
+			values := records[strings.ToLower(strings.Join(labels, "."))]
+
+			response := make([]byte, 0, 512)
+			response = append(response, query[0], query[1])
+			if len(values) == 0 {
+				response = append(response, 0x81, 0x83)
+			} else {
+				response = append(response, 0x81, 0x80)
+			}
+			response = append(response, 0, 1, 0, byte(len(values)), 0, 0, 0, 0)
+			response = append(response, query[12:questionEnd]...)
+			for _, value := range values {
+				response = append(response, 0xc0, 0x0c, 0, 16, 0, 1, 0, 0, 0, 60)
+				length := make([]byte, 2)
+				binary.BigEndian.PutUint16(length, uint16(len(value)+1))
+				response = append(response, length...)
+				response = append(response, byte(len(value)))
+				response = append(response, value...)
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn.LocalAddr().String()
+}
+
+func TestDomainVerification(t *testing.T) {
+
+	domain := SiteDomain{
+		ReferenceId:        "domain-1",
+		SiteId:             1,
+		Hostname:           "*.example.com",
+		VerificationMethod: DomainVerificationDns,
+	}
+	records := map[string][]string{}
+	verifier := NewDomainVerifierWithNameserver("secret", serveTxtRecords(t, records))
+
+	if err := verifier.Verify(domain); err == nil {
+		t.Fatalf("domain without the record should not be verified")
+	}
+
+	records[DomainVerificationRecord+".example.com"] = []string{"other", verifier.Token(domain)}
+	if err := verifier.Verify(domain); err != nil {
+		t.Fatalf("expected domain to be verified: %v", err)
+	}
+
+	domain.VerificationProof = verifier.Proof(domain)
+	if !verifier.IsVerified(domain) {
+		t.Errorf("expected proof to be valid")
+	}
+
+	site := SubSite{Id: 1, Hostname: "blog.example.com"}
+	if !verifier.SiteHostnameVerified(site, []SiteDomain{domain}, 99) {
+		t.Errorf("wildcard domain should verify a subdomain")
+	}
+
+	changed := domain
+	changed.Hostname = "*.example.org"
+	if verifier.IsVerified(changed) {
+		t.Errorf("proof should not be valid for another hostname")
+	}
+
+	site.Id = 2
+	if verifier.SiteHostnameVerified(site, []SiteDomain{domain}, 99) {
+		t.Errorf("domain of another site should not verify the site")
+	}
+	adminId := int64(99)
+	site.UserId = &adminId
+	if !verifier.SiteHostnameVerified(site, nil, 99) {
+		t.Errorf("sites of the administrator do not need verification")
+	}
+}
+
+func TestMatchHostname(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		hostname string
+		match    bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", false},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "*.example.com", true},
+	}
+	for _, c := range cases {
+		if MatchHostname(c.pattern, c.hostname) != c.match {
+			t.Errorf("MatchHostname(%v, %v) should be %v", c.pattern, c.hostname, c.match)
+		}
+	}
+
+	if !ValidHostname("*.example.com") || ValidHostname("a.*.example.com") || ValidHostname("default") {
+		t.Errorf("unexpected hostname validation")
+	}
+}
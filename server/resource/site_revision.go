@@ -0,0 +1,200 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Status of a site_revision. An edit is saved as a draft, publishing it writes it to the site and its cloud store and
+// archives the revision which was published before it
+const (
+	SiteRevisionDraft     = "draft"
+	SiteRevisionPublished = "published"
+	SiteRevisionArchived  = "archived"
+)
+
+// SiteRevision is one saved version of a file of a site, stored in the site_revision table
+type SiteRevision struct {
+	Id          int64
+	ReferenceId string `db:"reference_id"`
+	SiteId      int64  `db:"site_id"`
+	Path        string
+	Contents    string
+	Status      string
+}
+
+// CreateSiteRevision saves the contents of a file of a site as a new revision
+func (dr *DbResource) CreateSiteRevision(siteId int64, path string, contents string, status string, userId int64) (SiteRevision, error) {
+
+	u, _ := uuid.NewV4()
+	revision := SiteRevision{
+		ReferenceId: u.String(),
+		SiteId:      siteId,
+		Path:        path,
+		Contents:    contents,
+		Status:      status,
+	}
+
+	if userId == 0 {
+		userId, _ = GetAdminUserIdAndUserGroupId(dr.db)
+	}
+
+	s, v, err := statementbuilder.Squirrel.Insert("site_revision").SetMap(map[string]interface{}{
+		"site_id":              siteId,
+		"path":                 path,
+		"contents":             contents,
+		"status":               status,
+		"reference_id":         revision.ReferenceId,
+		"permission":           auth.DEFAULT_PERMISSION,
+		"created_at":           time.Now(),
+		USER_ACCOUNT_ID_COLUMN: userId,
+	}).ToSql()
+	if err != nil {
+		return revision, err
+	}
+
+	_, err = dr.db.Exec(s, v...)
+	if err != nil {
+		return revision, err
+	}
+
+	revision.Id, err = dr.GetReferenceIdToId("site_revision", revision.ReferenceId)
+	return revision, err
+}
+
+func (dr *DbResource) getSiteRevision(where squirrel.Eq) (SiteRevision, error) {
+
+	var revision SiteRevision
+	s, v, err := statementbuilder.Squirrel.Select("id", "reference_id", "site_id", "path", "contents", "status").
+		From("site_revision").Where(where).OrderBy("id desc").Limit(1).ToSql()
+	if err != nil {
+		return revision, err
+	}
+
+	err = dr.db.QueryRowx(s, v...).StructScan(&revision)
+	return revision, err
+}
+
+// GetSiteRevisionByReferenceId loads a revision by its reference id
+func (dr *DbResource) GetSiteRevisionByReferenceId(referenceId string) (SiteRevision, error) {
+	return dr.getSiteRevision(squirrel.Eq{"reference_id": referenceId})
+}
+
+// GetLatestSiteRevision loads the last saved revision of a file of a site, draft or published
+func (dr *DbResource) GetLatestSiteRevision(siteId int64, path string) (SiteRevision, error) {
+	return dr.getSiteRevision(squirrel.Eq{"site_id": siteId, "path": path})
+}
+
+// markSiteRevisionPublished archives the published revision of the file and marks this one as published, together
+func (dr *DbResource) markSiteRevisionPublished(revision SiteRevision) error {
+
+	tx, err := dr.connection.Beginx()
+	if err != nil {
+		return err
+	}
+
+	s, v, err := statementbuilder.Squirrel.Update("site_revision").
+		Set("status", SiteRevisionArchived).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"site_id": revision.SiteId, "path": revision.Path, "status": SiteRevisionPublished}).ToSql()
+	if err == nil {
+		_, err = tx.Exec(s, v...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	s, v, err = statementbuilder.Squirrel.Update("site_revision").
+		Set("status", SiteRevisionPublished).
+		Set("published_at", time.Now()).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": revision.Id}).ToSql()
+	if err == nil {
+		_, err = tx.Exec(s, v...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PublishSiteRevision writes the revision to the served folder of the site and copies it to the cloud store of the
+// site, so the next sync of the site storage keeps it. The revision is marked as published once the store has it
+func (dr *DbResource) PublishSiteRevision(site SubSiteInformation, revision SiteRevision) error {
+
+	if site.SourceRoot == "" {
+		return fmt.Errorf("site [%v] has no storage", site.SubSite.Name)
+	}
+
+	relativePath := filepath.Clean("/" + revision.Path)
+	servedPath := filepath.Join(site.SourceRoot, relativePath)
+	err := os.MkdirAll(filepath.Dir(servedPath), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(servedPath, []byte(revision.Contents), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	// only the published file is copied, into the same folders under the root of the store
+	uploadFolder, err := ioutil.TempDir("", "site-revision")
+	if err != nil {
+		return err
+	}
+	uploadPath := filepath.Join(uploadFolder, relativePath)
+	err = os.MkdirAll(filepath.Dir(uploadPath), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(uploadPath, []byte(revision.Contents), 0644)
+	}
+	if err != nil {
+		os.RemoveAll(uploadFolder)
+		return err
+	}
+	err = CopyToCloudStoreAndWait(dr.Cruds, uploadFolder, site.CloudStore.StoreProvider, site.CloudStore.OAutoTokenId, site.CloudStore.RootPath)
+	os.RemoveAll(uploadFolder)
+	if err != nil {
+		log.Errorf("Failed to write revision [%v] of [%v] to cloud store: %v", revision.ReferenceId, relativePath, err)
+		return err
+	}
+
+	err = dr.markSiteRevisionPublished(revision)
+	if err != nil {
+		return err
+	}
+
+	if site.MarkdownSite != nil {
+		return site.MarkdownSite.Build()
+	}
+	return nil
+}
+
+// SubSiteById finds the served folder and store of a site
+func (ti *CmsConfig) SubSiteById(siteId int64) (SubSiteInformation, bool) {
+	for _, site := range ti.SubSites {
+		if site.SubSite.Id == siteId {
+			return site, true
+		}
+	}
+	return SubSiteInformation{}, false
+}
+
+// SubSiteByReferenceId finds the served folder and store of a site by its reference id
+func (ti *CmsConfig) SubSiteByReferenceId(referenceId string) (SubSiteInformation, bool) {
+	for _, site := range ti.SubSites {
+		if site.SubSite.ReferenceId == referenceId {
+			return site, true
+		}
+	}
+	return SubSiteInformation{}, false
+}
@@ -0,0 +1,194 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	_ "github.com/artpar/rclone/backend/local"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSiteRevisionTestPerformer prepares a site served from a temporary folder, with a local folder as its store
+func newSiteRevisionTestPerformer(t *testing.T) (*sqlx.DB, *DbResource, SubSiteInformation, ActionPerformerInterface) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("create table site_revision (id integer primary key, reference_id varchar(40), site_id int, path varchar(500), " +
+		"contents text, status varchar(20), permission int, user_account_id int, created_at timestamp, updated_at timestamp, published_at timestamp)")
+	if err != nil {
+		t.Fatalf("failed to prepare database: %v", err)
+	}
+
+	sourceRoot, err := ioutil.TempDir("", "site-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeRoot, err := ioutil.TempDir("", "site-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(sourceRoot)
+		os.RemoveAll(storeRoot)
+	})
+
+	site := SubSiteInformation{
+		SubSite: SubSite{
+			Id:          1,
+			Name:        "docs",
+			ReferenceId: "site-1",
+			Permission: PermissionInstance{
+				UserId:     "owner",
+				Permission: auth.UserRead | auth.UserUpdate,
+			},
+		},
+		CloudStore: CloudStore{Name: "local", RootPath: storeRoot, StoreProvider: "local"},
+		SourceRoot: sourceRoot,
+	}
+
+	cruds := make(map[string]*DbResource)
+	for _, table := range []TableInfo{{TableName: "site"}, {TableName: "site_revision"}} {
+		cruds[table.TableName] = NewDbResource(api2go.NewApi2GoModel(table.TableName, nil, 0, nil), db, &MiddlewareSet{}, cruds, nil, table)
+	}
+	cruds["site"].PutContext("administrator_reference_id", "admin")
+
+	performer, err := NewSiteRevisionPublishPerformer(&CmsConfig{SubSites: map[string]SubSiteInformation{"docs": site}}, cruds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, cruds["site_revision"], site, performer
+}
+
+func siteRevisionStatus(t *testing.T, db *sqlx.DB, referenceId string) string {
+	var status string
+	err := db.QueryRowx("select status from site_revision where reference_id = ?", referenceId).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestPublishingARevisionArchivesThePublishedOne(t *testing.T) {
+
+	db, revisions, site, performer := newSiteRevisionTestPerformer(t)
+	owner := Outcome{Attributes: map[string]interface{}{"user": &auth.SessionUser{UserId: 5, UserReferenceId: "owner"}}}
+
+	first, err := revisions.CreateSiteRevision(1, "guide/index.html", "<p>one</p>", SiteRevisionDraft, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(site.SourceRoot, "guide", "index.html")); !os.IsNotExist(err) {
+		t.Fatalf("a draft should not be written to the site")
+	}
+
+	_, _, errs := performer.DoAction(owner, map[string]interface{}{"site_revision_id": first.ReferenceId})
+	if len(errs) > 0 {
+		t.Fatalf("failed to publish: %v", errs)
+	}
+
+	second, err := revisions.CreateSiteRevision(1, "guide/index.html", "<p>two</p>", SiteRevisionDraft, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, errs = performer.DoAction(owner, map[string]interface{}{"site_revision_id": second.ReferenceId})
+	if len(errs) > 0 {
+		t.Fatalf("failed to publish: %v", errs)
+	}
+
+	if status := siteRevisionStatus(t, db, first.ReferenceId); status != SiteRevisionArchived {
+		t.Errorf("previous revision should be archived, it is %v", status)
+	}
+	if status := siteRevisionStatus(t, db, second.ReferenceId); status != SiteRevisionPublished {
+		t.Errorf("new revision should be published, it is %v", status)
+	}
+	for _, root := range []string{site.SourceRoot, site.CloudStore.RootPath} {
+		contents, err := ioutil.ReadFile(filepath.Join(root, "guide", "index.html"))
+		if err != nil || string(contents) != "<p>two</p>" {
+			t.Errorf("expected the published revision in %v, found %q: %v", root, contents, err)
+		}
+	}
+}
+
+func TestRollbackPublishesACopyOfTheRevision(t *testing.T) {
+
+	db, revisions, site, performer := newSiteRevisionTestPerformer(t)
+	owner := Outcome{Attributes: map[string]interface{}{"user": &auth.SessionUser{UserId: 5, UserReferenceId: "owner"}}}
+
+	first, _ := revisions.CreateSiteRevision(1, "index.html", "<p>one</p>", SiteRevisionDraft, 5)
+	second, _ := revisions.CreateSiteRevision(1, "index.html", "<p>two</p>", SiteRevisionDraft, 5)
+	for _, revision := range []SiteRevision{first, second} {
+		_, _, errs := performer.DoAction(owner, map[string]interface{}{"site_revision_id": revision.ReferenceId})
+		if len(errs) > 0 {
+			t.Fatalf("failed to publish: %v", errs)
+		}
+	}
+
+	_, _, errs := performer.DoAction(owner, map[string]interface{}{"site_revision_id": first.ReferenceId, "rollback": true})
+	if len(errs) > 0 {
+		t.Fatalf("failed to roll back: %v", errs)
+	}
+
+	latest, err := revisions.GetLatestSiteRevision(1, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ReferenceId == first.ReferenceId || latest.Contents != "<p>one</p>" || latest.Status != SiteRevisionPublished {
+		t.Errorf("rollback should publish a new copy of the first revision, latest is %v", latest)
+	}
+	if status := siteRevisionStatus(t, db, first.ReferenceId); status != SiteRevisionArchived {
+		t.Errorf("rolled back revision should stay archived, it is %v", status)
+	}
+	if status := siteRevisionStatus(t, db, second.ReferenceId); status != SiteRevisionArchived {
+		t.Errorf("replaced revision should be archived, it is %v", status)
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(site.SourceRoot, "index.html"))
+	if string(contents) != "<p>one</p>" {
+		t.Errorf("site should serve the rolled back contents, found %q", contents)
+	}
+}
+
+func TestPublishingNeedsUpdatePermissionOnTheSite(t *testing.T) {
+
+	db, revisions, site, performer := newSiteRevisionTestPerformer(t)
+
+	draft, _ := revisions.CreateSiteRevision(1, "index.html", "<p>one</p>", SiteRevisionDraft, 5)
+
+	for _, inFields := range []map[string]interface{}{
+		{"site_revision_id": draft.ReferenceId},
+		{"site_revision_id": draft.ReferenceId, "rollback": true},
+	} {
+		_, _, errs := performer.DoAction(Outcome{Attributes: map[string]interface{}{
+			"user": &auth.SessionUser{UserId: 6, UserReferenceId: "reader"},
+		}}, inFields)
+		if len(errs) == 0 {
+			t.Fatalf("a user who cannot update the site should not publish")
+		}
+		if httpErr, ok := errs[0].(api2go.HTTPError); !ok || httpErr.Status() != 403 {
+			t.Errorf("expected forbidden, got %v", errs[0])
+		}
+	}
+
+	var count int
+	db.QueryRowx("select count(*) from site_revision").Scan(&count)
+	if count != 1 || siteRevisionStatus(t, db, draft.ReferenceId) != SiteRevisionDraft {
+		t.Errorf("a forbidden publish should not change the revisions")
+	}
+	if _, err := os.Stat(filepath.Join(site.SourceRoot, "index.html")); !os.IsNotExist(err) {
+		t.Errorf("a forbidden publish should not write the site")
+	}
+
+	_, _, errs := performer.DoAction(Outcome{Attributes: map[string]interface{}{
+		"user": &auth.SessionUser{UserId: 1, UserReferenceId: "admin"},
+	}}, map[string]interface{}{"site_revision_id": draft.ReferenceId})
+	if len(errs) > 0 {
+		t.Errorf("administrator should publish: %v", errs)
+	}
+}
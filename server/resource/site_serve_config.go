@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SiteServeConfig is how the files of a site are served, stored as json in the serve_config column of the site
+type SiteServeConfig struct {
+	// Compression lists the encodings to use, "gzip" compresses text files, "br" serves the .br file next to a
+	// file when it exists
+	Compression []string
+	// CacheControl sets the Cache-Control header of the first rule matching the path of a file
+	CacheControl []SiteCacheRule
+	// ContentSecurityPolicy, StrictTransportSecurity and FrameOptions set the headers of the same name
+	ContentSecurityPolicy   string
+	StrictTransportSecurity string
+	FrameOptions            string
+	// Headers are more headers set on every response of the site
+	Headers map[string]string
+	// NotFoundPage is served with a 404 status for paths with no file
+	NotFoundPage string
+	// FallbackPage is served for paths with no file, for single page apps which route in the browser
+	FallbackPage string
+	// CorsOrigins are the origins allowed to read the site from a browser, * allows any origin
+	CorsOrigins []string
+	// FileCacheSize is the bytes of files kept in memory, 0 uses the default and -1 turns the cache off
+	FileCacheSize int64
+}
+
+// SiteCacheRule matches a glob against the path of a file, a glob without a / matches the name of the file
+type SiteCacheRule struct {
+	Path  string
+	Value string
+}
+
+// Scan reads the config from the json in the site row
+func (c *SiteServeConfig) Scan(value interface{}) error {
+	var contents []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		contents = []byte(v)
+	case []byte:
+		contents = v
+	default:
+		return fmt.Errorf("invalid serve config %v", value)
+	}
+	if len(strings.TrimSpace(string(contents))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(contents, c)
+}
+
+// Compresses tells if the site should serve responses with this encoding
+func (c SiteServeConfig) Compresses(encoding string) bool {
+	for _, e := range c.Compression {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheControlFor gives the Cache-Control value of the first rule matching the path
+func (c SiteServeConfig) CacheControlFor(filePath string) string {
+	for _, rule := range c.CacheControl {
+		target := filePath
+		if !strings.Contains(rule.Path, "/") {
+			target = path.Base(filePath)
+		}
+		if matched, _ := path.Match(rule.Path, target); matched {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+// AllowsOrigin tells if a browser on the origin can read the site
+func (c SiteServeConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.CorsOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return c.ListsOrigin(origin)
+}
+
+// ListsOrigin tells if the origin is one of the cors origins by name, only those origins can send credentials
+func (c SiteServeConfig) ListsOrigin(origin string) bool {
+	for _, allowed := range c.CorsOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
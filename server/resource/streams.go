@@ -1,12 +1,22 @@
 package resource
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/artpar/api2go"
 	"github.com/go-gota/gota/dataframe"
 	"github.com/go-gota/gota/series"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 )
 
+// streamPageSize is the number of rows read at a time from the entities of a stream
+const streamPageSize = 1000
+
+// streamRowLimit caps the rows read from an entity for the transformations which need every row
+const streamRowLimit = 100000
+
 // StreamProcess handles the Read operations, and applies transformations on the data the create a new view
 type StreamProcessor struct {
 	cruds    map[string]*DbResource
@@ -21,6 +31,7 @@ type StreamContract struct {
 	Relations       []api2go.TableRelation
 	Transformations []Transformation
 	QueryParams     map[string][]string
+	Materialize     *StreamMaterialization
 }
 
 // A Transformation is the representation of column data changing its values according to the attribute map
@@ -63,105 +74,340 @@ func (dr *StreamProcessor) Update(obj interface{}, req api2go.Request) (api2go.R
 
 // FindAll implementation in accordance with JSONAPI
 // FindAll does the initial query to the database and applites the transformation contract on the result rows
+// Filters and sorts on the columns of the root entity are moved into the query. When there is no filter and the
+// remaining transformations only change the columns of each row the database paginates, otherwise every row is read
+// and the page is cut from the transformed rows so that the total count matches the output of the stream
 func (dr *StreamProcessor) PaginatedFindAll(req api2go.Request) (totalCount uint, response api2go.Responder, err error) {
 
 	contract := dr.contract
 
-	for key, val := range contract.QueryParams {
-		req.QueryParams[key] = val
+	queryParams, transformations := dr.pushDown(req.QueryParams)
+
+	// the total count of a table does not apply the filters of the query, a filtered stream counts its own rows
+	_, filtered := queryParams["query"]
+
+	if !filtered && !needsAllRows(transformations) {
+
+		req.QueryParams = queryParams
+		totalCount, responder1, err := dr.cruds[contract.RootEntityName].PaginatedFindAll(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		responder := responder1.(api2go.Response)
+
+		items := modelsToRows(responder.Result().([]*api2go.Api2GoModel))
+
+		rows, err := dr.Transform(items, transformations, req)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		newResponder := NewResponse(nil, dr.rowsToModels(rows), responder.StatusCode(), &responder.Pagination)
+		return totalCount, newResponder, nil
 	}
 
-	totalCount, responder1, err := dr.cruds[dr.contract.RootEntityName].PaginatedFindAll(req)
+	items, err := dr.readEntity(contract.RootEntityName, queryParams, req)
 	if err != nil {
 		return 0, nil, err
 	}
-	responder := responder1.(api2go.Response)
+
+	rows, err := dr.Transform(items, transformations, req)
 	if err != nil {
-		return totalCount, responder, err
+		return 0, nil, err
 	}
 
-	listOfResults := responder.Result().([]*api2go.Api2GoModel)
+	pageNumber, pageSize := streamPage(req.QueryParams)
+	total := uint64(len(rows))
 
-	items := make([]map[string]interface{}, 0)
+	offset := (pageNumber - 1) * pageSize
+	if offset > total {
+		offset = total
+	}
+	end := offset + pageSize
+	if end > total {
+		end = total
+	}
 
-	for _, item := range listOfResults {
-		items = append(items, item.Data)
+	pagination := &api2go.Pagination{
+		Next:        map[string]string{"limit": fmt.Sprintf("%v", pageSize), "offset": fmt.Sprintf("%v", offset+pageSize)},
+		Prev:        map[string]string{"limit": fmt.Sprintf("%v", pageSize), "offset": fmt.Sprintf("%v", int64(offset)-int64(pageSize))},
+		First:       map[string]string{},
+		Last:        map[string]string{"limit": fmt.Sprintf("%v", pageSize), "offset": fmt.Sprintf("%v", int64(total)-int64(pageSize))},
+		Total:       total,
+		PerPage:     pageSize,
+		CurrentPage: pageNumber,
+		LastPage:    1 + (total / pageSize),
+		From:        offset + 1,
+		To:          end,
 	}
 
-	df := dataframe.LoadMaps(items)
+	return uint(total), NewResponse(nil, dr.rowsToModels(rows[offset:end]), 200, pagination), nil
+}
 
-	for _, transformation := range contract.Transformations {
+// ReadAll returns every row of the stream, used to export a stream
+func (dr *StreamProcessor) ReadAll(req api2go.Request) ([]map[string]interface{}, error) {
 
-		switch transformation.Operation {
-		case "select":
-			var indexes interface{}
-			indexes, ok := transformation.Attributes["Columns"].([]string)
-			if !ok {
-				indexes = makeIndexArray(transformation.Attributes["Columns"].([]interface{}))
-			}
-			df = df.Select(indexes)
-		case "rename":
-			oldName := transformation.Attributes["OldName"].(string)
-			newName := transformation.Attributes["NewName"].(string)
-			df = df.Rename(newName, oldName)
-		case "drop":
-			var indexes interface{}
-			indexes, ok := transformation.Attributes["Columns"].([]string)
-			if !ok {
-				indexes = makeIndexArray(transformation.Attributes["Columns"].([]interface{}))
-			}
-			df = df.Drop(indexes)
+	if req.QueryParams == nil {
+		req.QueryParams = make(map[string][]string)
+	}
 
-		case "filter":
+	queryParams, transformations := dr.pushDown(req.QueryParams)
 
-			colName, ok := transformation.Attributes["ColumnName"]
+	items, err := dr.readEntity(dr.contract.RootEntityName, queryParams, req)
+	if err != nil {
+		return nil, err
+	}
 
-			if !ok {
-				continue
-			}
+	return dr.Transform(items, transformations, req)
+}
 
-			colnNameString, ok := colName.(string)
+func (dr *StreamProcessor) rowsToModels(rows []map[string]interface{}) []*api2go.Api2GoModel {
+	models := make([]*api2go.Api2GoModel, 0)
+	for _, row := range rows {
+		model := api2go.NewApi2GoModelWithData(dr.contract.StreamName, dr.contract.Columns, 0, nil, row)
+		models = append(models, model)
+	}
+	return models
+}
+
+func modelsToRows(models []*api2go.Api2GoModel) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0)
+	for _, model := range models {
+		rows = append(rows, model.Data)
+	}
+	return rows
+}
+
+// streamPage reads the 1 based page number and the page size of a request
+func streamPage(queryParams map[string][]string) (uint64, uint64) {
+
+	pageNumber := uint64(1)
+	pageSize := uint64(10)
+
+	if len(queryParams["page[number]"]) > 0 {
+		number, err := strconv.ParseUint(queryParams["page[number]"][0], 10, 32)
+		if err == nil && number > 0 {
+			pageNumber = number
+		}
+	}
+	if len(queryParams["page[size]"]) > 0 {
+		size, err := strconv.ParseUint(queryParams["page[size]"][0], 10, 32)
+		if err == nil && size > 0 {
+			pageSize = size
+		}
+	}
+
+	return pageNumber, pageSize
+}
+
+// readEntity reads every row of an entity visible to the user of the request, a page at a time
+func (dr *StreamProcessor) readEntity(entityName string, queryParams map[string][]string, req api2go.Request) ([]map[string]interface{}, error) {
+
+	crud, ok := dr.cruds[entityName]
+	if !ok {
+		return nil, fmt.Errorf("no such entity [%v] in stream [%v]", entityName, dr.contract.StreamName)
+	}
+
+	rows := make([]map[string]interface{}, 0)
+
+	for pageNumber := 1; len(rows) < streamRowLimit; pageNumber++ {
 
-			if !ok || colnNameString == "" {
+		pageParams := make(map[string][]string)
+		for key, value := range queryParams {
+			if strings.HasPrefix(key, "page[") {
 				continue
 			}
+			pageParams[key] = value
+		}
+		pageParams["page[number]"] = []string{strconv.Itoa(pageNumber)}
+		pageParams["page[size]"] = []string{strconv.Itoa(streamPageSize)}
+
+		pageRequest := api2go.Request{
+			PlainRequest: req.PlainRequest,
+			QueryParams:  pageParams,
+			Pagination:   map[string]string{},
+			Header:       req.Header,
+		}
+
+		_, responder, err := crud.PaginatedFindAll(pageRequest)
+		if err != nil {
+			return nil, err
+		}
 
-			comparator, ok := transformation.Attributes["Comparator"]
+		page := modelsToRows(responder.Result().([]*api2go.Api2GoModel))
+		rows = append(rows, page...)
 
-			if !ok {
+		if len(page) < streamPageSize {
+			break
+		}
+	}
+
+	if len(rows) >= streamRowLimit {
+		log.Warnf("Stream [%v] read the first %d rows of [%v]", dr.contract.StreamName, streamRowLimit, entityName)
+	}
+
+	return rows, nil
+}
+
+// Transform applies the transformations to the rows in order
+func (dr *StreamProcessor) Transform(rows []map[string]interface{}, transformations []Transformation, req api2go.Request) ([]map[string]interface{}, error) {
+
+	// consecutive select, rename, drop and filter transformations work on one data frame
+	frameTransformations := make([]Transformation, 0)
+	flushFrame := func() error {
+		if len(frameTransformations) == 0 || len(rows) == 0 {
+			frameTransformations = frameTransformations[:0]
+			return nil
+		}
+		df := dataframe.LoadMaps(rows, dataframe.WithTypes(frameTypes(rows)))
+		for _, transformation := range frameTransformations {
+			df = applyFrameTransformation(df, transformation)
+		}
+		frameTransformations = frameTransformations[:0]
+		if df.Err != nil {
+			return df.Err
+		}
+		rows = df.Maps()
+		return nil
+	}
+
+	var err error
+	for _, transformation := range transformations {
+
+		switch transformation.Operation {
+		case "select", "rename", "drop", "filter":
+			frameTransformations = append(frameTransformations, transformation)
+			continue
+		}
+
+		err = flushFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch transformation.Operation {
+		case "groupby":
+			rows, err = groupRows(rows, transformation.Attributes)
+		case "join":
+			rows, err = dr.joinRows(rows, transformation.Attributes, req)
+		case "mutate":
+			rows, err = mutateRows(rows, transformation.Attributes)
+		case "sort":
+			sortRows(rows, sortColumns(transformation.Attributes))
+		case "limit":
+			rows = limitRows(rows, transformation.Attributes)
+		default:
+			err = fmt.Errorf("unknown transformation [%v] in stream [%v]", transformation.Operation, dr.contract.StreamName)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = flushFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// frameTypes picks the type of each column from the values in the rows, so that numbers stay numbers in the frame
+func frameTypes(rows []map[string]interface{}) map[string]series.Type {
+
+	types := make(map[string]series.Type)
+	for _, row := range rows {
+		for column, value := range row {
+			if value == nil {
 				continue
 			}
-			comparatorString, ok := comparator.(string)
-			if !ok {
-				continue
+			var valueType series.Type
+			switch value.(type) {
+			case int, int32, int64:
+				valueType = series.Int
+			case float32, float64, json.Number:
+				valueType = series.Float
+			case bool:
+				valueType = series.Bool
+			default:
+				valueType = series.String
 			}
-			comparatorStringVal := series.Comparator(comparatorString)
-
-			value := transformation.Attributes["Value"]
 
-			filter := dataframe.F{
-				Colname:    colnNameString,
-				Comparator: comparatorStringVal,
-				Comparando: value,
+			current, ok := types[column]
+			switch {
+			case !ok || current == valueType:
+				types[column] = valueType
+			case (current == series.Int && valueType == series.Float) || (current == series.Float && valueType == series.Int):
+				types[column] = series.Float
+			default:
+				types[column] = series.String
 			}
+		}
+	}
+
+	return types
+}
 
-			df = df.Filter(filter)
+func applyFrameTransformation(df dataframe.DataFrame, transformation Transformation) dataframe.DataFrame {
 
+	switch transformation.Operation {
+	case "select":
+		var indexes interface{}
+		indexes, ok := transformation.Attributes["Columns"].([]string)
+		if !ok {
+			indexes = makeIndexArray(transformation.Attributes["Columns"].([]interface{}))
+		}
+		df = df.Select(indexes)
+	case "rename":
+		oldName := transformation.Attributes["OldName"].(string)
+		newName := transformation.Attributes["NewName"].(string)
+		df = df.Rename(newName, oldName)
+	case "drop":
+		var indexes interface{}
+		indexes, ok := transformation.Attributes["Columns"].([]string)
+		if !ok {
+			indexes = makeIndexArray(transformation.Attributes["Columns"].([]interface{}))
 		}
+		df = df.Drop(indexes)
 
-	}
+	case "filter":
 
-	newList := make([]*api2go.Api2GoModel, 0)
+		colName, ok := transformation.Attributes["ColumnName"]
+
+		if !ok {
+			return df
+		}
+
+		colnNameString, ok := colName.(string)
+
+		if !ok || colnNameString == "" {
+			return df
+		}
+
+		comparator, ok := transformation.Attributes["Comparator"]
+
+		if !ok {
+			return df
+		}
+		comparatorString, ok := comparator.(string)
+		if !ok {
+			return df
+		}
+		comparatorStringVal := series.Comparator(comparatorString)
+
+		value := transformation.Attributes["Value"]
+
+		filter := dataframe.F{
+			Colname:    colnNameString,
+			Comparator: comparatorStringVal,
+			Comparando: value,
+		}
 
-	maps := df.Maps()
+		df = df.Filter(filter)
 
-	for _, row := range maps {
-		model := api2go.NewApi2GoModelWithData(contract.StreamName, contract.Columns, 0, nil, row)
-		newList = append(newList, model)
 	}
 
-	newResponder := NewResponse(nil, newList, responder.StatusCode(), &responder.Pagination)
-	return totalCount, newResponder, nil
+	return df
 }
 
 func makeIndexArray(indexes []interface{}) interface{} {
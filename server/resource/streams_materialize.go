@@ -0,0 +1,361 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// streamRefreshDelay is how long a refresh on change waits for more changes to the root entity
+const streamRefreshDelay = 10 * time.Second
+
+// materializedStreamPermission lets only the owner of the rows, the administrator who refreshes the table, read them.
+// The rows are computed with the permissions of the administrator, a stream opts in to show them to others with
+// its Permission
+const materializedStreamPermission = auth.UserPeek | auth.UserRead
+
+// StreamMaterialization writes the output of a stream into a table with the name of the stream, which is then served
+// like any other table instead of computing the stream on every request. Schedule is a cron schedule for the refresh
+// like "@every 1h", OnChange refreshes the table a little while after rows of the root entity change. Permission is
+// used for the table and its rows, readable by the administrator only by default
+type StreamMaterialization struct {
+	Schedule   string
+	OnChange   bool
+	Permission auth.AuthPermission
+}
+
+// MaterializedStreamTables returns the tables backing the materialised streams
+func MaterializedStreamTables(streams []StreamContract) []TableInfo {
+
+	tables := make([]TableInfo, 0)
+	for _, stream := range streams {
+		if stream.Materialize == nil {
+			continue
+		}
+
+		permission := stream.Materialize.Permission
+		if permission == 0 {
+			permission = materializedStreamPermission
+		}
+
+		columns := make([]api2go.ColumnInfo, 0)
+		for _, column := range stream.Columns {
+			if column.ColumnName == "" {
+				column.ColumnName = column.Name
+			}
+			if column.Name == "" {
+				column.Name = column.ColumnName
+			}
+			if column.DataType == "" {
+				column.DataType = streamColumnDataType(column.ColumnType)
+			}
+			column.IsNullable = true
+			columns = append(columns, column)
+		}
+
+		tables = append(tables, TableInfo{
+			TableName:         stream.StreamName,
+			Columns:           columns,
+			IsTopLevel:        true,
+			Permission:        permission,
+			DefaultPermission: permission,
+		})
+	}
+
+	return tables
+}
+
+// streamColumnDataType is the first data type of a column type, text when the column type is not known
+func streamColumnDataType(columnType string) string {
+	for _, ct := range ColumnTypes {
+		if ct.Name == columnType && len(ct.DataTypes) > 0 {
+			return ct.DataTypes[0]
+		}
+	}
+	return "text"
+}
+
+// Materialize replaces the rows of the table of the stream with the output of the stream, in one transaction
+// The rows belong to the workspace of the request, the rows of other workspaces are left as they are
+func (dr *StreamProcessor) Materialize(req api2go.Request) (int, error) {
+
+	rows, err := dr.ReadAll(req)
+	if err != nil {
+		return 0, err
+	}
+
+	return dr.replaceRows(rows, req)
+}
+
+// replaceRows writes the rows to the table of the stream in place of the rows of the workspace of the request
+func (dr *StreamProcessor) replaceRows(rows []map[string]interface{}, req api2go.Request) (int, error) {
+
+	tableName := dr.contract.StreamName
+	table, ok := dr.cruds[tableName]
+	if !ok {
+		return 0, fmt.Errorf("no table for materialised stream [%v]", tableName)
+	}
+
+	permission := int64(materializedStreamPermission)
+	if dr.contract.Materialize != nil && dr.contract.Materialize.Permission != 0 {
+		permission = int64(dr.contract.Materialize.Permission)
+	}
+	adminId, _ := GetAdminUserIdAndUserGroupId(table.db)
+
+	columnNames := make([]string, 0)
+	for _, column := range table.TableInfo().Columns {
+		if _, isStream := dr.contract.columnByName(column.ColumnName); isStream {
+			columnNames = append(columnNames, column.ColumnName)
+		}
+	}
+
+	tx, err := table.connection.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	scoped := table.IsWorkspaceScoped()
+	var workspaceId interface{}
+	if workspace := GetWorkspace(req.PlainRequest); workspace != nil {
+		workspaceId = workspace.WorkspaceId
+	}
+
+	deleteQuery := statementbuilder.Squirrel.Delete(tableName)
+	if scoped {
+		deleteQuery = deleteQuery.Where(WorkspaceCondition(req.PlainRequest, ""))
+	}
+	s, v, err := deleteQuery.ToSql()
+	if err == nil {
+		_, err = tx.Exec(s, v...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, row := range rows {
+
+		u, _ := uuid.NewV4()
+		insertColumns := append([]string{"reference_id", "permission", USER_ACCOUNT_ID_COLUMN}, columnNames...)
+		values := []interface{}{u.String(), permission, adminId}
+		for _, name := range columnNames {
+			values = append(values, materializedValue(row[name]))
+		}
+		if scoped {
+			insertColumns = append(insertColumns, WORKSPACE_ID_COLUMN)
+			values = append(values, workspaceId)
+		}
+
+		s, v, err = statementbuilder.Squirrel.Insert(tableName).Columns(insertColumns...).Values(values...).ToSql()
+		if err == nil {
+			_, err = tx.Exec(s, v...)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to write row of materialised stream [%v]: %v", tableName, err)
+		}
+	}
+
+	return len(rows), tx.Commit()
+}
+
+// materializedValue stores lists and maps, like the rows of a join, as json
+func materializedValue(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, []map[string]interface{}, []string:
+		j, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		return string(j)
+	}
+	return value
+}
+
+func (sc StreamContract) columnByName(name string) (api2go.ColumnInfo, bool) {
+	for _, column := range sc.Columns {
+		if column.ColumnName == name || (column.ColumnName == "" && column.Name == name) {
+			return column, true
+		}
+	}
+	return api2go.ColumnInfo{}, false
+}
+
+// StreamRefreshPerformer recomputes the table of a materialised stream, with the permissions of the administrator
+// so the table holds the same rows however the refresh was started
+type StreamRefreshPerformer struct {
+	cmsConfig *CmsConfig
+	cruds     map[string]*DbResource
+	lease     *TaskLease
+	lock      sync.Mutex
+	pending   map[string]*time.Timer
+}
+
+func (d *StreamRefreshPerformer) Name() string {
+	return "stream.refresh"
+}
+
+func (d *StreamRefreshPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	responses := make([]ActionResponse, 0)
+
+	streamName, _ := inFields["stream_name"].(string)
+	workspaceId, _ := inFields[WORKSPACE_ID_COLUMN].(int64)
+	count, err := d.Refresh(streamName, workspaceId)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if count < 0 {
+		responses = append(responses, NewActionResponse("client.notify", NewClientNotification("warning", "Stream is being refreshed on another instance", "Skipped")))
+		return nil, responses, nil
+	}
+
+	message := fmt.Sprintf("Stream [%v] wrote %d rows", streamName, count)
+	responses = append(responses, NewActionResponse("client.notify", NewClientNotification("success", message, "Success")))
+
+	return nil, responses, nil
+}
+
+// Refresh materialises the stream in the workspace, 0 for the default workspace
+// It returns -1 when another instance is already refreshing it
+func (d *StreamRefreshPerformer) Refresh(streamName string, workspaceId int64) (int, error) {
+
+	var contract *StreamContract
+	for i, stream := range d.cmsConfig.Streams {
+		if stream.StreamName == streamName {
+			contract = &d.cmsConfig.Streams[i]
+			break
+		}
+	}
+	if contract == nil {
+		return 0, fmt.Errorf("no such stream [%v]", streamName)
+	}
+	if contract.Materialize == nil {
+		return 0, fmt.Errorf("stream [%v] is not materialised", streamName)
+	}
+
+	leaseName := streamRefreshKey(streamName, workspaceId)
+	acquired, err := d.lease.Acquire(leaseName, time.Now().Add(taskLeaseTtl))
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return -1, nil
+	}
+	stopKeepAlive := d.lease.KeepAlive(leaseName)
+	defer func() {
+		stopKeepAlive()
+		err := d.lease.Release(leaseName, time.Now())
+		CheckErr(err, "Failed to release lease [%v]", leaseName)
+	}()
+
+	start := time.Now()
+	adminEmail := d.cruds[USER_ACCOUNT_TABLE_NAME].GetAdminEmailId()
+	req := d.cruds["stream"].requestAsUser(adminEmail, "GET")
+	if workspaceId != 0 {
+		workspace := &auth.SessionWorkspace{WorkspaceId: workspaceId}
+		req.PlainRequest = req.PlainRequest.WithContext(context.WithValue(req.PlainRequest.Context(), "workspace", workspace))
+	}
+	count, err := NewStreamProcessor(*contract, d.cruds).Materialize(req)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Materialised stream [%v] with %d rows in %v", streamName, count, time.Since(start))
+
+	return count, nil
+}
+
+// streamRefreshKey names the refresh of a stream in a workspace, for the lease and the pending refreshes
+func streamRefreshKey(streamName string, workspaceId int64) string {
+	if workspaceId == 0 {
+		return "stream." + streamName
+	}
+	return fmt.Sprintf("stream.%v.%d", streamName, workspaceId)
+}
+
+// RefreshLater refreshes the streams materialised from the entity in the workspace after streamRefreshDelay,
+// changes in the meantime are picked up by the same refresh
+func (d *StreamRefreshPerformer) RefreshLater(entityName string, workspaceId int64) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, stream := range d.cmsConfig.Streams {
+		if stream.Materialize == nil || !stream.Materialize.OnChange || stream.RootEntityName != entityName {
+			continue
+		}
+		streamName := stream.StreamName
+		key := streamRefreshKey(streamName, workspaceId)
+		if _, ok := d.pending[key]; ok {
+			continue
+		}
+
+		d.pending[key] = time.AfterFunc(streamRefreshDelay, func() {
+			d.lock.Lock()
+			delete(d.pending, key)
+			d.lock.Unlock()
+
+			_, err := d.Refresh(streamName, workspaceId)
+			CheckErr(err, "Failed to refresh stream [%v]", streamName)
+		})
+	}
+}
+
+func NewStreamRefreshPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	lease, err := NewTaskLease(cruds["stream"].connection)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := StreamRefreshPerformer{
+		cmsConfig: initConfig,
+		cruds:     cruds,
+		lease:     lease,
+		pending:   make(map[string]*time.Timer),
+	}
+
+	return &handler, nil
+}
+
+// The StreamRefreshMiddleware refreshes the materialised streams of an entity after its rows are changed
+type StreamRefreshMiddleware struct {
+}
+
+func NewStreamRefreshMiddleware() DatabaseRequestInterceptor {
+	return &StreamRefreshMiddleware{}
+}
+
+func (sm *StreamRefreshMiddleware) String() string {
+	return "StreamRefreshMiddleware"
+}
+
+func (sm *StreamRefreshMiddleware) InterceptBefore(dr *DbResource, req *api2go.Request, objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	return objects, nil
+}
+
+func (sm *StreamRefreshMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	switch req.PlainRequest.Method {
+	case "POST", "PATCH", "PUT", "DELETE":
+	default:
+		return results, nil
+	}
+
+	if performer, ok := dr.ActionHandlerMap["stream.refresh"].(*StreamRefreshPerformer); ok {
+		workspaceId := int64(0)
+		if workspace := GetWorkspace(req.PlainRequest); workspace != nil {
+			workspaceId = workspace.WorkspaceId
+		}
+		performer.RefreshLater(dr.model.GetName(), workspaceId)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,111 @@
+package resource
+
+import (
+	"context"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"testing"
+)
+
+func TestMaterializedStreamTablePermission(t *testing.T) {
+
+	tables := MaterializedStreamTables([]StreamContract{
+		{StreamName: "private_summary", Materialize: &StreamMaterialization{}},
+		{StreamName: "public_summary", Materialize: &StreamMaterialization{Permission: auth.GuestRead | auth.UserRead}},
+		{StreamName: "live_summary"},
+	})
+
+	if len(tables) != 2 {
+		t.Fatalf("expected a table for each materialised stream, got %v", tables)
+	}
+	if tables[0].DefaultPermission != auth.UserPeek|auth.UserRead || tables[0].Permission&auth.GuestRead != 0 {
+		t.Errorf("expected only the owner to read a materialised stream by default, got %v", tables[0].DefaultPermission)
+	}
+	if tables[1].DefaultPermission != auth.GuestRead|auth.UserRead {
+		t.Errorf("expected the permission of the stream to be used, got %v", tables[1].DefaultPermission)
+	}
+}
+
+func TestMaterializedRowsBelongToTheWorkspaceOfTheRefresh(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table user_account (id integer primary key, email varchar(100))",
+		"create table usergroup (id integer primary key)",
+		"insert into user_account (email) values ('admin@example.com')",
+		"insert into usergroup (id) values (1)",
+		`create table sales_summary (id integer primary key autoincrement, reference_id varchar(40), permission int,
+			user_account_id int, workspace_id int, region varchar(100))`,
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	columns := []api2go.ColumnInfo{
+		{Name: "region", ColumnName: "region", ColumnType: "label"},
+		{Name: "workspace_id", ColumnName: WORKSPACE_ID_COLUMN, ColumnType: "alias"},
+	}
+	table := &DbResource{
+		model:      api2go.NewApi2GoModel("sales_summary", columns, 0, nil),
+		db:         db,
+		connection: db,
+		tableInfo:  &TableInfo{TableName: "sales_summary", Columns: columns},
+	}
+	processor := NewStreamProcessor(StreamContract{
+		StreamName:  "sales_summary",
+		Columns:     columns[:1],
+		Materialize: &StreamMaterialization{},
+	}, map[string]*DbResource{"sales_summary": table})
+
+	inWorkspace := func(workspaceId int64) api2go.Request {
+		req := &http.Request{Method: "GET"}
+		if workspaceId != 0 {
+			req = req.WithContext(context.WithValue(req.Context(), "workspace", &auth.SessionWorkspace{WorkspaceId: workspaceId}))
+		}
+		return api2go.Request{PlainRequest: req}
+	}
+
+	refreshes := []struct {
+		workspaceId int64
+		regions     []string
+	}{
+		{0, []string{"all"}},
+		{1, []string{"east", "west"}},
+		{2, []string{"north"}},
+		{1, []string{"east"}},
+	}
+	for _, refresh := range refreshes {
+		rows := make([]map[string]interface{}, 0)
+		for _, region := range refresh.regions {
+			rows = append(rows, map[string]interface{}{"region": region})
+		}
+		_, err = processor.replaceRows(rows, inWorkspace(refresh.workspaceId))
+		if err != nil {
+			t.Fatalf("failed to write rows: %v", err)
+		}
+	}
+
+	expected := map[int64]string{0: "all", 1: "east", 2: "north"}
+	for workspaceId, region := range expected {
+		var regions []string
+		if workspaceId == 0 {
+			err = db.Select(&regions, "select region from sales_summary where workspace_id is null")
+		} else {
+			err = db.Select(&regions, "select region from sales_summary where workspace_id = ?", workspaceId)
+		}
+		if err != nil || len(regions) != 1 || regions[0] != region {
+			t.Errorf("expected workspace %d to have only [%v], got %v: %v", workspaceId, region, regions, err)
+		}
+	}
+}
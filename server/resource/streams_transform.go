@@ -0,0 +1,469 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// comparators of filter transformations and the query operators they are pushed down as
+var streamFilterOperators = map[string]string{
+	"==": "is",
+	"!=": "is not",
+	">":  "after",
+	"<":  "before",
+	"in": "any of",
+}
+
+// pushDown builds the query params for the root entity, filters and sorts on columns of the root entity which come
+// before any transformation that changes the rows are moved into the query. Returns the transformations left to apply
+func (dr *StreamProcessor) pushDown(requestParams map[string][]string) (map[string][]string, []Transformation) {
+
+	queryParams := make(map[string][]string)
+	for key, val := range requestParams {
+		queryParams[key] = val
+	}
+	for key, val := range dr.contract.QueryParams {
+		queryParams[key] = val
+	}
+
+	rootColumns := make(map[string]bool)
+	var rootTable *TableInfo
+	if root, ok := dr.cruds[dr.contract.RootEntityName]; ok {
+		rootTable = root.TableInfo()
+		for _, column := range rootTable.Columns {
+			// foreign keys are ids in the database but reference ids in the rows
+			if !column.IsForeignKey {
+				rootColumns[column.ColumnName] = true
+			}
+		}
+	}
+	isRootColumn := func(column string) bool {
+		_, isJsonPath := ParseJsonPath(rootTable, column)
+		return rootColumns[column] || isJsonPath
+	}
+
+	queries := make([]Query, 0)
+	sorts := make([]string, 0)
+	remaining := make([]Transformation, 0)
+
+	pushing := true
+	for _, transformation := range dr.contract.Transformations {
+
+		if pushing {
+			switch transformation.Operation {
+			case "filter":
+				column, _ := transformation.Attributes["ColumnName"].(string)
+				comparator, _ := transformation.Attributes["Comparator"].(string)
+				operator, ok := streamFilterOperators[comparator]
+				if ok && isRootColumn(column) {
+					value := transformation.Attributes["Value"]
+					if list, isList := value.([]interface{}); isList {
+						values := make([]string, len(list))
+						for i, v := range list {
+							values[i] = fmt.Sprintf("%v", v)
+						}
+						value = strings.Join(values, ",")
+					}
+					queries = append(queries, Query{
+						ColumnName: column,
+						Operator:   operator,
+						Value:      value,
+					})
+					continue
+				}
+			case "sort":
+				columns := sortColumns(transformation.Attributes)
+				allRoot := len(columns) > 0
+				for _, column := range columns {
+					allRoot = allRoot && isRootColumn(strings.TrimLeft(column, "-+"))
+				}
+				if allRoot {
+					// a later sort decides the order, the earlier one only breaks ties
+					sorts = append(append([]string{}, columns...), sorts...)
+					continue
+				}
+			case "select", "drop":
+				// only remove columns, filters after them can still be pushed
+			default:
+				pushing = false
+			}
+		}
+
+		remaining = append(remaining, transformation)
+	}
+
+	if len(queries) > 0 {
+		existing := make([]Query, 0)
+		if query, ok := queryParams["query"]; ok && len(query) > 0 {
+			err := json.Unmarshal([]byte(strings.Join(query, ",")), &existing)
+			CheckInfo(err, "Failed to read query of request to stream [%v]", dr.contract.StreamName)
+		}
+		queryJson, err := json.Marshal(append(existing, queries...))
+		CheckErr(err, "Failed to build query for stream [%v]", dr.contract.StreamName)
+		queryParams["query"] = []string{string(queryJson)}
+	}
+
+	if len(sorts) > 0 {
+		queryParams["sort"] = sorts
+	}
+
+	return queryParams, remaining
+}
+
+// needsAllRows is true when a transformation changes the number or the order of the rows, the page can then only
+// be cut after the transformations
+func needsAllRows(transformations []Transformation) bool {
+	for _, transformation := range transformations {
+		switch transformation.Operation {
+		case "select", "rename", "drop", "mutate":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// streamAggregation is one aggregated column of a groupby transformation
+type streamAggregation struct {
+	Column   string
+	Function string
+	As       string
+}
+
+// groupRows groups the rows by the values in Columns, each group becomes one row with the group columns and the
+// Aggregations, a list of {Column, Function, As} where Function is one of count, sum, avg, min, max, first and last
+func groupRows(rows []map[string]interface{}, attributes map[string]interface{}) ([]map[string]interface{}, error) {
+
+	columns := stringList(attributes["Columns"])
+
+	aggregations := make([]streamAggregation, 0)
+	aggregationsJson, err := json.Marshal(attributes["Aggregations"])
+	if err != nil {
+		return nil, err
+	}
+	if attributes["Aggregations"] != nil {
+		err = json.Unmarshal(aggregationsJson, &aggregations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregations for groupby: %v", err)
+		}
+	}
+
+	for i, aggregation := range aggregations {
+		if aggregation.Function == "" {
+			aggregation.Function = "count"
+		}
+		if aggregation.As == "" {
+			aggregation.As = aggregation.Function
+			if aggregation.Column != "" {
+				aggregation.As = aggregation.Function + "_" + aggregation.Column
+			}
+		}
+		aggregations[i] = aggregation
+	}
+
+	groupKeys := make([]string, 0)
+	groups := make(map[string][]map[string]interface{})
+
+	for _, row := range rows {
+		keyParts := make([]string, len(columns))
+		for i, column := range columns {
+			keyParts[i] = fmt.Sprintf("%v", rowValue(row, column))
+		}
+		key := strings.Join(keyParts, "\x00")
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for _, key := range groupKeys {
+		group := groups[key]
+		row := make(map[string]interface{})
+		for _, column := range columns {
+			row[column] = rowValue(group[0], column)
+		}
+		for _, aggregation := range aggregations {
+			value, err := aggregate(group, aggregation)
+			if err != nil {
+				return nil, err
+			}
+			row[aggregation.As] = value
+		}
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+func aggregate(group []map[string]interface{}, aggregation streamAggregation) (interface{}, error) {
+
+	switch aggregation.Function {
+	case "count":
+		if aggregation.Column == "" {
+			return len(group), nil
+		}
+		count := 0
+		for _, row := range group {
+			if rowValue(row, aggregation.Column) != nil {
+				count += 1
+			}
+		}
+		return count, nil
+	case "first":
+		return rowValue(group[0], aggregation.Column), nil
+	case "last":
+		return rowValue(group[len(group)-1], aggregation.Column), nil
+	case "sum", "avg":
+		sum := float64(0)
+		count := 0
+		for _, row := range group {
+			number, ok := toFloat(rowValue(row, aggregation.Column))
+			if !ok {
+				continue
+			}
+			sum += number
+			count += 1
+		}
+		if aggregation.Function == "sum" {
+			return sum, nil
+		}
+		if count == 0 {
+			return nil, nil
+		}
+		return sum / float64(count), nil
+	case "min", "max":
+		var selected interface{}
+		for _, row := range group {
+			value := rowValue(row, aggregation.Column)
+			if value == nil {
+				continue
+			}
+			if selected == nil {
+				selected = value
+				continue
+			}
+			less := compareValues(value, selected) < 0
+			if less == (aggregation.Function == "min") {
+				selected = value
+			}
+		}
+		return selected, nil
+	}
+
+	return nil, fmt.Errorf("unknown aggregation [%v]", aggregation.Function)
+}
+
+// joinRows adds the columns of the rows of Entity whose ForeignColumn matches LocalColumn of the row
+// The columns are prefixed with Prefix, the name of the entity and an underscore by default, Columns limits the
+// columns added. Type is "left" by default which keeps the rows without a match, "inner" drops them
+func (dr *StreamProcessor) joinRows(rows []map[string]interface{}, attributes map[string]interface{}, req api2go.Request) ([]map[string]interface{}, error) {
+
+	entity, _ := attributes["Entity"].(string)
+	localColumn, _ := attributes["LocalColumn"].(string)
+	foreignColumn, _ := attributes["ForeignColumn"].(string)
+	if entity == "" || foreignColumn == "" {
+		return nil, fmt.Errorf("join in stream [%v] needs an Entity and a ForeignColumn", dr.contract.StreamName)
+	}
+	if localColumn == "" {
+		localColumn = "reference_id"
+	}
+	joinType, _ := attributes["Type"].(string)
+	prefix, ok := attributes["Prefix"].(string)
+	if !ok {
+		prefix = entity + "_"
+	}
+	columns := stringList(attributes["Columns"])
+
+	foreignRows, err := dr.readEntity(entity, map[string][]string{}, req)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string][]map[string]interface{})
+	for _, foreignRow := range foreignRows {
+		key := fmt.Sprintf("%v", foreignRow[foreignColumn])
+		index[key] = append(index[key], foreignRow)
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for _, row := range rows {
+		matches := index[fmt.Sprintf("%v", row[localColumn])]
+		if row[localColumn] == nil {
+			matches = nil
+		}
+
+		if len(matches) == 0 {
+			if joinType != "inner" {
+				result = append(result, row)
+			}
+			continue
+		}
+
+		for _, match := range matches {
+			joined := make(map[string]interface{})
+			for key, value := range row {
+				joined[key] = value
+			}
+			if len(columns) > 0 {
+				for _, column := range columns {
+					joined[prefix+column] = match[column]
+				}
+			} else {
+				for key, value := range match {
+					if key == "__type" || key == "permission" {
+						continue
+					}
+					joined[prefix+key] = value
+				}
+			}
+			result = append(result, joined)
+		}
+	}
+
+	return result, nil
+}
+
+// mutateRows sets Column of every row to the value of Expression, evaluated like action attributes with the
+// columns of the row available by their names and as row, eg "!row.price * row.quantity"
+func mutateRows(rows []map[string]interface{}, attributes map[string]interface{}) ([]map[string]interface{}, error) {
+
+	column, _ := attributes["Column"].(string)
+	expression, _ := attributes["Expression"].(string)
+	if column == "" || expression == "" {
+		return nil, fmt.Errorf("mutate needs a Column and an Expression")
+	}
+
+	for _, row := range rows {
+		context := make(map[string]interface{})
+		for key, value := range row {
+			context[key] = value
+		}
+		context["row"] = row
+
+		value, err := evaluateString(expression, context)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate [%v] for column [%v]: %v", expression, column, err)
+		}
+		row[column] = value
+	}
+
+	return rows, nil
+}
+
+// sortColumns reads the Columns of a sort transformation, a column starting with - is sorted in descending order
+// like the sort parameter of a request
+func sortColumns(attributes map[string]interface{}) []string {
+	return stringList(attributes["Columns"])
+}
+
+func sortRows(rows []map[string]interface{}, columns []string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, column := range columns {
+			descending := strings.HasPrefix(column, "-")
+			column = strings.TrimLeft(column, "-+")
+			compared := compareValues(rowValue(rows[i], column), rowValue(rows[j], column))
+			if compared == 0 {
+				continue
+			}
+			if descending {
+				return compared > 0
+			}
+			return compared < 0
+		}
+		return false
+	})
+}
+
+// limitRows keeps Count rows after skipping Offset rows
+func limitRows(rows []map[string]interface{}, attributes map[string]interface{}) []map[string]interface{} {
+
+	offset, _ := toFloat(attributes["Offset"])
+	count, ok := toFloat(attributes["Count"])
+
+	start := int(offset)
+	if start > len(rows) {
+		start = len(rows)
+	}
+	end := len(rows)
+	if ok && start+int(count) < end {
+		end = start + int(count)
+	}
+
+	return rows[start:end]
+}
+
+// compareValues compares numbers as numbers and everything else as text, nil is before any value
+func compareValues(a interface{}, b interface{}) int {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0
+		}
+		if a == nil {
+			return -1
+		}
+		return 1
+	}
+
+	aNumber, aOk := toFloat(a)
+	bNumber, bOk := toFloat(b)
+	if aOk && bOk {
+		switch {
+		case aNumber < bNumber:
+			return -1
+		case aNumber > bNumber:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0)
+		for _, item := range v {
+			list = append(list, fmt.Sprintf("%v", item))
+		}
+		return list
+	case string:
+		if v == "" {
+			return []string{}
+		}
+		return strings.Split(v, ",")
+	}
+	return []string{}
+}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"encoding/json"
+	"github.com/artpar/api2go"
+	"testing"
+)
+
+func TestStreamPushDownStopsAtGroupBy(t *testing.T) {
+
+	processor := &StreamProcessor{
+		cruds: map[string]*DbResource{
+			"sale": {tableInfo: &TableInfo{Columns: []api2go.ColumnInfo{
+				{ColumnName: "region", ColumnType: "label"},
+				{ColumnName: "amount", ColumnType: "measurement"},
+			}}},
+		},
+		contract: StreamContract{
+			StreamName:     "sales_by_region",
+			RootEntityName: "sale",
+			Transformations: []Transformation{
+				{Operation: "filter", Attributes: map[string]interface{}{"ColumnName": "amount", "Comparator": ">", "Value": 10}},
+				{Operation: "filter", Attributes: map[string]interface{}{"ColumnName": "region", "Comparator": "contains", "Value": "e"}},
+				{Operation: "sort", Attributes: map[string]interface{}{"Columns": "-amount"}},
+				{Operation: "groupby", Attributes: map[string]interface{}{"Columns": "region"}},
+				{Operation: "filter", Attributes: map[string]interface{}{"ColumnName": "region", "Comparator": "==", "Value": "east"}},
+			},
+		},
+	}
+
+	queryParams, remaining := processor.pushDown(map[string][]string{})
+
+	queries := make([]Query, 0)
+	err := json.Unmarshal([]byte(queryParams["query"][0]), &queries)
+	if err != nil {
+		t.Fatalf("invalid query pushed down: %v", err)
+	}
+	if len(queries) != 1 || queries[0].ColumnName != "amount" || queries[0].Operator != "after" {
+		t.Errorf("expected only the amount filter in the query, got %v", queries)
+	}
+	if len(queryParams["sort"]) != 1 || queryParams["sort"][0] != "-amount" {
+		t.Errorf("expected the sort in the query, got %v", queryParams["sort"])
+	}
+	// a filter without a query operator is applied in memory, the groupby stops the push down of the filter after it
+	if len(remaining) != 3 || remaining[0].Operation != "filter" || remaining[1].Operation != "groupby" {
+		t.Errorf("expected the filter, groupby and the filter after it to remain, got %v", remaining)
+	}
+	if !needsAllRows(remaining) {
+		t.Errorf("expected a groupby to need all the rows")
+	}
+}
+
+func TestStreamGroupSortAndLimit(t *testing.T) {
+
+	rows := []map[string]interface{}{
+		{"region": "east", "amount": 10},
+		{"region": "west", "amount": "5"},
+		{"region": "east", "amount": 30.5},
+		{"region": "north", "amount": nil},
+	}
+
+	grouped, err := groupRows(rows, map[string]interface{}{
+		"Columns": "region",
+		"Aggregations": []interface{}{
+			map[string]interface{}{"Function": "count"},
+			map[string]interface{}{"Column": "amount", "Function": "sum"},
+			map[string]interface{}{"Column": "amount", "Function": "max", "As": "largest"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to group rows: %v", err)
+	}
+	if len(grouped) != 3 {
+		t.Fatalf("expected a row per region, got %v", grouped)
+	}
+	east := grouped[0]
+	if east["region"] != "east" || east["count"] != 2 || east["sum_amount"] != 40.5 || east["largest"] != 30.5 {
+		t.Errorf("unexpected aggregation of east: %v", east)
+	}
+	if grouped[2]["largest"] != nil || grouped[2]["sum_amount"] != float64(0) {
+		t.Errorf("expected a region without amounts to have no largest amount, got %v", grouped[2])
+	}
+
+	sortRows(grouped, []string{"-sum_amount"})
+	limited := limitRows(grouped, map[string]interface{}{"Count": 2})
+	if len(limited) != 2 || limited[0]["region"] != "east" || limited[1]["region"] != "west" {
+		t.Errorf("expected the two regions with the largest sums, got %v", limited)
+	}
+
+	_, err = groupRows(rows, map[string]interface{}{
+		"Columns":      "region",
+		"Aggregations": []interface{}{map[string]interface{}{"Column": "amount", "Function": "median"}},
+	})
+	if err == nil {
+		t.Errorf("expected an unknown aggregation to be rejected")
+	}
+}
@@ -0,0 +1,201 @@
+package resource
+
+import (
+	"errors"
+	"github.com/Masterminds/squirrel"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/database"
+	"github.com/daptin/daptin/server/statementbuilder"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// TaskLease is a named lock with an expiry stored in the database, shared by all daptin instances
+// connected to the same database. A scheduled task is executed only by the instance holding its lease,
+// so a task fires once across the cluster instead of once per replica
+// Expiry is stored as unix milliseconds, so it works the same on sqlite, mysql and postgres
+type TaskLease struct {
+	db         database.DatabaseConnection
+	instanceId string
+}
+
+var taskLeaseTableName = "_task_lease"
+
+// how long a lease stays valid without being renewed by the running instance
+var taskLeaseTtl = 30 * time.Second
+
+var ErrTaskLeaseHeld = errors.New("task lease is held by another instance")
+
+var TaskLeaseTableStructure = TableInfo{
+	TableName: taskLeaseTableName,
+	Columns: []api2go.ColumnInfo{
+		{
+			Name:         "name",
+			ColumnName:   "name",
+			ColumnType:   "string",
+			DataType:     "varchar(200)",
+			IsNullable:   false,
+			IsPrimaryKey: true,
+		},
+		{
+			Name:       "holder",
+			ColumnName: "holder",
+			ColumnType: "string",
+			DataType:   "varchar(100)",
+			IsNullable: false,
+		},
+		{
+			Name:       "expires_at",
+			ColumnName: "expires_at",
+			ColumnType: "measurement",
+			DataType:   "bigint",
+			IsNullable: false,
+		},
+	},
+}
+
+func NewTaskLease(db database.DatabaseConnection) (*TaskLease, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select("count(*)").From(taskLeaseTableName).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = db.QueryRowx(s, v...).Scan(&count)
+	if err != nil {
+		createTableQuery := MakeCreateTableQuery(&TaskLeaseTableStructure, db.DriverName())
+		_, err = db.Exec(createTableQuery)
+		if err != nil {
+			log.Printf("create task lease table query: %v", createTableQuery)
+			return nil, err
+		}
+	}
+
+	return &TaskLease{
+		db:         db,
+		instanceId: InstanceId(),
+	}, nil
+}
+
+// Acquire takes the lease `name` until `until` if it is free, expired or already held by this instance
+// Returns false when another instance holds a valid lease
+func (tl *TaskLease) Acquire(name string, until time.Time) (bool, error) {
+
+	expiresAt := toMillis(until)
+
+	s, v, err := statementbuilder.Squirrel.Update(taskLeaseTableName).
+		Set("holder", tl.instanceId).
+		Set("expires_at", expiresAt).
+		Where(squirrel.Eq{"name": name}).
+		Where(squirrel.Or{
+			squirrel.Lt{"expires_at": toMillis(time.Now())},
+			squirrel.Eq{"holder": tl.instanceId},
+		}).ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tl.db.Exec(s, v...)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if updated == 1 {
+		return true, nil
+	}
+
+	// the lease row is created by the first instance to ask for it, the primary key on name lets only one insert succeed
+	s, v, err = statementbuilder.Squirrel.Insert(taskLeaseTableName).
+		Columns("name", "holder", "expires_at").
+		Values(name, tl.instanceId, expiresAt).ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	_, insertErr := tl.db.Exec(s, v...)
+	if insertErr == nil {
+		return true, nil
+	}
+
+	// the insert is turned down by the primary key only when another instance has the row, any other failure
+	// is returned so a broken lease table does not quietly skip every run
+	s, v, err = statementbuilder.Squirrel.Select("count(*)").From(taskLeaseTableName).
+		Where(squirrel.Eq{"name": name}).ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	err = tl.db.QueryRowx(s, v...).Scan(&count)
+	if err != nil || count == 0 {
+		log.Errorf("Failed to acquire lease [%v]: %v", name, insertErr)
+		return false, insertErr
+	}
+
+	log.Debugf("Lease [%v] is held by another instance: %v", name, insertErr)
+	return false, nil
+}
+
+// Renew extends the lease held by this instance by taskLeaseTtl from now
+func (tl *TaskLease) Renew(name string) error {
+
+	s, v, err := statementbuilder.Squirrel.Update(taskLeaseTableName).
+		Set("expires_at", toMillis(time.Now().Add(taskLeaseTtl))).
+		Where(squirrel.Eq{"name": name}).
+		Where(squirrel.Eq{"holder": tl.instanceId}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tl.db.Exec(s, v...)
+	return err
+}
+
+// Release sets the expiry of the lease held by this instance to `until`
+// Passing the current time frees the lease immediately, a later time keeps other instances out until then
+func (tl *TaskLease) Release(name string, until time.Time) error {
+
+	s, v, err := statementbuilder.Squirrel.Update(taskLeaseTableName).
+		Set("expires_at", toMillis(until)).
+		Where(squirrel.Eq{"name": name}).
+		Where(squirrel.Eq{"holder": tl.instanceId}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tl.db.Exec(s, v...)
+	return err
+}
+
+// KeepAlive renews the lease periodically until the returned function is called
+func (tl *TaskLease) KeepAlive(name string) func() {
+
+	done := make(chan bool)
+	ticker := time.NewTicker(taskLeaseTtl / 3)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := tl.Renew(name)
+				CheckErr(err, "Failed to renew lease [%v]", name)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -2,12 +2,20 @@ package resource
 
 import (
 	"context"
+	"crypto/sha1"
+	"errors"
 	"fmt"
 	"github.com/artpar/api2go"
+	"github.com/artpar/go.uuid"
+	"github.com/artpar/resty"
 	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/database"
 	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Task struct {
@@ -21,11 +29,46 @@ type Task struct {
 	ActionName     string
 	EntityName     string
 	AttributesJson string
+	OnFailure      TaskFailureHook
 }
 
+// TaskFailureHook is stored in the `on_failure` column of a task
+// ActionName on EntityName is invoked as the task user when an execution fails
+// Webhook is called with a POST request carrying the task run as json
+// Either or both can be set
+type TaskFailureHook struct {
+	ActionName string
+	EntityName string
+	Webhook    string
+}
+
+// TaskRun is the record of one execution of a task, persisted in the `task_run` table
+type TaskRun struct {
+	TaskName    string
+	TriggeredBy string
+	StartedAt   time.Time
+	EndedAt     time.Time
+	Duration    time.Duration
+	Outcome     string
+	Error       string
+	Response    []ActionResponse
+}
+
+const (
+	TaskRunSuccess = "success"
+	TaskRunFailure = "failure"
+
+	TaskTriggerSchedule = "schedule"
+	TaskTriggerManual   = "manual"
+)
+
+var ErrTaskAlreadyRunning = errors.New("task is already running")
+
 type TaskScheduler interface {
 	StartTasks()
 	AddTask(task Task) error
+	SyncTasks() error
+	RunTask(referenceId string) (*TaskRun, error)
 	StopTasks()
 }
 
@@ -34,61 +77,302 @@ type DefaultTaskScheduler struct {
 	cruds       map[string]*DbResource
 	configStore *ConfigStore
 	cronService *cron.Cron
-	activeTasks []*ActiveTaskInstance
+	activeTasks map[string]*ActiveTaskInstance
+	running     map[string]*int32
+	lease       *TaskLease
+	stopped     bool
+	taskLock    sync.Mutex
 }
 
-func NewTaskScheduler(cmsConfig *CmsConfig, cruds map[string]*DbResource, configStore *ConfigStore) TaskScheduler {
+func NewTaskScheduler(cmsConfig *CmsConfig, cruds map[string]*DbResource, configStore *ConfigStore, db database.DatabaseConnection) TaskScheduler {
 	cronService := cron.New()
 	cronService.Start()
+
+	lease, err := NewTaskLease(db)
+	CheckErr(err, "Failed to create task lease table, tasks will run on every instance")
+
 	dts := &DefaultTaskScheduler{
 		//cmsConfig:   cmsConfig,
 		cruds:       cruds,
 		configStore: configStore,
 		cronService: cronService,
-		activeTasks: make([]*ActiveTaskInstance, 0),
+		activeTasks: make(map[string]*ActiveTaskInstance),
+		running:     make(map[string]*int32),
+		lease:       lease,
 	}
 	return dts
 }
 
 func (dts *DefaultTaskScheduler) StopTasks() {
+	dts.taskLock.Lock()
+	defer dts.taskLock.Unlock()
+	dts.stopped = true
 	dts.cronService.Stop()
 }
 
 func (dts *DefaultTaskScheduler) StartTasks() {
 
+	err := dts.SyncTasks()
+	CheckErr(err, "Failed to fetch tasks from database")
+
+}
+
+// SyncTasks reconciles the scheduled jobs with the rows of the task table
+// Active tasks which are not scheduled yet are added, edited tasks are rescheduled, and
+// tasks which were deleted or marked inactive are removed. Tasks registered using AddTask are kept as they are
+func (dts *DefaultTaskScheduler) SyncTasks() error {
+
 	tasks, err := dts.cruds["task"].GetAllTasks()
-	if CheckErr(err, "Failed to fetch tasks from database") {
-		return
+	if err != nil {
+		return err
 	}
-	for _, cronjob := range tasks {
 
-		err := dts.AddTask(cronjob)
-		if CheckErr(err, fmt.Sprintf("Failed to start scheduled job: %v", cronjob.Name)) {
+	dts.taskLock.Lock()
+	defer dts.taskLock.Unlock()
+
+	changed := false
+	present := make(map[string]bool)
+	for _, task := range tasks {
+		if !task.Active {
+			continue
+		}
+
+		schedule, err := cron.Parse(task.Schedule)
+		if CheckErr(err, "Invalid schedule [%v] for task [%v]", task.Schedule, task.Name) {
+			continue
+		}
+		present[task.ReferenceId] = true
+
+		existing, ok := dts.activeTasks[task.ReferenceId]
+		if ok && toJson(existing.Task) == toJson(task) {
 			continue
 		}
 
+		log.Printf("Register task [%v] at %v", task.Name, task.Schedule)
+		at := dts.cruds["task"].NewActiveTaskInstance(task)
+		at.lease = dts.lease
+		at.schedule = schedule
+		// an edited task keeps its running flag, so an edit does not allow an overlapping run
+		at.running = dts.runningFlag(task.ReferenceId)
+		dts.activeTasks[task.ReferenceId] = at
+		changed = true
+	}
+
+	for key, at := range dts.activeTasks {
+		if at.Task.ReferenceId == "" || present[key] {
+			continue
+		}
+		log.Printf("Unregister task [%v]", at.Task.Name)
+		delete(dts.activeTasks, key)
+		changed = true
+	}
+
+	if changed {
+		dts.rescheduleTasks()
+	}
+
+	return nil
+}
+
+// rescheduleTasks replaces the cron with a new one holding the current set of tasks
+// robfig/cron cannot remove a single entry. Runs which are in progress are not interrupted
+func (dts *DefaultTaskScheduler) rescheduleTasks() {
+
+	cronService := cron.New()
+	for _, at := range dts.activeTasks {
+		err := cronService.AddJob(at.Task.Schedule, at)
+		CheckErr(err, "Failed to schedule task [%v]", at.Task.Name)
 	}
 
+	dts.cronService.Stop()
+	dts.cronService = cronService
+	if !dts.stopped {
+		cronService.Start()
+	}
+}
+
+// runningFlag is the flag marking a run of the task with the reference id in progress
+// Scheduled and manual runs of a task share it, so they cannot overlap. Called with the taskLock held
+func (dts *DefaultTaskScheduler) runningFlag(referenceId string) *int32 {
+	if dts.running == nil {
+		dts.running = make(map[string]*int32)
+	}
+	flag, ok := dts.running[referenceId]
+	if !ok {
+		flag = new(int32)
+		dts.running[referenceId] = flag
+	}
+	return flag
+}
+
+// RunTask executes the task identified by the reference id immediately
+// The scheduled instance is reused when the task is registered with the cron. A task which is not scheduled
+// runs with the same running flag, so a manual run cannot overlap with another run of the same task
+func (dts *DefaultTaskScheduler) RunTask(referenceId string) (*TaskRun, error) {
+
+	dts.taskLock.Lock()
+	instance, ok := dts.activeTasks[referenceId]
+	dts.taskLock.Unlock()
+
+	if !ok {
+		task, err := dts.cruds["task"].GetTaskByReferenceId(referenceId)
+		if err != nil {
+			return nil, err
+		}
+		instance = dts.cruds["task"].NewActiveTaskInstance(task)
+		instance.lease = dts.lease
+		dts.taskLock.Lock()
+		instance.running = dts.runningFlag(task.ReferenceId)
+		dts.taskLock.Unlock()
+	}
+
+	return instance.Execute(TaskTriggerManual)
 }
 
 type ActiveTaskInstance struct {
 	Task          Task
 	ActionRequest ActionRequest
 	DbResource    *DbResource
+	running       *int32
+	lease         *TaskLease
+	schedule      cron.Schedule
 }
 
 func (ati *ActiveTaskInstance) Run() {
+	_, err := ati.Execute(TaskTriggerSchedule)
+	if err == ErrTaskAlreadyRunning {
+		log.Warnf("Skipping task [%v], previous run has not finished yet", ati.Task.ActionName)
+	} else if err == ErrTaskLeaseHeld {
+		log.Infof("Skipping task [%v], it is executed by another instance", ati.Task.ActionName)
+	}
+}
+
+// Execute runs the action of the task once and records the run in the task_run table
+// Returns ErrTaskAlreadyRunning without executing if another run of the same task is in progress
+func (ati *ActiveTaskInstance) Execute(triggeredBy string) (*TaskRun, error) {
+	if !atomic.CompareAndSwapInt32(ati.running, 0, 1) {
+		return nil, ErrTaskAlreadyRunning
+	}
+	defer atomic.StoreInt32(ati.running, 0)
+
+	if ati.lease != nil {
+		release, err := ati.acquireLease(triggeredBy)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
 	log.Printf("Execute task [%v] as user [%v]", ati.Task.ActionName, ati.Task.AsUserEmail)
 
+	req := ati.newTaskRequest()
+
+	attributes := make(map[string]interface{})
+	for k, v := range ati.ActionRequest.Attributes {
+		attributes[k] = v
+	}
+	actionRequest := ActionRequest{
+		Type:       ati.ActionRequest.Type,
+		Action:     ati.ActionRequest.Action,
+		Attributes: attributes,
+	}
+
+	taskRun := TaskRun{
+		TaskName:    ati.Task.Name,
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	if taskRun.TaskName == "" {
+		taskRun.TaskName = ati.Task.EntityName + "." + ati.Task.ActionName
+	}
+
+	res, err := ati.DbResource.Cruds[actionRequest.Type].HandleActionRequest(&actionRequest, req)
+
+	taskRun.EndedAt = time.Now()
+	taskRun.Duration = taskRun.EndedAt.Sub(taskRun.StartedAt)
+	taskRun.Response = res
+
+	if err != nil {
+		log.Errorf("Errors while executing action: %v", err)
+		taskRun.Outcome = TaskRunFailure
+		taskRun.Error = err.Error()
+	} else {
+		log.Printf("Response from action: %v", res)
+		taskRun.Outcome = TaskRunSuccess
+	}
+
+	runErr := ati.DbResource.CreateTaskRun(ati.Task, taskRun)
+	CheckErr(runErr, "Failed to record run of task [%v]", taskRun.TaskName)
+
+	if taskRun.Outcome == TaskRunFailure {
+		ati.notifyFailure(taskRun, req)
+	}
+
+	return &taskRun, err
+}
+
+// acquireLease makes sure only one instance in the cluster executes the task
+// A scheduled run first takes the lease for the current slot, held until just before the next scheduled time,
+// so replicas whose cron fires a moment later skip this run. Every run then holds the run lease while executing,
+// which keeps a manual run on one instance from overlapping with a run on another
+func (ati *ActiveTaskInstance) acquireLease(triggeredBy string) (func(), error) {
+
+	leaseName := ati.leaseName()
+
+	if triggeredBy == TaskTriggerSchedule && ati.schedule != nil {
+		slotEnd := ati.schedule.Next(time.Now()).Add(-time.Second)
+		acquired, err := ati.lease.Acquire(leaseName+".slot", slotEnd)
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			return nil, ErrTaskLeaseHeld
+		}
+	}
+
+	runLease := leaseName + ".run"
+	acquired, err := ati.lease.Acquire(runLease, time.Now().Add(taskLeaseTtl))
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrTaskLeaseHeld
+	}
+
+	stopKeepAlive := ati.lease.KeepAlive(runLease)
+	return func() {
+		stopKeepAlive()
+		err := ati.lease.Release(runLease, time.Now())
+		CheckErr(err, "Failed to release lease [%v]", runLease)
+	}, nil
+}
+
+// leaseName is the same for a task on every instance. A task from the task table is named by its reference id, the
+// tasks added at startup have none and are named by their action, entity and attributes instead
+func (ati *ActiveTaskInstance) leaseName() string {
+	if ati.Task.ReferenceId != "" {
+		return "task." + ati.Task.ReferenceId
+	}
+	attributesHash := sha1.Sum([]byte(toJson(ati.Task.Attributes)))
+	return fmt.Sprintf("task.%v.%v.%x", ati.Task.EntityName, ati.Task.ActionName, attributesHash[:8])
+}
+
+func (ati *ActiveTaskInstance) newTaskRequest() api2go.Request {
+	return ati.DbResource.requestAsUser(ati.Task.AsUserEmail, "EXECUTE")
+}
+
+// requestAsUser builds a request carrying the session of the user with the given email, for work done in the background
+// An empty email gives a request without a user
+func (dr *DbResource) requestAsUser(email string, method string) api2go.Request {
 	sessionUser := &auth.SessionUser{}
 
-	if ati.Task.AsUserEmail != "" {
-		permission, err := ati.DbResource.GetObjectByWhereClause(USER_ACCOUNT_TABLE_NAME, "email", ati.Task.AsUserEmail)
-		CheckErr(err, "Failed to load user by email [%v]", ati.Task.AsUserEmail)
+	if email != "" {
+		permission, err := dr.GetObjectByWhereClause(USER_ACCOUNT_TABLE_NAME, "email", email, nil)
+		CheckErr(err, "Failed to load user by email [%v]", email)
 		//log.Printf("Loaded user permission: %v", permission)
 		refId := permission["reference_id"]
 		if refId != nil {
-			usergroups := ati.DbResource.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "reference_id", refId.(string))
+			usergroups := dr.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "reference_id", refId.(string))
 			sessionUser.UserReferenceId = permission["reference_id"].(string)
 			sessionUser.UserId = permission["id"].(int64)
 			sessionUser.Groups = usergroups
@@ -96,31 +380,86 @@ func (ati *ActiveTaskInstance) Run() {
 	}
 
 	pr1 := http.Request{
-		Method: "EXECUTE",
+		Method: method,
 	}
 
 	pr := pr1.WithContext(context.WithValue(context.Background(), "user", sessionUser))
-	req := api2go.Request{
+	return api2go.Request{
 		PlainRequest: pr,
 	}
-	res, err := ati.DbResource.Cruds[ati.ActionRequest.Type].HandleActionRequest(&ati.ActionRequest, req)
-	//_, _, err := ati.ActionPerformer.DoAction(ati.ActionRequest, ati.Task.Attributes)
+}
 
-	if err != nil {
-		log.Errorf("Errors while executing action: %v", err)
-	} else {
-		log.Printf("Response from action: %v", res)
+// notifyFailure invokes the failure action and the webhook configured on the task, if any
+func (ati *ActiveTaskInstance) notifyFailure(taskRun TaskRun, req api2go.Request) {
+	hook := ati.Task.OnFailure
+
+	payload := map[string]interface{}{
+		"task_name":    taskRun.TaskName,
+		"triggered_by": taskRun.TriggeredBy,
+		"started_at":   taskRun.StartedAt,
+		"ended_at":     taskRun.EndedAt,
+		"duration_ms":  int64(taskRun.Duration / time.Millisecond),
+		"error":        taskRun.Error,
+	}
+	if ati.Task.ReferenceId != "" {
+		payload["task_id"] = ati.Task.ReferenceId
+	}
+
+	if hook.ActionName != "" && hook.EntityName != "" {
+		crud, ok := ati.DbResource.Cruds[hook.EntityName]
+		if !ok {
+			crud = ati.DbResource.Cruds["world"]
+		}
+		req.PlainRequest.Method = "EXECUTE"
+		_, err := crud.HandleActionRequest(&ActionRequest{
+			Type:       hook.EntityName,
+			Action:     hook.ActionName,
+			Attributes: payload,
+		}, req)
+		CheckErr(err, "Failed to invoke failure action [%v][%v] for task [%v]", hook.EntityName, hook.ActionName, taskRun.TaskName)
+	}
+
+	if hook.Webhook != "" {
+		resp, err := resty.R().SetHeader("Content-Type", "application/json").SetBody(payload).Post(hook.Webhook)
+		if !CheckErr(err, "Failed to call failure webhook for task [%v]", taskRun.TaskName) && resp.StatusCode() >= 400 {
+			log.Errorf("Failure webhook for task [%v] responded with status %v", taskRun.TaskName, resp.StatusCode())
+		}
 	}
 
 }
 
+// AddTask schedules a task which is not stored in the task table, like the syncs registered at startup
+// Every instance registers the same tasks, the lease makes sure each scheduled run happens on one of them
 func (dts *DefaultTaskScheduler) AddTask(task Task) error {
 	log.Printf("Register task [%v] at %v", task.ActionName, task.Schedule)
 	at := dts.cruds["task"].NewActiveTaskInstance(task)
-	dts.activeTasks = append(dts.activeTasks, at)
-	err := dts.cronService.AddJob(task.Schedule, at)
 
-	return err
+	schedule, err := cron.Parse(task.Schedule)
+	if err != nil {
+		return err
+	}
+	at.lease = dts.lease
+	at.schedule = schedule
+
+	dts.taskLock.Lock()
+	defer dts.taskLock.Unlock()
+	if task.ReferenceId != "" {
+		at.running = dts.runningFlag(task.ReferenceId)
+	}
+
+	err = dts.cronService.AddJob(task.Schedule, at)
+	if err != nil {
+		return err
+	}
+
+	key := task.ReferenceId
+	if key == "" {
+		u, _ := uuid.NewV4()
+		key = u.String()
+	}
+	dts.activeTasks[key] = at
+
+	return nil
 }
 
 func (db *DbResource) NewActiveTaskInstance(task Task) *ActiveTaskInstance {
@@ -132,5 +471,6 @@ func (db *DbResource) NewActiveTaskInstance(task Task) *ActiveTaskInstance {
 			Attributes: task.Attributes,
 		},
 		DbResource: db,
+		running:    new(int32),
 	}
 }
@@ -0,0 +1,109 @@
+package resource
+
+import (
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/robfig/cron"
+	"testing"
+	"time"
+)
+
+func newReplicaScheduler(t *testing.T, db *sqlx.DB, instanceId string) *DefaultTaskScheduler {
+	lease, err := NewTaskLease(db)
+	if err != nil {
+		t.Fatalf("failed to create task lease: %v", err)
+	}
+	lease.instanceId = instanceId
+	return &DefaultTaskScheduler{
+		cruds:       map[string]*DbResource{"task": {}},
+		cronService: cron.New(),
+		activeTasks: make(map[string]*ActiveTaskInstance),
+		lease:       lease,
+	}
+}
+
+func TestAddedTaskRunsOnceAcrossSchedulers(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	task := Task{
+		Schedule:   "@every 1h",
+		ActionName: "sync_mail_servers",
+		EntityName: "mail_server",
+		Attributes: map[string]interface{}{"hostname": "mail.example.com"},
+	}
+
+	replicas := []*DefaultTaskScheduler{
+		newReplicaScheduler(t, db, "replica-a"),
+		newReplicaScheduler(t, db, "replica-b"),
+	}
+	instances := make([]*ActiveTaskInstance, 0)
+	for _, replica := range replicas {
+		err = replica.AddTask(task)
+		if err != nil {
+			t.Fatalf("failed to add task: %v", err)
+		}
+		for _, at := range replica.activeTasks {
+			instances = append(instances, at)
+		}
+	}
+
+	if instances[0].leaseName() != instances[1].leaseName() {
+		t.Errorf("expected the same lease on every replica, got %v and %v", instances[0].leaseName(), instances[1].leaseName())
+	}
+	other := Task{ActionName: task.ActionName, EntityName: task.EntityName, Attributes: map[string]interface{}{"hostname": "other"}}
+	if (&ActiveTaskInstance{Task: other}).leaseName() == instances[0].leaseName() {
+		t.Errorf("expected tasks with other attributes to have their own lease")
+	}
+
+	// the first replica takes the slot of this run, the second one must skip it without executing the action
+	release, err := instances[0].acquireLease(TaskTriggerSchedule)
+	if err != nil {
+		t.Fatalf("expected the first replica to run the task: %v", err)
+	}
+	defer release()
+
+	_, err = instances[1].Execute(TaskTriggerSchedule)
+	if err != ErrTaskLeaseHeld {
+		t.Errorf("expected the second replica to skip the run, got %v", err)
+	}
+}
+
+func TestTaskLeaseReturnsErrorsOtherThanAHeldLease(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	replicaA := newReplicaScheduler(t, db, "replica-a").lease
+	replicaB := newReplicaScheduler(t, db, "replica-b").lease
+
+	acquired, err := replicaA.Acquire("task.held", time.Now().Add(time.Minute))
+	if !acquired || err != nil {
+		t.Fatalf("expected the first replica to take the lease: %v %v", acquired, err)
+	}
+	acquired, err = replicaB.Acquire("task.held", time.Now().Add(time.Minute))
+	if acquired || err != nil {
+		t.Errorf("expected a lease held by another replica to be turned down without an error, got %v %v", acquired, err)
+	}
+
+	_, err = db.Exec("create trigger broken_lease before insert on _task_lease begin select raise(abort, 'broken'); end")
+	if err != nil {
+		t.Fatalf("failed to break the lease table: %v", err)
+	}
+	acquired, err = replicaB.Acquire("task.other", time.Now().Add(time.Minute))
+	if acquired || err == nil {
+		t.Errorf("expected a failed insert to be returned as an error, got %v %v", acquired, err)
+	}
+}
@@ -13,6 +13,11 @@ import (
 )
 
 func (res *DbResource) SyncStorageToPath(cloudStore CloudStore, cloudPath string, tempDirectoryPath string) error {
+	return res.SyncStorageToPathAndThen(cloudStore, cloudPath, tempDirectoryPath, nil)
+}
+
+// SyncStorageToPathAndThen copies the cloud store to the path in the background and calls done when the copy is over
+func (res *DbResource) SyncStorageToPathAndThen(cloudStore CloudStore, cloudPath string, tempDirectoryPath string, done func(err error)) error {
 
 	oauthTokenId := cloudStore.OAutoTokenId
 
@@ -61,6 +66,9 @@ func (res *DbResource) SyncStorageToPath(cloudStore CloudStore, cloudPath string
 			return nil
 		}
 		dir := sync.CopyDir(ctx, fdst, fsrc, true)
+		if done != nil {
+			done(dir)
+		}
 		return dir
 	})
 
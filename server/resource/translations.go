@@ -2,16 +2,137 @@ package resource
 
 import (
 	english "github.com/go-playground/locales/en"
+	french "github.com/go-playground/locales/fr"
+	indonesian "github.com/go-playground/locales/id"
+	japanese "github.com/go-playground/locales/ja"
+	dutch "github.com/go-playground/locales/nl"
+	portuguese "github.com/go-playground/locales/pt_BR"
+	chinese "github.com/go-playground/locales/zh"
 	"github.com/go-playground/universal-translator"
+	"gopkg.in/go-playground/validator.v9"
 	en2 "gopkg.in/go-playground/validator.v9/translations/en"
+	fr2 "gopkg.in/go-playground/validator.v9/translations/fr"
+	id2 "gopkg.in/go-playground/validator.v9/translations/id"
+	ja2 "gopkg.in/go-playground/validator.v9/translations/ja"
+	nl2 "gopkg.in/go-playground/validator.v9/translations/nl"
+	pt2 "gopkg.in/go-playground/validator.v9/translations/pt_BR"
+	zh2 "gopkg.in/go-playground/validator.v9/translations/zh"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// translationBundle is a language the validation errors are given in, the messages of the data validators are
+// added to the messages of the validator tags
+type translationBundle struct {
+	register func(v *validator.Validate, trans ut.Translator) error
+	messages map[string]string
+}
+
+var translationBundles = map[string]translationBundle{
+	"en": {en2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0} is already taken",
+		"db_referable": "{0} does not refer to a row which can be referred",
+	}},
+	"fr": {fr2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0} est déjà utilisé",
+		"db_referable": "{0} ne fait pas référence à une ligne qui peut être référencée",
+	}},
+	"nl": {nl2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0} is al in gebruik",
+		"db_referable": "{0} verwijst niet naar een rij waarnaar verwezen kan worden",
+	}},
+	"pt_BR": {pt2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0} já está em uso",
+		"db_referable": "{0} não se refere a uma linha que pode ser referenciada",
+	}},
+	"id": {id2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0} sudah digunakan",
+		"db_referable": "{0} tidak merujuk ke baris yang dapat dirujuk",
+	}},
+	"ja": {ja2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0}は既に使用されています",
+		"db_referable": "{0}は参照できる行を指していません",
+	}},
+	"zh": {zh2.RegisterDefaultTranslations, map[string]string{
+		"db_unique":    "{0}已被使用",
+		"db_referable": "{0}没有指向可以引用的行",
+	}},
+}
+
+var universalTranslator *ut.UniversalTranslator
+var registerTranslationsOnce sync.Once
+
+// RegisterTranslations registers the messages of every bundle with the validator, english being the fallback for
+// the languages without a bundle
 func RegisterTranslations() {
+	registerTranslationsOnce.Do(func() {
+
+		eng := english.New()
+		universalTranslator = ut.New(eng, eng, french.New(), dutch.New(), portuguese.New(), indonesian.New(),
+			japanese.New(), chinese.New())
+
+		for locale, bundle := range translationBundles {
+			trans, _ := universalTranslator.GetTranslator(locale)
+
+			err := bundle.register(ValidatorInstance, trans)
+			CheckErr(err, "Failed to register translations for [%v]", locale)
+
+			for key, message := range bundle.messages {
+				err = trans.Add(key, message, true)
+				CheckErr(err, "Failed to add translation [%v] for [%v]", key, locale)
+			}
+		}
+	})
+}
+
+// GetTranslator gives the translator of the most preferred language of an Accept-Language header which has a
+// bundle, english otherwise
+func GetTranslator(acceptLanguage string) ut.Translator {
+	RegisterTranslations()
+	trans, _ := universalTranslator.FindTranslator(AcceptedLocales(acceptLanguage)...)
+	return trans
+}
+
+// AcceptedLocales gives the locales of an Accept-Language header by preference, each region specific locale is
+// followed by its language
+func AcceptedLocales(acceptLanguage string) []string {
+
+	type acceptedLocale struct {
+		locale  string
+		quality float64
+	}
+
+	accepted := make([]acceptedLocale, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := strings.Replace(strings.TrimSpace(fields[0]), "-", "_", -1)
+		if locale == "" || locale == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		accepted = append(accepted, acceptedLocale{locale, quality})
+	}
 
-	eng := english.New()
-	uni := ut.New(eng, eng)
-	trans, _ := uni.GetTranslator("en")
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
 
-	err := en2.RegisterDefaultTranslations(ValidatorInstance, trans)
-	CheckErr(err, "Failed to register translactions")
+	locales := make([]string, 0)
+	for _, a := range accepted {
+		locales = append(locales, a.locale)
+		if i := strings.Index(a.locale, "_"); i > 0 {
+			locales = append(locales, a.locale[:i])
+		}
+	}
+	return locales
 }
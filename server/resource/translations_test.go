@@ -0,0 +1,53 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAcceptedLocales(t *testing.T) {
+
+	locales := AcceptedLocales("en;q=0.5, pt-BR, fr;q=0.8, *;q=0.1")
+	expected := []string{"pt_BR", "pt", "fr", "en"}
+	if !reflect.DeepEqual(locales, expected) {
+		t.Errorf("expected locales %v, got %v", expected, locales)
+	}
+
+	if len(AcceptedLocales("")) != 0 {
+		t.Errorf("expected no locales for an empty header")
+	}
+}
+
+func TestGetTranslator(t *testing.T) {
+
+	translations := map[string]string{
+		"":               "en",
+		"de-DE":          "en",
+		"fr-CA, en;q=.5": "fr",
+		"ja":             "ja",
+		"pt-BR":          "pt_BR",
+	}
+
+	for acceptLanguage, locale := range translations {
+		if translator := GetTranslator(acceptLanguage); translator.Locale() != locale {
+			t.Errorf("expected locale [%v] for [%v], got [%v]", locale, acceptLanguage, translator.Locale())
+		}
+	}
+
+	message, err := GetTranslator("nl").T("db_unique", "email")
+	if err != nil || message != "email is al in gebruik" {
+		t.Errorf("unexpected translation of db_unique: %v %v", message, err)
+	}
+}
+
+func TestSplitValidationTags(t *testing.T) {
+
+	tags, dataValidators := SplitValidationTags("required,db_unique,min=3,db_referable=user_account")
+	if tags != "required,min=3" {
+		t.Errorf("unexpected validator tags: %v", tags)
+	}
+	if len(dataValidators) != 2 || dataValidators[0].Tag != "db_unique" ||
+		dataValidators[1].Tag != "db_referable" || dataValidators[1].Param != "user_account" {
+		t.Errorf("unexpected data validators: %v", dataValidators)
+	}
+}
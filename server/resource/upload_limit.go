@@ -0,0 +1,46 @@
+package resource
+
+import (
+	"strings"
+)
+
+// UploadLimit restricts the files which can be uploaded to a file column, declared on a table as {"ColumnName":
+// "video", "MaxSize": 104857600, "MimeTypes": ["video/*"]}. A zero MaxSize uses the upload.max.size config and an
+// empty MimeTypes list allows any file
+type UploadLimit struct {
+	ColumnName string
+	MaxSize    int64
+	MimeTypes  []string
+}
+
+// UploadLimitFor is the limit declared for the column, or a limit without restrictions
+func (ti *TableInfo) UploadLimitFor(columnName string) UploadLimit {
+	for _, limit := range ti.UploadLimits {
+		if limit.ColumnName == columnName {
+			return limit
+		}
+	}
+	return UploadLimit{
+		ColumnName: columnName,
+	}
+}
+
+// AllowsMimeType checks the mime type against the allowed list, entries like image/* allow every subtype
+func (l UploadLimit) AllowsMimeType(mimeType string) bool {
+
+	if len(l.MimeTypes) == 0 {
+		return true
+	}
+
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	for _, allowed := range l.MimeTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == mimeType || allowed == "*/*" {
+			return true
+		}
+		if prefix, ok := EndsWith(allowed, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
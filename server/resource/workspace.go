@@ -0,0 +1,121 @@
+package resource
+
+import (
+	"database/sql"
+	"github.com/Masterminds/squirrel"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"net/http"
+	"strings"
+)
+
+// Workspace roles, the administrators of a workspace can do anything with the rows of the workspace
+const (
+	WorkspaceRoleMember = "member"
+	WorkspaceRoleAdmin  = "admin"
+)
+
+// workspaceScopedStandardTables are the system tables which hold data of a workspace, the other system tables are
+// shared by every workspace
+var workspaceScopedStandardTables = map[string]bool{
+	"cloud_store":   true,
+	"site":          true,
+	"site_revision": true,
+	"site_domain":   true,
+	"mail_server":   true,
+	"mail_account":  true,
+	"mail_box":      true,
+	"mail":          true,
+}
+
+// IsWorkspaceScopedTable tells if the rows of a table belong to a workspace. Every table defined in a schema is
+// scoped, along with the system tables which hold the sites and mails
+func IsWorkspaceScopedTable(tableName string) bool {
+	if scoped, ok := workspaceScopedStandardTables[tableName]; ok {
+		return scoped
+	}
+	if tableName == USER_ACCOUNT_TABLE_NAME || strings.Index(tableName, "_has_") > -1 ||
+		EndsWithCheck(tableName, "_audit") || EndsWithCheck(tableName, "_state") {
+		return false
+	}
+	for _, table := range StandardTables {
+		if table.TableName == tableName {
+			return false
+		}
+	}
+	return true
+}
+
+// GetWorkspace gives the workspace the request works in, nil for the default workspace
+func GetWorkspace(req *http.Request) *auth.SessionWorkspace {
+	if req == nil {
+		return nil
+	}
+	workspace, _ := req.Context().Value("workspace").(*auth.SessionWorkspace)
+	return workspace
+}
+
+// IsWorkspaceScoped tells if the rows of the table belong to a workspace, the members of a workspace refer to it
+// without being scoped to it
+func (dr *DbResource) IsWorkspaceScoped() bool {
+	return IsWorkspaceScopedTable(dr.model.GetName()) && dr.model.HasColumn(WORKSPACE_ID_COLUMN)
+}
+
+// IsWorkspaceAdmin tells if the user is an administrator of the workspace of the request, which makes them an
+// administrator of the rows of the table in that workspace
+func (dr *DbResource) IsWorkspaceAdmin(req *http.Request) bool {
+	workspace := GetWorkspace(req)
+	return workspace != nil && workspace.IsAdmin && dr.IsWorkspaceScoped()
+}
+
+// WorkspaceCondition matches the rows of the workspace of the request, rows without a workspace are in the default
+// workspace
+func WorkspaceCondition(req *http.Request, prefix string) squirrel.Sqlizer {
+	workspace := GetWorkspace(req)
+	if workspace == nil {
+		return squirrel.Eq{prefix + WORKSPACE_ID_COLUMN: nil}
+	}
+	return squirrel.Eq{prefix + WORKSPACE_ID_COLUMN: workspace.WorkspaceId}
+}
+
+// ScopeToWorkspace limits a query of the table to the rows of the workspace of the request. The lists, single rows,
+// aggregates and lookups of the rows of a table are all read through it. A read the server makes on its own, without
+// a request, is not scoped
+func (dr *DbResource) ScopeToWorkspace(query squirrel.SelectBuilder, req *http.Request, prefix string) squirrel.SelectBuilder {
+	if req == nil || !dr.IsWorkspaceScoped() {
+		return query
+	}
+	return query.Where(WorkspaceCondition(req, prefix))
+}
+
+// GetRowWorkspaceId gives the id of the workspace of a row, 0 for the default workspace
+func (dr *DbResource) GetRowWorkspaceId(typeName string, referenceId string) (int64, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select(WORKSPACE_ID_COLUMN).From(typeName).
+		Where(squirrel.Eq{"reference_id": referenceId}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var workspaceId sql.NullInt64
+	err = dr.db.QueryRowx(s, v...).Scan(&workspaceId)
+	return workspaceId.Int64, err
+}
+
+// GetWorkspaceRole gives the role of the user in the enabled workspace with the slug
+func (dr *DbResource) GetWorkspaceRole(slug string, userReferenceId string) (string, error) {
+
+	s, v, err := statementbuilder.Squirrel.Select("m.role").From("workspace_member m").
+		Join("workspace w on w.id = m.workspace_id").
+		Join(USER_ACCOUNT_TABLE_NAME + " u on u.id = m.member_id").
+		Where(squirrel.Eq{"w.slug": slug}).
+		Where(squirrel.Eq{"w.enable": true}).
+		Where(squirrel.Eq{"u.reference_id": userReferenceId}).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var role string
+	err = dr.db.QueryRowx(s, v...).Scan(&role)
+	return role, err
+}
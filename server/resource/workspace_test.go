@@ -0,0 +1,174 @@
+package resource
+
+import (
+	"context"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"testing"
+)
+
+func TestIsWorkspaceScopedTable(t *testing.T) {
+
+	tables := map[string]bool{
+		"gallery_image": true,
+		"site":          true,
+		"mail":          true,
+		"user_account":  false,
+		"usergroup":     false,
+		"world":         false,
+		"workspace":     false,
+		"todo_audit":    false,
+		"todo_state":    false,
+		"todo_todo_id_has_usergroup_usergroup_id": false,
+	}
+
+	for tableName, scoped := range tables {
+		if IsWorkspaceScopedTable(tableName) != scoped {
+			t.Errorf("expected [%v] to be scoped: %v", tableName, scoped)
+		}
+	}
+}
+
+func TestWorkspaceCondition(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+
+	req, _ := http.NewRequest("GET", "/api/todo", nil)
+	query, args, _ := statementbuilder.Squirrel.Select("id").From("todo").Where(WorkspaceCondition(req, "todo.")).ToSql()
+	if query != "SELECT id FROM todo WHERE todo.workspace_id IS NULL" || len(args) != 0 {
+		t.Errorf("unexpected query for the default workspace: %v %v", query, args)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), "workspace", &auth.SessionWorkspace{WorkspaceId: 4, Slug: "acme"}))
+	query, args, _ = statementbuilder.Squirrel.Select("id").From("todo").Where(WorkspaceCondition(req, "todo.")).ToSql()
+	if query != "SELECT id FROM todo WHERE todo.workspace_id = ?" || len(args) != 1 || args[0] != int64(4) {
+		t.Errorf("unexpected query for a workspace: %v %v", query, args)
+	}
+}
+
+func TestReadsAreScopedToTheWorkspace(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table sale (id integer primary key, reference_id varchar(40), workspace_id int, region varchar(100), amount int)",
+		"insert into sale (reference_id, workspace_id, region, amount) values ('s1', 1, 'east', 10), ('s2', 1, 'west', 20)",
+		"insert into sale (reference_id, workspace_id, region, amount) values ('s3', 2, 'east', 400), ('s4', null, 'east', 5000)",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	table := TableInfo{
+		TableName: "sale",
+		Columns: []api2go.ColumnInfo{
+			{Name: "id", ColumnName: "id", ColumnType: "id"},
+			{Name: "reference_id", ColumnName: "reference_id", ColumnType: "alias"},
+			{Name: "workspace_id", ColumnName: WORKSPACE_ID_COLUMN, ColumnType: "alias"},
+			{Name: "region", ColumnName: "region", ColumnType: "label"},
+			{Name: "amount", ColumnName: "amount", ColumnType: "measurement"},
+		},
+	}
+	cruds := make(map[string]*DbResource)
+	crud := NewDbResource(api2go.NewApi2GoModel(table.TableName, table.Columns, 0, nil), db, nil, cruds, nil, table)
+	cruds[table.TableName] = crud
+
+	inWorkspace := func(workspaceId int64) *http.Request {
+		req, _ := http.NewRequest("GET", "/aggregate/sale", nil)
+		if workspaceId != 0 {
+			req = req.WithContext(context.WithValue(req.Context(), "workspace", &auth.SessionWorkspace{WorkspaceId: workspaceId}))
+		}
+		return req
+	}
+
+	expected := map[int64]int64{1: 30, 2: 400, 0: 5000}
+	for workspaceId, total := range expected {
+		aggregate, err := crud.DataStats(AggregationRequest{
+			RootEntity:    "sale",
+			ProjectColumn: []string{"sum(amount) as total"},
+			Query:         []Query{{ColumnName: "region", Operator: "in", Value: []interface{}{"east", "west"}}},
+			PlainRequest:  inWorkspace(workspaceId),
+		})
+		if err != nil {
+			t.Fatalf("failed to aggregate: %v", err)
+		}
+		if len(aggregate.Data) != 1 || aggregate.Data[0]["total"] != total {
+			t.Errorf("expected a total of %d in workspace %d, got %v", total, workspaceId, aggregate.Data)
+		}
+	}
+
+	row, err := crud.GetObjectByWhereClause("sale", "reference_id", "s3", inWorkspace(1))
+	if err != nil || row != nil {
+		t.Errorf("expected a row of another workspace to not be found, got %v: %v", row, err)
+	}
+	row, err = crud.GetObjectByWhereClause("sale", "reference_id", "s3", inWorkspace(2))
+	if err != nil || row == nil {
+		t.Errorf("expected a row of the workspace to be found, got %v: %v", row, err)
+	}
+	_, _, err = crud.GetSingleRowByReferenceId("sale", "s1", inWorkspace(2))
+	if err == nil {
+		t.Errorf("expected a row of another workspace to not be read")
+	}
+}
+
+func TestEmptyFilterIsScopedToTheWorkspace(t *testing.T) {
+
+	statementbuilder.InitialiseStatementBuilder("sqlite3")
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{
+		"create table sale (id integer primary key, reference_id varchar(40), workspace_id int, region varchar(100))",
+		"insert into sale (reference_id, workspace_id, region) values ('s1', 1, null), ('s2', 1, ''), ('s3', 1, 'east')",
+		"insert into sale (reference_id, workspace_id, region) values ('s4', 2, null), ('s5', 2, '')",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("failed to prepare database: %v", err)
+		}
+	}
+
+	table := TableInfo{
+		TableName: "sale",
+		Columns: []api2go.ColumnInfo{
+			{Name: "id", ColumnName: "id", ColumnType: "id"},
+			{Name: "reference_id", ColumnName: "reference_id", ColumnType: "alias"},
+			{Name: "workspace_id", ColumnName: WORKSPACE_ID_COLUMN, ColumnType: "alias"},
+			{Name: "region", ColumnName: "region", ColumnType: "label"},
+		},
+	}
+	crud := NewDbResource(api2go.NewApi2GoModel(table.TableName, table.Columns, 0, nil), db, nil, map[string]*DbResource{}, nil, table)
+
+	req, _ := http.NewRequest("GET", "/api/sale", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "workspace", &auth.SessionWorkspace{WorkspaceId: 1}))
+
+	query := statementbuilder.Squirrel.Select("reference_id").From("sale").OrderBy("reference_id")
+	query = crud.addFilters(query, []Query{{ColumnName: "region", Operator: "is empty"}}, "")
+	query = crud.ScopeToWorkspace(query, req, "")
+	s, v, err := query.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	err = db.Select(&found, s, v...)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	if len(found) != 2 || found[0] != "s1" || found[1] != "s2" {
+		t.Errorf("expected only the empty rows of the workspace, got %v", found)
+	}
+}
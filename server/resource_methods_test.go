@@ -40,7 +40,7 @@ func GetResource() (*InMemoryTestDatabase, *resource.DbResource) {
 
 	cruds := make(map[string]*resource.DbResource)
 
-	ms := BuildMiddlewareSet(&initConfig, &cruds)
+	ms := BuildMiddlewareSet(&initConfig, &cruds, resource.NewTaskScheduler(&initConfig, cruds, configStore, wrapper), resource.NewLocalInvalidationBus())
 	for _, table := range initConfig.Tables {
 		model := api2go.NewApi2GoModel(table.TableName, table.Columns, int64(table.DefaultPermission), table.Relations)
 		res := resource.NewDbResource(model, wrapper, &ms, cruds, configStore, table)
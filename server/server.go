@@ -3,6 +3,7 @@ package server
 import (
 	"crypto/tls"
 	"fmt"
+	"github.com/Masterminds/squirrel"
 	"github.com/artpar/api2go"
 	"github.com/artpar/api2go-adapter/gingonic"
 	"github.com/artpar/go-guerrilla"
@@ -34,7 +35,7 @@ import (
 var TaskScheduler resource.TaskScheduler
 var Stats = stats.New()
 
-func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch, *guerrilla.Daemon, resource.TaskScheduler, *resource.ConfigStore) {
+func Main(boxRoot http.FileSystem, db database.DatabaseConnection, invalidationBus resource.InvalidationBus) (HostSwitch, *guerrilla.Daemon, resource.TaskScheduler, *resource.ConfigStore) {
 
 	/// Start system initialise
 	log.Infof("Load config files")
@@ -59,6 +60,10 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch,
 
 	initialiseResources(&initConfig, db)
 
+	if !resource.HasJsonFunctions(db) {
+		log.Errorf("The database has no json functions, filters on json paths are rejected. Build with -tags sqlite_json to use them on sqlite")
+	}
+
 	/// end system initialise
 
 	defaultRouter := gin.Default()
@@ -129,6 +134,7 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch,
 
 	configStore, err := resource.NewConfigStore(db)
 	resource.CheckErr(err, "Failed to get config store")
+	configStore.SetInvalidationBus(invalidationBus)
 
 	hostname, err := configStore.GetConfigValueFor("hostname", "backend")
 	if err != nil {
@@ -224,8 +230,6 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch,
 	err = CheckSystemSecrets(configStore)
 	resource.CheckErr(err, "Failed to initialise system secrets")
 
-	defaultRouter.GET("/config", CreateConfigHandler(configStore))
-
 	jwtTokenIssuer, err := configStore.GetConfigValueFor("jwt.token.issuer", "backend")
 	resource.CheckErr(err, "No default jwt token issuer set")
 	if err != nil {
@@ -234,8 +238,12 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch,
 		err = configStore.SetConfigValueFor("jwt.token.issuer", jwtTokenIssuer, "backend")
 	}
 	authMiddleware := auth.NewAuthMiddlewareBuilder(db, jwtTokenIssuer)
+	// workspaces are resolved from the subdomains of this domain, like acme.example.com for example.com
+	workspaceBaseDomain, _ := configStore.GetConfigValueFor("workspace.base.domain", "backend")
+	authMiddleware.SetWorkspaceBaseDomain(workspaceBaseDomain)
 	auth.InitJwtMiddleware([]byte(jwtSecret), jwtTokenIssuer)
 	defaultRouter.Use(authMiddleware.AuthCheckMiddleware)
+	defaultRouter.GET("/config", CreateConfigHandler(configStore))
 
 	cruds := make(map[string]*resource.DbResource)
 	defaultRouter.GET("/actions", resource.CreateGuestActionListHandler(&initConfig))
@@ -246,7 +254,9 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection) (HostSwitch,
 		gingonic.New(defaultRouter),
 	)
 
-	ms := BuildMiddlewareSet(&initConfig, &cruds)
+	TaskScheduler = resource.NewTaskScheduler(&initConfig, cruds, configStore, db)
+
+	ms := BuildMiddlewareSet(&initConfig, &cruds, TaskScheduler, invalidationBus)
 	cruds = AddResourcesToApi2Go(api, initConfig.Tables, db, &ms, configStore, cruds)
 
 	rcloneRetries, err := configStore.GetConfigIntValueFor("rclone.retries", "backend")
@@ -401,7 +411,7 @@ fagus7nZFuPIRAU1dz5Ni1g=
 		}
 	}
 
-	actionPerformers := GetActionPerformers(&initConfig, configStore, cruds, mailDaemon)
+	actionPerformers := GetActionPerformers(&initConfig, configStore, cruds, mailDaemon, TaskScheduler)
 	initConfig.ActionPerformers = actionPerformers
 
 	AddStreamsToApi2Go(api, streamProcessors, db, &ms, configStore)
@@ -414,8 +424,6 @@ fagus7nZFuPIRAU1dz5Ni1g=
 
 	resource.ImportDataFiles(initConfig.Imports, db, cruds)
 
-	TaskScheduler = resource.NewTaskScheduler(&initConfig, cruds, configStore)
-
 	err = TaskScheduler.AddTask(resource.Task{
 		EntityName:  "mail_server",
 		ActionName:  "sync_mail_servers",
@@ -424,14 +432,67 @@ fagus7nZFuPIRAU1dz5Ni1g=
 		Schedule:    "@every 1h",
 	})
 
+	err = TaskScheduler.AddTask(resource.Task{
+		EntityName:  "smd",
+		ActionName:  "run_state_timers",
+		Attributes:  map[string]interface{}{},
+		AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+		Schedule:    "@every 1m",
+	})
+
+	// exchanges which pull from a source run on their schedule
+	for _, exchange := range initConfig.ExchangeContracts {
+		schedule, ok := exchange.Options["schedule"].(string)
+		if !ok || schedule == "" || exchange.SourceType == "self" {
+			continue
+		}
+		err = TaskScheduler.AddTask(resource.Task{
+			EntityName: "data_exchange",
+			ActionName: "run_exchange",
+			Attributes: map[string]interface{}{
+				"data_exchange_id": exchange.ReferenceId,
+			},
+			AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+			Schedule:    schedule,
+		})
+		resource.CheckErr(err, "Failed to schedule exchange [%v]", exchange.Name)
+	}
+
+	// materialised streams are refreshed on their schedule
+	for _, stream := range initConfig.Streams {
+		if stream.Materialize == nil || stream.Materialize.Schedule == "" {
+			continue
+		}
+		streamIds, err := cruds["stream"].GetReferenceIdByWhereClause("stream", squirrel.Eq{"stream_name": stream.StreamName})
+		if err != nil || len(streamIds) == 0 {
+			log.Errorf("Failed to find stream [%v] to schedule its refresh: %v", stream.StreamName, err)
+			continue
+		}
+		err = TaskScheduler.AddTask(resource.Task{
+			EntityName: "stream",
+			ActionName: "refresh_stream",
+			Attributes: map[string]interface{}{
+				"stream_id": streamIds[0],
+			},
+			AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+			Schedule:    stream.Materialize.Schedule,
+		})
+		resource.CheckErr(err, "Failed to schedule refresh of stream [%v]", stream.StreamName)
+	}
+
 	TaskScheduler.StartTasks()
 
-	hostSwitch := CreateSubSites(&initConfig, db, cruds, authMiddleware)
+	urlSigner := resource.NewUrlSigner(configStore, cruds[resource.USER_ACCOUNT_TABLE_NAME])
+	hostSwitch := CreateSubSites(&initConfig, db, cruds, authMiddleware, resource.NewDomainVerifier(configStore))
+	hostSwitch.urlSigner = urlSigner
 	assetColumnFolders := CreateAssetColumnSync(&initConfig, db, cruds, authMiddleware)
 	for k := range cruds {
 		cruds[k].AssetFolderCache = assetColumnFolders
 	}
 
+	SubscribeInvalidations(invalidationBus, &initConfig, cruds, TaskScheduler, authMiddleware)
+	invalidationBus.Start()
+
 	hostSwitch.handlerMap["api"] = defaultRouter
 	hostSwitch.handlerMap["dashboard"] = defaultRouter
 
@@ -452,9 +513,12 @@ fagus7nZFuPIRAU1dz5Ni1g=
 	statsHandler := CreateStatsHandler(&initConfig, cruds)
 	resource.InitialiseColumnManager()
 
-	dbAssetHandler := CreateDbAssetHandler(&initConfig, cruds)
+	dbAssetHandler := CreateDbAssetHandler(&initConfig, cruds, configStore, urlSigner)
 	defaultRouter.GET("/asset/:typename/:resource_id/:columnname", dbAssetHandler)
 
+	uploadHandler := CreateTusUploadHandler(cruds, configStore, urlSigner)
+	uploadHandler.Register(defaultRouter)
+
 	resource.RegisterTranslations()
 
 	if initConfig.EnableGraphQL {
@@ -507,11 +571,15 @@ fagus7nZFuPIRAU1dz5Ni1g=
 
 	defaultRouter.POST("/track/start/:stateMachineId", CreateEventStartHandler(fsmManager, cruds, db))
 	defaultRouter.POST("/track/event/:typename/:objectStateId/:eventName", CreateEventHandler(&initConfig, fsmManager, cruds, db))
+	defaultRouter.GET("/track/events/:typename/:objectStateId", CreateAllowedEventsHandler(fsmManager, cruds))
+	defaultRouter.GET("/track/history/:typename/:objectStateId", CreateStateHistoryHandler(fsmManager, cruds))
+	defaultRouter.GET("/track/machine/:stateMachineId/:format", CreateStateMachineExportHandler(fsmManager, cruds))
 
 	loader := CreateSubSiteContentHandler(&initConfig, cruds, db)
 	defaultRouter.POST("/site/content/load", loader)
 	defaultRouter.GET("/site/content/load", loader)
 	defaultRouter.POST("/site/content/store", CreateSubSiteSaveContentHandler(&initConfig, cruds, db))
+	defaultRouter.GET("/site/content/preview/:revision_id", CreateSiteRevisionPreviewHandler(cruds))
 
 	//webSocketConnectionHandler := WebSocketConnectionHandlerImpl{}
 	//websocketServer := websockets.NewServer("/live", &webSocketConnectionHandler)
@@ -609,6 +677,12 @@ func initialiseResources(initConfig *resource.CmsConfig, db database.DatabaseCon
 	errc = tx.Commit()
 	resource.CheckErr(errc, "Failed to commit transaction after creating indexes")
 
+	tx, errb = db.Beginx()
+	resource.CheckErr(errb, "Failed to begin transaction")
+	resource.CreateJsonIndexes(initConfig, tx)
+	errc = tx.Commit()
+	resource.CheckErr(errc, "Failed to commit transaction after creating json indexes")
+
 	tx, errb = db.Beginx()
 	resource.CheckErr(errb, "Failed to begin transaction")
 	resource.UpdateWorldTable(initConfig, tx)
@@ -710,6 +784,8 @@ func MergeTables(existingTables []resource.TableInfo, initConfigTables []resourc
 			existableTable.DefaultGroups = tableBeingModified.DefaultGroups
 			existableTable.Conformations = tableBeingModified.Conformations
 			existableTable.Validations = tableBeingModified.Validations
+			existableTable.JsonIndexes = tableBeingModified.JsonIndexes
+			existableTable.UploadLimits = tableBeingModified.UploadLimits
 			existingTables[j] = existableTable
 		} else {
 			//log.Infof("Table %s is not being modified", existableTable.TableName)
@@ -754,6 +830,9 @@ func AddStreamsToApi2Go(api *api2go.API, processors []*resource.StreamProcessor,
 	for _, processor := range processors {
 
 		contract := processor.GetContract()
+		if contract.Materialize != nil {
+			continue
+		}
 		model := api2go.NewApi2GoModel(contract.StreamName, contract.Columns, 0, nil)
 		api.AddResource(model, processor)
 
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSiteFileCacheSize is the memory for the hot files of a site when its serve config does not set it
+const defaultSiteFileCacheSize = 32 << 20
+
+// maxSiteCachedFileSize is the largest file kept in memory or compressed on the fly, larger files are sent from disk
+const maxSiteCachedFileSize = 1 << 20
+
+type siteFile struct {
+	key         string
+	contents    []byte
+	contentType string
+	etag        string
+	modTime     time.Time
+	sourceSize  int64
+}
+
+// SiteFileCache keeps the files of a site served last in memory, the least recently used files are dropped when the
+// cache is over its size
+type SiteFileCache struct {
+	lock    sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func NewSiteFileCache(maxSize int64) *SiteFileCache {
+	return &SiteFileCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get gives the cached file if it is still the same as the file on disk
+func (fc *SiteFileCache) Get(key string, modTime time.Time, size int64) (*siteFile, bool) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	element, ok := fc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	file := element.Value.(*siteFile)
+	if !file.modTime.Equal(modTime) || file.sourceSize != size {
+		fc.remove(element)
+		return nil, false
+	}
+	fc.order.MoveToFront(element)
+	return file, true
+}
+
+func (fc *SiteFileCache) Put(file *siteFile) {
+	if int64(len(file.contents)) > fc.maxSize {
+		return
+	}
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if element, ok := fc.entries[file.key]; ok {
+		fc.remove(element)
+	}
+	fc.entries[file.key] = fc.order.PushFront(file)
+	fc.size += int64(len(file.contents))
+
+	for fc.size > fc.maxSize {
+		fc.remove(fc.order.Back())
+	}
+}
+
+func (fc *SiteFileCache) remove(element *list.Element) {
+	file := fc.order.Remove(element).(*siteFile)
+	delete(fc.entries, file.key)
+	fc.size -= int64(len(file.contents))
+}
+
+// SiteServer serves the files of a site with the headers, compression, caching and fallback pages of its serve
+// config
+type SiteServer struct {
+	config resource.SiteServeConfig
+	root   string
+	files  *SiteFileCache
+}
+
+func NewSiteServer(config resource.SiteServeConfig, root string) *SiteServer {
+	ss := &SiteServer{
+		config: config,
+		root:   root,
+	}
+	if config.FileCacheSize == 0 {
+		ss.files = NewSiteFileCache(defaultSiteFileCacheSize)
+	} else if config.FileCacheSize > 0 {
+		ss.files = NewSiteFileCache(config.FileCacheSize)
+	}
+	return ss
+}
+
+// Headers sets the security and cors headers of the site, and answers the preflight requests of allowed origins
+func (ss *SiteServer) Headers(c *gin.Context) {
+	header := c.Writer.Header()
+	if ss.config.ContentSecurityPolicy != "" {
+		header.Set("Content-Security-Policy", ss.config.ContentSecurityPolicy)
+	}
+	if ss.config.StrictTransportSecurity != "" {
+		header.Set("Strict-Transport-Security", ss.config.StrictTransportSecurity)
+	}
+	if ss.config.FrameOptions != "" {
+		header.Set("X-Frame-Options", ss.config.FrameOptions)
+	}
+	for name, value := range ss.config.Headers {
+		header.Set(name, value)
+	}
+
+	if len(ss.config.CorsOrigins) > 0 {
+		header.Add("Vary", "Origin")
+	}
+	origin := c.GetHeader("Origin")
+	if origin != "" && ss.config.AllowsOrigin(origin) {
+		// any origin can read the site, but only the origins listed by name can read it with the cookies of the user
+		if ss.config.ListsOrigin(origin) {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		if c.Request.Method == "OPTIONS" {
+			header.Set("Access-Control-Allow-Methods", "GET,HEAD,POST,OPTIONS")
+			if requestHeaders := c.GetHeader("Access-Control-Request-Headers"); requestHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", requestHeaders)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+	}
+	c.Next()
+}
+
+// Files serves the file at the path of the request when there is one, a folder is served by its index.html
+func (ss *SiteServer) Files(c *gin.Context) {
+	if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+		return
+	}
+
+	filePath := path.Clean("/" + c.Request.URL.Path)
+	stat, err := os.Stat(ss.fullPath(filePath))
+	if err != nil {
+		return
+	}
+	if stat.IsDir() {
+		if !strings.HasSuffix(c.Request.URL.Path, "/") {
+			// relative, so the redirect works for sites served under a folder as well
+			c.Header("Location", path.Base(filePath)+"/")
+			c.AbortWithStatus(http.StatusMovedPermanently)
+			return
+		}
+		filePath = path.Join(filePath, "index.html")
+		stat, err = os.Stat(ss.fullPath(filePath))
+		if err != nil || stat.IsDir() {
+			return
+		}
+	}
+
+	ss.serveFile(c, filePath, stat, http.StatusOK)
+}
+
+// NotFound serves the not found page or the fallback page of the site, it returns false when the site has neither
+func (ss *SiteServer) NotFound(c *gin.Context) bool {
+	page, status := ss.config.NotFoundPage, http.StatusNotFound
+	if page == "" {
+		page, status = ss.config.FallbackPage, http.StatusOK
+	}
+	if page == "" {
+		return false
+	}
+
+	filePath := path.Clean("/" + page)
+	stat, err := os.Stat(ss.fullPath(filePath))
+	if err != nil || stat.IsDir() {
+		c.AbortWithStatus(http.StatusNotFound)
+		return true
+	}
+	ss.serveFile(c, filePath, stat, status)
+	return true
+}
+
+func (ss *SiteServer) fullPath(filePath string) string {
+	return filepath.Join(ss.root, filepath.FromSlash(filePath))
+}
+
+func (ss *SiteServer) serveFile(c *gin.Context, filePath string, stat os.FileInfo, status int) {
+
+	header := c.Writer.Header()
+	if cacheControl := ss.config.CacheControlFor(filePath); cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	servedPath := ss.fullPath(filePath)
+	encoding := ""
+	acceptEncoding := c.GetHeader("Accept-Encoding")
+	if ss.config.Compresses("br") && acceptsEncoding(acceptEncoding, "br") {
+		if brotliStat, err := os.Stat(servedPath + ".br"); err == nil && !brotliStat.IsDir() {
+			servedPath, stat, encoding = servedPath+".br", brotliStat, "br"
+		}
+	}
+	gzipContents := encoding == "" && ss.config.Compresses("gzip") && acceptsEncoding(acceptEncoding, "gzip") &&
+		compressibleContentType(contentType) && stat.Size() <= maxSiteCachedFileSize
+	if gzipContents {
+		encoding = "gzip"
+	}
+	if len(ss.config.Compression) > 0 {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Set("Content-Type", contentType)
+
+	key := servedPath + ":" + encoding
+	var file *siteFile
+	ok := false
+	if ss.files != nil {
+		file, ok = ss.files.Get(key, stat.ModTime(), stat.Size())
+	}
+
+	if !ok {
+		if stat.Size() > maxSiteCachedFileSize {
+			ss.serveFromDisk(c, servedPath, filePath, stat, status)
+			return
+		}
+
+		contents, err := ioutil.ReadFile(servedPath)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if gzipContents {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			writer.Write(contents)
+			writer.Close()
+			contents = compressed.Bytes()
+		}
+		etag, _ := Etag(contents)
+		file = &siteFile{
+			key:         key,
+			contents:    contents,
+			contentType: contentType,
+			etag:        etag,
+			modTime:     stat.ModTime(),
+			sourceSize:  stat.Size(),
+		}
+		if ss.files != nil {
+			ss.files.Put(file)
+		}
+	}
+
+	header.Set("ETag", file.etag)
+	if status == http.StatusOK {
+		http.ServeContent(c.Writer, c.Request, filePath, file.modTime, bytes.NewReader(file.contents))
+	} else {
+		c.Data(status, file.contentType, file.contents)
+	}
+	c.Abort()
+}
+
+func (ss *SiteServer) serveFromDisk(c *gin.Context, servedPath string, filePath string, stat os.FileInfo, status int) {
+	f, err := os.Open(servedPath)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	if status == http.StatusOK {
+		http.ServeContent(c.Writer, c.Request, filePath, stat.ModTime(), f)
+	} else {
+		c.DataFromReader(status, stat.Size(), c.Writer.Header().Get("Content-Type"), f, nil)
+	}
+	c.Abort()
+}
+
+// acceptsEncoding tells if the Accept-Encoding header allows the encoding
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		values := strings.Split(part, ";")
+		if strings.TrimSpace(values[0]) != encoding {
+			continue
+		}
+		for _, param := range values[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func compressibleContentType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	if strings.HasPrefix(contentType, "text/") || strings.HasSuffix(contentType, "+xml") || strings.HasSuffix(contentType, "+json") {
+		return true
+	}
+	switch contentType {
+	case "application/javascript", "application/json", "application/xml", "application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteFileCache(t *testing.T) {
+	cache := NewSiteFileCache(10)
+	now := time.Now()
+	cache.Put(&siteFile{key: "a", contents: []byte("12345"), modTime: now, sourceSize: 5})
+	cache.Put(&siteFile{key: "b", contents: []byte("12345"), modTime: now, sourceSize: 5})
+	if _, ok := cache.Get("a", now, 5); !ok {
+		t.Fatalf("expected a in cache")
+	}
+	cache.Put(&siteFile{key: "c", contents: []byte("12345"), modTime: now, sourceSize: 5})
+	if _, ok := cache.Get("b", now, 5); ok {
+		t.Errorf("least recently used file should be dropped")
+	}
+	if _, ok := cache.Get("a", now.Add(time.Second), 5); ok {
+		t.Errorf("changed file should not be served from cache")
+	}
+}
+
+func TestSiteServer(t *testing.T) {
+
+	root, _ := ioutil.TempDir("", "site-serving")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "app.js"), []byte(strings.Repeat("console.log(1);", 100)), 0644)
+	ioutil.WriteFile(filepath.Join(root, "docs", "index.html"), []byte("<h1>docs</h1>"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "404.html"), []byte("missing"), 0644)
+
+	var config resource.SiteServeConfig
+	err := config.Scan(`{"Compression": ["gzip"], "CacheControl": [{"Path": "*.js", "Value": "max-age=60"}],
+		"FrameOptions": "DENY", "NotFoundPage": "/404.html", "CorsOrigins": ["https://example.com"]}`)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	siteServer := NewSiteServer(config, root)
+	router := gin.New()
+	router.Use(siteServer.Headers)
+	router.Use(siteServer.Files)
+	router.NoRoute(func(c *gin.Context) {
+		siteServer.NotFound(c)
+	})
+
+	request := httptest.NewRequest("GET", "/app.js", nil)
+	request.Header.Set("Accept-Encoding", "gzip, deflate")
+	request.Header.Set("Origin", "https://example.com")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	if response.Code != 200 || response.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzipped file, got %v %v", response.Code, response.Header())
+	}
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	contents, _ := ioutil.ReadAll(reader)
+	if !strings.HasPrefix(string(contents), "console.log") {
+		t.Errorf("unexpected contents %s", contents)
+	}
+	if response.Header().Get("Cache-Control") != "max-age=60" || response.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("expected site headers, got %v", response.Header())
+	}
+	if response.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("expected cors header, got %v", response.Header())
+	}
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/docs", nil))
+	if response.Code != http.StatusMovedPermanently || response.Header().Get("Location") != "docs/" {
+		t.Errorf("expected redirect to folder, got %v %v", response.Code, response.Header())
+	}
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/docs/", nil))
+	if response.Code != 200 || response.Body.String() != "<h1>docs</h1>" {
+		t.Errorf("expected folder index, got %v %v", response.Code, response.Body.String())
+	}
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/nothing", nil))
+	if response.Code != 404 || response.Body.String() != "missing" {
+		t.Errorf("expected not found page, got %v %v", response.Code, response.Body.String())
+	}
+
+	request = httptest.NewRequest("OPTIONS", "/app.js", nil)
+	request.Header.Set("Origin", "https://other.com")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("origin should not be allowed")
+	}
+}
+
+func TestSiteServerCors(t *testing.T) {
+
+	cases := []struct {
+		origins     []string
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{[]string{"*"}, "https://example.com", "*", ""},
+		{[]string{"*", "https://app.example.com"}, "https://app.example.com", "https://app.example.com", "true"},
+		{[]string{"https://app.example.com"}, "https://example.com", "", ""},
+		{[]string{"https://app.example.com"}, "", "", ""},
+	}
+
+	for _, cors := range cases {
+		siteServer := NewSiteServer(resource.SiteServeConfig{CorsOrigins: cors.origins}, "")
+		router := gin.New()
+		router.Use(siteServer.Headers)
+		router.GET("/", func(c *gin.Context) {
+			c.String(200, "home")
+		})
+
+		request := httptest.NewRequest("GET", "/", nil)
+		if cors.origin != "" {
+			request.Header.Set("Origin", cors.origin)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		header := response.Header()
+		if header.Get("Access-Control-Allow-Origin") != cors.allowOrigin || header.Get("Access-Control-Allow-Credentials") != cors.credentials {
+			t.Errorf("expected origin [%v] of %v to be allowed as [%v] with credentials [%v], got %v", cors.origin, cors.origins, cors.allowOrigin, cors.credentials, header)
+		}
+		if header.Get("Vary") != "Origin" {
+			t.Errorf("expected the response to vary by origin, got %v", header)
+		}
+	}
+
+	siteServer := NewSiteServer(resource.SiteServeConfig{}, "")
+	router := gin.New()
+	router.Use(siteServer.Headers)
+	router.GET("/", func(c *gin.Context) {
+		c.String(200, "home")
+	})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Origin", "https://example.com")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Vary") != "" || response.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no cors headers without cors origins, got %v", response.Header())
+	}
+}
+
+func TestDomainVerificationIsAnsweredByTheServer(t *testing.T) {
+
+	wrapper, dbResource := GetResource()
+	defer wrapper.db.Close()
+
+	u, _ := uuid.NewV4()
+	domain := resource.SiteDomain{
+		ReferenceId:        u.String(),
+		SiteId:             1,
+		Hostname:           "d-" + u.String() + ".example.com",
+		VerificationMethod: resource.DomainVerificationHttp,
+	}
+	verifier := resource.NewDomainVerifierWithNameserver("secret", "")
+
+	// the site on the hostname serves the token from its own files
+	siteRouter := gin.New()
+	siteRouter.NoRoute(func(c *gin.Context) {
+		c.String(200, verifier.Token(domain))
+	})
+	hs := HostSwitch{
+		handlerMap:   map[string]*gin.Engine{domain.Hostname: siteRouter},
+		siteMap:      map[string]resource.SubSite{domain.Hostname: {Permission: resource.PermissionInstance{Permission: auth.GuestPeek | auth.GuestExecute}}},
+		siteDomains:  dbResource.Cruds["site_domain"],
+		pathHandlers: map[string]*gin.Engine{},
+	}
+	server := httptest.NewServer(hs)
+	defer server.Close()
+	verifier.Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+
+	if err := verifier.Verify(domain); err == nil {
+		t.Fatalf("a token served from the files of a site should not verify the domain")
+	}
+
+	_, err := wrapper.db.Exec("insert into site_domain (reference_id, site_id, hostname, verification_method, verification_token, permission, created_at) values (?, ?, ?, ?, ?, ?, ?)",
+		domain.ReferenceId, domain.SiteId, domain.Hostname, domain.VerificationMethod, verifier.Token(domain), auth.DEFAULT_PERMISSION, time.Now())
+	if err != nil {
+		t.Fatalf("failed to add domain: %v", err)
+	}
+
+	if err := verifier.Verify(domain); err != nil {
+		t.Errorf("expected the stored token to verify the domain: %v", err)
+	}
+}
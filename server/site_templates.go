@@ -0,0 +1,383 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/ghodss/yaml"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// siteManifestName is the file in the root of a site which declares its templated pages
+const siteManifestName = "daptin-site.yaml"
+
+// SiteManifest declares the pages of a site rendered from templates with live data, like
+//
+//	Partials: ["templates/layout/*.html"]
+//	Routes:
+//	  - Path: /blog/:slug
+//	    Template: templates/post.html
+//	    Data:
+//	      post:
+//	        Entity: blog_post
+//	        Query: [{column: slug, operator: is, value: ":slug"}]
+//	        Single: true
+//
+// A value starting with : is a param of the path and a value starting with ? is a param of the url query
+type SiteManifest struct {
+	Partials []string
+	Routes   []SiteRoute
+}
+
+// SiteRoute is a page of the site, the path can have :name params for one part and a *name param for the rest
+type SiteRoute struct {
+	Path        string
+	Template    string
+	ContentType string
+	Data        map[string]SiteRouteQuery
+}
+
+// SiteRouteQuery reads rows of an entity as the user requesting the page
+type SiteRouteQuery struct {
+	Entity     string
+	Query      []resource.Query
+	Sort       []string
+	PageSize   int
+	PageNumber string
+	Included   bool
+	// Single gives the first row instead of a list, the page is not found when there is no row
+	Single bool
+}
+
+// SiteTemplates renders the templated pages of one site from its source folder. The manifest and the templates are
+// read again when they change, the storage sync of the site updates them
+type SiteTemplates struct {
+	sourceRoot     string
+	cruds          map[string]*resource.DbResource
+	lock           sync.Mutex
+	manifest       *SiteManifest
+	manifestTime   time.Time
+	templates      map[string]*template.Template
+	templatesTimes map[string]time.Time
+}
+
+func NewSiteTemplates(sourceRoot string, cruds map[string]*resource.DbResource) *SiteTemplates {
+	return &SiteTemplates{
+		sourceRoot:     sourceRoot,
+		cruds:          cruds,
+		templates:      make(map[string]*template.Template),
+		templatesTimes: make(map[string]time.Time),
+	}
+}
+
+// sitePath is a path inside the source folder, paths can not go above it
+func (st *SiteTemplates) sitePath(path string) string {
+	return filepath.Join(st.sourceRoot, filepath.Clean("/"+path))
+}
+
+func (st *SiteTemplates) loadManifest() (*SiteManifest, error) {
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	stat, err := os.Stat(st.sitePath(siteManifestName))
+	if err != nil {
+		st.manifest = nil
+		return nil, nil
+	}
+	if st.manifest != nil && stat.ModTime().Equal(st.manifestTime) {
+		return st.manifest, nil
+	}
+
+	contents, err := ioutil.ReadFile(st.sitePath(siteManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest SiteManifest
+	err = yaml.Unmarshal(contents, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", siteManifestName, err)
+	}
+
+	st.manifest = &manifest
+	st.manifestTime = stat.ModTime()
+	st.templates = make(map[string]*template.Template)
+	st.templatesTimes = make(map[string]time.Time)
+	return st.manifest, nil
+}
+
+// template parses the template of the route with the partials of the manifest
+func (st *SiteTemplates) template(manifest *SiteManifest, route SiteRoute) (*template.Template, error) {
+
+	files := []string{st.sitePath(route.Template)}
+	for _, pattern := range manifest.Partials {
+		matches, err := filepath.Glob(st.sitePath(pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	var lastChange time.Time
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if stat.ModTime().After(lastChange) {
+			lastChange = stat.ModTime()
+		}
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if parsed, ok := st.templates[route.Path]; ok && !lastChange.After(st.templatesTimes[route.Path]) {
+		return parsed, nil
+	}
+
+	parsed, err := template.New(filepath.Base(files[0])).Funcs(siteTemplateFuncs).ParseFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	st.templates[route.Path] = parsed
+	st.templatesTimes[route.Path] = lastChange
+	return parsed, nil
+}
+
+var siteTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		out, err := json.Marshal(value)
+		return string(out), err
+	},
+	"raw": func(value string) template.HTML {
+		return template.HTML(value)
+	},
+}
+
+// IsSource tells if the path of a request is the manifest, a template of a route or a partial, which are not served
+// as files
+func (st *SiteTemplates) IsSource(requestPath string) bool {
+
+	requestPath = path.Clean("/" + requestPath)
+	if requestPath == "/"+siteManifestName {
+		return true
+	}
+
+	manifest, err := st.loadManifest()
+	if err != nil || manifest == nil {
+		return false
+	}
+	for _, route := range manifest.Routes {
+		if requestPath == path.Clean("/"+route.Template) {
+			return true
+		}
+	}
+	for _, pattern := range manifest.Partials {
+		if matched, _ := path.Match(path.Clean("/"+pattern), requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// HideSources answers requests for the manifest and the templates of the site as not found
+func (st *SiteTemplates) HideSources(c *gin.Context) {
+	if st.IsSource(c.Request.URL.Path) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Next()
+}
+
+// MatchSiteRoute matches a path against a route path, returning the params in the path
+func MatchSiteRoute(pattern string, path string) (map[string]string, bool) {
+
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	params := make(map[string]string)
+
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			params[part[1:]] = strings.Join(pathParts[i:], "/")
+			return params, true
+		}
+		if i >= len(pathParts) {
+			return nil, false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[part[1:]] = pathParts[i]
+		} else if part != pathParts[i] {
+			return nil, false
+		}
+	}
+
+	return params, len(patternParts) == len(pathParts)
+}
+
+// resolveSiteValue replaces :name with the param of the path and ?name with the param of the query
+func resolveSiteValue(value interface{}, params map[string]string, query url.Values) interface{} {
+	valueString, ok := value.(string)
+	if !ok || len(valueString) < 2 {
+		return value
+	}
+	switch valueString[0] {
+	case ':':
+		return params[valueString[1:]]
+	case '?':
+		return query.Get(valueString[1:])
+	}
+	return value
+}
+
+// find runs a query of the route as the user of the request, through the permission checks of the api
+func (st *SiteTemplates) find(c *gin.Context, routeQuery SiteRouteQuery, params map[string]string) ([]map[string]interface{}, error) {
+
+	crud, ok := st.cruds[routeQuery.Entity]
+	if !ok {
+		return nil, fmt.Errorf("no such entity [%v]", routeQuery.Entity)
+	}
+
+	queries := make([]resource.Query, 0)
+	for _, query := range routeQuery.Query {
+		query.Value = resolveSiteValue(query.Value, params, c.Request.URL.Query())
+		queries = append(queries, query)
+	}
+	queryJson, err := json.Marshal(queries)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := routeQuery.PageSize
+	if routeQuery.Single {
+		pageSize = 1
+	} else if pageSize < 1 {
+		pageSize = 10
+	}
+	pageNumber := fmt.Sprintf("%v", resolveSiteValue(routeQuery.PageNumber, params, c.Request.URL.Query()))
+	if pageNumber == "" {
+		pageNumber = "1"
+	}
+
+	queryParams := map[string][]string{
+		"query":        {string(queryJson)},
+		"page[size]":   {fmt.Sprintf("%d", pageSize)},
+		"page[number]": {pageNumber},
+	}
+	if len(routeQuery.Sort) > 0 {
+		queryParams["sort"] = routeQuery.Sort
+	}
+	if routeQuery.Included {
+		queryParams["included_relations"] = []string{"*"}
+	}
+
+	pr := &http.Request{
+		Method: "GET",
+	}
+	pr = pr.WithContext(c.Request.Context())
+
+	_, responder, err := crud.PaginatedFindAll(api2go.Request{
+		PlainRequest: pr,
+		QueryParams:  queryParams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	for _, model := range responder.Result().([]*api2go.Api2GoModel) {
+		rows = append(rows, model.Data)
+	}
+	return rows, nil
+}
+
+// Render writes the page of the first route matching the request, it returns false when no route matches
+func (st *SiteTemplates) Render(c *gin.Context) bool {
+
+	manifest, err := st.loadManifest()
+	if err != nil {
+		log.Printf("Failed to read site manifest in [%v]: %v", st.sourceRoot, err)
+		return false
+	}
+	if manifest == nil {
+		return false
+	}
+
+	for _, route := range manifest.Routes {
+
+		params, ok := MatchSiteRoute(route.Path, c.Request.URL.Path)
+		if !ok {
+			continue
+		}
+
+		tmpl, err := st.template(manifest, route)
+		if err != nil {
+			log.Printf("Failed to read template [%v]: %v", route.Template, err)
+			c.AbortWithStatus(500)
+			return true
+		}
+
+		user := ""
+		if sessionUser, ok := c.Request.Context().Value("user").(*auth.SessionUser); ok {
+			user = sessionUser.UserReferenceId
+		}
+		data := map[string]interface{}{
+			"params": params,
+			"query":  c.Request.URL.Query(),
+			"user":   user,
+		}
+
+		for name, routeQuery := range route.Data {
+			rows, err := st.find(c, routeQuery, params)
+			if err != nil {
+				log.Printf("Failed to read [%v] for [%v]: %v", name, route.Path, err)
+				c.AbortWithStatus(500)
+				return true
+			}
+			if !routeQuery.Single {
+				data[name] = rows
+			} else if len(rows) > 0 {
+				data[name] = rows[0]
+			} else {
+				c.AbortWithStatus(404)
+				return true
+			}
+		}
+
+		var out bytes.Buffer
+		err = tmpl.Execute(&out, data)
+		if err != nil {
+			log.Printf("Failed to render template [%v]: %v", route.Template, err)
+			c.AbortWithStatus(500)
+			return true
+		}
+
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "text/html; charset=utf-8"
+		}
+		// the page is rendered with the rows the user can read
+		c.Header("Cache-Control", "private")
+		c.Data(200, contentType, out.Bytes())
+		c.Abort()
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchSiteRoute(t *testing.T) {
+
+	params, ok := MatchSiteRoute("/blog/:slug", "/blog/hello-world")
+	if !ok || params["slug"] != "hello-world" {
+		t.Errorf("expected slug param, got %v %v", ok, params)
+	}
+
+	if _, ok := MatchSiteRoute("/blog/:slug", "/blog"); ok {
+		t.Errorf("missing param should not match")
+	}
+	if _, ok := MatchSiteRoute("/blog/:slug", "/blog/a/b"); ok {
+		t.Errorf("longer path should not match")
+	}
+	if _, ok := MatchSiteRoute("/blog", "/news"); ok {
+		t.Errorf("other path should not match")
+	}
+
+	params, ok = MatchSiteRoute("/docs/*page", "/docs/guide/install")
+	if !ok || params["page"] != "guide/install" {
+		t.Errorf("expected rest of path, got %v %v", ok, params)
+	}
+
+	query := url.Values{"page": []string{"2"}}
+	if value := resolveSiteValue(":slug", map[string]string{"slug": "a"}, query); value != "a" {
+		t.Errorf("expected path param, got %v", value)
+	}
+	if value := resolveSiteValue("?page", nil, query); value != "2" {
+		t.Errorf("expected query param, got %v", value)
+	}
+	if value := resolveSiteValue("draft", nil, query); value != "draft" {
+		t.Errorf("expected literal, got %v", value)
+	}
+}
+
+func TestSiteSourcesAreNotServed(t *testing.T) {
+
+	root, _ := ioutil.TempDir("", "site-templates")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "templates", "layout"), 0755)
+	ioutil.WriteFile(filepath.Join(root, siteManifestName), []byte(`
+Partials: ["templates/layout/*.html"]
+Routes:
+  - Path: /about
+    Template: templates/about.html
+`), 0644)
+	ioutil.WriteFile(filepath.Join(root, "templates", "about.html"), []byte(`{{template "base.html"}}`), 0644)
+	ioutil.WriteFile(filepath.Join(root, "templates", "layout", "base.html"), []byte("about us"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("home"), 0644)
+
+	siteTemplates := NewSiteTemplates(root, nil)
+	siteServer := NewSiteServer(resource.SiteServeConfig{}, root)
+	router := gin.New()
+	router.Use(siteTemplates.HideSources)
+	router.Use(siteServer.Files)
+	router.NoRoute(func(c *gin.Context) {
+		siteTemplates.Render(c)
+	})
+
+	for _, source := range []string{"/daptin-site.yaml", "/templates/about.html", "/templates/layout/base.html", "/templates/../daptin-site.yaml"} {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest("GET", source, nil))
+		if response.Code != 404 {
+			t.Errorf("expected [%v] to not be served, got %v %s", source, response.Code, response.Body.Bytes())
+		}
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/index.html", nil))
+	if response.Code != 200 || response.Body.String() != "home" {
+		t.Errorf("expected other files to be served, got %v %s", response.Code, response.Body.Bytes())
+	}
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/about", nil))
+	if response.Code != 200 || response.Body.String() != "about us" || response.Header().Get("Cache-Control") != "private" {
+		t.Errorf("expected a private rendered page, got %v %v %s", response.Code, response.Header(), response.Body.Bytes())
+	}
+}
@@ -1,16 +1,17 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/artpar/api2go"
 	"github.com/artpar/go.uuid"
 	_ "github.com/artpar/rclone/backend/all" // import all fs
 	"github.com/artpar/stats"
 	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/database"
 	"github.com/daptin/daptin/server/resource"
-	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
@@ -25,6 +26,71 @@ type HostSwitch struct {
 	handlerMap     map[string]*gin.Engine
 	siteMap        map[string]resource.SubSite
 	authMiddleware *auth.AuthMiddleware
+	urlSigner      *resource.UrlSigner
+	// handlers of sites by their path, which serves a site whose hostname is not verified as well
+	pathHandlers map[string]*gin.Engine
+	// ids of sites whose hostname is not verified, these sites are served only under their path
+	inactiveSites map[int64]bool
+	// domains of sites, to answer the http verification of a domain
+	siteDomains *resource.DbResource
+	// hostnames of sites like *.example.com
+	wildcardHosts []string
+	// verified domains of sites which redirect to the hostname of the site
+	aliases map[string]string
+}
+
+// resolveHost gives the hostname of the site served on a hostname, or the hostname to redirect to for an alias. Only
+// the sites with a verified hostname are registered by their hostname
+func (hs HostSwitch) resolveHost(hostName string) (string, string) {
+	if _, ok := hs.handlerMap[hostName]; ok {
+		return hostName, ""
+	}
+	if canonical, ok := hs.aliases[hostName]; ok {
+		return "", canonical
+	}
+	for _, pattern := range hs.wildcardHosts {
+		if resource.MatchHostname(pattern, hostName) {
+			return pattern, ""
+		}
+	}
+	for pattern, canonical := range hs.aliases {
+		if strings.HasPrefix(pattern, "*.") && resource.MatchHostname(pattern, hostName) {
+			return "", canonical
+		}
+	}
+	return hostName, ""
+}
+
+// serveVerificationTokens answers the http verification of the domains claiming the hostname, so a site can not
+// verify a domain with a file of its own
+func (hs HostSwitch) serveVerificationTokens(w http.ResponseWriter, r *http.Request, hostName string) {
+	var tokens []string
+	var err error
+	if hs.siteDomains != nil {
+		tokens, err = hs.siteDomains.GetSiteDomainVerificationTokens(hostName)
+		resource.CheckErr(err, "Failed to load verification tokens of [%v]", hostName)
+	}
+	if len(tokens) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(strings.Join(tokens, "\n")))
+}
+
+// signedRequest reads a request with a signed url for a file of the site as a request of the user who signed it
+func (hs HostSwitch) signedRequest(r *http.Request, subSite resource.SubSite, path string) (*http.Request, bool) {
+	query := r.URL.Query()
+	if hs.urlSigner == nil || !resource.IsSigned(query) || query.Get("site") != subSite.ReferenceId {
+		return r, false
+	}
+	signer, err := hs.urlSigner.Verify(r.Method, path, query)
+	if err != nil {
+		log.Printf("Invalid signed url for site [%v]: %v", subSite.Name, err)
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), "user", signer)), true
 }
 
 type JsonApiError struct {
@@ -96,7 +162,7 @@ func CreateAssetColumnSync(cmsConfig *resource.CmsConfig, db database.DatabaseCo
 
 }
 
-func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnection, cruds map[string]*resource.DbResource, authMiddleware *auth.AuthMiddleware) HostSwitch {
+func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnection, cruds map[string]*resource.DbResource, authMiddleware *auth.AuthMiddleware, domainVerifier *resource.DomainVerifier) HostSwitch {
 
 	router := httprouter.New()
 	router.ServeFiles("/*filepath", http.Dir("./scripts"))
@@ -105,6 +171,10 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 	hs.handlerMap = make(map[string]*gin.Engine)
 	hs.siteMap = make(map[string]resource.SubSite)
 	hs.authMiddleware = authMiddleware
+	hs.pathHandlers = make(map[string]*gin.Engine)
+	hs.inactiveSites = make(map[int64]bool)
+	hs.siteDomains = cruds["site_domain"]
+	hs.aliases = make(map[string]string)
 
 	//log.Printf("Cruds before making sub sits: %v", cruds)
 	sites, err := cruds["site"].GetAllSites()
@@ -122,6 +192,11 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 		return hs
 	}
 
+	domains, err := cruds["site_domain"].GetAllSiteDomains()
+	resource.CheckErr(err, "Failed to load site domains")
+	adminUserId, _ := resource.GetAdminUserIdAndUserGroupId(db)
+	siteById := make(map[int64]resource.SubSite)
+
 	for _, site := range sites {
 
 		if !site.Enable {
@@ -130,7 +205,17 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 
 		subSiteInformation := resource.SubSiteInformation{}
 		hs.siteMap[site.Path] = site
-		hs.siteMap[site.Hostname] = site
+
+		if !domainVerifier.SiteHostnameVerified(site, domains, adminUserId) {
+			log.Infof("Hostname [%v] of site [%v] is not verified, the site is served only under /%v", site.Hostname, site.Name, site.Path)
+			hs.inactiveSites[site.Id] = true
+		} else {
+			hs.siteMap[site.Hostname] = site
+			if strings.HasPrefix(site.Hostname, "*.") {
+				hs.wildcardHosts = append(hs.wildcardHosts, site.Hostname)
+			}
+		}
+		siteById[site.Id] = site
 		//log.Infof("Site to subhost: %v", site)
 
 		subSiteInformation.SubSite = site
@@ -154,7 +239,24 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 			continue
 		}
 
-		err = cruds["task"].SyncStorageToPath(cloudStore, "", tempDirectoryPath)
+		// a markdown site is served from the folder its pages are built into, after each sync of its store
+		servedPath := tempDirectoryPath
+		if site.SiteType == resource.SiteTypeMarkdown {
+			servedPath, err = ioutil.TempDir("", sourceDirectoryName+"-public")
+			if resource.CheckErr(err, "Failed to create build directory") {
+				continue
+			}
+			subSiteInformation.MarkdownSite = resource.NewMarkdownSite(tempDirectoryPath, servedPath)
+		}
+		markdownSite := subSiteInformation.MarkdownSite
+		siteName := site.Name
+
+		err = cruds["task"].SyncStorageToPathAndThen(cloudStore, "", tempDirectoryPath, func(err error) {
+			if err == nil && markdownSite != nil {
+				err = markdownSite.Build()
+				resource.CheckErr(err, "Failed to build markdown site [%v]", siteName)
+			}
+		})
 		if resource.CheckErr(err, "Failed to setup sync to path for subsite [%v]", site.Name) {
 			continue
 		}
@@ -182,18 +284,35 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 			}
 		}())
 
+		siteServer := NewSiteServer(site.ServeConfig, servedPath)
+		hostRouter.Use(siteServer.Headers)
+
 		hostRouter.GET("/stats", func(c *gin.Context) {
 			c.JSON(200, subsiteStats.Data())
 		})
 
 		//hostRouter.ServeFiles("/*filepath", http.Dir(tempDirectoryPath))
 		hostRouter.Use(authMiddleware.AuthCheckMiddleware)
-		hostRouter.Use(static.Serve("/", static.LocalFile(tempDirectoryPath, true)))
+		siteTemplates := NewSiteTemplates(tempDirectoryPath, cruds)
+		hostRouter.Use(siteTemplates.HideSources)
+		hostRouter.Use(siteServer.Files)
 
 		hostRouter.GET("/favicon.ico", func(c *gin.Context) {
-			c.File(tempDirectoryPath + "/favicon.ico")
+			c.File(servedPath + "/favicon.ico")
+		})
+		builtPages := http.FileServer(&StaticFsWithDefaultIndex{
+			system:    http.Dir(servedPath),
+			pageOn404: "/index.html",
 		})
 		hostRouter.NoRoute(func(c *gin.Context) {
+			if siteTemplates.Render(c) || siteServer.NotFound(c) {
+				return
+			}
+			if markdownSite != nil {
+				builtPages.ServeHTTP(c.Writer, c.Request)
+				c.Abort()
+				return
+			}
 			log.Printf("Found no route for %v", c.Request.URL)
 			c.File(tempDirectoryPath + "/index.html")
 			c.AbortWithStatus(200)
@@ -203,9 +322,22 @@ func CreateSubSites(cmsConfig *resource.CmsConfig, db database.DatabaseConnectio
 			c.JSON(http.StatusOK, Stats.Data())
 		})
 
-		hs.handlerMap[site.Hostname] = hostRouter
-		siteMap[subSiteInformation.SubSite.Hostname] = subSiteInformation
+		hs.pathHandlers[site.Path] = hostRouter
 		siteMap[subSiteInformation.SubSite.Path] = subSiteInformation
+		if !hs.inactiveSites[site.Id] {
+			hs.handlerMap[site.Hostname] = hostRouter
+			siteMap[subSiteInformation.SubSite.Hostname] = subSiteInformation
+		}
+	}
+
+	// a verified domain which is not the hostname of its site redirects to the hostname of the site
+	for _, domain := range domains {
+		site, ok := siteById[domain.SiteId]
+		if !ok || hs.inactiveSites[site.Id] || strings.HasPrefix(site.Hostname, "*.") ||
+			resource.MatchHostname(domain.Hostname, site.Hostname) || !domainVerifier.IsVerified(domain) {
+			continue
+		}
+		hs.aliases[domain.Hostname] = site.Hostname
 	}
 
 	cmsConfig.SubSites = siteMap
@@ -241,7 +373,19 @@ var apiPaths = map[string]bool{
 func (hs HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check if a http.Handler is registered for the given host.
 	// If yes, use it to handle the request.
-	hostName := strings.Split(r.Host, ":")[0]
+	if r.URL.Path == resource.DomainVerificationPath {
+		hs.serveVerificationTokens(w, r, strings.Split(r.Host, ":")[0])
+		return
+	}
+	hostName, redirectTo := hs.resolveHost(strings.Split(r.Host, ":")[0])
+	if redirectTo != "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		http.Redirect(w, r, scheme+"://"+redirectTo+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
 	pathParts := strings.Split(r.URL.Path, "/")
 	if handler := hs.handlerMap[hostName]; handler != nil && !(len(pathParts) > 1 && apiPaths[pathParts[1]]) {
 
@@ -252,6 +396,10 @@ func (hs HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		subSite := hs.siteMap[hostName]
 		permission := subSite.Permission
+		if signedRequest, signed := hs.signedRequest(r, subSite, r.URL.Path); signed {
+			r = signedRequest
+			ok, abort = true, false
+		}
 		if abort {
 			w.Header().Set("WWW-Authenticate", `Basic realm="`+hostName+`"`)
 			w.WriteHeader(401)
@@ -285,6 +433,9 @@ func (hs HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if isSubSite {
 
 				permission := subSite.Permission
+				if signedRequest, signed := hs.signedRequest(r, subSite, "/"+strings.Join(pathParts[2:], "/")); signed {
+					r = signedRequest
+				}
 				userI := r.Context().Value("user")
 				var user *auth.SessionUser
 				if userI != nil {
@@ -297,7 +448,11 @@ func (hs HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 				if permission.CanExecute(user.UserReferenceId, user.Groups) {
 					r.URL.Path = "/" + strings.Join(pathParts[2:], "/")
-					handler := hs.handlerMap[subSite.Hostname]
+					handler, ok := hs.pathHandlers[subSite.Path]
+					if !ok {
+						w.WriteHeader(404)
+						return
+					}
 					handler.ServeHTTP(w, r)
 				} else {
 					w.WriteHeader(403)
@@ -444,13 +599,40 @@ func CreateSubSiteSaveContentHandler(initConfig *resource.CmsConfig, cruds map[s
 			return
 		}
 
-		log.Infof("Writing contents to file: %v", fullpath)
-		err = ioutil.WriteFile(fullpath, []byte(htmlString.(string)), 0644)
-		if !ok {
-			log.Errorf("Invalid subsite: %v", context.GetHeader("Referer"))
-			context.AbortWithStatus(400)
+		sessionUser := &auth.SessionUser{}
+		if user, ok := context.Request.Context().Value("user").(*auth.SessionUser); ok {
+			sessionUser = user
+		}
+		adminId := cruds["site"].GetAdminReferenceId()
+		isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+		if !isAdmin && !subsite.SubSite.Permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups) {
+			context.AbortWithStatus(403)
 			return
 		}
+
+		// edits are saved as a draft revision, the site and its store change when the revision is published
+		relativePath := strings.TrimPrefix(fullpath, subsite.SourceRoot)
+		revision, err := cruds["site_revision"].CreateSiteRevision(subsite.SubSite.Id, relativePath, htmlString.(string), resource.SiteRevisionDraft, sessionUser.UserId)
+		if err != nil {
+			log.Errorf("Failed to save revision of [%v]: %v", fullpath, err)
+			context.AbortWithStatus(500)
+			return
+		}
+		log.Infof("Saved revision [%v] of [%v]", revision.ReferenceId, fullpath)
+
+		if publish, _ := requestJson["publish"].(bool); publish {
+			err = cruds["site_revision"].PublishSiteRevision(subsite, revision)
+			if err != nil {
+				log.Errorf("Failed to publish revision [%v]: %v", revision.ReferenceId, err)
+				context.AbortWithStatus(500)
+				return
+			}
+			revision.Status = resource.SiteRevisionPublished
+		}
+
+		requestJson["revision_id"] = revision.ReferenceId
+		requestJson["status"] = revision.Status
+		requestJson["preview_url"] = "/site/content/preview/" + revision.ReferenceId
 		//
 		//} else if action == "load" {
 		//	keys := strings.Split(context.Request.FormValue("keys"), ",")
@@ -479,6 +661,33 @@ func CreateSubSiteSaveContentHandler(initConfig *resource.CmsConfig, cruds map[s
 
 }
 
+// CreateSiteRevisionPreviewHandler serves a saved revision of a site file, to see a draft before it is published
+func CreateSiteRevisionPreviewHandler(cruds map[string]*resource.DbResource) func(context *gin.Context) {
+
+	return func(context *gin.Context) {
+
+		pr := &http.Request{
+			Method: "GET",
+		}
+		pr = pr.WithContext(context.Request.Context())
+
+		revision, err := cruds["site_revision"].FindOne(context.Param("revision_id"), api2go.Request{
+			PlainRequest: pr,
+		})
+		if err != nil {
+			context.AbortWithStatus(404)
+			return
+		}
+
+		contents, _ := revision.Result().(*api2go.Api2GoModel).Data["contents"].(string)
+		context.Header("Cache-Control", "no-store")
+		// the draft is served from the api origin, so it runs in a sandbox without scripts or access to the origin
+		context.Header("Content-Security-Policy", "sandbox; default-src 'none'; img-src * data:; style-src * 'unsafe-inline'; font-src * data:")
+		context.Header("X-Content-Type-Options", "nosniff")
+		context.Data(200, "text/html; charset=utf-8", []byte(contents))
+	}
+}
+
 func GetFilePath(sourceRoot string, path string) (string, bool) {
 	fullpath := sourceRoot + path
 
@@ -570,6 +779,13 @@ func CreateSubSiteContentHandler(initConfig *resource.CmsConfig, cruds map[strin
 			return
 		}
 		cts := string(fileContents)
+
+		// the editor continues from an unpublished draft
+		relativePath := strings.TrimPrefix(fullpath, subsite.SourceRoot)
+		revision, err := cruds["site_revision"].GetLatestSiteRevision(subsite.SubSite.Id, relativePath)
+		if err == nil && revision.Status == resource.SiteRevisionDraft {
+			cts = revision.Contents
+		}
 		doc, err := goquery.NewDocumentFromReader(strings.NewReader(cts))
 		if err != nil {
 			log.Errorf("Failed to read file as html doc: %v", err)
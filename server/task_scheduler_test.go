@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/resource"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTaskRunIsRecordedAndFailureHookCalled(t *testing.T) {
+
+	wrapper, dbResource := GetResource()
+	defer wrapper.db.Close()
+
+	var instance *resource.ActiveTaskInstance
+	var overlapErr error
+
+	payloads := make(chan map[string]interface{}, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+		// the first run is still in progress while its failure hook is called
+		_, overlapErr = instance.Execute(resource.TaskTriggerSchedule)
+	}))
+	defer webhook.Close()
+
+	instance = dbResource.Cruds["task"].NewActiveTaskInstance(resource.Task{
+		Name:       "failing task",
+		ActionName: "no_such_action",
+		EntityName: "world",
+		Attributes: map[string]interface{}{},
+		OnFailure:  resource.TaskFailureHook{Webhook: webhook.URL},
+	})
+
+	taskRun, err := instance.Execute(resource.TaskTriggerManual)
+	if err == nil {
+		t.Fatalf("expected the task to fail")
+	}
+	if taskRun.Outcome != resource.TaskRunFailure || taskRun.TriggeredBy != resource.TaskTriggerManual {
+		t.Errorf("unexpected task run: %v", taskRun)
+	}
+
+	select {
+	case payload := <-payloads:
+		if payload["task_name"] != "failing task" || payload["error"] == "" {
+			t.Errorf("unexpected failure webhook payload: %v", payload)
+		}
+	default:
+		t.Errorf("expected the failure webhook to be called")
+	}
+
+	if overlapErr != resource.ErrTaskAlreadyRunning {
+		t.Errorf("expected a run overlapping another to be skipped, got %v", overlapErr)
+	}
+
+	var count int
+	err = wrapper.db.QueryRowx("select count(*) from task_run where task_name = ? and outcome = ?",
+		"failing task", resource.TaskRunFailure).Scan(&count)
+	if err != nil || count == 0 {
+		t.Errorf("expected the failed run to be recorded: %v %v", count, err)
+	}
+}
+
+func TestManualRunsOfAnInactiveTaskDoNotOverlap(t *testing.T) {
+
+	wrapper, dbResource := GetResource()
+	defer wrapper.db.Close()
+
+	scheduler := resource.NewTaskScheduler(nil, dbResource.Cruds, nil, wrapper)
+	defer scheduler.StopTasks()
+
+	referenceId, _ := uuid.NewV4()
+	var overlapErr error
+	var overlapping int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first manual run is still in progress while its failure hook is called
+		if atomic.CompareAndSwapInt32(&overlapping, 0, 1) {
+			_, overlapErr = scheduler.RunTask(referenceId.String())
+		}
+	}))
+	defer webhook.Close()
+
+	_, err := wrapper.db.Exec("insert into task (reference_id, name, action_name, entity_name, schedule, active, attributes, job_type, on_failure, permission) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", referenceId.String(), "inactive task", "no_such_action", "world", "@every 1h", false, "{}", "",
+		`{"Webhook": "`+webhook.URL+`"}`, 0)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	taskRun, err := scheduler.RunTask(referenceId.String())
+	if err == nil || taskRun == nil || taskRun.TriggeredBy != resource.TaskTriggerManual {
+		t.Fatalf("expected the manual run to execute and fail, got %v %v", taskRun, err)
+	}
+	if overlapErr != resource.ErrTaskAlreadyRunning {
+		t.Errorf("expected a manual run overlapping another to be skipped, got %v", overlapErr)
+	}
+
+	_, err = scheduler.RunTask(referenceId.String())
+	if err == resource.ErrTaskAlreadyRunning {
+		t.Errorf("expected the task to run again once the first run finished")
+	}
+}
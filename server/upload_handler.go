@@ -0,0 +1,561 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	"github.com/h2non/filetype"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tusVersion is the version of the tus resumable upload protocol, https://tus.io/protocols/resumable-upload.html,
+// implemented by the upload endpoint with the creation and termination extensions
+const tusVersion = "1.0.0"
+
+const tusExtensions = "creation,termination"
+
+// TusUpload is an upload in progress to a file column of a row. It is kept next to the received bytes so uploads can
+// be resumed after a restart
+type TusUpload struct {
+	Id              string
+	TableName       string
+	ColumnName      string
+	ResourceId      string
+	FileName        string
+	FileType        string
+	Length          int64
+	Append          bool
+	UserReferenceId string
+	CreatedAt       time.Time
+}
+
+// TusUploadHandler receives chunked uploads into a temp folder and moves finished files to the cloud store of the
+// column. The file is then set on the row with a normal update. Files can also be sent in one request to a signed url
+type TusUploadHandler struct {
+	cruds      map[string]*resource.DbResource
+	urlSigner  *resource.UrlSigner
+	uploadPath string
+	maxSize    int64
+	busy       map[string]bool
+	busyLock   sync.Mutex
+}
+
+// CreateTusUploadHandler reads the folder for uploads in progress from upload.path and the default size limit of a
+// column from upload.max.size
+func CreateTusUploadHandler(cruds map[string]*resource.DbResource, configStore *resource.ConfigStore, urlSigner *resource.UrlSigner) *TusUploadHandler {
+
+	uploadPath, err := configStore.GetConfigValueFor("upload.path", "backend")
+	if err != nil || uploadPath == "" {
+		uploadPath = filepath.Join(os.TempDir(), "daptin-uploads")
+		configStore.SetConfigValueFor("upload.path", uploadPath, "backend")
+	}
+	err = os.MkdirAll(uploadPath, 0755)
+	resource.CheckErr(err, "Failed to create folder for uploads [%v]", uploadPath)
+
+	maxSize, err := configStore.GetConfigIntValueFor("upload.max.size", "backend")
+	if err != nil || maxSize < 1 {
+		maxSize = 1 << 30
+		configStore.SetConfigIntValueFor("upload.max.size", maxSize, "backend")
+	}
+
+	return &TusUploadHandler{
+		cruds:      cruds,
+		urlSigner:  urlSigner,
+		uploadPath: uploadPath,
+		maxSize:    int64(maxSize),
+		busy:       make(map[string]bool),
+	}
+}
+
+// Register adds the routes of the protocol, uploads are created on /upload/<table>/<column>
+func (h *TusUploadHandler) Register(router *gin.Engine) {
+	router.POST("/upload/:typename/:columnname", h.Create)
+	router.HEAD("/upload/:typename/:columnname/:upload_id", h.Head)
+	router.PATCH("/upload/:typename/:columnname/:upload_id", h.Patch)
+	router.DELETE("/upload/:typename/:columnname/:upload_id", h.Delete)
+	router.PUT("/asset/:typename/:resource_id/:columnname", h.Put)
+}
+
+// TusOptions are the headers sent to an OPTIONS request on the upload endpoint
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+}
+
+func sessionUserOf(c *gin.Context) *auth.SessionUser {
+	if user, ok := c.Request.Context().Value("user").(*auth.SessionUser); ok {
+		return user
+	}
+	return &auth.SessionUser{}
+}
+
+// ParseUploadMetadata reads the Upload-Metadata header, pairs of a key and a base64 value separated by commas
+func ParseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata
+}
+
+// column finds the upload column of the request, a file column stored on a cloud store
+func (h *TusUploadHandler) column(c *gin.Context) (*resource.DbResource, *api2go.ColumnInfo, bool) {
+	table, ok := h.cruds[c.Param("typename")]
+	if !ok || table == nil {
+		return nil, nil, false
+	}
+	column, ok := table.TableInfo().GetColumnByName(c.Param("columnname"))
+	if !ok || !column.IsForeignKey || column.ForeignKeyData.DataSource != "cloud_store" {
+		return nil, nil, false
+	}
+	return table, column, true
+}
+
+func (h *TusUploadHandler) dataPath(id string) string {
+	return filepath.Join(h.uploadPath, id+".bin")
+}
+
+func (h *TusUploadHandler) infoPath(id string) string {
+	return filepath.Join(h.uploadPath, id+".info")
+}
+
+// load reads an upload of the request, only the user who created it can continue it
+func (h *TusUploadHandler) load(c *gin.Context) (TusUpload, int64, bool) {
+
+	var upload TusUpload
+	id := c.Param("upload_id")
+	if _, err := uuid.FromString(id); err != nil {
+		return upload, 0, false
+	}
+
+	contents, err := ioutil.ReadFile(h.infoPath(id))
+	if err != nil || json.Unmarshal(contents, &upload) != nil {
+		return upload, 0, false
+	}
+	if upload.TableName != c.Param("typename") || upload.ColumnName != c.Param("columnname") ||
+		upload.UserReferenceId != sessionUserOf(c).UserReferenceId {
+		return upload, 0, false
+	}
+
+	stat, err := os.Stat(h.dataPath(id))
+	if err != nil {
+		return upload, 0, false
+	}
+	return upload, stat.Size(), true
+}
+
+func (h *TusUploadHandler) remove(id string) {
+	os.Remove(h.dataPath(id))
+	os.Remove(h.infoPath(id))
+}
+
+func (h *TusUploadHandler) lock(id string) bool {
+	h.busyLock.Lock()
+	defer h.busyLock.Unlock()
+	if h.busy[id] {
+		return false
+	}
+	h.busy[id] = true
+	return true
+}
+
+func (h *TusUploadHandler) unlock(id string) {
+	h.busyLock.Lock()
+	defer h.busyLock.Unlock()
+	delete(h.busy, id)
+}
+
+// Create starts an upload for a row, the metadata has the filename, the filetype and the resource_id of the row.
+// Files are set in place of the current files of the column, or added to them when the metadata has append
+func (h *TusUploadHandler) Create(c *gin.Context) {
+
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+
+	table, column, ok := h.column(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	limit := table.TableInfo().UploadLimitFor(column.ColumnName)
+	maxSize := h.maxSize
+	if limit.MaxSize > 0 {
+		maxSize = limit.MaxSize
+	}
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Upload-Length is required"))
+		return
+	}
+	if length > maxSize {
+		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata := ParseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	fileName := filepath.Base(metadata["filename"])
+	if fileName == "." || fileName == "/" || fileName == "" {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("filename is required in Upload-Metadata"))
+		return
+	}
+	fileType := metadata["filetype"]
+	if fileType == "" {
+		fileType = mime.TypeByExtension(filepath.Ext(fileName))
+	}
+	if fileType != "" && !limit.AllowsMimeType(fileType) {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	resourceId := metadata["resource_id"]
+	sessionUser := sessionUserOf(c)
+	adminId := table.GetAdminReferenceId()
+	isAdmin := adminId != "" && adminId == sessionUser.UserReferenceId
+	if resourceId == "" {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("resource_id is required in Upload-Metadata"))
+		return
+	}
+	permission := table.GetObjectPermissionByReferenceId(table.TableInfo().TableName, resourceId)
+	if !isAdmin && !permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	u, _ := uuid.NewV4()
+	upload := TusUpload{
+		Id:              u.String(),
+		TableName:       table.TableInfo().TableName,
+		ColumnName:      column.ColumnName,
+		ResourceId:      resourceId,
+		FileName:        fileName,
+		FileType:        fileType,
+		Length:          length,
+		Append:          metadata["append"] == "true",
+		UserReferenceId: sessionUser.UserReferenceId,
+		CreatedAt:       time.Now(),
+	}
+
+	info, _ := json.Marshal(upload)
+	err = ioutil.WriteFile(h.infoPath(upload.Id), info, 0600)
+	if err == nil {
+		err = ioutil.WriteFile(h.dataPath(upload.Id), []byte{}, 0600)
+	}
+	if err != nil {
+		log.Printf("Failed to create upload [%v]: %v", upload.Id, err)
+		h.remove(upload.Id)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if length == 0 {
+		if status, err := h.finish(c, upload); err != nil {
+			c.AbortWithError(status, err)
+			return
+		}
+	}
+
+	c.Header("Location", fmt.Sprintf("/upload/%s/%s/%s", upload.TableName, upload.ColumnName, upload.Id))
+	c.Status(http.StatusCreated)
+}
+
+// Head tells the client how much of the file was received
+func (h *TusUploadHandler) Head(c *gin.Context) {
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+
+	upload, offset, ok := h.load(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Status(http.StatusOK)
+}
+
+// Patch appends a chunk at the offset, the last chunk moves the file to the cloud store and sets it on the row
+func (h *TusUploadHandler) Patch(c *gin.Context) {
+
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	upload, offset, ok := h.load(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !h.lock(upload.Id) {
+		c.AbortWithStatus(http.StatusLocked)
+		return
+	}
+	defer h.unlock(upload.Id)
+
+	requestOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || requestOffset != offset {
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+
+	file, err := os.OpenFile(h.dataPath(upload.Id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// a chunk is never read past the length of the upload, an interrupted chunk keeps what was received
+	written, err := io.Copy(file, io.LimitReader(c.Request.Body, upload.Length-offset))
+	file.Close()
+	offset = offset + written
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		log.Printf("Upload [%v] interrupted at %v: %v", upload.Id, offset, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if offset == upload.Length {
+		if status, err := h.finish(c, upload); err != nil {
+			c.AbortWithError(status, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Delete stops an upload and removes what was received
+func (h *TusUploadHandler) Delete(c *gin.Context) {
+
+	c.Header("Tus-Resumable", tusVersion)
+	upload, _, ok := h.load(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !h.lock(upload.Id) {
+		c.AbortWithStatus(http.StatusLocked)
+		return
+	}
+	defer h.unlock(upload.Id)
+
+	h.remove(upload.Id)
+	c.Status(http.StatusNoContent)
+}
+
+// Put receives a whole file on a signed upload url, made with the sign_asset_url action, and sets it on the row as
+// the user who signed the url
+func (h *TusUploadHandler) Put(c *gin.Context) {
+
+	query := c.Request.URL.Query()
+	if !resource.IsSigned(query) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	signer, err := h.urlSigner.Verify("PUT", c.Request.URL.Path, query)
+	if err != nil {
+		c.AbortWithError(http.StatusForbidden, err)
+		return
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), "user", signer))
+
+	table, column, ok := h.column(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	limit := table.TableInfo().UploadLimitFor(column.ColumnName)
+	maxSize := h.maxSize
+	if limit.MaxSize > 0 {
+		maxSize = limit.MaxSize
+	}
+	if c.Request.ContentLength > maxSize {
+		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	u, _ := uuid.NewV4()
+	upload := TusUpload{
+		Id:              u.String(),
+		TableName:       table.TableInfo().TableName,
+		ColumnName:      column.ColumnName,
+		ResourceId:      c.Param("resource_id"),
+		FileName:        filepath.Base(query.Get("filename")),
+		FileType:        c.ContentType(),
+		UserReferenceId: signer.UserReferenceId,
+		CreatedAt:       time.Now(),
+	}
+
+	file, err := os.Create(h.dataPath(upload.Id))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	upload.Length, err = io.Copy(file, io.LimitReader(c.Request.Body, maxSize+1))
+	file.Close()
+	if err != nil || upload.Length > maxSize {
+		h.remove(upload.Id)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		} else {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		}
+		return
+	}
+
+	if status, err := h.finish(c, upload); err != nil {
+		h.remove(upload.Id)
+		c.AbortWithError(status, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// finish checks the type of the received file, copies it to the cloud store and local folder of the column and sets
+// it on the row through an update, which checks the permissions of the user
+func (h *TusUploadHandler) finish(c *gin.Context, upload TusUpload) (int, error) {
+
+	table := h.cruds[upload.TableName]
+	column, _ := table.TableInfo().GetColumnByName(upload.ColumnName)
+	dataPath := h.dataPath(upload.Id)
+
+	head := make([]byte, 261)
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	n, _ := io.ReadFull(file, head)
+	file.Close()
+
+	fileType := upload.FileType
+	if kind, err := filetype.Match(head[:n]); err == nil && kind != filetype.Unknown {
+		fileType = kind.MIME.Value
+	}
+	if !table.TableInfo().UploadLimitFor(upload.ColumnName).AllowsMimeType(fileType) {
+		h.remove(upload.Id)
+		return http.StatusUnsupportedMediaType, fmt.Errorf("files of type [%v] are not allowed in [%v]", fileType, upload.ColumnName)
+	}
+
+	cloudStore, err := table.GetCloudStoreByName(column.ForeignKeyData.Namespace)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	storeFolder := filepath.Join(h.uploadPath, upload.Id+".store")
+	err = os.MkdirAll(storeFolder, 0755)
+	if err == nil {
+		err = os.Rename(dataPath, filepath.Join(storeFolder, upload.FileName))
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	os.Remove(h.infoPath(upload.Id))
+
+	if assetCache, ok := table.AssetFolderCache[upload.TableName][upload.ColumnName]; ok {
+		err = copyFile(filepath.Join(storeFolder, upload.FileName), filepath.Join(assetCache.LocalSyncPath, upload.FileName))
+		resource.CheckErr(err, "Failed to copy upload [%v] to the local folder of [%v]", upload.Id, upload.ColumnName)
+	}
+
+	resource.CopyToCloudStore(h.cruds, storeFolder, cloudStore.StoreProvider, cloudStore.OAutoTokenId,
+		cloudStore.RootPath+"/"+column.ForeignKeyData.KeyName, func(err error) {
+			os.RemoveAll(storeFolder)
+		})
+
+	files := make([]interface{}, 0)
+	if upload.Append {
+		row, err := table.GetReferenceIdToObject(upload.TableName, upload.ResourceId)
+		if err != nil {
+			return http.StatusNotFound, err
+		}
+		if existing, ok := row[upload.ColumnName].(string); ok && existing != "" {
+			err = json.Unmarshal([]byte(existing), &files)
+			resource.CheckErr(err, "Failed to read files of [%v][%v]", upload.TableName, upload.ResourceId)
+		}
+	}
+	files = append(files, map[string]interface{}{
+		"name": upload.FileName,
+		"src":  upload.FileName,
+		"type": fileType,
+		"size": upload.Length,
+	})
+
+	pr := &http.Request{
+		Method: "PATCH",
+	}
+	pr = pr.WithContext(c.Request.Context())
+	req := api2go.Request{
+		PlainRequest: pr,
+	}
+	model := api2go.NewApi2GoModelWithData(upload.TableName, nil, 0, nil, map[string]interface{}{
+		"reference_id":    upload.ResourceId,
+		upload.ColumnName: files,
+	})
+	_, err = table.Update(model, req)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+
+	return 0, nil
+}
+
+func copyFile(source string, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
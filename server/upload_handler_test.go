@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/daptin/daptin/server/resource"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+
+	metadata := ParseUploadMetadata("filename bXkgdmlkZW8ubXA0,resource_id YWJj, append")
+
+	if metadata["filename"] != "my video.mp4" || metadata["resource_id"] != "abc" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+	if value, ok := metadata["append"]; !ok || value != "" {
+		t.Errorf("a key without a value should be read as empty")
+	}
+}
+
+func TestUploadLimitMimeTypes(t *testing.T) {
+
+	tableInfo := resource.TableInfo{
+		UploadLimits: []resource.UploadLimit{
+			{ColumnName: "video", MimeTypes: []string{"video/*", "application/pdf"}},
+		},
+	}
+
+	limit := tableInfo.UploadLimitFor("video")
+	for mimeType, allowed := range map[string]bool{
+		"video/mp4":                true,
+		"application/pdf":          true,
+		"image/png":                false,
+		"videos/mp4":               false,
+		"application/pdf; charset": true,
+	} {
+		if limit.AllowsMimeType(mimeType) != allowed {
+			t.Errorf("expected %v for %v", allowed, mimeType)
+		}
+	}
+
+	if !tableInfo.UploadLimitFor("photo").AllowsMimeType("image/png") {
+		t.Errorf("a column without a limit should allow every type")
+	}
+}
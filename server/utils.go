@@ -161,15 +161,19 @@ func GetTablesFromWorld(db database.DatabaseConnection) ([]resource.TableInfo, e
 
 }
 
-func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resource.DbResource) resource.MiddlewareSet {
+func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resource.DbResource, taskScheduler resource.TaskScheduler, invalidationBus resource.InvalidationBus) resource.MiddlewareSet {
 
 	var ms resource.MiddlewareSet
 
 	exchangeMiddleware := resource.NewExchangeMiddleware(cmsConfig, cruds)
 
+	workspaceScopeChecker := &resource.WorkspaceScopeChecker{}
 	tablePermissionChecker := &resource.TableAccessPermissionChecker{}
 	objectPermissionChecker := &resource.ObjectAccessPermissionChecker{}
 	dataValidationMiddleware := resource.NewDataValidationMiddleware(cmsConfig, cruds)
+	taskSchedulerMiddleware := resource.NewTaskSchedulerMiddleware(taskScheduler)
+	invalidationMiddleware := resource.NewInvalidationMiddleware(invalidationBus)
+	streamRefreshMiddleware := resource.NewStreamRefreshMiddleware()
 
 	findOneHandler := resource.NewFindOneEventHandler()
 	createEventHandler := resource.NewCreateEventHandler()
@@ -177,16 +181,19 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resour
 	deleteEventHandler := resource.NewDeleteEventHandler()
 
 	ms.BeforeFindAll = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 	}
 
 	ms.AfterFindAll = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 	}
 
 	ms.BeforeCreate = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		dataValidationMiddleware,
@@ -197,9 +204,13 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resour
 		objectPermissionChecker,
 		createEventHandler,
 		exchangeMiddleware,
+		taskSchedulerMiddleware,
+		invalidationMiddleware,
+		streamRefreshMiddleware,
 	}
 
 	ms.BeforeDelete = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		deleteEventHandler,
@@ -208,9 +219,13 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resour
 		tablePermissionChecker,
 		objectPermissionChecker,
 		deleteEventHandler,
+		taskSchedulerMiddleware,
+		invalidationMiddleware,
+		streamRefreshMiddleware,
 	}
 
 	ms.BeforeUpdate = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		dataValidationMiddleware,
@@ -220,14 +235,19 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig, cruds *map[string]*resour
 		tablePermissionChecker,
 		objectPermissionChecker,
 		updateEventHandler,
+		taskSchedulerMiddleware,
+		invalidationMiddleware,
+		streamRefreshMiddleware,
 	}
 
 	ms.BeforeFindOne = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		findOneHandler,
 	}
 	ms.AfterFindOne = []resource.DatabaseRequestInterceptor{
+		workspaceScopeChecker,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		findOneHandler,
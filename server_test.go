@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/GeertJohan/go.rice"
 	"github.com/artpar/go-guerrilla"
 	"github.com/daptin/daptin/server"
@@ -101,7 +102,11 @@ func TestServer(t *testing.T) {
 	configStore.SetConfigValueFor("imap.listen_interface", ":8743", "backend")
 	configStore.SetConfigValueFor("logs.enable", "true", "backend")
 
-	hostSwitch, mailDaemon, taskScheduler, configStore = server.Main(boxRoot, db)
+	invalidationBus, err := resource.NewInvalidationBus("poll", db, *connection_string)
+	if err != nil {
+		panic(err)
+	}
+	hostSwitch, mailDaemon, taskScheduler, configStore = server.Main(boxRoot, db, invalidationBus)
 
 	rhs := TestRestartHandlerServer{
 		HostSwitch: &hostSwitch,
@@ -110,7 +115,8 @@ func TestServer(t *testing.T) {
 	trigger.On("restart", func() {
 		log.Printf("Trigger restart")
 
-		taskScheduler.StartTasks()
+		taskScheduler.StopTasks()
+		invalidationBus.Stop()
 		mailDaemon.Shutdown()
 		err = db.Close()
 		if err != nil {
@@ -119,7 +125,8 @@ func TestServer(t *testing.T) {
 
 		db, err = server.GetDbConnection(*db_type, *connection_string)
 
-		hostSwitch, mailDaemon, taskScheduler, configStore = server.Main(boxRoot, db)
+		invalidationBus, err = resource.NewInvalidationBus("poll", db, *connection_string)
+		hostSwitch, mailDaemon, taskScheduler, configStore = server.Main(boxRoot, db, invalidationBus)
 		rhs.HostSwitch = &hostSwitch
 	})
 
@@ -329,8 +336,202 @@ func RunTests(t *testing.T, hostSwitch server.HostSwitch, daemon *guerrilla.Daem
 		t.Errorf("world type mismatch")
 	}
 
+	err = RunWorkspaceTests(t, baseAddress, token)
+	if err != nil {
+		return err
+	}
+
+	return RunValidationTests(t, baseAddress, token)
+
+}
+
+// RunWorkspaceTests checks that rows created in a workspace are seen only in that workspace
+func RunWorkspaceTests(t *testing.T, baseAddress string, token string) error {
+
+	r := req.New()
+	authHeader := req.Header{
+		"Authorization": "Bearer " + token,
+	}
+
+	createRow := func(typeName string, attributes map[string]interface{}, header req.Header) (string, error) {
+		resp, err := r.Post(baseAddress+"/api/"+typeName, header, req.BodyJSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"type":       typeName,
+				"attributes": attributes,
+			},
+		}))
+		if err != nil {
+			return "", err
+		}
+		created := make(map[string]interface{})
+		err = resp.ToJSON(&created)
+		if err != nil {
+			return "", err
+		}
+		data, ok := created["data"].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("failed to create %v: %v", typeName, resp.String())
+		}
+		return data["id"].(string), nil
+	}
+
+	workspaceId, err := createRow("workspace", map[string]interface{}{
+		"name": "Acme",
+		"slug": "acme",
+	}, authHeader)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.Get(baseAddress+"/api/user_account/mine", authHeader)
+	if err != nil {
+		return err
+	}
+	me := make(map[string]interface{})
+	resp.ToJSON(&me)
+	userId := me["data"].(map[string]interface{})["id"].(string)
+
+	_, err = createRow("workspace_member", map[string]interface{}{
+		"workspace_id": workspaceId,
+		"member_id":    userId,
+		"role":         "admin",
+	}, authHeader)
+	if err != nil {
+		return err
+	}
+
+	resp, err = r.Post(baseAddress+"/action/user_account/signin", req.BodyJSON(map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"email":     "test@gmail.com",
+			"password":  "tester123",
+			"workspace": "acme",
+		},
+	}))
+	if err != nil {
+		return err
+	}
+	var signInResponse []map[string]interface{}
+	resp.ToJSON(&signInResponse)
+	if len(signInResponse) == 0 || signInResponse[0]["ResponseType"] != "client.store.set" {
+		return fmt.Errorf("failed to sign in to workspace: %v", resp.String())
+	}
+	workspaceHeader := req.Header{
+		"Authorization": "Bearer " + signInResponse[0]["Attributes"].(map[string]interface{})["value"].(string),
+	}
+
+	inWorkspace, err := createRow("gallery_image", map[string]interface{}{"title": "in workspace"}, workspaceHeader)
+	if err != nil {
+		return err
+	}
+	outsideWorkspace, err := createRow("gallery_image", map[string]interface{}{"title": "outside workspace"}, authHeader)
+	if err != nil {
+		return err
+	}
+
+	listRows := func(header req.Header) ([]string, error) {
+		resp, err := r.Get(baseAddress+"/api/gallery_image", header)
+		if err != nil {
+			return nil, err
+		}
+		list := make(map[string]interface{})
+		resp.ToJSON(&list)
+		ids := make([]string, 0)
+		rows, _ := list["data"].([]interface{})
+		for _, row := range rows {
+			ids = append(ids, row.(map[string]interface{})["id"].(string))
+		}
+		return ids, nil
+	}
+
+	ids, err := listRows(workspaceHeader)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 || ids[0] != inWorkspace {
+		t.Errorf("expected only the row of the workspace, found %v", ids)
+	}
+
+	ids, err = listRows(authHeader)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == inWorkspace {
+			t.Errorf("row of the workspace listed outside of it")
+		}
+	}
+
+	resp, err = r.Get(baseAddress+"/api/gallery_image/"+outsideWorkspace, workspaceHeader)
+	if err != nil {
+		return err
+	}
+	if resp.Response().StatusCode != http.StatusNotFound {
+		t.Errorf("expected a row outside of the workspace to not be found, got %v", resp.Response().StatusCode)
+	}
+
 	return nil
+}
+
+func RunValidationTests(t *testing.T, baseAddress string, token string) error {
+
+	r := req.New()
+
+	validationErrors := func(typeName string, attributes map[string]interface{}, language string) (int, []map[string]interface{}, error) {
+		resp, err := r.Post(baseAddress+"/api/"+typeName, req.Header{
+			"Authorization":   "Bearer " + token,
+			"Accept-Language": language,
+		}, req.BodyJSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"type":       typeName,
+				"attributes": attributes,
+			},
+		}))
+		if err != nil {
+			return 0, nil, err
+		}
+		var response struct {
+			Errors []map[string]interface{} `json:"errors"`
+		}
+		resp.ToJSON(&response)
+		return resp.Response().StatusCode, response.Errors, nil
+	}
 
+	status, errs, err := validationErrors("role_policy", map[string]interface{}{
+		"table_name": "todo",
+		"ownership":  "everyone",
+		"effect":     "maybe",
+	}, "fr-CA, en;q=0.5")
+	if err != nil {
+		return err
+	}
+	if status != http.StatusBadRequest || len(errs) != 2 {
+		t.Errorf("expected both invalid columns to be reported, got %v: %v", status, errs)
+	} else {
+		pointers := map[string]bool{}
+		for _, e := range errs {
+			pointers[e["source"].(map[string]interface{})["pointer"].(string)] = true
+			if e["code"] != "oneof" || !strings.Contains(e["detail"].(string), "doit") {
+				t.Errorf("expected a french oneof error, got %v", e)
+			}
+		}
+		if !pointers["/data/attributes/ownership"] || !pointers["/data/attributes/effect"] {
+			t.Errorf("unexpected pointers of the errors: %v", pointers)
+		}
+	}
+
+	status, errs, err = validationErrors("workspace", map[string]interface{}{
+		"name": "Acme again",
+		"slug": "acme",
+	}, "")
+	if err != nil {
+		return err
+	}
+	if status != http.StatusBadRequest || len(errs) != 1 || errs[0]["code"] != "db_unique" ||
+		errs[0]["detail"] != "slug is already taken" {
+		t.Errorf("expected the slug to be taken, got %v: %v", status, errs)
+	}
+
+	return nil
 }
 
 type TestRestartHandlerServer struct {